@@ -5,7 +5,9 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"monkey/token"
+	"strconv"
 	"strings"
 )
 
@@ -114,6 +116,34 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// ImportStatement は import文 implements Statement
+//
+//	import "math.mky" as m;
+//	import "util.mky";
+type ImportStatement struct {
+	// import
+	Token token.Token
+	// 読み込むファイルのパス
+	Path string
+	// モジュールを束縛する変数（省略した場合はnilで、モジュールの束縛を現在のスコープに展開する）
+	Alias *Identifier
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(is.TokenLiteral() + " ")
+	out.WriteString(strconv.Quote(is.Path))
+	if is.Alias != nil {
+		out.WriteString(" as " + is.Alias.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
 // ExpressionStatement は 式文 implements Statement
 type ExpressionStatement struct {
 	Token      token.Token
@@ -164,6 +194,22 @@ func (il IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 //  String of Expression
 func (il IntegerLiteral) String() string { return il.TokenLiteral() }
 
+// BigIntegerLiteral は int64 に収まらない整数リテラル implements Expression
+// 評価すると BigInteger になる
+type BigIntegerLiteral struct {
+	Token token.Token
+	Value *big.Int
+}
+
+// expressionNode of Expression
+func (bl BigIntegerLiteral) expressionNode() {}
+
+// TokenLiteral of Expression
+func (bl BigIntegerLiteral) TokenLiteral() string { return bl.Token.Literal }
+
+//  String of Expression
+func (bl BigIntegerLiteral) String() string { return bl.TokenLiteral() }
+
 // PrefixExpression は 前置演算子 implements Expression
 type PrefixExpression struct {
 	Token token.Token
@@ -259,6 +305,66 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// ForInExpression は for-in式 implements Expression
+//
+//	for (v in xs) { ... }
+//	for (k, v in xs) { ... }
+type ForInExpression struct {
+	Token token.Token // 'for'
+	// 要素のキーを束縛する変数（変数が1つの場合はnil）
+	Key *Identifier
+	// 要素の値を束縛する変数
+	Value *Identifier
+	// 反復する対象
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fe *ForInExpression) expressionNode()      {}
+func (fe *ForInExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *ForInExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fe.Key != nil {
+		out.WriteString(fe.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(fe.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fe.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fe.Body.String())
+
+	return out.String()
+}
+
+// エラーを値として受け取る式
+//
+//	try { ... } catch (e) { ... }
+type TryExpression struct {
+	Token token.Token // 'try'
+	Body  *BlockStatement
+	// 捕まえたエラーを束縛する変数
+	Param   *Identifier
+	Handler *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Body.String())
+	out.WriteString(" catch (")
+	out.WriteString(te.Param.String())
+	out.WriteString(") ")
+	out.WriteString(te.Handler.String())
+
+	return out.String()
+}
+
 // ブロック文
 type BlockStatement struct {
 	Token      token.Token
@@ -282,6 +388,8 @@ type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	// let文で束縛された場合の名前（無名の場合は空）
+	Name string
 }
 
 func (f *FunctionLiteral) expressionNode()      {}
@@ -308,6 +416,10 @@ type CallExpression struct {
 	Token     token.Token
 	Function  Expression // Identifier or Function literal
 	Arguments []Expression
+	// 名前付き引数（name: value）。位置引数の後にだけ書ける
+	NamedArguments map[string]Expression
+	// NamedArgumentsの名前を記述した順に並べたもの
+	Names []*Identifier
 }
 
 func (ce *CallExpression) expressionNode()      {}
@@ -319,6 +431,9 @@ func (ce *CallExpression) String() string {
 	for _, a := range ce.Arguments {
 		args = append(args, a.String())
 	}
+	for _, name := range ce.Names {
+		args = append(args, name.Value+": "+ce.NamedArguments[name.Value].String())
+	}
 
 	out.WriteString(ce.Function.String())
 	out.WriteString("(")
@@ -366,6 +481,20 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// 呼び出しの引数や配列リテラルの要素の位置で、配列を個々の値に展開する式（...xs）
+type SpreadExpression struct {
+	Token token.Token // ... トークン
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode() {}
+func (se *SpreadExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
+}
+
 // 配列またはハッシュの添字アクセスを表す式
 type IndexExpression struct {
 	Token token.Token
@@ -389,10 +518,27 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// 受け手が NULL のときは添字を評価せずに NULL になる添字アクセス（a?[i]）
+type OptionalIndexExpression struct {
+	Token token.Token // ?[ トークン
+	Left  Expression
+	Index Expression
+}
+
+func (oe *OptionalIndexExpression) expressionNode() {}
+func (oe *OptionalIndexExpression) TokenLiteral() string {
+	return oe.Token.Literal
+}
+func (oe *OptionalIndexExpression) String() string {
+	return "(" + oe.Left.String() + "?[" + oe.Index.String() + "])"
+}
+
 // ハッシュリテラル
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	// Pairsのキーを記述した順に並べたもの
+	Keys []Expression
 }
 
 func (h *HashLiteral) expressionNode() {}
@@ -403,8 +549,8 @@ func (h *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range h.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range h.Keys {
+		pairs = append(pairs, key.String()+":"+h.Pairs[key].String())
 	}
 
 	out.WriteString("{")
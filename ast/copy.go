@@ -0,0 +1,143 @@
+package ast
+
+// Copy は node を根とする木の複製を返す
+// Modify は木をその場で書き換えるので、元の木を残したい場合は複製してから使う
+func Copy(node Node) Node {
+	if isNilNode(node) {
+		return node
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		return &Program{Statements: copyStatements(node.Statements)}
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: node.Token, Expression: copyExpression(node.Expression)}
+	case *LetStatement:
+		return &LetStatement{Token: node.Token, Name: copyIdentifier(node.Name), Value: copyExpression(node.Value)}
+	case *ImportStatement:
+		return &ImportStatement{Token: node.Token, Path: node.Path, Alias: copyIdentifier(node.Alias)}
+	case *ReturnStatement:
+		return &ReturnStatement{Token: node.Token, ReturnValue: copyExpression(node.ReturnValue)}
+	case *BlockStatement:
+		return copyBlock(node)
+	case *Identifier:
+		return copyIdentifier(node)
+	case *IntegerLiteral:
+		copied := *node
+		return &copied
+	case *BigIntegerLiteral:
+		// 値は変更しないので共有する
+		copied := *node
+		return &copied
+	case *StringLiteral:
+		copied := *node
+		return &copied
+	case *Boolean:
+		copied := *node
+		return &copied
+	case *PrefixExpression:
+		return &PrefixExpression{Token: node.Token, Operator: node.Operator, Right: copyExpression(node.Right)}
+	case *InfixExpression:
+		return &InfixExpression{Token: node.Token, Left: copyExpression(node.Left), Operator: node.Operator, Right: copyExpression(node.Right)}
+	case *IndexExpression:
+		return &IndexExpression{Token: node.Token, Left: copyExpression(node.Left), Index: copyExpression(node.Index)}
+	case *OptionalIndexExpression:
+		return &OptionalIndexExpression{Token: node.Token, Left: copyExpression(node.Left), Index: copyExpression(node.Index)}
+	case *IfExpression:
+		return &IfExpression{
+			Token:       node.Token,
+			Condition:   copyExpression(node.Condition),
+			Consequence: copyBlock(node.Consequence),
+			Alternative: copyBlock(node.Alternative),
+		}
+	case *ForInExpression:
+		return &ForInExpression{
+			Token:    node.Token,
+			Key:      copyIdentifier(node.Key),
+			Value:    copyIdentifier(node.Value),
+			Iterable: copyExpression(node.Iterable),
+			Body:     copyBlock(node.Body),
+		}
+	case *TryExpression:
+		return &TryExpression{
+			Token:   node.Token,
+			Body:    copyBlock(node.Body),
+			Param:   copyIdentifier(node.Param),
+			Handler: copyBlock(node.Handler),
+		}
+	case *FunctionLiteral:
+		params := make([]*Identifier, len(node.Parameters))
+		for i, param := range node.Parameters {
+			params[i] = copyIdentifier(param)
+		}
+		return &FunctionLiteral{Token: node.Token, Parameters: params, Body: copyBlock(node.Body), Name: node.Name}
+	case *CallExpression:
+		copied := &CallExpression{Token: node.Token, Function: copyExpression(node.Function), Arguments: copyExpressions(node.Arguments)}
+		if node.NamedArguments != nil {
+			copied.NamedArguments = make(map[string]Expression, len(node.NamedArguments))
+			for _, name := range node.Names {
+				copied.NamedArguments[name.Value] = copyExpression(node.NamedArguments[name.Value])
+				copied.Names = append(copied.Names, copyIdentifier(name))
+			}
+		}
+		return copied
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: node.Token, Elements: copyExpressions(node.Elements)}
+	case *SpreadExpression:
+		return &SpreadExpression{Token: node.Token, Value: copyExpression(node.Value)}
+	case *HashLiteral:
+		copied := &HashLiteral{Token: node.Token, Pairs: make(map[Expression]Expression, len(node.Pairs))}
+		for _, key := range node.Keys {
+			newKey := copyExpression(key)
+			copied.Pairs[newKey] = copyExpression(node.Pairs[key])
+			copied.Keys = append(copied.Keys, newKey)
+		}
+		return copied
+	default:
+		return node
+	}
+}
+
+func copyExpression(exp Expression) Expression {
+	if exp == nil {
+		return nil
+	}
+	return Copy(exp).(Expression)
+}
+
+func copyExpressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+	copied := make([]Expression, len(exps))
+	for i, exp := range exps {
+		copied[i] = copyExpression(exp)
+	}
+	return copied
+}
+
+func copyStatements(statements []Statement) []Statement {
+	if statements == nil {
+		return nil
+	}
+	copied := make([]Statement, len(statements))
+	for i, statement := range statements {
+		copied[i] = Copy(statement).(Statement)
+	}
+	return copied
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	copied := *ident
+	return &copied
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return &BlockStatement{Token: block.Token, Statements: copyStatements(block.Statements)}
+}
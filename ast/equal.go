@@ -0,0 +1,156 @@
+package ast
+
+// Equal は2つのノードが同じ構造かどうかを返す
+// トークンの位置は比較しない
+func Equal(a, b Node) bool {
+	if isNilNode(a) || isNilNode(b) {
+		return isNilNode(a) && isNilNode(b)
+	}
+
+	switch a := a.(type) {
+	case *Program:
+		b, ok := b.(*Program)
+		return ok && statementsEqual(a.Statements, b.Statements)
+	case *ExpressionStatement:
+		b, ok := b.(*ExpressionStatement)
+		return ok && Equal(a.Expression, b.Expression)
+	case *LetStatement:
+		b, ok := b.(*LetStatement)
+		return ok && Equal(a.Name, b.Name) && Equal(a.Value, b.Value)
+	case *ImportStatement:
+		b, ok := b.(*ImportStatement)
+		return ok && a.Path == b.Path && Equal(a.Alias, b.Alias)
+	case *ReturnStatement:
+		b, ok := b.(*ReturnStatement)
+		return ok && Equal(a.ReturnValue, b.ReturnValue)
+	case *BlockStatement:
+		b, ok := b.(*BlockStatement)
+		return ok && statementsEqual(a.Statements, b.Statements)
+	case *Identifier:
+		b, ok := b.(*Identifier)
+		return ok && a.Value == b.Value
+	case *IntegerLiteral:
+		b, ok := b.(*IntegerLiteral)
+		return ok && a.Value == b.Value
+	case *BigIntegerLiteral:
+		b, ok := b.(*BigIntegerLiteral)
+		return ok && a.Value.Cmp(b.Value) == 0
+	case *StringLiteral:
+		b, ok := b.(*StringLiteral)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *PrefixExpression:
+		b, ok := b.(*PrefixExpression)
+		return ok && a.Operator == b.Operator && Equal(a.Right, b.Right)
+	case *InfixExpression:
+		b, ok := b.(*InfixExpression)
+		return ok && a.Operator == b.Operator && Equal(a.Left, b.Left) && Equal(a.Right, b.Right)
+	case *IndexExpression:
+		b, ok := b.(*IndexExpression)
+		return ok && Equal(a.Left, b.Left) && Equal(a.Index, b.Index)
+	case *OptionalIndexExpression:
+		b, ok := b.(*OptionalIndexExpression)
+		return ok && Equal(a.Left, b.Left) && Equal(a.Index, b.Index)
+	case *IfExpression:
+		b, ok := b.(*IfExpression)
+		return ok && Equal(a.Condition, b.Condition) &&
+			Equal(a.Consequence, b.Consequence) && Equal(a.Alternative, b.Alternative)
+	case *ForInExpression:
+		b, ok := b.(*ForInExpression)
+		return ok && Equal(a.Key, b.Key) && Equal(a.Value, b.Value) &&
+			Equal(a.Iterable, b.Iterable) && Equal(a.Body, b.Body)
+	case *TryExpression:
+		b, ok := b.(*TryExpression)
+		return ok && Equal(a.Body, b.Body) && Equal(a.Param, b.Param) && Equal(a.Handler, b.Handler)
+	case *FunctionLiteral:
+		b, ok := b.(*FunctionLiteral)
+		if !ok || a.Name != b.Name || len(a.Parameters) != len(b.Parameters) {
+			return false
+		}
+		for i := range a.Parameters {
+			if !Equal(a.Parameters[i], b.Parameters[i]) {
+				return false
+			}
+		}
+		return Equal(a.Body, b.Body)
+	case *CallExpression:
+		b, ok := b.(*CallExpression)
+		if !ok || !Equal(a.Function, b.Function) || !expressionsEqual(a.Arguments, b.Arguments) || len(a.Names) != len(b.Names) {
+			return false
+		}
+		for i, name := range a.Names {
+			if name.Value != b.Names[i].Value || !Equal(a.NamedArguments[name.Value], b.NamedArguments[name.Value]) {
+				return false
+			}
+		}
+		return true
+	case *ArrayLiteral:
+		b, ok := b.(*ArrayLiteral)
+		return ok && expressionsEqual(a.Elements, b.Elements)
+	case *SpreadExpression:
+		b, ok := b.(*SpreadExpression)
+		return ok && Equal(a.Value, b.Value)
+	case *HashLiteral:
+		b, ok := b.(*HashLiteral)
+		if !ok || !expressionsEqual(a.Keys, b.Keys) {
+			return false
+		}
+		for i, key := range a.Keys {
+			if !Equal(a.Pairs[key], b.Pairs[b.Keys[i]]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// *Identifier(nil) などの型付きの nil も nil とみなす
+func isNilNode(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *Identifier:
+		return node == nil
+	case *BlockStatement:
+		return node == nil
+	// 構文エラーのあるプログラムには解析に失敗した文が型付きの nil で残る
+	case *LetStatement:
+		return node == nil
+	case *ReturnStatement:
+		return node == nil
+	case *ExpressionStatement:
+		return node == nil
+	case *ImportStatement:
+		return node == nil
+	default:
+		return false
+	}
+}
+
+func statementsEqual(a, b []Statement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func expressionsEqual(a, b []Expression) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
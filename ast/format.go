@@ -0,0 +1,308 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Format は node を正規の形のソースコードにして返す
+// 字下げはタブで、文はそれぞれ1行（ブロックは複数行）にし、括弧は演算子の優先順位に必要なものだけを付ける
+// 本体が if 式や for 式でない1つの式だけで、1行に収まる関数リテラルと if 式は1行にまとめる
+// ソースの空行は AST に残らないので保たない
+func Format(node Node) string {
+	f := &formatter{}
+	switch node := node.(type) {
+	case *Program:
+		return f.statements(node.Statements, 0, false)
+	case Statement:
+		return f.statement(node, 0, true)
+	case Expression:
+		return f.expression(node, 0)
+	default:
+		return node.String()
+	}
+}
+
+// 式の優先順位。parser の優先順位と同じ順に並べる
+const (
+	precLowest = iota
+	precEquals
+	precLessGreater
+	precRange
+	precSum
+	precProduct
+	precPrefix
+	precCall
+	precIndex
+	precAtom
+)
+
+var infixPrecedences = map[string]int{
+	"==": precEquals,
+	"!=": precEquals,
+	"is": precEquals,
+	"<":  precLessGreater,
+	">":  precLessGreater,
+	"..": precRange,
+	"+":  precSum,
+	"-":  precSum,
+	"*":  precProduct,
+	"/":  precProduct,
+}
+
+type formatter struct{}
+
+func indentString(indent int) string {
+	return strings.Repeat("\t", indent)
+}
+
+// statements は文を1行ずつ indent の深さで字下げして、それぞれ改行を付けて返す
+// inBlock がtrueならブロックの中の文で、最後の式文にはセミコロンを付けない
+func (f *formatter) statements(stmts []Statement, indent int, inBlock bool) string {
+	// 式文のセミコロンは次の文で決まるので、後ろから整形する
+	lines := make([]string, len(stmts))
+	next := ""
+	for i := len(stmts) - 1; i >= 0; i-- {
+		semicolon := true
+		if exp, ok := stmts[i].(*ExpressionStatement); ok {
+			switch {
+			case inBlock && i == len(stmts)-1:
+				semicolon = false
+			case endsWithBlock(exp.Expression):
+				semicolon = continuesExpression(next)
+			}
+		}
+		lines[i] = f.statement(stmts[i], indent, semicolon)
+		next = strings.TrimLeft(lines[i], "\t")
+	}
+
+	var out strings.Builder
+	for _, line := range lines {
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// continuesExpression は next が直前の式の続き（中置演算子、呼び出し、添字）として読まれる場合にtrueを返す
+func continuesExpression(next string) bool {
+	return strings.HasPrefix(next, "(") || strings.HasPrefix(next, "[") || strings.HasPrefix(next, "-")
+}
+
+// statement は文を indent の深さで字下げして返す
+// semicolon がfalseなら式文にセミコロンを付けない
+func (f *formatter) statement(stmt Statement, indent int, semicolon bool) string {
+	prefix := indentString(indent)
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		return prefix + "let " + stmt.Name.Value + " = " + f.expression(stmt.Value, indent) + ";"
+	case *ReturnStatement:
+		if stmt.ReturnValue == nil {
+			return prefix + "return;"
+		}
+		return prefix + "return " + f.expression(stmt.ReturnValue, indent) + ";"
+	case *ImportStatement:
+		out := prefix + `import "` + stmt.Path + `"`
+		if stmt.Alias != nil {
+			out += " as " + stmt.Alias.Value
+		}
+		return out + ";"
+	case *ExpressionStatement:
+		out := prefix + f.expression(stmt.Expression, indent)
+		if !semicolon {
+			return out
+		}
+		return out + ";"
+	case *BlockStatement:
+		return prefix + f.block(stmt, indent)
+	default:
+		return prefix + stmt.String()
+	}
+}
+
+// if 式と for 式の文はブロックで終わるので、次の文と続けて読まれない限りセミコロンを付けない
+func endsWithBlock(exp Expression) bool {
+	switch exp.(type) {
+	case *IfExpression, *ForInExpression:
+		return true
+	default:
+		return false
+	}
+}
+
+// block は "{" から "}" までを返す。中の文は indent+1 の深さで字下げする
+func (f *formatter) block(block *BlockStatement, indent int) string {
+	if len(block.Statements) == 0 {
+		return "{}"
+	}
+	var out strings.Builder
+	out.WriteString("{\n")
+	out.WriteString(f.statements(block.Statements, indent+1, true))
+	out.WriteString(indentString(indent) + "}")
+	return out.String()
+}
+
+// inlineBlock は本体が1行に収まる1つの式だけのブロックを "{ 式 }" の形で返す。収まらなければfalse
+func (f *formatter) inlineBlock(block *BlockStatement, indent int) (string, bool) {
+	if len(block.Statements) != 1 {
+		return "", false
+	}
+	stmt, ok := block.Statements[0].(*ExpressionStatement)
+	// ブロックを含む if 式や for 式は入れ子にすると読みにくいので1行にしない
+	if !ok || endsWithBlock(stmt.Expression) {
+		return "", false
+	}
+	exp := f.expression(stmt.Expression, indent+1)
+	if strings.Contains(exp, "\n") {
+		return "", false
+	}
+	return "{ " + exp + " }", true
+}
+
+func (f *formatter) body(block *BlockStatement, indent int, inline bool) string {
+	if inline {
+		if s, ok := f.inlineBlock(block, indent); ok {
+			return s
+		}
+	}
+	return f.block(block, indent)
+}
+
+func precedence(exp Expression) int {
+	switch exp := exp.(type) {
+	case *InfixExpression:
+		if p, ok := infixPrecedences[exp.Operator]; ok {
+			return p
+		}
+		return precLowest
+	case *PrefixExpression:
+		return precPrefix
+	case *IntegerLiteral:
+		if exp.Value < 0 {
+			return precPrefix
+		}
+		return precAtom
+	case *BigIntegerLiteral:
+		if exp.Value.Sign() < 0 {
+			return precPrefix
+		}
+		return precAtom
+	case *CallExpression:
+		return precCall
+	case *IndexExpression, *OptionalIndexExpression:
+		return precIndex
+	default:
+		return precAtom
+	}
+}
+
+// octalLiteral は 0o で始まる8進数のリテラル lit を、8進数のまま 0o を付けて返す
+// 8進数で書かれたリテラルでなければ ok は false
+func octalLiteral(lit string) (string, bool) {
+	if len(lit) > 2 && lit[0] == '0' && (lit[1] == 'o' || lit[1] == 'O') {
+		return "0o" + lit[2:], true
+	}
+	return "", false
+}
+
+// operand は exp が min より弱く結合する場合に括弧で囲んで返す
+func (f *formatter) operand(exp Expression, min int, indent int) string {
+	s := f.expression(exp, indent)
+	if precedence(exp) < min {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// expression は式を返す。複数行になる場合、2行目以降は indent の深さに合わせて字下げする
+func (f *formatter) expression(exp Expression, indent int) string {
+	switch exp := exp.(type) {
+	case *Identifier:
+		return exp.Value
+	case *IntegerLiteral:
+		if octal, ok := octalLiteral(exp.Token.Literal); ok {
+			return octal
+		}
+		return strconv.FormatInt(exp.Value, 10)
+	case *BigIntegerLiteral:
+		if octal, ok := octalLiteral(exp.Token.Literal); ok {
+			return octal
+		}
+		return exp.Value.String()
+	case *Boolean:
+		return strconv.FormatBool(exp.Value)
+	case *StringLiteral:
+		// 文字列リテラルにはエスケープがないので、そのまま囲む
+		return `"` + exp.Value + `"`
+	case *PrefixExpression:
+		return exp.Operator + f.operand(exp.Right, precPrefix, indent)
+	case *InfixExpression:
+		p := precedence(exp)
+		op := " " + exp.Operator + " "
+		if exp.Operator == ".." {
+			// 範囲は 1..10 のように空白を入れない
+			op = exp.Operator
+		}
+		// 左結合なので、右側は同じ優先順位でも括弧が要る
+		return f.operand(exp.Left, p, indent) + op + f.operand(exp.Right, p+1, indent)
+	case *CallExpression:
+		args := f.list(exp.Arguments, indent)
+		for i, name := range exp.Names {
+			if i > 0 || len(exp.Arguments) > 0 {
+				args += ", "
+			}
+			args += name.Value + ": " + f.expression(exp.NamedArguments[name.Value], indent)
+		}
+		return f.operand(exp.Function, precCall, indent) + "(" + args + ")"
+	case *IndexExpression:
+		return f.operand(exp.Left, precCall, indent) + "[" + f.expression(exp.Index, indent) + "]"
+	case *OptionalIndexExpression:
+		return f.operand(exp.Left, precCall, indent) + "?[" + f.expression(exp.Index, indent) + "]"
+	case *ArrayLiteral:
+		return "[" + f.list(exp.Elements, indent) + "]"
+	case *SpreadExpression:
+		return "..." + f.operand(exp.Value, precPrefix, indent)
+	case *HashLiteral:
+		pairs := make([]string, len(exp.Keys))
+		for i, key := range exp.Keys {
+			pairs[i] = f.expression(key, indent) + ": " + f.expression(exp.Pairs[key], indent)
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *FunctionLiteral:
+		params := make([]string, len(exp.Parameters))
+		for i, p := range exp.Parameters {
+			params[i] = p.Value
+		}
+		return "fn(" + strings.Join(params, ", ") + ") " + f.body(exp.Body, indent, true)
+	case *IfExpression:
+		_, consequenceInline := f.inlineBlock(exp.Consequence, indent)
+		inline := consequenceInline
+		if exp.Alternative != nil {
+			_, alternativeInline := f.inlineBlock(exp.Alternative, indent)
+			inline = inline && alternativeInline
+		}
+		out := "if (" + f.expression(exp.Condition, indent) + ") " + f.body(exp.Consequence, indent, inline)
+		if exp.Alternative != nil {
+			out += " else " + f.body(exp.Alternative, indent, inline)
+		}
+		return out
+	case *ForInExpression:
+		vars := exp.Value.Value
+		if exp.Key != nil {
+			vars = exp.Key.Value + ", " + vars
+		}
+		return "for (" + vars + " in " + f.expression(exp.Iterable, indent) + ") " + f.block(exp.Body, indent)
+	case *TryExpression:
+		return "try " + f.block(exp.Body, indent) + " catch (" + exp.Param.Value + ") " + f.block(exp.Handler, indent)
+	default:
+		return exp.String()
+	}
+}
+
+func (f *formatter) list(exps []Expression, indent int) string {
+	items := make([]string, len(exps))
+	for i, e := range exps {
+		items[i] = f.expression(e, indent)
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,74 @@
+package ast
+
+import (
+	"math/big"
+	"monkey/token"
+	"testing"
+)
+
+func TestFormatParentheses(t *testing.T) {
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	infix := func(l Expression, op string, r Expression) *InfixExpression {
+		return &InfixExpression{Left: l, Operator: op, Right: r}
+	}
+
+	tests := []struct {
+		exp      Expression
+		expected string
+	}{
+		{infix(infix(ident("a"), "+", ident("b")), "*", ident("c")), "(a + b) * c"},
+		{infix(ident("a"), "+", infix(ident("b"), "*", ident("c"))), "a + b * c"},
+		{infix(infix(ident("a"), "-", ident("b")), "-", ident("c")), "a - b - c"},
+		{infix(ident("a"), "-", infix(ident("b"), "-", ident("c"))), "a - (b - c)"},
+		{&PrefixExpression{Operator: "-", Right: infix(ident("a"), "+", ident("b"))}, "-(a + b)"},
+		{&PrefixExpression{Operator: "!", Right: &PrefixExpression{Operator: "-", Right: ident("a")}}, "!-a"},
+		{&CallExpression{Function: infix(ident("f"), "+", ident("g")), Arguments: []Expression{ident("x")}}, "(f + g)(x)"},
+		{&IndexExpression{Left: &CallExpression{Function: ident("f")}, Index: &IntegerLiteral{Value: 0}}, "f()[0]"},
+		{&IndexExpression{Left: &PrefixExpression{Operator: "-", Right: ident("a")}, Index: ident("i")}, "(-a)[i]"},
+		{infix(ident("a"), "+", &IntegerLiteral{Value: -1}), "a + -1"},
+		// 8進数で書かれたリテラルは8進数のまま残す
+		{&IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "0O755"}, Value: 493}, "0o755"},
+		{&IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "493"}, Value: 493}, "493"},
+		{&BigIntegerLiteral{Token: token.Token{Type: token.INT, Literal: "0o1000000000000000000000"}, Value: new(big.Int).Lsh(big.NewInt(1), 63)}, "0o1000000000000000000000"},
+		{infix(ident("a"), "+", &BigIntegerLiteral{Value: new(big.Int).Lsh(big.NewInt(-1), 63)}), "a + -9223372036854775808"},
+		{&CallExpression{Function: ident("f"), Arguments: []Expression{&SpreadExpression{Value: ident("xs")}}}, "f(...xs)"},
+		{&ArrayLiteral{Elements: []Expression{&SpreadExpression{Value: infix(ident("a"), "+", ident("b"))}}}, "[...(a + b)]"},
+		{&CallExpression{Function: ident("f"), Arguments: []Expression{ident("x")}, Names: []*Identifier{ident("tls"), ident("port")},
+			NamedArguments: map[string]Expression{"tls": &Boolean{Value: true}, "port": infix(ident("p"), "+", ident("q"))}}, "f(x, tls: true, port: p + q)"},
+		{&CallExpression{Function: ident("f"), Names: []*Identifier{ident("a")}, NamedArguments: map[string]Expression{"a": ident("b")}}, "f(a: b)"},
+	}
+
+	for _, tt := range tests {
+		if got := Format(tt.exp); got != tt.expected {
+			t.Errorf("wrong format. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestFormatSemicolons(t *testing.T) {
+	ifExp := &ExpressionStatement{Expression: &IfExpression{
+		Condition:   &Boolean{Value: true},
+		Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &IntegerLiteral{Value: 1}}}},
+	}}
+	call := &ExpressionStatement{Expression: &CallExpression{Function: &Identifier{Value: "f"}}}
+	neg := &ExpressionStatement{Expression: &PrefixExpression{Operator: "-", Right: &IntegerLiteral{Value: 1}}}
+
+	tests := []struct {
+		program  *Program
+		expected string
+	}{
+		{&Program{Statements: []Statement{call, call}}, "f();\nf();\n"},
+		{&Program{Statements: []Statement{ifExp, call}}, "if (true) { 1 }\nf();\n"},
+		// セミコロンがないと次の文が if 式への中置演算子として読まれる
+		{&Program{Statements: []Statement{ifExp, neg}}, "if (true) { 1 };\n-1;\n"},
+		{&Program{Statements: []Statement{&ExpressionStatement{Expression: &FunctionLiteral{
+			Body: &BlockStatement{Statements: []Statement{call, call}},
+		}}}}, "fn() {\n\tf();\n\tf()\n};\n"},
+	}
+
+	for _, tt := range tests {
+		if got := Format(tt.program); got != tt.expected {
+			t.Errorf("wrong format. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package ast
+
+// ModifierFunc はノードを受け取り、置き換えるノードを返す関数
+type ModifierFunc func(Node) Node
+
+// Modify は node の子ノードを深さ優先でたどり、子ノードを書き換えてから node 自体に modifier を適用する
+// ノードはその場で書き換えられる
+// Expression を置き換える場合は Expression を、Statement を置き換える場合は Statement を返さなければならない
+func Modify(node Node, modifier ModifierFunc) Node {
+	if node == nil {
+		return nil
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for i, statement := range node.Statements {
+			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+		}
+	case *ExpressionStatement:
+		node.Expression, _ = Modify(node.Expression, modifier).(Expression)
+	case *LetStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *ReturnStatement:
+		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+	case *BlockStatement:
+		for i, statement := range node.Statements {
+			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+		}
+	case *PrefixExpression:
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+	case *InfixExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+	case *IndexExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Index, _ = Modify(node.Index, modifier).(Expression)
+	case *OptionalIndexExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Index, _ = Modify(node.Index, modifier).(Expression)
+	case *IfExpression:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
+		if node.Alternative != nil {
+			node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+		}
+	case *ForInExpression:
+		node.Iterable, _ = Modify(node.Iterable, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *TryExpression:
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+		node.Handler, _ = Modify(node.Handler, modifier).(*BlockStatement)
+	case *FunctionLiteral:
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *CallExpression:
+		node.Function, _ = Modify(node.Function, modifier).(Expression)
+		for i, arg := range node.Arguments {
+			node.Arguments[i], _ = Modify(arg, modifier).(Expression)
+		}
+		for _, name := range node.Names {
+			node.NamedArguments[name.Value], _ = Modify(node.NamedArguments[name.Value], modifier).(Expression)
+		}
+	case *ArrayLiteral:
+		for i, element := range node.Elements {
+			node.Elements[i], _ = Modify(element, modifier).(Expression)
+		}
+	case *SpreadExpression:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression, len(node.Pairs))
+		keys := make([]Expression, len(node.Keys))
+		for i, key := range node.Keys {
+			newKey, _ := Modify(key, modifier).(Expression)
+			newValue, _ := Modify(node.Pairs[key], modifier).(Expression)
+			pairs[newKey] = newValue
+			keys[i] = newKey
+		}
+		node.Pairs = pairs
+		node.Keys = keys
+	}
+
+	return modifier(node)
+}
@@ -0,0 +1,155 @@
+package ast
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2} }
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return two()
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{&InfixExpression{Left: one(), Operator: "+", Right: one()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+		{&PrefixExpression{Operator: "-", Right: one()}, &PrefixExpression{Operator: "-", Right: two()}},
+		{&IndexExpression{Left: one(), Index: one()}, &IndexExpression{Left: two(), Index: two()}},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{&IfExpression{Condition: one(), Consequence: &BlockStatement{}}, &IfExpression{Condition: two(), Consequence: &BlockStatement{}}},
+		{
+			&ForInExpression{Value: ident("x"), Iterable: one(), Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}},
+			&ForInExpression{Value: ident("x"), Iterable: two(), Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}}},
+		},
+		{&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+		{&ReturnStatement{}, &ReturnStatement{}},
+		{&LetStatement{Name: ident("x"), Value: one()}, &LetStatement{Name: ident("x"), Value: two()}},
+		{
+			&FunctionLiteral{Parameters: []*Identifier{ident("a")}, Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}},
+			&FunctionLiteral{Parameters: []*Identifier{ident("a")}, Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}}},
+		},
+		{&CallExpression{Function: ident("f"), Arguments: []Expression{one(), ident("x")}}, &CallExpression{Function: ident("f"), Arguments: []Expression{two(), ident("x")}}},
+		{&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+		if !Equal(modified, tt.expected) {
+			t.Errorf("not equal. want=%s, got=%s", tt.expected.String(), modified.String())
+		}
+	}
+
+	hashKey := one()
+	hash := &HashLiteral{Pairs: map[Expression]Expression{hashKey: one()}, Keys: []Expression{hashKey}}
+	Modify(hash, turnOneIntoTwo)
+	if len(hash.Keys) != 1 || len(hash.Pairs) != 1 {
+		t.Fatalf("wrong number of hash pairs. got=%d", len(hash.Pairs))
+	}
+	for key, value := range hash.Pairs {
+		if key != hash.Keys[0] || key.(*IntegerLiteral).Value != 2 || value.(*IntegerLiteral).Value != 2 {
+			t.Errorf("hash pair not modified. got=%s", hash.String())
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	x := &Identifier{Token: token.Token{Line: 1, Column: 1}, Value: "x"}
+	xElsewhere := &Identifier{Token: token.Token{Line: 3, Column: 7}, Value: "x"}
+	y := &Identifier{Value: "y"}
+	str := &StringLiteral{Value: "x"}
+
+	tests := []struct {
+		a, b     Node
+		expected bool
+	}{
+		{x, xElsewhere, true},
+		{x, y, false},
+		{x, str, false},
+		{&InfixExpression{Left: x, Operator: "+", Right: y}, &InfixExpression{Left: xElsewhere, Operator: "+", Right: y}, true},
+		{&InfixExpression{Left: x, Operator: "+", Right: y}, &InfixExpression{Left: x, Operator: "-", Right: y}, false},
+		{&ForInExpression{Value: x, Iterable: y, Body: &BlockStatement{}}, &ForInExpression{Key: x, Value: x, Iterable: y, Body: &BlockStatement{}}, false},
+		{&IfExpression{Condition: x, Consequence: &BlockStatement{}}, &IfExpression{Condition: x, Consequence: &BlockStatement{}, Alternative: &BlockStatement{}}, false},
+		{&ArrayLiteral{Elements: []Expression{x}}, &ArrayLiteral{Elements: []Expression{x, x}}, false},
+		{&HashLiteral{Pairs: map[Expression]Expression{x: y}, Keys: []Expression{x}}, &HashLiteral{Pairs: map[Expression]Expression{xElsewhere: y}, Keys: []Expression{xElsewhere}}, true},
+		{&HashLiteral{Pairs: map[Expression]Expression{x: y}, Keys: []Expression{x}}, &HashLiteral{Pairs: map[Expression]Expression{x: x}, Keys: []Expression{x}}, false},
+		{&CallExpression{Function: x, Names: []*Identifier{x}, NamedArguments: map[string]Expression{"x": y}}, &CallExpression{Function: x, Names: []*Identifier{xElsewhere}, NamedArguments: map[string]Expression{"x": y}}, true},
+		{&CallExpression{Function: x, Names: []*Identifier{x}, NamedArguments: map[string]Expression{"x": y}}, &CallExpression{Function: x, Names: []*Identifier{x}, NamedArguments: map[string]Expression{"x": x}}, false},
+		{&CallExpression{Function: x, Names: []*Identifier{x}, NamedArguments: map[string]Expression{"x": y}}, &CallExpression{Function: x, Names: []*Identifier{y}, NamedArguments: map[string]Expression{"y": y}}, false},
+		{&CallExpression{Function: x, Arguments: []Expression{y}}, &CallExpression{Function: x, Names: []*Identifier{y}, NamedArguments: map[string]Expression{"y": y}}, false},
+	}
+
+	for _, tt := range tests {
+		if Equal(tt.a, tt.b) != tt.expected || Equal(tt.b, tt.a) != tt.expected {
+			t.Errorf("Equal(%s, %s) should be %t", tt.a.String(), tt.b.String(), tt.expected)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	one := &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}
+	x := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"}
+	original := &Program{Statements: []Statement{
+		&LetStatement{Name: x, Value: &InfixExpression{Left: one, Operator: "+", Right: x}},
+		&ExpressionStatement{Expression: &IfExpression{
+			Condition:   &Boolean{Value: true},
+			Consequence: &BlockStatement{Statements: []Statement{&ReturnStatement{ReturnValue: one}}},
+		}},
+		&ExpressionStatement{Expression: &ForInExpression{Value: x, Iterable: &ArrayLiteral{Elements: []Expression{one}}, Body: &BlockStatement{}}},
+		&ExpressionStatement{Expression: &CallExpression{
+			Function:  &FunctionLiteral{Parameters: []*Identifier{x}, Body: &BlockStatement{}},
+			Arguments: []Expression{&HashLiteral{Pairs: map[Expression]Expression{one: x}, Keys: []Expression{one}}},
+		}},
+		&ExpressionStatement{Expression: &CallExpression{
+			Function:       x,
+			Names:          []*Identifier{x},
+			NamedArguments: map[string]Expression{"x": &InfixExpression{Left: one, Operator: "+", Right: x}},
+		}},
+	}}
+	before := original.String()
+
+	copied := Copy(original)
+	if !Equal(original, copied) {
+		t.Fatalf("copy is not equal. want=%s, got=%s", original.String(), copied.String())
+	}
+
+	// 複製を書き換えても元の木は変わらない
+	Modify(copied, func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok {
+			integer.Value = 2
+			integer.Token.Literal = "2"
+		}
+		if ident, ok := node.(*Identifier); ok {
+			ident.Value = "y"
+		}
+		return node
+	})
+	if original.String() != before || one.Value != 1 || x.Value != "x" {
+		t.Errorf("original modified. got=%s", original.String())
+	}
+}
@@ -0,0 +1,182 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// field はノードの属性または子ノード
+// value は string, int64, *big.Int, bool, Node, []Node のいずれか
+type field struct {
+	name  string
+	value interface{}
+}
+
+// nodeFields はノードの種類の名前と、表示する属性・子ノードを返す
+// トークンは表示しない
+func nodeFields(node Node) (string, []field) {
+	switch node := node.(type) {
+	case *Program:
+		return "Program", []field{{"Statements", statementNodes(node.Statements)}}
+	case *ExpressionStatement:
+		return "ExpressionStatement", []field{{"Expression", node.Expression}}
+	case *LetStatement:
+		return "LetStatement", []field{{"Name", node.Name}, {"Value", node.Value}}
+	case *ImportStatement:
+		return "ImportStatement", []field{{"Path", node.Path}, {"Alias", node.Alias}}
+	case *ReturnStatement:
+		return "ReturnStatement", []field{{"ReturnValue", node.ReturnValue}}
+	case *BlockStatement:
+		return "BlockStatement", []field{{"Statements", statementNodes(node.Statements)}}
+	case *Identifier:
+		return "Identifier", []field{{"Value", node.Value}}
+	case *IntegerLiteral:
+		return "IntegerLiteral", []field{{"Value", node.Value}}
+	case *BigIntegerLiteral:
+		return "BigIntegerLiteral", []field{{"Value", node.Value}}
+	case *StringLiteral:
+		return "StringLiteral", []field{{"Value", node.Value}}
+	case *Boolean:
+		return "Boolean", []field{{"Value", node.Value}}
+	case *PrefixExpression:
+		return "PrefixExpression", []field{{"Operator", node.Operator}, {"Right", node.Right}}
+	case *InfixExpression:
+		return "InfixExpression", []field{{"Operator", node.Operator}, {"Left", node.Left}, {"Right", node.Right}}
+	case *IndexExpression:
+		return "IndexExpression", []field{{"Left", node.Left}, {"Index", node.Index}}
+	case *OptionalIndexExpression:
+		return "OptionalIndexExpression", []field{{"Left", node.Left}, {"Index", node.Index}}
+	case *IfExpression:
+		return "IfExpression", []field{{"Condition", node.Condition}, {"Consequence", node.Consequence}, {"Alternative", node.Alternative}}
+	case *ForInExpression:
+		return "ForInExpression", []field{{"Key", node.Key}, {"Value", node.Value}, {"Iterable", node.Iterable}, {"Body", node.Body}}
+	case *TryExpression:
+		return "TryExpression", []field{{"Body", node.Body}, {"Param", node.Param}, {"Handler", node.Handler}}
+	case *FunctionLiteral:
+		params := make([]Node, len(node.Parameters))
+		for i, p := range node.Parameters {
+			params[i] = p
+		}
+		return "FunctionLiteral", []field{{"Name", node.Name}, {"Parameters", params}, {"Body", node.Body}}
+	case *CallExpression:
+		fields := []field{{"Function", node.Function}, {"Arguments", expressionNodes(node.Arguments)}}
+		if len(node.Names) == 0 {
+			return "CallExpression", fields
+		}
+		// 名前付き引数は使った場合だけ出力する
+		names := make([]Node, len(node.Names))
+		values := make([]Node, len(node.Names))
+		for i, name := range node.Names {
+			names[i] = name
+			values[i] = node.NamedArguments[name.Value]
+		}
+		return "CallExpression", append(fields, field{"Names", names}, field{"NamedArguments", values})
+	case *ArrayLiteral:
+		return "ArrayLiteral", []field{{"Elements", expressionNodes(node.Elements)}}
+	case *SpreadExpression:
+		return "SpreadExpression", []field{{"Value", node.Value}}
+	case *HashLiteral:
+		values := make([]Node, len(node.Keys))
+		for i, key := range node.Keys {
+			values[i] = node.Pairs[key]
+		}
+		return "HashLiteral", []field{{"Keys", expressionNodes(node.Keys)}, {"Values", values}}
+	default:
+		return fmt.Sprintf("%T", node), nil
+	}
+}
+
+func statementNodes(statements []Statement) []Node {
+	nodes := make([]Node, len(statements))
+	for i, s := range statements {
+		nodes[i] = s
+	}
+	return nodes
+}
+
+func expressionNodes(expressions []Expression) []Node {
+	nodes := make([]Node, len(expressions))
+	for i, e := range expressions {
+		nodes[i] = e
+	}
+	return nodes
+}
+
+// Print は node を根とする木を1行1ノードで字下げして w に書く
+// 属性は種類の名前の後に name=value の形で、子ノードは1段深く "name: " を付けて書く
+func Print(w io.Writer, node Node) {
+	printNode(w, node, "", 0)
+}
+
+func printNode(w io.Writer, node Node, label string, depth int) {
+	kind, fields := nodeFields(node)
+
+	var line strings.Builder
+	line.WriteString(strings.Repeat("  ", depth))
+	line.WriteString(label)
+	line.WriteString(kind)
+	for _, f := range fields {
+		switch v := f.value.(type) {
+		case string:
+			fmt.Fprintf(&line, " %s=%q", f.name, v)
+		case int64, *big.Int, bool:
+			fmt.Fprintf(&line, " %s=%v", f.name, v)
+		}
+	}
+	fmt.Fprintln(w, line.String())
+
+	for _, f := range fields {
+		switch v := f.value.(type) {
+		case Node:
+			if !isNilNode(v) {
+				printNode(w, v, f.name+": ", depth+1)
+			}
+		case []Node:
+			for i, child := range v {
+				if !isNilNode(child) {
+					printNode(w, child, fmt.Sprintf("%s[%d]: ", f.name, i), depth+1)
+				}
+			}
+		}
+	}
+}
+
+// PrintJSON は node を根とする木をJSONで w に書く
+// 各ノードは種類の名前を "type" に持つオブジェクトになり、属性と子ノードは先頭を小文字にした名前のキーになる
+func PrintJSON(w io.Writer, node Node) error {
+	out, err := json.MarshalIndent(nodeJSON(node), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+func nodeJSON(node Node) map[string]interface{} {
+	kind, fields := nodeFields(node)
+	obj := map[string]interface{}{"type": kind}
+	for _, f := range fields {
+		key := strings.ToLower(f.name[:1]) + f.name[1:]
+		switch v := f.value.(type) {
+		case Node:
+			if !isNilNode(v) {
+				obj[key] = nodeJSON(v)
+			}
+		case []Node:
+			children := make([]interface{}, len(v))
+			for i, child := range v {
+				// 解析に失敗したノードは null にする
+				if !isNilNode(child) {
+					children[i] = nodeJSON(child)
+				}
+			}
+			obj[key] = children
+		default:
+			obj[key] = v
+		}
+	}
+	return obj
+}
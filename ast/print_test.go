@@ -0,0 +1,124 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"monkey/token"
+	"strings"
+	"testing"
+)
+
+func TestPrint(t *testing.T) {
+	// if (x) { fn(a) { a } } else { {"k": [1]} }
+	hashKey := &StringLiteral{Value: "k"}
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &IfExpression{
+			Condition: &Identifier{Value: "x"},
+			Consequence: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &FunctionLiteral{
+					Parameters: []*Identifier{{Value: "a"}},
+					Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &Identifier{Value: "a"}}}},
+				}},
+			}},
+			Alternative: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &HashLiteral{
+					Pairs: map[Expression]Expression{hashKey: &ArrayLiteral{Elements: []Expression{&IntegerLiteral{Value: 1}}}},
+					Keys:  []Expression{hashKey},
+				}},
+			}},
+		}},
+	}}
+
+	expected := `Program
+  Statements[0]: ExpressionStatement
+    Expression: IfExpression
+      Condition: Identifier Value="x"
+      Consequence: BlockStatement
+        Statements[0]: ExpressionStatement
+          Expression: FunctionLiteral Name=""
+            Parameters[0]: Identifier Value="a"
+            Body: BlockStatement
+              Statements[0]: ExpressionStatement
+                Expression: Identifier Value="a"
+      Alternative: BlockStatement
+        Statements[0]: ExpressionStatement
+          Expression: HashLiteral
+            Keys[0]: StringLiteral Value="k"
+            Values[0]: ArrayLiteral
+              Elements[0]: IntegerLiteral Value=1
+`
+	var out bytes.Buffer
+	Print(&out, program)
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%s\ngot=%s", expected, out.String())
+	}
+
+	out.Reset()
+	if err := PrintJSON(&out, program); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+	ifExp := decoded["statements"].([]interface{})[0].(map[string]interface{})["expression"].(map[string]interface{})
+	if ifExp["type"] != "IfExpression" || ifExp["alternative"] == nil {
+		t.Errorf("wrong JSON. got=%s", out.String())
+	}
+}
+
+func TestPrintNamedArguments(t *testing.T) {
+	// f(1, tls: true)
+	call := &CallExpression{
+		Function:       &Identifier{Value: "f"},
+		Arguments:      []Expression{&IntegerLiteral{Value: 1}},
+		Names:          []*Identifier{{Value: "tls"}},
+		NamedArguments: map[string]Expression{"tls": &Boolean{Value: true}},
+	}
+
+	expected := `CallExpression
+  Function: Identifier Value="f"
+  Arguments[0]: IntegerLiteral Value=1
+  Names[0]: Identifier Value="tls"
+  NamedArguments[0]: Boolean Value=true
+`
+	var out bytes.Buffer
+	Print(&out, call)
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%s\ngot=%s", expected, out.String())
+	}
+}
+
+func TestPrintOmitsMissingChildren(t *testing.T) {
+	node := &IfExpression{Token: token.Token{Type: token.IF, Literal: "if"}, Condition: &Boolean{Value: true}, Consequence: &BlockStatement{}}
+
+	var out bytes.Buffer
+	Print(&out, node)
+	expected := "IfExpression\n  Condition: Boolean Value=true\n  Consequence: BlockStatement\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestPrintPartialProgram(t *testing.T) {
+	// 構文エラーのあるプログラムには解析に失敗した文が型付きの nil で残る
+	program := &Program{Statements: []Statement{
+		(*LetStatement)(nil),
+		&ExpressionStatement{Expression: &IntegerLiteral{Value: 2}},
+	}}
+
+	var out bytes.Buffer
+	Print(&out, program)
+	expected := "Program\n  Statements[1]: ExpressionStatement\n    Expression: IntegerLiteral Value=2\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	if err := PrintJSON(&out, program); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "\"statements\": [\n    null,") {
+		t.Errorf("failed statement should be null. got=%s", out.String())
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/bench"
+	"monkey/repl"
+	"regexp"
+	"time"
+)
+
+// 計測する最小の時間の既定値
+const defaultBenchTime = time.Second
+
+// runBench は monkey bench を実行し、終了コードを返す
+// 埋め込んだワークロードを選んだバックエンドで繰り返し実行し、1秒あたりの回数と時間を表示する
+//
+//	monkey bench [-engine eval|vm|all] [-run regexp] [-time 1s] [-json]
+func runBench(args []string, out, errOut io.Writer) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	engine := fs.String("engine", "all", "`backend` to measure: eval, vm or all")
+	pattern := fs.String("run", "", "measure only workloads whose name matches this `regexp`")
+	minTime := fs.Duration("time", defaultBenchTime, "run each workload at least this `long`")
+	asJSON := fs.Bool("json", false, "print the results as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintln(errOut, "usage: monkey bench [-engine eval|vm|all] [-run regexp] [-time 1s] [-json]")
+		return 2
+	}
+
+	engines := bench.Engines
+	switch *engine {
+	case "all":
+	case repl.EngineEval, repl.EngineVM:
+		engines = []string{*engine}
+	default:
+		fmt.Fprintf(errOut, "unknown engine %q (want eval, vm or all)\n", *engine)
+		return 2
+	}
+	match, err := regexp.Compile(*pattern)
+	if err != nil {
+		fmt.Fprintf(errOut, "invalid -run: %s\n", err)
+		return 2
+	}
+
+	results := []*bench.Result{}
+	for _, w := range bench.Workloads() {
+		if !match.MatchString(w.Name) {
+			continue
+		}
+		for _, e := range engines {
+			result, err := bench.Run(w, e, *minTime)
+			if err != nil {
+				fmt.Fprintf(errOut, "%s/%s: %s\n", w.Name, e, err)
+				return 1
+			}
+			results = append(results, result)
+			if !*asJSON {
+				fmt.Fprintf(out, "%-10s %-5s %8d runs %12.2f ops/s %14s/op\n",
+					result.Workload, result.Engine, result.Runs, result.OpsPerSec, result.PerRun())
+			}
+		}
+	}
+	if len(results) == 0 {
+		fmt.Fprintf(errOut, "no workload matches %q\n", *pattern)
+		return 1
+	}
+
+	if *asJSON {
+		b, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+		fmt.Fprintln(out, string(b))
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+/*
+Package bench は評価器と仮想マシンの速さを比べるための決まった処理（ワークロード）を提供するパッケージ
+
+ワークロードは workloads/*.mky に Monkey で書いて埋め込む。同じファイルを正しさのテストにも使い、
+どちらのバックエンドでも同じ値になることを確かめる
+*/
+package bench
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/repl"
+	"monkey/vm"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed workloads/*.mky
+var workloads embed.FS
+
+// Engines は計測できるバックエンドの名前
+var Engines = []string{repl.EngineEval, repl.EngineVM}
+
+// Workload は計測する1つのプログラム
+type Workload struct {
+	// ファイル名から拡張子を除いたもの（fib など）
+	Name   string
+	Source string
+}
+
+// Workloads は埋め込んだワークロードを名前順に返す
+func Workloads() []Workload {
+	entries, err := workloads.ReadDir("workloads")
+	if err != nil {
+		panic(err)
+	}
+	result := make([]Workload, 0, len(entries))
+	for _, entry := range entries {
+		src, err := workloads.ReadFile(path.Join("workloads", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, Workload{Name: strings.TrimSuffix(entry.Name(), ".mky"), Source: string(src)})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Result は1つのワークロードを1つのバックエンドで計測した結果
+type Result struct {
+	Workload string `json:"workload"`
+	Engine   string `json:"engine"`
+	// 実行した回数と、その合計の時間
+	Runs  int           `json:"runs"`
+	Total time.Duration `json:"total_ns"`
+	// 1秒あたりの実行回数
+	OpsPerSec float64 `json:"ops_per_sec"`
+	// 最後の式の値（Inspect したもの）
+	Value string `json:"value"`
+}
+
+// PerRun は1回あたりの時間を返す
+func (r *Result) PerRun() time.Duration {
+	return r.Total / time.Duration(r.Runs)
+}
+
+// Prepare は w を engine で1回実行する関数を返す
+// 構文解析やコンパイルはここで1回だけ行い、返した関数は毎回新しい環境（仮想マシン）で実行する
+func Prepare(w Workload, engine string) (func() (object.Object, error), error) {
+	p := parser.New(lexer.New(w.Source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("%s: parse error: %s", w.Name, strings.Join(p.Errors(), "; "))
+	}
+
+	switch engine {
+	case repl.EngineEval:
+		ev := evaluator.New(evaluator.WithOutput(io.Discard))
+		return func() (object.Object, error) {
+			result := ev.Eval(program, object.NewEnvironment())
+			if errObj, ok := result.(*object.Error); ok {
+				return nil, fmt.Errorf("%s: %s", w.Name, errObj.Inspect())
+			}
+			return result, nil
+		}, nil
+	case repl.EngineVM:
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			return nil, fmt.Errorf("%s: compile error: %s", w.Name, err)
+		}
+		bytecode := comp.Bytecode()
+		return func() (object.Object, error) {
+			machine := vm.New(bytecode)
+			if err := machine.Run(); err != nil {
+				return nil, fmt.Errorf("%s: %s", w.Name, err)
+			}
+			return machine.LastPoppedStackElem(), nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown engine %q", engine)
+	}
+}
+
+// Run は w を engine で、合計が minTime を超えるまで（少なくとも1回）繰り返し実行して計測する
+func Run(w Workload, engine string, minTime time.Duration) (*Result, error) {
+	run, err := Prepare(w, engine)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Workload: w.Name, Engine: engine}
+	for result.Runs == 0 || result.Total < minTime {
+		start := time.Now()
+		value, err := run()
+		result.Total += time.Since(start)
+		if err != nil {
+			return nil, err
+		}
+		result.Runs++
+		result.Value = value.Inspect()
+	}
+	result.OpsPerSec = float64(result.Runs) / result.Total.Seconds()
+	return result, nil
+}
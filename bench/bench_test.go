@@ -0,0 +1,90 @@
+package bench
+
+import (
+	"testing"
+)
+
+// 各ワークロードの正しい値。どちらのバックエンドでもこの値になる
+var expectedValues = map[string]string{
+	"array":   "4000000",
+	"fib":     "75025",
+	"hash":    "12497564",
+	"loop":    "199998",
+	"strings": "42500",
+}
+
+func TestWorkloadsAgree(t *testing.T) {
+	all := Workloads()
+	if len(all) != len(expectedValues) {
+		t.Errorf("wrong number of workloads. want=%d, got=%d", len(expectedValues), len(all))
+	}
+
+	for _, w := range all {
+		expected, ok := expectedValues[w.Name]
+		if !ok {
+			t.Errorf("%s: no expected value", w.Name)
+			continue
+		}
+		for _, engine := range Engines {
+			run, err := Prepare(w, engine)
+			if err != nil {
+				t.Errorf("%s/%s: %s", w.Name, engine, err)
+				continue
+			}
+			result, err := run()
+			if err != nil {
+				t.Errorf("%s/%s: %s", w.Name, engine, err)
+				continue
+			}
+			if result.Inspect() != expected {
+				t.Errorf("%s/%s: wrong result. want=%s, got=%s", w.Name, engine, expected, result.Inspect())
+			}
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	w := Workload{Name: "small", Source: "1 + 2"}
+	result, err := Run(w, "vm", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Runs != 1 || result.Value != "3" || result.Workload != "small" || result.Engine != "vm" {
+		t.Errorf("wrong result. got=%+v", result)
+	}
+
+	tests := []struct {
+		source   string
+		engine   string
+		expected string
+	}{
+		{"1 +", "eval", "small: parse error: no prefix parse function for 'EOF' found"},
+		{"1 + true", "eval", "small: ERROR: line 1, column 3: TypeError: type mismatch: INTEGER + BOOLEAN"},
+		{"for (x in [1]) { x }", "vm", "small: compile error: unsupported node *ast.ForInExpression"},
+		{"1", "jit", `unknown engine "jit"`},
+	}
+	for _, tt := range tests {
+		_, err := Run(Workload{Name: "small", Source: tt.source}, tt.engine, 0)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q on %s: wrong error. want=%q, got=%v", tt.source, tt.engine, tt.expected, err)
+		}
+	}
+}
+
+func BenchmarkWorkloads(b *testing.B) {
+	for _, w := range Workloads() {
+		for _, engine := range Engines {
+			run, err := Prepare(w, engine)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(w.Name+"/"+engine, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := run(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
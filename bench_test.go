@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"monkey/bench"
+	"strings"
+	"testing"
+)
+
+func TestRunBench(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if status := runBench([]string{"-run", "^fib$", "-time", "0", "-json"}, &out, &errOut); status != 0 {
+		t.Fatalf("bench failed with status %d. stderr=%q", status, errOut.String())
+	}
+	var results []bench.Result
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("output is not JSON: %s\n%s", err, out.String())
+	}
+	if len(results) != 2 {
+		t.Fatalf("want a result per engine. got=%+v", results)
+	}
+	for i, engine := range []string{"eval", "vm"} {
+		r := results[i]
+		if r.Workload != "fib" || r.Engine != engine || r.Runs != 1 || r.Value != "75025" || r.OpsPerSec <= 0 {
+			t.Errorf("wrong result. got=%+v", r)
+		}
+	}
+
+	out.Reset()
+	if status := runBench([]string{"-engine", "vm", "-run", "^fib$", "-time", "0"}, &out, &errOut); status != 0 {
+		t.Fatalf("bench failed with status %d. stderr=%q", status, errOut.String())
+	}
+	if !strings.HasPrefix(out.String(), "fib        vm           1 runs") || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestRunBenchErrors(t *testing.T) {
+	tests := []struct {
+		args   []string
+		status int
+		errOut string
+	}{
+		{[]string{"-engine", "jit"}, 2, "unknown engine \"jit\" (want eval, vm or all)\n"},
+		{[]string{"-run", "("}, 2, "invalid -run: "},
+		{[]string{"-run", "nothing"}, 1, "no workload matches \"nothing\"\n"},
+		{[]string{"extra"}, 2, "usage: monkey bench"},
+	}
+
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		if status := runBench(tt.args, &out, &errOut); status != tt.status {
+			t.Errorf("%v: wrong status. want=%d, got=%d", tt.args, tt.status, status)
+		}
+		if !strings.HasPrefix(errOut.String(), tt.errOut) {
+			t.Errorf("%v: stderr should start with %q. got=%q", tt.args, tt.errOut, errOut.String())
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey/compiler"
+	"monkey/interp"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"path/filepath"
+	"strings"
+)
+
+// コンパイルしたバイトコードのファイルの拡張子
+const bytecodeExt = ".mkc"
+
+// runBuild は monkey build を実行し、終了コードを返す
+// ソースをバイトコードにコンパイルして -o のファイル（既定は拡張子を .mkc にしたもの）に書く
+//
+//	monkey build file.mky -o file.mkc
+func runBuild(args []string, errOut io.Writer) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	output := fs.String("o", "", "write the bytecode to this `file` (default: the source file with the extension "+bytecodeExt+")")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	// ファイル名の後のフラグも受け付ける
+	path := fs.Arg(0)
+	if fs.NArg() > 0 {
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return 2
+		}
+	}
+	if path == "" || fs.NArg() > 0 {
+		fmt.Fprintln(errOut, "usage: monkey build file.mky [-o file.mkc]")
+		return 2
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + bytecodeExt
+	}
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		printParseErrors(errOut, source{name: path, text: string(src)}, p.ErrorDetails())
+		return 1
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		printCompileError(errOut, source{name: path, text: string(src)}, err)
+		return 1
+	}
+
+	var buf bytes.Buffer
+	if err := comp.Bytecode().Encode(&buf); err != nil {
+		fmt.Fprintf(errOut, "%s: %s\n", path, err)
+		return 1
+	}
+	if err := ioutil.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	return 0
+}
+
+// runBytecodeFile は monkey run を実行し、終了コードを返す
+// monkey build で作ったファイルを構文解析せずに仮想マシンで実行し、最後の式の値が NULL でなければ表示する
+//
+//	monkey run file.mkc
+func runBytecodeFile(args []string, out, errOut io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(errOut, "usage: monkey run file"+bytecodeExt)
+		return 2
+	}
+	path := args[0]
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	bytecode, err := interp.LoadBytecode(bytes.NewReader(src))
+	if err != nil {
+		fmt.Fprintf(errOut, "%s: %s\n", path, err)
+		if err == compiler.ErrNotBytecode {
+			fmt.Fprintf(errOut, "compile it first with: monkey build %s\n", path)
+		}
+		return 1
+	}
+
+	result, err := interp.RunBytecode(bytecode)
+	if err != nil {
+		if runtimeErr, ok := err.(*interp.RuntimeError); ok {
+			if runtimeErr.Object.Exit {
+				return runtimeErr.Object.ExitCode
+			}
+			// 評価器と同じくエラーの種類も表示する
+			fmt.Fprintf(errOut, "%s: %s\n", path, runtimeErr.Object.Inspect())
+			return 1
+		}
+		fmt.Fprintf(errOut, "%s: ERROR: %s\n", path, err)
+		return 1
+	}
+	if result != object.NULL {
+		fmt.Fprintln(out, result.Inspect())
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSource(t *testing.T, dir, name, src string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBuildAndRun(t *testing.T) {
+	dir := t.TempDir()
+	path := writeSource(t, dir, "fib.mky", `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let label = "fib(20) = ";
+fib(20)
+`)
+
+	var out, errOut bytes.Buffer
+	if status := runBuild([]string{path}, &errOut); status != 0 {
+		t.Fatalf("build failed with status %d. stderr=%q", status, errOut.String())
+	}
+	// 既定では拡張子を .mkc にしたファイルに書く
+	compiled := filepath.Join(dir, "fib.mkc")
+	if status := runBytecodeFile([]string{compiled}, &out, &errOut); status != 0 {
+		t.Fatalf("run failed with status %d. stderr=%q", status, errOut.String())
+	}
+	if out.String() != "6765\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	// -o はファイル名の後にも書ける
+	out.Reset()
+	other := filepath.Join(dir, "other.mkc")
+	if status := runBuild([]string{path, "-o", other}, &errOut); status != 0 {
+		t.Fatalf("build -o failed with status %d. stderr=%q", status, errOut.String())
+	}
+	if status := runBytecodeFile([]string{other}, &out, &errOut); status != 0 || out.String() != "6765\n" {
+		t.Errorf("wrong result of -o. status=%d, out=%q, stderr=%q", status, out.String(), errOut.String())
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		src    string
+		errOut string
+	}{
+		{"let 1;", "bad.mky:1:5: expected next token to be IDENT, got INT instead\n"},
+		{"let x = 1;\nx + y", "x + y\n    ^\n" + filepath.Join(dir, "bad.mky") + ":2:5: compile error: undefined variable y\n"},
+		{"for (x in [1, 2]) { x }", "bad.mky: compile error: unsupported node *ast.ForInExpression\n"},
+	}
+
+	for _, tt := range tests {
+		path := writeSource(t, dir, "bad.mky", tt.src)
+		var errOut bytes.Buffer
+		if status := runBuild([]string{path}, &errOut); status != 1 {
+			t.Errorf("%q: wrong status. want=1, got=%d", tt.src, status)
+		}
+		if !strings.HasSuffix(errOut.String(), tt.errOut) {
+			t.Errorf("%q: stderr should end with %q. got=%q", tt.src, tt.errOut, errOut.String())
+		}
+	}
+
+	var errOut bytes.Buffer
+	if status := runBuild(nil, &errOut); status != 2 {
+		t.Errorf("build without a file should fail with status 2. got=%d", status)
+	}
+}
+
+func TestRunBytecodeErrors(t *testing.T) {
+	dir := t.TempDir()
+	source := writeSource(t, dir, "prog.mky", "let f = fn(a) { a };\nf(1, 2)\n")
+	var out, errOut bytes.Buffer
+	if status := runBuild([]string{source}, &errOut); status != 0 {
+		t.Fatalf("build failed. stderr=%q", errOut.String())
+	}
+	compiled := filepath.Join(dir, "prog.mkc")
+	data, err := ioutil.ReadFile(compiled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		errOut string
+	}{
+		{compiled, "prog.mkc: ERROR: ArityError: wrong number of arguments: want=1, got=2\n"},
+		{source, "prog.mky: not a monkey bytecode file\ncompile it first with: monkey build " + source + "\n"},
+		{writeSource(t, dir, "short.mkc", string(data[:len(data)/2])), "short.mkc: bytecode is truncated\n"},
+		{writeSource(t, dir, "old.mkc", "\x00mkc\x00"), "old.mkc: unsupported bytecode version 0 (want 2)"},
+		{filepath.Join(dir, "missing.mkc"), "no such file or directory"},
+	}
+
+	for _, tt := range tests {
+		errOut.Reset()
+		if status := runBytecodeFile([]string{tt.path}, &out, &errOut); status != 1 {
+			t.Errorf("%s: wrong status. want=1, got=%d", tt.path, status)
+		}
+		if !strings.Contains(errOut.String(), tt.errOut) {
+			t.Errorf("%s: stderr should contain %q. got=%q", tt.path, tt.errOut, errOut.String())
+		}
+	}
+	if out.Len() > 0 {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Package check はプログラムを実行せずに抽象構文木を調べ、未定義の名前の参照と使われない let を報告するパッケージ
+*/
+package check
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/token"
+	"sort"
+)
+
+// Diagnostic は検査で見つかった問題
+type Diagnostic struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// Check は program を調べて、見つかった問題を位置の順に返す
+// predefined はプログラムの外で定義される名前（プレリュードなど）。組み込み関数の名前は含めなくてよい
+//
+// スコープは評価器と同じく、関数・for-in・catch が新しいスコープを作り、if などのブロックは作らない
+// 関数の本体は囲むスコープの文をすべて調べてから調べるので、後で let する名前を関数の中から参照してもよい
+// 名前を付けずに import したスコープでは、モジュールがどの名前を定義するか分からないので未定義の名前を報告しない
+// _ で始まる名前の let は使われなくても報告しない
+func Check(program *ast.Program, predefined []string) []Diagnostic {
+	c := &checker{}
+	global := c.push(nil)
+	for _, name := range evaluator.BuiltinNames() {
+		global.declare(name, token.Token{}).used = true
+	}
+	for _, name := range predefined {
+		global.declare(name, token.Token{}).used = true
+	}
+
+	top := c.push(global)
+	c.statements(program.Statements, top)
+	c.pop(top)
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return c.diagnostics
+}
+
+// binding は let や仮引数で束縛された名前
+type binding struct {
+	tok token.Token
+	// let で束縛された場合はtrue（仮引数などは使われなくても報告しない）
+	let  bool
+	used bool
+}
+
+// scope は評価器の環境に対応する名前の表
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+	// 同じスコープで束縛し直されて隠れた束縛（使われたかどうかの報告に使う）
+	shadowed []*binding
+	// 名前を付けずに import した場合はtrue
+	open bool
+	// このスコープの文をすべて調べた後で調べる関数の本体
+	deferred []func()
+}
+
+func (s *scope) declare(name string, tok token.Token) *binding {
+	if old, ok := s.bindings[name]; ok {
+		s.shadowed = append(s.shadowed, old)
+	}
+	b := &binding{tok: tok}
+	s.bindings[name] = b
+	return b
+}
+
+// name を内側のスコープから探す。見つからなければ nil と、開いたスコープがあったかどうかを返す
+func (s *scope) lookup(name string) (b *binding, open bool) {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.bindings[name]; ok {
+			return b, false
+		}
+		open = open || s.open
+	}
+	return nil, open
+}
+
+type checker struct {
+	diagnostics []Diagnostic
+}
+
+func (c *checker) report(tok token.Token, format string, a ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, a...)})
+}
+
+// outer の内側に新しいスコープを作る
+func (c *checker) push(outer *scope) *scope {
+	return &scope{outer: outer, bindings: map[string]*binding{}}
+}
+
+// スコープを閉じる。後回しにした関数の本体を調べてから、使われなかった let を報告する
+func (c *checker) pop(s *scope) {
+	for len(s.deferred) > 0 {
+		fn := s.deferred[0]
+		s.deferred = s.deferred[1:]
+		fn()
+	}
+	all := s.shadowed
+	for _, b := range s.bindings {
+		all = append(all, b)
+	}
+	for _, b := range all {
+		if b.let && !b.used && b.tok.Literal != "" && b.tok.Literal[0] != '_' {
+			c.report(b.tok, "%s is declared but never used", b.tok.Literal)
+		}
+	}
+}
+
+func (c *checker) statements(stmts []ast.Statement, s *scope) {
+	for _, stmt := range stmts {
+		c.statement(stmt, s)
+	}
+}
+
+func (c *checker) statement(stmt ast.Statement, s *scope) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		// 値を調べてから束縛する（let x = x + 1 の右辺の x は外側の x）
+		// ただし関数の本体は後で調べるので、再帰する関数は自分の名前を参照できる
+		c.expression(stmt.Value, s)
+		s.declare(stmt.Name.Value, stmt.Name.Token).let = true
+	case *ast.ExpressionStatement:
+		c.expression(stmt.Expression, s)
+	case *ast.ReturnStatement:
+		c.expression(stmt.ReturnValue, s)
+	case *ast.ImportStatement:
+		if stmt.Alias != nil {
+			s.declare(stmt.Alias.Value, stmt.Alias.Token).let = true
+		} else {
+			s.open = true
+		}
+	case *ast.BlockStatement:
+		c.statements(stmt.Statements, s)
+	}
+}
+
+func (c *checker) block(block *ast.BlockStatement, s *scope) {
+	if block != nil {
+		c.statements(block.Statements, s)
+	}
+}
+
+func (c *checker) expression(exp ast.Expression, s *scope) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		b, open := s.lookup(exp.Value)
+		switch {
+		case b != nil:
+			b.used = true
+		case !open:
+			c.report(exp.Token, "undefined: %s", exp.Value)
+		}
+	case *ast.PrefixExpression:
+		c.expression(exp.Right, s)
+	case *ast.InfixExpression:
+		c.expression(exp.Left, s)
+		c.expression(exp.Right, s)
+	case *ast.IfExpression:
+		c.expression(exp.Condition, s)
+		c.block(exp.Consequence, s)
+		c.block(exp.Alternative, s)
+	case *ast.ForInExpression:
+		c.expression(exp.Iterable, s)
+		inner := c.push(s)
+		if exp.Key != nil {
+			inner.declare(exp.Key.Value, exp.Key.Token)
+		}
+		inner.declare(exp.Value.Value, exp.Value.Token)
+		c.block(exp.Body, inner)
+		c.pop(inner)
+	case *ast.TryExpression:
+		c.block(exp.Body, s)
+		inner := c.push(s)
+		inner.declare(exp.Param.Value, exp.Param.Token)
+		c.block(exp.Handler, inner)
+		c.pop(inner)
+	case *ast.FunctionLiteral:
+		// 本体は囲むスコープの文をすべて調べた後で調べる
+		s.deferred = append(s.deferred, func() {
+			inner := c.push(s)
+			for _, param := range exp.Parameters {
+				inner.declare(param.Value, param.Token)
+			}
+			c.block(exp.Body, inner)
+			c.pop(inner)
+		})
+	case *ast.CallExpression:
+		if ident, ok := exp.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+			// quote の引数は評価されない
+			return
+		}
+		c.expression(exp.Function, s)
+		for _, arg := range exp.Arguments {
+			c.expression(arg, s)
+		}
+		for _, name := range exp.Names {
+			c.expression(exp.NamedArguments[name.Value], s)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			c.expression(el, s)
+		}
+	case *ast.SpreadExpression:
+		c.expression(exp.Value, s)
+	case *ast.IndexExpression:
+		c.expression(exp.Left, s)
+		c.expression(exp.Index, s)
+	case *ast.OptionalIndexExpression:
+		c.expression(exp.Left, s)
+		c.expression(exp.Index, s)
+	case *ast.HashLiteral:
+		for _, key := range exp.Keys {
+			c.expression(key, s)
+			c.expression(exp.Pairs[key], s)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package check
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let x = 1; puts(x)`, nil},
+		{`puts(y)`, []string{"1:6: undefined: y"}},
+		{`let x = 1;`, []string{"1:5: x is declared but never used"}},
+		{`let _x = 1;`, nil},
+		// 組み込み関数と事前に定義された名前
+		{`len(sum)`, nil},
+		// 仮引数は使わなくても報告しない
+		{`let f = fn(a, b) { a }; f(1, 2)`, nil},
+		{`let f = fn(a) { b }; f(1)`, []string{"1:17: undefined: b"}},
+		// 関数の中の let
+		{`let f = fn(a) { let t = a; a }; f(1)`, []string{"1:21: t is declared but never used"}},
+		// 仮引数と let は関数の外からは見えない
+		{`let f = fn(a) { let t = a; t }; f(a) + t`, []string{"1:35: undefined: a", "1:40: undefined: t"}},
+		// 再帰と、後で定義する名前の参照
+		{`let f = fn(n) { if (n < 1) { 0 } else { f(n - 1) + g(n) } }; let g = fn(x) { x }; f(2)`, nil},
+		// 関数の外では定義より前に参照できない
+		{`puts(x); let x = 1; x`, []string{"1:6: undefined: x"}},
+		// let の右辺は束縛する前に調べる
+		{`let x = x + 1; x`, []string{"1:9: undefined: x"}},
+		// クロージャは外側のスコープの名前を参照できる
+		{`let adder = fn(n) { fn(x) { x + n } }; adder(1)(2)`, nil},
+		{`let adder = fn(n) { let k = 1; fn(x) { x + m } }; adder(1)`,
+			[]string{"1:25: k is declared but never used", "1:44: undefined: m"}},
+		// if のブロックは新しいスコープを作らない
+		{`if (true) { let x = 1 }; x`, nil},
+		// for-in と catch の変数
+		{`for (k, v in {"a": 1}) { puts(k, v) }; v`, []string{"1:40: undefined: v"}},
+		{`let r = try { 1 } catch (e) { e }; [r, e]`, []string{"1:40: undefined: e"}},
+		// 同じスコープで束縛し直した場合、前の束縛が使われていなければ報告する
+		{`let x = 1; let x = 2; x`, []string{"1:5: x is declared but never used"}},
+		{`let x = 1; let x = x + 1; x`, nil},
+		// 名前付きの import はその名前を束縛し、名前のない import の後は未定義の名前を報告しない
+		{`import "m.mky" as m; m["f"]`, nil},
+		{`import "m.mky"; f(1)`, nil},
+		{`import "m.mky" as m; f(1)`, []string{"1:19: m is declared but never used", "1:22: undefined: f"}},
+		// quote の引数は評価されない
+		{`quote(a + b)`, nil},
+		{`let f = fn(a) { a }; f(1, ...[z], a: w)`, []string{"1:31: undefined: z", "1:38: undefined: w"}},
+		{`{k: v}[i]`, []string{"1:2: undefined: k", "1:5: undefined: v", "1:8: undefined: i"}},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("%s: parser errors: %v", tt.input, p.Errors())
+		}
+
+		var got []string
+		for _, d := range Check(program, []string{"sum"}) {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: wrong diagnostics.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
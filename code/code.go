@@ -0,0 +1,238 @@
+/*
+Package code はコンパイラが生成し、仮想マシンが実行するバイトコードの命令を定義する
+命令は1バイトのオペコードと、それに続くビッグエンディアンのオペランドからなる
+*/
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions は命令を並べたバイト列
+type Instructions []byte
+
+// String は1行に1命令ずつ、先頭からのオフセットを付けて逆アセンブルする
+//
+//	0000 OpConstant 2
+//	0003 OpAdd
+//
+// 未定義のオペコードはその1バイトを "ERROR: unknown opcode NN" と書いて続きを読む
+// オペランドの途中で終わっていれば、そこで止める
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, ok := definitions[Opcode(ins[i])]
+		if !ok {
+			fmt.Fprintf(&out, "%04d ERROR: unknown opcode %d\n", i, ins[i])
+			i++
+			continue
+		}
+		if i+1+def.Width() > len(ins) {
+			fmt.Fprintf(&out, "%04d ERROR: truncated %s\n", i, def.Name)
+			break
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, fmtInstruction(def, operands))
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func fmtInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d", len(operands), len(def.OperandWidths))
+	}
+
+	switch len(operands) {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+	return fmt.Sprintf("ERROR: unhandled operand count for %s", def.Name)
+}
+
+type Opcode byte
+
+const (
+	// 定数プールの値をスタックに積む。オペランドは定数の番号
+	OpConstant Opcode = iota
+	// スタックの先頭を捨てる。式文の終わりに置く
+	OpPop
+
+	// スタックの上2つを取り出して演算し、結果を積む
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	// スタックの先頭を取り出して演算し、結果を積む
+	OpMinus
+	OpBang
+
+	// スタックの先頭を取り出し、真でなければオペランドの位置に移る
+	OpJumpNotTruthy
+	// 無条件にオペランドの位置に移る
+	OpJump
+
+	// 大域変数の値を積む、またはスタックの先頭を取り出して大域変数に入れる。オペランドは変数の番号
+	OpGetGlobal
+	OpSetGlobal
+	// 実行中のフレームの局所変数を読み書きする。オペランドは変数の番号
+	OpGetLocal
+	OpSetLocal
+
+	// オペランドの数の引数と、その下にある関数を取り出して呼び出す
+	OpCall
+	// スタックの先頭を戻り値として呼び出し元に戻る
+	OpReturnValue
+	// NULL を戻り値として呼び出し元に戻る
+	OpReturn
+	// 定数の CompiledFunction と、スタックの上にある自由変数からクロージャを作る
+	// オペランドは定数の番号と自由変数の数
+	OpClosure
+	// 実行中のクロージャが捕捉した自由変数の値を積む。オペランドは変数の番号
+	OpGetFree
+	// 実行中のクロージャ自身を積む。再帰呼び出しに使う
+	OpCurrentClosure
+	// 末尾位置の OpCall。呼び出す関数のフレームで実行中のフレームを置き換える
+	OpTailCall
+
+	// スタックの上のオペランドの数の要素から配列を作る
+	OpArray
+	// スタックの上のオペランドの数の値（キーと値を交互に並べたもの）からハッシュを作る
+	OpHash
+	// スタックの上の添字と、その下の値を取り出して添字の要素を積む
+	OpIndex
+	// 組み込み関数を積む。オペランドは Bytecode.BuiltinNames の番号
+	OpGetBuiltin
+)
+
+// Definition は命令の名前とオペランドごとのバイト数
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:      {"OpConstant", []int{2}},
+	OpPop:           {"OpPop", []int{}},
+	OpAdd:           {"OpAdd", []int{}},
+	OpSub:           {"OpSub", []int{}},
+	OpMul:           {"OpMul", []int{}},
+	OpDiv:           {"OpDiv", []int{}},
+	OpEqual:         {"OpEqual", []int{}},
+	OpNotEqual:      {"OpNotEqual", []int{}},
+	OpGreaterThan:   {"OpGreaterThan", []int{}},
+	OpLessThan:      {"OpLessThan", []int{}},
+	OpTrue:          {"OpTrue", []int{}},
+	OpFalse:         {"OpFalse", []int{}},
+	OpNull:          {"OpNull", []int{}},
+	OpMinus:         {"OpMinus", []int{}},
+	OpBang:          {"OpBang", []int{}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+	OpGetGlobal:     {"OpGetGlobal", []int{2}},
+	OpSetGlobal:     {"OpSetGlobal", []int{2}},
+	OpGetLocal:      {"OpGetLocal", []int{1}},
+	OpSetLocal:      {"OpSetLocal", []int{1}},
+
+	OpCall:           {"OpCall", []int{1}},
+	OpReturnValue:    {"OpReturnValue", []int{}},
+	OpReturn:         {"OpReturn", []int{}},
+	OpClosure:        {"OpClosure", []int{2, 1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpTailCall:       {"OpTailCall", []int{1}},
+	OpArray:          {"OpArray", []int{2}},
+	OpHash:           {"OpHash", []int{2}},
+	OpIndex:          {"OpIndex", []int{}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+}
+
+// Width はオペランドのバイト数の合計を返す
+func (def *Definition) Width() int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
+}
+
+// Lookup はオペコードの定義を返す
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make はオペコードとオペランドから1つの命令を作る。未定義のオペコードには空の命令を返す
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instruction := make([]byte, 1+def.Width())
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands は ins の先頭から def のオペランドを読み、その値と読んだバイト数を返す
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 は2バイトのオペランドを読む
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 は1バイトのオペランドを読む
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
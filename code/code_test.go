@@ -0,0 +1,112 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpJump, []int{258}, []byte{byte(OpJump), 1, 2}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpArray, []int{3}, []byte{byte(OpArray), 0, 3}},
+		{OpTailCall, []int{2}, []byte{byte(OpTailCall), 2}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Errorf("instruction has wrong length. want=%d, got=%d", len(tt.expected), len(instruction))
+			continue
+		}
+		for i, b := range tt.expected {
+			if instruction[i] != b {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpJumpNotTruthy, 12),
+		Make(OpSetLocal, 1),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpConstant 2
+0004 OpConstant 65535
+0007 OpJumpNotTruthy 12
+0010 OpSetLocal 1
+0012 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
+	}
+}
+
+// 読めない命令があっても止まらずに続きを逆アセンブルする
+func TestInstructionsStringErrors(t *testing.T) {
+	ins := Instructions{}
+	ins = append(ins, Make(OpTrue)...)
+	ins = append(ins, 200, 201)
+	ins = append(ins, Make(OpPop)...)
+	ins = append(ins, Make(OpConstant, 1)[:2]...)
+
+	expected := `0000 OpTrue
+0001 ERROR: unknown opcode 200
+0002 ERROR: unknown opcode 201
+0003 OpPop
+0004 ERROR: truncated OpConstant
+`
+	if ins.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, ins.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpPop, []int{}, 0},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,514 @@
+/*
+Package compiler は構文木をスタックマシンのバイトコードに変換する
+生成したバイトコードは vm パッケージで実行する
+*/
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+// Bytecode はコンパイルした結果の命令と定数プール
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	// 大域変数の名前を番号の順に並べたもの。VMのエラーメッセージに使う
+	GlobalNames []string
+	// OpGetBuiltin の番号が指す組み込み関数の名前。VMは名前で組み込み関数を探す
+	BuiltinNames []string
+}
+
+// EmittedInstruction は出力した命令とその位置
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// Error はコンパイルできない構文のエラー。位置が分からない場合 Line と Column は0
+type Error struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+	}
+	return e.Message
+}
+
+// CompilationScope は1つの関数本体（または最上位）の命令
+type CompilationScope struct {
+	instructions code.Instructions
+	// 直前とその前に出力した命令。ブロックの最後の OpPop を取り除くのに使う
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+}
+
+// Compiler は構文木を1つのバイトコードにまとめる
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	// 関数リテラルに入るたびに積む。scopes[0] が最上位
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// コンパイル中のプログラムの最上位で let する名前
+	// 関数の中からは、定義より前でも大域変数として参照できる
+	topLevelNames map[string]bool
+}
+
+// 組み込み関数の名前とその番号。評価器と同じく、変数が見つからない場合に使う
+var (
+	builtinNames = evaluator.BuiltinNames()
+	builtinIndex = map[string]int{}
+)
+
+func init() {
+	for i, name := range builtinNames {
+		builtinIndex[name] = i
+	}
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{instructions: code.Instructions{}}
+	return &Compiler{
+		constants:     []object.Object{},
+		symbolTable:   NewSymbolTable(),
+		scopes:        []CompilationScope{mainScope},
+		scopeIndex:    0,
+		topLevelNames: map[string]bool{},
+	}
+}
+
+// NewWithState は以前のコンパイルで定義した名前と定数を引き継ぐコンパイラを生成する
+// REPLのように入力ごとにコンパイルし、同じ globals で実行する場合に使う
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	c := New()
+	c.symbolTable = s
+	c.constants = constants
+	return c
+}
+
+// Compile は node をコンパイルする。まだ対応していない構文にはエラーを返す
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			if let, ok := s.(*ast.LetStatement); ok {
+				c.topLevelNames[let.Name.Value] = true
+			}
+		}
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		// 評価器と同じく、右辺では束縛する名前をまだ参照できない
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if c.symbolTable.Captured(node.Name.Value) {
+			// 評価器のクロージャは環境を参照するので束縛し直した値が見えるが、VMのクロージャは作った時点の値を持つ
+			return &Error{Message: fmt.Sprintf("rebinding %s after a closure captured it is not supported by the compiler", node.Name.Value),
+				Line: node.Name.Token.Line, Column: node.Name.Token.Column}
+		}
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			c.emit(code.OpReturn)
+			break
+		}
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok && c.scopeIndex > 0 && c.topLevelNames[node.Value] {
+			// 後で定義する大域変数。評価器と同じく、呼び出すまでに定義されていればよい
+			c.symbolTable.global().Define(node.Value)
+			symbol, ok = c.symbolTable.Resolve(node.Value)
+		}
+		if index, isBuiltin := builtinIndex[node.Value]; !ok && isBuiltin {
+			symbol, ok = c.symbolTable.global().DefineBuiltin(index, node.Value), true
+		}
+		if !ok {
+			return &Error{Message: "undefined variable " + node.Value, Line: node.Token.Line, Column: node.Token.Column}
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node)
+
+	case *ast.CallExpression:
+		if len(node.Names) > 0 {
+			name := node.Names[0].Token
+			return &Error{Message: "named arguments are not supported by the compiler", Line: name.Line, Column: name.Column}
+		}
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		if len(node.Arguments) > math.MaxUint8 {
+			return &Error{Message: fmt.Sprintf("too many arguments (more than %d)", math.MaxUint8), Line: node.Token.Line, Column: node.Token.Column}
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.ArrayLiteral:
+		if len(node.Elements) > math.MaxUint16 {
+			return &Error{Message: fmt.Sprintf("too many elements (more than %d)", math.MaxUint16), Line: node.Token.Line, Column: node.Token.Column}
+		}
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.SpreadExpression:
+		// 引数の個数や配列の長さが実行時に決まるので、今の命令では表せない
+		return &Error{Message: "spread operator ... is not supported by the compiler", Line: node.Token.Line, Column: node.Token.Column}
+
+	case *ast.HashLiteral:
+		if len(node.Keys)*2 > math.MaxUint16 {
+			return &Error{Message: fmt.Sprintf("too many elements (more than %d)", math.MaxUint16/2), Line: node.Token.Line, Column: node.Token.Column}
+		}
+		// 評価器と同じく記述した順に、キーと値を交互に評価する
+		for _, key := range node.Keys {
+			if err := c.Compile(key); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[key]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Keys)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.OptionalIndexExpression:
+		return &Error{Message: "null-safe index operator ?[ ] is not supported by the compiler", Line: node.Token.Line, Column: node.Token.Column}
+
+	case *ast.InfixExpression:
+		// 評価器と同じく左辺から評価する
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		op, ok := infixOpcodes[node.Operator]
+		if !ok {
+			return &Error{Message: "unsupported operator " + node.Operator, Line: node.Token.Line, Column: node.Token.Column}
+		}
+		c.emit(op)
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return &Error{Message: "unsupported operator " + node.Operator, Line: node.Token.Line, Column: node.Token.Column}
+		}
+
+	case *ast.IfExpression:
+		return c.compileIf(node)
+
+	case *ast.IntegerLiteral:
+		return c.emitConstant(object.NewInteger(node.Value))
+
+	case *ast.BigIntegerLiteral:
+		return c.emitConstant(&object.BigInteger{Value: node.Value})
+
+	case *ast.StringLiteral:
+		return c.emitConstant(&object.String{Value: node.Value})
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	default:
+		return &Error{Message: fmt.Sprintf("unsupported node %T", node)}
+	}
+
+	return nil
+}
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+}
+
+// if 式は条件が偽なら else 節へ飛び、then 節の後は else 節を飛び越える
+// 各節は値を1つ残す。else 節がなければ NULL を残す
+func (c *Compiler) compileIf(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	// 飛び先は後で書き換える
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compileBranch(node.Consequence); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBranch(node.Alternative); err != nil {
+		return err
+	}
+	after := len(c.currentInstructions())
+	c.changeOperand(jumpPos, after)
+
+	// 飛び先はオペランドの2バイトに収まらなければならない
+	if after > math.MaxUint16 {
+		return &Error{Message: fmt.Sprintf("program too large: jump target %d out of range", after)}
+	}
+	return nil
+}
+
+// 関数の本体を新しいスコープでコンパイルし、定数の CompiledFunction からクロージャを作る命令を出力する
+// 本体で参照した外側の局所変数は、クロージャを作る前にスタックに積んでおく
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	if node.Name != "" {
+		c.symbolTable.DefineFunctionName(node.Name)
+	}
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		c.leaveScope()
+		return err
+	}
+	// 最後の式文の値を返す
+	if c.lastInstructionIs(code.OpPop) && len(node.Body.Statements) > 0 {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) && !c.lastInstructionIs(code.OpReturn) {
+		c.emit(code.OpReturn)
+	}
+	markTailCalls(c.currentInstructions())
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	localNames := c.symbolTable.localNames()
+	if len(localNames) > math.MaxUint8+1 || len(freeSymbols) > math.MaxUint8 {
+		c.leaveScope()
+		return &Error{Message: "too many local variables", Line: node.Token.Line, Column: node.Token.Column}
+	}
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		LocalNames:    localNames,
+		NumParameters: len(node.Parameters),
+		Name:          node.Name,
+	}
+	index := c.addConstant(compiledFn)
+	if index > math.MaxUint16 {
+		return &Error{Message: fmt.Sprintf("too many constants (more than %d)", math.MaxUint16+1)}
+	}
+	c.emit(code.OpClosure, index, len(freeSymbols))
+	return nil
+}
+
+// markTailCalls は結果をそのまま返す OpCall を OpTailCall に置き換える
+// 直後が OpReturnValue か、OpJump をたどった先が OpReturnValue であれば末尾位置にある
+// 評価器と同じく、末尾再帰は呼び出しの深さの上限に数えない
+func markTailCalls(ins code.Instructions) {
+	returns := func(pos int) bool {
+		// if 式の入れ子では OpJump が続く。飛び先は常に後ろにある
+		for pos < len(ins) && code.Opcode(ins[pos]) == code.OpJump {
+			pos = int(code.ReadUint16(ins[pos+1:]))
+		}
+		return pos < len(ins) && code.Opcode(ins[pos]) == code.OpReturnValue
+	}
+	for i := 0; i < len(ins); {
+		def, _ := code.Lookup(ins[i])
+		next := i + 1 + def.Width()
+		if code.Opcode(ins[i]) == code.OpCall && returns(next) {
+			ins[i] = byte(code.OpTailCall)
+		}
+		i = next
+	}
+}
+
+// ブロックの最後の式文の値を残す。最後が式文でなければ NULL を残す
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+	if c.lastInstructionIs(code.OpPop) && len(block.Statements) > 0 {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// Bytecode はここまでにコンパイルした結果を返す
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.global().localNames(),
+		BuiltinNames: builtinNames,
+	}
+}
+
+// 定数プールに obj を加え、それを積む命令を出力する
+func (c *Compiler) emitConstant(obj object.Object) error {
+	index := c.addConstant(obj)
+	if index > math.MaxUint16 {
+		return &Error{Message: fmt.Sprintf("too many constants (more than %d)", math.MaxUint16+1)}
+	}
+	c.emit(code.OpConstant, index)
+	return nil
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// emit は命令を出力し、その位置を返す
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = EmittedInstruction{Opcode: op, Position: pos}
+	return pos
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.instructions = scope.instructions[:scope.lastInstruction.Position]
+	scope.lastInstruction = scope.previousInstruction
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+// 同じ長さの命令で置き換える
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	copy(c.currentInstructions()[pos:], newInstruction)
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.replaceInstruction(opPos, code.Make(op, operand))
+}
+
+// 関数の本体のスコープに入る
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// 関数の本体のスコープを出て、その命令を返す
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
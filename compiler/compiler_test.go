@@ -0,0 +1,716 @@
+package compiler
+
+import (
+	"monkey/ast"
+	"monkey/code"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1; 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "2 / 1 * 3 - 4",
+			expectedConstants: []interface{}{2, 1, 3, 4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDiv),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpMul),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSub),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 評価器と同じく左辺から評価するので、オペランドを入れ替えない
+			input:             "1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true != !false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpFalse),
+				code.Make(code.OpBang),
+				code.Make(code.OpNotEqual),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { 10 } else { 20 }; 3333;",
+			expectedConstants: []interface{}{10, 20, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 13),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpPop),
+				// 0014
+				code.Make(code.OpConstant, 2),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) {}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 8),
+				code.Make(code.OpNull),
+				code.Make(code.OpJump, 9),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"monkey"`,
+			expectedConstants: []interface{}{"monkey"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"mon", "key"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestUnsupportedNode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (x in [1, 2]) { x }", "unsupported node *ast.ForInExpression"},
+		{"1..3", "line 1, column 2: unsupported operator .."},
+		{"let a = 1; +a", "line 1, column 12: unsupported operator +"},
+		{"let f = fn(a) { a }; f(a: 1)", "line 1, column 24: named arguments are not supported by the compiler"},
+		{"fn() { let y = 1; let h = fn() { y }; let y = 2; h() }", "line 1, column 43: rebinding y after a closure captured it is not supported by the compiler"},
+		{"fn() { let y = 1; let y = [fn() { y }]; y }", "line 1, column 23: rebinding y after a closure captured it is not supported by the compiler"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; let two = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+		{
+			input:             "let one = 1; one;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 同じ名前の let は同じ番号に代入する
+			input:             "let one = 1; let two = one; let one = two;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			// ブロックは新しいスコープを作らない
+			input:             "let x = 1; if (true) { let x = 2; x }",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpTrue),
+				// 0007
+				code.Make(code.OpJumpNotTruthy, 22),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpSetGlobal, 0),
+				// 0016
+				code.Make(code.OpGetGlobal, 0),
+				// 0019
+				code.Make(code.OpJump, 23),
+				// 0022
+				code.Make(code.OpNull),
+				// 0023
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestUndefinedVariable(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x", "line 1, column 1: undefined variable x"},
+		{"let a = 1;\na + b", "line 2, column 5: undefined variable b"},
+		// 右辺では束縛する名前をまだ参照できない
+		{"let a = a;", "line 1, column 9: undefined variable a"},
+		// 実行されない分岐の中でもコンパイル時に見つける
+		{"if (false) { missing }", "line 1, column 14: undefined variable missing"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("%q: expected compile error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestCompilerWithState(t *testing.T) {
+	symbols := NewSymbolTable()
+	first := NewWithState(symbols, []object.Object{})
+	if err := first.Compile(parse("let a = 1;")); err != nil {
+		t.Fatal(err)
+	}
+
+	second := NewWithState(symbols, first.Bytecode().Constants)
+	if err := second.Compile(parse("let b = a + 2; b")); err != nil {
+		t.Fatal(err)
+	}
+	bytecode := second.Bytecode()
+	testConstants(t, "second", []interface{}{1, 2}, bytecode.Constants)
+	testInstructions(t, "second", []code.Instructions{
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpAdd),
+		code.Make(code.OpSetGlobal, 1),
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+
+	expectedNames := []string{"a", "b"}
+	if len(bytecode.GlobalNames) != 2 || bytecode.GlobalNames[0] != "a" || bytecode.GlobalNames[1] != "b" {
+		t.Errorf("wrong global names. want=%v, got=%v", expectedNames, bytecode.GlobalNames)
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn() { return 5 + 10 }",
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 最後の式文の値を返す
+			input: "fn() { 1; 2 }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctionCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "let manyArg = fn(a, b) { let c = a; c + b }; manyArg(24, 25);",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				24,
+				25,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// 末尾位置の呼び出しだけを置き換える
+			input: "fn(f) { f(f(1)) }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 入れ子の if 式の各節の最後も末尾位置
+			input: "fn(f) { if (true) { if (false) { f() } else { f() } } else { f() + 1 } }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpTrue),
+					code.Make(code.OpJumpNotTruthy, 22),
+					code.Make(code.OpFalse),
+					code.Make(code.OpJumpNotTruthy, 15),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpJump, 19),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpJump, 30),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 最上位の呼び出しは置き換えない
+			input:             "let f = fn() { 1 }; f()",
+			expectedConstants: []interface{}{1, []code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpReturnValue)}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCollections(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[]",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2 + 3]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `{"b": 1, "a": 2}["a"]`,
+			expectedConstants: []interface{}{"b", 1, "a", 2, "a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	lenIndex, pushIndex := builtinIndex["len"], builtinIndex["push"]
+	tests := []compilerTestCase{
+		{
+			input:             "len([]); push([], 1);",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, lenIndex),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetBuiltin, pushIndex),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 同じ名前の変数は組み込み関数より優先する
+			input:             "let len = 1; len",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "fn() { len }",
+			expectedConstants: []interface{}{[]code.Instructions{code.Make(code.OpGetBuiltin, lenIndex), code.Make(code.OpReturnValue)}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 関数の中で定義した関数は、自分自身を OpCurrentClosure で参照する
+			input: "let wrapper = fn() { let countDown = fn(x) { countDown(x - 1) }; countDown(1) };",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			// 関数の中からは、後で定義する大域変数も参照できる (先に参照された isOdd が 0 番になる)
+			input: "let isEven = fn(n) { isOdd(n) }; let isOdd = fn(n) { isEven(n) };",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("%s: compiler error: %s", tt.input, err)
+		}
+
+		bytecode := compiler.Bytecode()
+		testInstructions(t, tt.input, tt.expectedInstructions, bytecode.Instructions)
+		testConstants(t, tt.input, tt.expectedConstants, bytecode.Constants)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testInstructions(t *testing.T, input string, expected []code.Instructions, actual code.Instructions) {
+	t.Helper()
+	concatted := code.Instructions{}
+	for _, ins := range expected {
+		concatted = append(concatted, ins...)
+	}
+
+	if actual.String() != concatted.String() {
+		t.Errorf("%s: wrong instructions.\nwant=\n%s\ngot=\n%s", input, concatted, actual)
+	}
+}
+
+func testConstants(t *testing.T, input string, expected []interface{}, actual []object.Object) {
+	t.Helper()
+	if len(expected) != len(actual) {
+		t.Errorf("%s: wrong number of constants. want=%d, got=%d", input, len(expected), len(actual))
+		return
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("%s: constant %d is not a function. got=%T", input, i, actual[i])
+				continue
+			}
+			testInstructions(t, input, constant, fn.Instructions)
+		case int:
+			result, ok := actual[i].(*object.Integer)
+			if !ok {
+				t.Errorf("%s: constant %d is not Integer. got=%T", input, i, actual[i])
+				continue
+			}
+			if result.Value != int64(constant) {
+				t.Errorf("%s: constant %d has wrong value. want=%d, got=%d", input, i, constant, result.Value)
+			}
+		case string:
+			result, ok := actual[i].(*object.String)
+			if !ok {
+				t.Errorf("%s: constant %d is not String. got=%T", input, i, actual[i])
+				continue
+			}
+			if result.Value != constant {
+				t.Errorf("%s: constant %d has wrong value. want=%q, got=%q", input, i, constant, result.Value)
+			}
+		}
+	}
+}
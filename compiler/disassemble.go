@@ -0,0 +1,74 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"monkey/object"
+	"strconv"
+	"strings"
+)
+
+// Disassemble はバイトコード全体を読める形で w に書く
+// 最上位の命令、定数プール、大域変数の名前の順に並べる。関数の定数は局所変数と命令も書く
+//
+//	main:
+//	0000 OpClosure 1 0
+//	0004 OpSetGlobal 0
+//
+//	constants:
+//	0 INTEGER 1
+//	1 FUNCTION inc(x)
+//	    locals: x
+//	    0000 OpGetLocal 0
+//	    ...
+//
+//	globals:
+//	0 inc
+func Disassemble(w io.Writer, b *Bytecode) {
+	io.WriteString(w, "main:\n")
+	io.WriteString(w, b.Instructions.String())
+
+	if len(b.Constants) > 0 {
+		io.WriteString(w, "\nconstants:\n")
+		for i, c := range b.Constants {
+			fmt.Fprintf(w, "%d %s\n", i, describeConstant(c))
+			if fn, ok := c.(*object.CompiledFunction); ok {
+				if len(fn.LocalNames) > 0 {
+					fmt.Fprintf(w, "    locals: %s\n", strings.Join(fn.LocalNames, ", "))
+				}
+				io.WriteString(w, indent(fn.Instructions.String(), "    "))
+			}
+		}
+	}
+
+	if len(b.GlobalNames) > 0 {
+		io.WriteString(w, "\nglobals:\n")
+		for i, name := range b.GlobalNames {
+			fmt.Fprintf(w, "%d %s\n", i, name)
+		}
+	}
+}
+
+func describeConstant(c object.Object) string {
+	switch c := c.(type) {
+	case *object.String:
+		return "STRING " + strconv.Quote(c.Value)
+	case *object.CompiledFunction:
+		name := c.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		return fmt.Sprintf("FUNCTION %s(%s)", name, strings.Join(c.LocalNames[:c.NumParameters], ", "))
+	default:
+		return fmt.Sprintf("%s %s", c.Type(), c.Inspect())
+	}
+}
+
+// 各行の先頭に prefix を付ける
+func indent(s, prefix string) string {
+	if s == "" {
+		return ""
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(s, "\n"), "\n")
+	return prefix + strings.Join(lines, prefix) + "\n"
+}
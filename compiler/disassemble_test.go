@@ -0,0 +1,49 @@
+package compiler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	comp := New()
+	if err := comp.Compile(parse(`let inc = fn(x) { x + 1 }; fn() { "hi" }`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	Disassemble(&out, comp.Bytecode())
+	expected := `main:
+0000 OpClosure 1 0
+0004 OpSetGlobal 0
+0007 OpClosure 3 0
+0011 OpPop
+
+constants:
+0 INTEGER 1
+1 FUNCTION inc(x)
+    locals: x
+    0000 OpGetLocal 0
+    0002 OpConstant 0
+    0005 OpAdd
+    0006 OpReturnValue
+2 STRING "hi"
+3 FUNCTION <anonymous>()
+    0000 OpConstant 2
+    0003 OpReturnValue
+
+globals:
+0 inc
+`
+	if out.String() != expected {
+		t.Errorf("wrong disassembly.\nwant=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestDisassembleEmpty(t *testing.T) {
+	var out bytes.Buffer
+	Disassemble(&out, New().Bytecode())
+	if out.String() != "main:\n" {
+		t.Errorf("wrong disassembly. got=%q", out.String())
+	}
+}
@@ -0,0 +1,291 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/code"
+	"monkey/object"
+)
+
+// バイトコードのファイルの先頭に置く印
+const bytecodeMagic = "\x00mkc"
+
+// FormatVersion はバイトコードのファイル形式の版。形式を変えたら上げる
+const FormatVersion = 2
+
+// 定数プールの値の種類
+const (
+	constInteger  byte = 'i'
+	constString   byte = 's'
+	constFunction byte = 'f'
+)
+
+// ErrNotBytecode は Decode に渡したものがバイトコードのファイルでない場合のエラー
+var ErrNotBytecode = errors.New("not a monkey bytecode file")
+
+// ErrTruncated はバイトコードのファイルが途中で終わっている場合のエラー
+var ErrTruncated = errors.New("bytecode is truncated")
+
+// Encode はバイトコードを w に書き出す。Decode で読み戻せる
+//
+// 形式は印と版の後に、大域変数の名前、組み込み関数の名前、定数プール、命令を順に並べる
+// 数は符号なし varint、整数の定数は符号付き varint、文字列は長さと UTF-8 のバイト列
+func (b *Bytecode) Encode(w io.Writer) error {
+	e := &encoder{w: bufio.NewWriter(w)}
+	e.w.WriteString(bytecodeMagic)
+	e.w.WriteByte(FormatVersion)
+
+	e.strings(b.GlobalNames)
+	e.strings(b.BuiltinNames)
+	e.uvarint(uint64(len(b.Constants)))
+	for i, c := range b.Constants {
+		if err := e.constant(c); err != nil {
+			return fmt.Errorf("constant %d: %s", i, err)
+		}
+	}
+	e.bytes(b.Instructions)
+	return e.w.Flush()
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) uvarint(n uint64) {
+	e.w.Write(e.buf[:binary.PutUvarint(e.buf[:], n)])
+}
+
+func (e *encoder) varint(n int64) {
+	e.w.Write(e.buf[:binary.PutVarint(e.buf[:], n)])
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.w.Write(b)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.w.WriteString(s)
+}
+
+func (e *encoder) strings(ss []string) {
+	e.uvarint(uint64(len(ss)))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+func (e *encoder) constant(c object.Object) error {
+	switch c := c.(type) {
+	case *object.Integer:
+		e.w.WriteByte(constInteger)
+		e.varint(c.Value)
+	case *object.String:
+		e.w.WriteByte(constString)
+		e.string(c.Value)
+	case *object.CompiledFunction:
+		e.w.WriteByte(constFunction)
+		e.string(c.Name)
+		e.uvarint(uint64(c.NumParameters))
+		e.strings(c.LocalNames)
+		e.bytes(c.Instructions)
+	default:
+		return fmt.Errorf("cannot encode %s", c.Type())
+	}
+	return nil
+}
+
+// Decode は Encode で書き出したバイトコードを読む
+// 別の版の形式や途中で終わっているファイル、壊れた命令にはエラーを返す
+func Decode(r io.Reader) (*Bytecode, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+
+	magic := make([]byte, len(bytecodeMagic))
+	if _, err := io.ReadFull(d.r, magic); err != nil || string(magic) != bytecodeMagic {
+		return nil, ErrNotBytecode
+	}
+	version, err := d.r.ReadByte()
+	if err != nil {
+		return nil, ErrTruncated
+	}
+	if version != FormatVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d (want %d); rebuild the program with this version of monkey", version, FormatVersion)
+	}
+
+	b := &Bytecode{GlobalNames: d.strings(), BuiltinNames: d.strings()}
+	n := d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		b.Constants = append(b.Constants, d.constant())
+	}
+	b.Instructions = d.bytes()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if _, err := d.r.ReadByte(); err != io.EOF {
+		return nil, errors.New("invalid bytecode: unexpected data after instructions")
+	}
+
+	if err := verify(b.Instructions, 0, b); err != nil {
+		return nil, fmt.Errorf("invalid bytecode: %s", err)
+	}
+	for i, c := range b.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			if err := verify(fn.Instructions, fn.NumLocals(), b); err != nil {
+				return nil, fmt.Errorf("invalid bytecode: constant %d: %s", i, err)
+			}
+		}
+	}
+	return b, nil
+}
+
+// decoder は最初のエラーを err に残し、それ以降は何も読まない
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err != nil {
+		return
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+	d.err = err
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return n
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return n
+}
+
+// count は要素の数を読む。要素は読んだ分だけ確保するので、壊れた数でも大きな領域は確保しない
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if d.err == nil && n > 1<<31 {
+		d.fail(errors.New("invalid bytecode: length out of range"))
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	if d.err != nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		d.fail(err)
+		return nil
+	}
+	return buf.Bytes()
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) strings() []string {
+	n := d.count()
+	var ss []string
+	for i := 0; i < n && d.err == nil; i++ {
+		ss = append(ss, d.string())
+	}
+	return ss
+}
+
+func (d *decoder) constant() object.Object {
+	kind, err := d.r.ReadByte()
+	if err != nil {
+		d.fail(err)
+		return nil
+	}
+	switch kind {
+	case constInteger:
+		return object.NewInteger(d.varint())
+	case constString:
+		return &object.String{Value: d.string()}
+	case constFunction:
+		fn := &object.CompiledFunction{Name: d.string()}
+		fn.NumParameters = d.count()
+		fn.LocalNames = d.strings()
+		fn.Instructions = d.bytes()
+		if d.err == nil && fn.NumParameters > len(fn.LocalNames) {
+			d.fail(errors.New("invalid bytecode: function has more parameters than locals"))
+		}
+		return fn
+	default:
+		d.fail(fmt.Errorf("invalid bytecode: unknown constant kind %q", kind))
+		return nil
+	}
+}
+
+// verify は命令が最後まで読めて、定数と局所変数と組み込み関数と飛び先を正しく指していることを確かめる
+// VMはオペランドを検査せずに実行するので、読み込み時に調べておく
+// スタックの深さまでは調べないので、手で作った命令列までは防げない
+func verify(ins code.Instructions, numLocals int, b *Bytecode) error {
+	constants := b.Constants
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return fmt.Errorf("offset %d: %s", i, err)
+		}
+		width := def.Width()
+		if i+1+width > len(ins) {
+			return fmt.Errorf("offset %d: %s is truncated", i, def.Name)
+		}
+		operands, _ := code.ReadOperands(def, ins[i+1:])
+
+		switch code.Opcode(ins[i]) {
+		case code.OpConstant:
+			if operands[0] >= len(constants) {
+				return fmt.Errorf("offset %d: constant %d out of range", i, operands[0])
+			}
+		case code.OpClosure:
+			if operands[0] >= len(constants) {
+				return fmt.Errorf("offset %d: constant %d out of range", i, operands[0])
+			}
+			if _, ok := constants[operands[0]].(*object.CompiledFunction); !ok {
+				return fmt.Errorf("offset %d: constant %d is not a function", i, operands[0])
+			}
+		case code.OpGetLocal, code.OpSetLocal:
+			if operands[0] >= numLocals {
+				return fmt.Errorf("offset %d: local %d out of range", i, operands[0])
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(b.BuiltinNames) {
+				return fmt.Errorf("offset %d: builtin %d out of range", i, operands[0])
+			}
+		case code.OpJump, code.OpJumpNotTruthy:
+			if operands[0] > len(ins) {
+				return fmt.Errorf("offset %d: jump target %d out of range", i, operands[0])
+			}
+		}
+		i += 1 + width
+	}
+	return nil
+}
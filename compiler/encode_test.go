@@ -0,0 +1,150 @@
+package compiler
+
+import (
+	"bytes"
+	"monkey/code"
+	"monkey/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func encode(t *testing.T, input string) []byte {
+	t.Helper()
+	comp := New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("%s: compiler error: %s", input, err)
+	}
+	var buf bytes.Buffer
+	if err := comp.Bytecode().Encode(&buf); err != nil {
+		t.Fatalf("%s: encode error: %s", input, err)
+	}
+	return buf.Bytes()
+}
+
+const encodeProgram = `
+let greeting = "hello, " + "world";
+let big = 9223372036854775807;
+let newAdder = fn(a) { fn(b) { a + b } };
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let pairs = {"one": [1], "two": push([1], 2)};
+newAdder(-1)(fib(len(pairs["two"]) * 5));
+`
+
+func TestEncodeDecode(t *testing.T) {
+	comp := New()
+	if err := comp.Compile(parse(encodeProgram)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	expected := comp.Bytecode()
+
+	var buf bytes.Buffer
+	if err := expected.Encode(&buf); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	result, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("bytecode differs after round trip.\nwant=%+v\ngot=%+v", expected, result)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data := encode(t, encodeProgram)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", nil, "not a monkey bytecode file"},
+		{"source", []byte("let x = 1;"), "not a monkey bytecode file"},
+		{"version", append([]byte(bytecodeMagic), 99), "unsupported bytecode version 99 (want 2)"},
+		{"trailing data", append(append([]byte{}, data...), 0), "invalid bytecode: unexpected data after instructions"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.data))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+// 途中で切れたファイルはどこで切れていてもパニックせずにエラーになる
+func TestDecodeTruncated(t *testing.T) {
+	data := encode(t, encodeProgram)
+
+	for n := len(bytecodeMagic) + 1; n < len(data); n++ {
+		_, err := Decode(bytes.NewReader(data[:n]))
+		if err == nil {
+			t.Errorf("%d bytes: expected error", n)
+			continue
+		}
+		if err != ErrTruncated && !strings.HasPrefix(err.Error(), "invalid bytecode") {
+			t.Errorf("%d bytes: wrong error. got=%v", n, err)
+		}
+	}
+}
+
+func TestDecodeInvalidInstructions(t *testing.T) {
+	fn := &object.CompiledFunction{
+		Instructions: code.Make(code.OpGetLocal, 1),
+		LocalNames:   []string{"a"},
+	}
+	tests := []struct {
+		bytecode *Bytecode
+		expected string
+	}{
+		{
+			&Bytecode{Instructions: code.Make(code.OpConstant, 0)},
+			"invalid bytecode: offset 0: constant 0 out of range",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpConstant, 0)[:2], Constants: []object.Object{&object.Integer{Value: 1}}},
+			"invalid bytecode: offset 0: OpConstant is truncated",
+		},
+		{
+			&Bytecode{Instructions: code.Instructions{255}},
+			"invalid bytecode: offset 0: opcode 255 undefined",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpJump, 100)},
+			"invalid bytecode: offset 0: jump target 100 out of range",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpClosure, 0, 0), Constants: []object.Object{&object.Integer{Value: 1}}},
+			"invalid bytecode: offset 0: constant 0 is not a function",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpGetBuiltin, 0)},
+			"invalid bytecode: offset 0: builtin 0 out of range",
+		},
+		{
+			&Bytecode{Constants: []object.Object{fn}},
+			"invalid bytecode: constant 0: offset 0: local 1 out of range",
+		},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := tt.bytecode.Encode(&buf); err != nil {
+			t.Fatalf("encode error: %s", err)
+		}
+		_, err := Decode(&buf)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestEncodeUnsupportedConstant(t *testing.T) {
+	bytecode := &Bytecode{Constants: []object.Object{object.TRUE}}
+	err := bytecode.Encode(&bytes.Buffer{})
+	if err == nil || err.Error() != "constant 0: cannot encode BOOLEAN" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
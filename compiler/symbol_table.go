@@ -0,0 +1,143 @@
+package compiler
+
+// SymbolScope は名前がどこに束縛されているか
+type SymbolScope string
+
+const (
+	// プログラムの最上位で束縛した名前。VMの globals に置く
+	GlobalScope SymbolScope = "GLOBAL"
+	// 関数の中で束縛した名前。呼び出しごとのフレームに置く
+	LocalScope SymbolScope = "LOCAL"
+	// 組み込み関数の名前
+	BuiltinScope SymbolScope = "BUILTIN"
+	// 外側の関数の局所変数を内側の関数が参照する名前。クロージャに置く
+	FreeScope SymbolScope = "FREE"
+	// 関数の中から参照した、その関数自身の名前
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+// Symbol は名前を解決した結果。Index はスコープの中での番号
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable は1つのスコープの名前と番号の対応
+// Outer が nil なら最上位のスコープで、そこで定義した名前は GlobalScope になる
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// このスコープで参照した外側の局所変数。FreeScope のシンボルの Index の順に並べる
+	FreeSymbols []Symbol
+	// このスコープの局所変数のうち、内側の関数が自由変数として参照したもの
+	captured map[string]bool
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: map[string]Symbol{}}
+}
+
+// NewEnclosedSymbolTable は outer の内側のスコープを作る
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NumDefinitions はこのスコープで定義した名前の数を返す
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
+
+// Define は name をこのスコープに定義する
+// 評価器の let と同じく、同じスコープで定義済みの名前は同じ番号のまま上書きする
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: LocalScope}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// Captured はこのスコープの局所変数 name を内側の関数が自由変数として参照していればtrueを返す
+// クロージャは作った時点の値を持つので、その後で束縛し直しても変更が見えない
+func (s *SymbolTable) Captured(name string) bool {
+	return s.captured[name]
+}
+
+// 最上位のスコープ
+func (s *SymbolTable) global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// このスコープで定義した名前を番号の順に返す
+func (s *SymbolTable) localNames() []string {
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		if symbol.Scope == LocalScope || symbol.Scope == GlobalScope {
+			names[symbol.Index] = name
+		}
+	}
+	return names
+}
+
+// DefineFunctionName は関数の中でその関数自身を name で参照できるようにする
+// 引数や局所変数に同じ名前があれば、そちらが優先される
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineBuiltin は index 番目の組み込み関数を name で定義する
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// 外側の局所変数 original をこのスコープの自由変数にする
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Resolve は name を内側のスコープから順に探す
+// 外側の関数の局所変数は、このスコープの自由変数として返す
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok {
+		return symbol, ok
+	}
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+	if symbol.Scope == LocalScope {
+		if s.Outer.captured == nil {
+			s.Outer.captured = map[string]bool{}
+		}
+		s.Outer.captured[name] = true
+	}
+	return s.defineFree(symbol), true
+}
@@ -0,0 +1,136 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+		"e": {Name: "e", Scope: LocalScope, Index: 0},
+	}
+
+	global := NewSymbolTable()
+	if a := global.Define("a"); a != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+	}
+	if b := global.Define("b"); b != expected["b"] {
+		t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+	}
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	if c := firstLocal.Define("c"); c != expected["c"] {
+		t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
+	}
+	if d := firstLocal.Define("d"); d != expected["d"] {
+		t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
+	}
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	if e := secondLocal.Define("e"); e != expected["e"] {
+		t.Errorf("expected e=%+v, got=%+v", expected["e"], e)
+	}
+}
+
+func TestRedefineKeepsIndex(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.Define("b")
+
+	if a := global.Define("a"); a.Index != 0 {
+		t.Errorf("redefined a should keep index 0. got=%d", a.Index)
+	}
+	if global.NumDefinitions() != 2 {
+		t.Errorf("wrong number of definitions. want=2, got=%d", global.NumDefinitions())
+	}
+
+	// 外側と同じ名前は内側のスコープに新しく定義する
+	local := NewEnclosedSymbolTable(global)
+	expected := Symbol{Name: "a", Scope: LocalScope, Index: 0}
+	if a := local.Define("a"); a != expected {
+		t.Errorf("expected a=%+v, got=%+v", expected, a)
+	}
+}
+
+func TestResolveNestedLocal(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	tests := []struct {
+		table    *SymbolTable
+		expected []Symbol
+	}{
+		{firstLocal, []Symbol{
+			{Name: "a", Scope: GlobalScope, Index: 0},
+			{Name: "len", Scope: BuiltinScope, Index: 0},
+			{Name: "c", Scope: LocalScope, Index: 0},
+		}},
+		{secondLocal, []Symbol{
+			{Name: "a", Scope: GlobalScope, Index: 0},
+			{Name: "len", Scope: BuiltinScope, Index: 0},
+			{Name: "c", Scope: FreeScope, Index: 0},
+			{Name: "e", Scope: LocalScope, Index: 0},
+		}},
+	}
+
+	for _, tt := range tests {
+		for _, sym := range tt.expected {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+
+	expectedFree := []Symbol{{Name: "c", Scope: LocalScope, Index: 0}}
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0] != expectedFree[0] {
+		t.Errorf("wrong free symbols. want=%+v, got=%+v", expectedFree, secondLocal.FreeSymbols)
+	}
+}
+
+func TestResolveUnresolvable(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	local := NewEnclosedSymbolTable(global)
+	local.Define("c")
+
+	for _, name := range []string{"b", "d"} {
+		if _, ok := local.Resolve(name); ok {
+			t.Errorf("name %s resolved, but was expected not to", name)
+		}
+	}
+	// 内側で定義した名前は外側からは見えない
+	if _, ok := global.Resolve("c"); ok {
+		t.Errorf("local name c should not be visible from the global scope")
+	}
+}
+
+func TestDefineFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("f")
+
+	expected := Symbol{Name: "f", Scope: FunctionScope, Index: 0}
+	if result, ok := local.Resolve("f"); !ok || result != expected {
+		t.Errorf("expected f to resolve to %+v, got=%+v", expected, result)
+	}
+
+	// 同じ名前を定義し直すと、関数名より局所変数が優先される
+	local.Define("f")
+	expected = Symbol{Name: "f", Scope: LocalScope, Index: 0}
+	if result, ok := local.Resolve("f"); !ok || result != expected {
+		t.Errorf("expected f to resolve to %+v, got=%+v", expected, result)
+	}
+}
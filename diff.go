@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext は unifiedDiff が変更の前後に表示する行数
+const diffContext = 3
+
+// diffOp は行単位の差分の1行
+type diffOp struct {
+	kind byte // ' ', '-', '+'
+	line string
+}
+
+// unifiedDiff は a から b への差分を unified 形式で返す。同じなら空文字列
+func unifiedDiff(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(ops); {
+		// 次の変更を探す
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		// 変更の間の変更していない行が 2*diffContext 以下なら1つのハンクにまとめる
+		hunkStart := max(first-diffContext, start)
+		end := first
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+		hunkEnd := min(end+diffContext, len(ops))
+		writeHunk(&out, ops, hunkStart, hunkEnd)
+		start = hunkEnd
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []diffOp, start, end int) {
+	// ハンクの先頭が a と b の何行目にあたるかを数える
+	aLine, bLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			aLine++
+		}
+		if op.kind != '-' {
+			bLine++
+		}
+	}
+	aCount, bCount := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			aCount++
+		}
+		if op.kind != '-' {
+			bCount++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+	for _, op := range ops[start:end] {
+		out.WriteByte(op.kind)
+		out.WriteString(op.line)
+		out.WriteString("\n")
+	}
+}
+
+func hunkRange(line, count int) string {
+	if count == 0 {
+		// 空の範囲は直前の行を指す
+		return fmt.Sprintf("%d,0", line-1)
+	}
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines は最長共通部分列で a と b の行を対応させ、差分を返す
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] は a[i:] と b[j:] の最長共通部分列の長さ
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/repl"
+	"monkey/token"
+)
+
+// 評価せずに出力するフロントエンドの段階
+const (
+	dumpTokens   = "tokens"
+	dumpAST      = "ast"
+	dumpBytecode = "bytecode"
+)
+
+// 出力の形式
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// dump は src を評価せずに、字句解析か構文解析かコンパイルの結果を opts.Format の形式で out に書き、終了コードを返す
+// 構文エラーがあれば errOut に書いて1を返すが、構文木は解析できたところまで書く
+func dump(src source, out, errOut io.Writer, opts runOptions) int {
+	if opts.Dump == dumpTokens {
+		return dumpTokenStream(src, out, errOut, opts.Format)
+	}
+
+	p := parser.New(lexer.New(src.text))
+	program := p.ParseProgram()
+	if opts.Dump == dumpBytecode {
+		if len(p.Errors()) > 0 {
+			printParseErrors(errOut, src, p.ErrorDetails())
+			return 1
+		}
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			printCompileError(errOut, src, err)
+			return 1
+		}
+		compiler.Disassemble(out, comp.Bytecode())
+		return 0
+	}
+
+	if opts.Format == formatJSON {
+		if err := ast.PrintJSON(out, program); err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+	} else {
+		ast.Print(out, program)
+	}
+
+	if len(p.Errors()) > 0 {
+		printParseErrors(errOut, src, p.ErrorDetails())
+		return 1
+	}
+	return 0
+}
+
+// tokenJSON は --format=json で書くトークン
+type tokenJSON struct {
+	Type    string `json:"type"`
+	Literal string `json:"literal"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+}
+
+// 1行に1つ、位置と種類とリテラルを書く。不正なトークンがあれば1を返す
+func dumpTokenStream(src source, out, errOut io.Writer, format string) int {
+	tokens := lexer.Tokenize(src.text)
+	status := 0
+	if format == formatJSON {
+		list := make([]tokenJSON, len(tokens))
+		for i, tok := range tokens {
+			list[i] = tokenJSON{string(tok.Type), tok.Literal, tok.Line, tok.Column}
+		}
+		b, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+		fmt.Fprintln(out, string(b))
+	} else {
+		for _, tok := range tokens {
+			fmt.Fprintf(out, "%-7s %-10s %s\n", fmt.Sprintf("%d:%d", tok.Line, tok.Column), tok.Type, tok.Literal)
+		}
+	}
+
+	for _, tok := range tokens {
+		if tok.Type == token.ILLEGAL {
+			fmt.Fprint(errOut, repl.Snippet(src.text, tok.Line, tok.Column))
+			fmt.Fprintf(errOut, "%s:%d:%d: illegal token %q\n", src.name, tok.Line, tok.Column, tok.Literal)
+			status = 1
+		}
+	}
+	return status
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	tests := []struct {
+		file   string
+		dump   string
+		format string
+		golden string
+		status int
+		errOut string
+	}{
+		{"dump/program.mky", dumpTokens, formatText, "program.tokens.golden", 0, ""},
+		{"dump/program.mky", dumpTokens, formatJSON, "program.tokens.json.golden", 0, ""},
+		{"dump/program.mky", dumpAST, formatText, "program.ast.golden", 0, ""},
+		{"dump/program.mky", dumpAST, formatJSON, "program.ast.json.golden", 0, ""},
+		{"dump/bytecode.mky", dumpBytecode, formatText, "bytecode.bytecode.golden", 0, ""},
+		// 構文エラーがあっても解析できたところまで出力する
+		{"parse_error.mky", dumpAST, formatText, "parse_error.ast.golden", 1, "testdata/parse_error.mky:2:5: expected next token to be IDENT, got = instead\n"},
+	}
+
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		opts := runOptions{Dump: tt.dump, Format: tt.format}
+		status := runFile(filepath.Join("testdata", tt.file), &out, &errOut, opts)
+		if status != tt.status {
+			t.Errorf("%s: wrong status. want=%d, got=%d (stderr=%q)", tt.golden, tt.status, status, errOut.String())
+		}
+
+		golden, err := ioutil.ReadFile(filepath.Join("testdata", "dump", tt.golden))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != string(golden) {
+			t.Errorf("%s: wrong output.\nwant:\n%s\ngot:\n%s", tt.golden, golden, out.String())
+		}
+		if tt.errOut == "" && errOut.Len() > 0 {
+			t.Errorf("%s: unexpected stderr %q", tt.golden, errOut.String())
+		}
+		if !strings.Contains(errOut.String(), tt.errOut) {
+			t.Errorf("%s: stderr should contain %q. got=%q", tt.golden, tt.errOut, errOut.String())
+		}
+	}
+}
+
+func TestDumpDoesNotEvaluate(t *testing.T) {
+	var out, errOut bytes.Buffer
+	status := runExpressions([]string{`puts("side effect")`, `exit(3)`}, &out, &errOut, runOptions{Dump: dumpAST, Format: formatText})
+	if status != 0 {
+		t.Errorf("wrong status. want=0, got=%d", status)
+	}
+	if strings.Contains(out.String(), "side effect\n") {
+		t.Errorf("source should not be evaluated. got=%q", out.String())
+	}
+	if strings.Count(out.String(), "Program\n") != 2 {
+		t.Errorf("each source should be dumped. got=%q", out.String())
+	}
+}
+
+func TestDumpBytecodeErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		errOut string
+	}{
+		{"let = 1;", "<stdin>:1:5: expected next token to be IDENT, got = instead\n"},
+		{"let a = 1;\na + b", "a + b\n    ^\n<stdin>:2:5: compile error: undefined variable b\n"},
+	}
+
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		status := runReader("<stdin>", strings.NewReader(tt.input), &out, &errOut, runOptions{Dump: dumpBytecode, Format: formatText})
+		if status != 1 {
+			t.Errorf("%q: wrong status. want=1, got=%d", tt.input, status)
+		}
+		if out.Len() > 0 {
+			t.Errorf("%q: nothing should be dumped. got=%q", tt.input, out.String())
+		}
+		if !strings.Contains(errOut.String(), tt.errOut) {
+			t.Errorf("%q: stderr should contain %q. got=%q", tt.input, tt.errOut, errOut.String())
+		}
+	}
+}
+
+func TestDumpIllegalToken(t *testing.T) {
+	var out, errOut bytes.Buffer
+	status := runReader("<stdin>", strings.NewReader("let x = 1 @ 2;"), &out, &errOut, runOptions{Dump: dumpTokens, Format: formatText})
+	if status != 1 {
+		t.Errorf("wrong status. want=1, got=%d", status)
+	}
+	if !strings.Contains(out.String(), "1:11    ILLEGAL    @\n") {
+		t.Errorf("illegal token should be dumped. got=%q", out.String())
+	}
+	expected := "<stdin>:1:11: illegal token \"@\"\n"
+	if !strings.Contains(errOut.String(), expected) {
+		t.Errorf("stderr should contain %q. got=%q", expected, errOut.String())
+	}
+}
@@ -0,0 +1,80 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+)
+
+// 呼び出しの引数を評価する。名前付き引数は仮引数の名前に合わせて位置引数の並びに入れる
+// エラーの場合はそのエラーだけを含むスライスを返す
+func (e *Evaluator) evalCallArguments(fn object.Object, node *ast.CallExpression, env *object.Environment) []object.Object {
+	args := e.evalExpressions(node.Arguments, env)
+	if len(node.Names) == 0 || (len(args) == 1 && isError(args[0])) {
+		return args
+	}
+
+	switch fn := fn.(type) {
+	case *object.Function:
+		return e.bindNamedArguments(fn, node, args, env)
+	case *object.Builtin:
+		return []object.Object{argumentError(object.TypeError, node.Names[0].Token, "%s: named arguments are not supported by builtin functions", fn.Name)}
+	case object.Callable:
+		return []object.Object{argumentError(object.TypeError, node.Names[0].Token, "named arguments are not supported by %s", object.TypeName(fn.Type()))}
+	default:
+		// 関数でないことは applyFunction が報告する
+		return args
+	}
+}
+
+// 位置引数 args の後に名前付き引数を評価し、fn の仮引数の順に並べる
+// 名前付き引数は記述した順に評価してから、仮引数に割り当てる
+func (e *Evaluator) bindNamedArguments(fn *object.Function, node *ast.CallExpression, args []object.Object, env *object.Environment) []object.Object {
+	if len(args) > len(fn.Parameters) {
+		return []object.Object{argumentError(object.ArityError, callSite(node), "wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args)+len(node.Names))}
+	}
+
+	values := make([]object.Object, len(node.Names))
+	for i, name := range node.Names {
+		values[i] = e.eval(node.NamedArguments[name.Value], env)
+		if isError(values[i]) {
+			return []object.Object{values[i]}
+		}
+	}
+
+	bound := make([]object.Object, len(fn.Parameters))
+	copy(bound, args)
+	for i, name := range node.Names {
+		position := parameterIndex(fn, name.Value)
+		if position < 0 {
+			return []object.Object{argumentError(object.ArityError, name.Token, "unknown named argument: %s", name.Value)}
+		}
+		if position < len(args) {
+			return []object.Object{argumentError(object.ArityError, name.Token, "argument %s is already given by position", name.Value)}
+		}
+		bound[position] = values[i]
+	}
+	for i, value := range bound {
+		if value == nil {
+			return []object.Object{argumentError(object.ArityError, callSite(node), "missing argument: %s", fn.Parameters[i].Value)}
+		}
+	}
+	return bound
+}
+
+// 仮引数 name の位置を返す。ない場合は -1
+func parameterIndex(fn *object.Function, name string) int {
+	for i, param := range fn.Parameters {
+		if param.Value == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// tok の位置で起きた引数のエラーを返す
+func argumentError(kind object.ErrorKind, tok token.Token, format string, a ...interface{}) *object.Error {
+	err := newError(kind, format, a...)
+	err.Line, err.Column = tok.Line, tok.Column
+	return err
+}
@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+	"monkey/object"
+)
+
+// 整数の演算結果がint64に収まらない場合は BigInteger に昇格し、収まる場合は Integer に戻す
+
+// 整数（Integer または BigInteger）かどうか
+func isInteger(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.INTEGER_OBJ || t == object.BIG_INTEGER_OBJ
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	if i, ok := obj.(*object.Integer); ok {
+		return big.NewInt(i.Value)
+	}
+	return obj.(*object.BigInteger).Value
+}
+
+// int64に収まれば Integer、収まらなければ BigInteger を返す
+func newInteger(n *big.Int) object.Object {
+	if n.IsInt64() {
+		return object.NewInteger(n.Int64())
+	}
+	return &object.BigInteger{Value: n}
+}
+
+// 桁あふれする場合はokがfalse
+func addInt64(a, b int64) (sum int64, ok bool) {
+	sum = a + b
+	return sum, (a^sum)&(b^sum) >= 0
+}
+
+func subInt64(a, b int64) (diff int64, ok bool) {
+	diff = a - b
+	return diff, (a^b)&(a^diff) >= 0
+}
+
+func mulInt64(a, b int64) (product int64, ok bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	product = a * b
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return product, false
+	}
+	return product, product/b == a
+}
+
+// 少なくとも一方が BigInteger の整数どうしの演算
+func evalBigIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toBigInt(left)
+	rightVal := toBigInt(right)
+
+	switch operator {
+	case "+":
+		return newInteger(new(big.Int).Add(leftVal, rightVal))
+	case "-":
+		return newInteger(new(big.Int).Sub(leftVal, rightVal))
+	case "*":
+		return newInteger(new(big.Int).Mul(leftVal, rightVal))
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newError(object.DivisionByZero, "division by zero")
+		}
+		// int64の除算と同じく0方向に切り捨てる
+		return newInteger(new(big.Int).Quo(leftVal, rightVal))
+	case "<":
+		return nativeBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "==":
+		return nativeBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// 整数の符号を反転する
+func negateInteger(obj object.Object) object.Object {
+	if i, ok := obj.(*object.Integer); ok && i.Value != math.MinInt64 {
+		return object.NewInteger(-i.Value)
+	}
+	return newInteger(new(big.Int).Neg(toBigInt(obj)))
+}
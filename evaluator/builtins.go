@@ -0,0 +1,1498 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"monkey/object"
+	"monkey/token"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var builtins = map[string]*object.Builtin{
+	"len": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			err := object.CheckArgs("len", args, object.Arg(object.STRING_OBJ, object.ARRAY_OBJ, object.HASH_OBJ, object.SET_OBJ, object.RANGE_OBJ, object.STRING_BUILDER_OBJ))
+			if err != nil {
+				return err
+			}
+			switch arg := args[0].(type) {
+			case *object.String:
+				return object.NewInteger(int64(len(arg.Value)))
+			case *object.StringBuilder:
+				return object.NewInteger(int64(arg.Len()))
+			case *object.Hash:
+				return object.NewInteger(int64(len(arg.Pairs)))
+			case *object.Set:
+				return object.NewInteger(int64(len(arg.Elements)))
+			case *object.Range:
+				return object.NewInteger(arg.Len())
+			default:
+				return object.NewInteger(int64(len(arg.(*object.Array).Elements)))
+			}
+		},
+	},
+	"first": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("first", args, object.Arg(object.ARRAY_OBJ, object.STRING_OBJ)); err != nil {
+				return err
+			}
+			return edgeElement(args[0], false, NULL)
+		},
+	},
+	"firstOr": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("firstOr", args, object.Arg(object.ARRAY_OBJ, object.STRING_OBJ), object.Arg()); err != nil {
+				return err
+			}
+			return edgeElement(args[0], false, args[1])
+		},
+	},
+	"last": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("last", args, object.Arg(object.ARRAY_OBJ, object.STRING_OBJ)); err != nil {
+				return err
+			}
+			return edgeElement(args[0], true, NULL)
+		},
+	},
+	"lastOr": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("lastOr", args, object.Arg(object.ARRAY_OBJ, object.STRING_OBJ), object.Arg()); err != nil {
+				return err
+			}
+			return edgeElement(args[0], true, args[1])
+		},
+	},
+	"rest": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("rest", args, object.Arg(object.ARRAY_OBJ, object.STRING_OBJ)); err != nil {
+				return err
+			}
+			// 空の場合もnullではなく空の配列・文字列を返す（再帰で扱いやすくするため）
+			switch arg := args[0].(type) {
+			case *object.Array:
+				length := len(arg.Elements)
+				if length == 0 {
+					return &object.Array{Elements: []object.Object{}}
+				}
+				newElements := make([]object.Object, length-1, length-1) // 初期サイズlength-1のスライスを確保する
+				copy(newElements, arg.Elements[1:length])
+				return &object.Array{Elements: newElements}
+			default:
+				runes := []rune(arg.(*object.String).Value)
+				if len(runes) == 0 {
+					return &object.String{Value: ""}
+				}
+				return &object.String{Value: string(runes[1:])}
+			}
+		},
+	},
+	"push": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("push", args, object.Arg(object.ARRAY_OBJ), object.Arg()); err != nil {
+				return err
+			}
+			array := args[0].(*object.Array)
+			length := len(array.Elements)
+			newElements := make([]object.Object, length+1, length+1)
+			copy(newElements, array.Elements)
+			newElements[length] = args[1]
+			return &object.Array{Elements: newElements}
+		},
+	},
+	"append": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("append", args, object.Arg(object.ARRAY_OBJ, object.STRING_BUILDER_OBJ), object.Arg()); err != nil {
+				return withRangeHint(err, args[0])
+			}
+			if sb, ok := args[0].(*object.StringBuilder); ok {
+				return appendString(sb, args[1])
+			}
+			// pushと違い、元の配列そのものを書き換えて返す
+			array := args[0].(*object.Array)
+			if err := checkNotFrozen("append", array); err != nil {
+				return err
+			}
+			array.Elements = append(array.Elements, args[1])
+			return array
+		},
+	},
+	"builder": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("builder", args, object.OptionalArg(object.STRING_OBJ)); err != nil {
+				return err
+			}
+			sb := &object.StringBuilder{}
+			if len(args) == 1 {
+				sb.WriteString(args[0].(*object.String).Value)
+			}
+			return sb
+		},
+	},
+	"build": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("build", args, object.Arg(object.STRING_BUILDER_OBJ)); err != nil {
+				return err
+			}
+			// 後で書き足しても、返した文字列は変わらない
+			return &object.String{Value: args[0].(*object.StringBuilder).String()}
+		},
+	},
+	// padLeft(s, width) と padRight(s, width) は s が width 文字（rune）以上になるよう埋める
+	// 3番目の引数で埋める1文字を指定できる（省略時は空白）
+	"padLeft": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			return pad("padLeft", args, true)
+		},
+	},
+	"padRight": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			return pad("padRight", args, false)
+		},
+	},
+	"repeat": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("repeat", args, object.Arg(object.STRING_OBJ), object.Arg(object.INTEGER_OBJ)); err != nil {
+				return err
+			}
+			s := args[0].(*object.String).Value
+			// 負の回数は0回として扱う
+			count := args[1].(*object.Integer).Value
+			if count <= 0 || s == "" {
+				return &object.String{Value: ""}
+			}
+			if count > maxStringLength/int64(len(s)) {
+				return object.ArgError(object.LimitError, "repeat", 2, "is too large: the result would be longer than %d bytes", maxStringLength)
+			}
+			return &object.String{Value: strings.Repeat(s, int(count))}
+		},
+	},
+	// 大文字と小文字を区別しない比較は Go の strings.EqualFold と同じ Unicode の単純な大文字小文字変換で行う
+	// 言語（ロケール）によらないので、トルコ語の "İ" と "i" は等しくない
+	"equalsFold": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("equalsFold", args, object.Arg(object.STRING_OBJ), object.Arg(object.STRING_OBJ)); err != nil {
+				return err
+			}
+			return nativeBooleanObject(strings.EqualFold(args[0].(*object.String).Value, args[1].(*object.String).Value))
+		},
+	},
+	"containsFold": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("containsFold", args, object.Arg(object.STRING_OBJ), object.Arg(object.STRING_OBJ)); err != nil {
+				return err
+			}
+			return nativeBooleanObject(strings.Contains(foldCase(args[0].(*object.String).Value), foldCase(args[1].(*object.String).Value)))
+		},
+	},
+	// compare(a, b) は a が b より前なら -1、等しければ 0、後なら 1 を返す。バイト列として比べる
+	"compare": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("compare", args, object.Arg(object.STRING_OBJ), object.Arg(object.STRING_OBJ)); err != nil {
+				return err
+			}
+			return object.NewInteger(int64(strings.Compare(args[0].(*object.String).Value, args[1].(*object.String).Value)))
+		},
+	},
+	// 識別子に!を使えないため、pop!ではなくpopを破壊的な版とし、非破壊的な版をdropLastとする
+	"pop": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("pop", args, object.Arg(object.ARRAY_OBJ)); err != nil {
+				return withRangeHint(err, args...)
+			}
+			array := args[0].(*object.Array)
+			if err := checkNotFrozen("pop", array); err != nil {
+				return err
+			}
+			length := len(array.Elements)
+			if length == 0 {
+				return object.ArgError(object.IndexError, "pop", 1, "must be non-empty array, got empty array")
+			}
+			last := array.Elements[length-1]
+			array.Elements[length-1] = nil // 参照を残さない
+			array.Elements = array.Elements[:length-1]
+			return last
+		},
+	},
+	"dropLast": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("dropLast", args, object.Arg(object.ARRAY_OBJ)); err != nil {
+				return err
+			}
+			// popと違い、元の配列は書き換えずに末尾を除いた新しい配列を返す
+			array := args[0].(*object.Array)
+			length := len(array.Elements)
+			if length == 0 {
+				return object.ArgError(object.IndexError, "dropLast", 1, "must be non-empty array, got empty array")
+			}
+			newElements := make([]object.Object, length-1)
+			copy(newElements, array.Elements)
+			return &object.Array{Elements: newElements}
+		},
+	},
+	// flatten(arr) は要素の配列を1段展開する。flatten(arr, depth) は depth 段まで展開し、負の depth ではすべて展開する
+	"flatten": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("flatten", args, object.Arg(object.ARRAY_OBJ), object.OptionalArg(object.INTEGER_OBJ)); err != nil {
+				return err
+			}
+			depth := int64(1)
+			if len(args) == 2 {
+				depth = args[1].(*object.Integer).Value
+			}
+			elements, err := flatten(args[0].(*object.Array), depth, []object.Object{}, map[*object.Array]bool{})
+			if err != nil {
+				return err
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	// 要素をハッシュのキーとして比べるので、ハッシュのキーに使えない要素があるとエラーになる
+	"unique": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("unique", args, object.Arg(object.ARRAY_OBJ)); err != nil {
+				return err
+			}
+			seen := map[object.HashKey]bool{}
+			elements := []object.Object{}
+			for _, el := range args[0].(*object.Array).Elements {
+				hashable, ok := el.(object.Hashable)
+				if !ok {
+					return object.ArgError(object.TypeError, "unique", 1, "must contain only hashable elements, got %s", object.TypeName(el.Type()))
+				}
+				// 最初に現れたものを残す
+				if key := hashable.HashKey(); !seen[key] {
+					seen[key] = true
+					elements = append(elements, el)
+				}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	// zip(a, b, ...) は各配列の同じ位置の要素をまとめた配列の配列を返す。長さは最も短い配列に合わせる
+	"zip": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("zip", args, object.VariadicArg(object.ARRAY_OBJ)); err != nil {
+				return err
+			}
+			length := -1
+			for _, arg := range args {
+				if n := len(arg.(*object.Array).Elements); length < 0 || n < length {
+					length = n
+				}
+			}
+			tuples := make([]object.Object, 0, length+1)
+			for i := 0; i < length; i++ {
+				tuple := make([]object.Object, len(args))
+				for j, arg := range args {
+					tuple[j] = arg.(*object.Array).Elements[i]
+				}
+				tuples = append(tuples, &object.Array{Elements: tuple})
+			}
+			return &object.Array{Elements: tuples}
+		},
+	},
+	// concat(a, b, ...) は配列をつなげた新しい配列を返す
+	"concat": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("concat", args, object.VariadicArg(object.ARRAY_OBJ)); err != nil {
+				return err
+			}
+			elements := []object.Object{}
+			for _, arg := range args {
+				elements = append(elements, arg.(*object.Array).Elements...)
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"contains": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			err := object.CheckArgs("contains", args,
+				object.Arg(object.STRING_OBJ, object.ARRAY_OBJ, object.HASH_OBJ, object.RANGE_OBJ), object.Arg())
+			if err != nil {
+				return err
+			}
+			switch container := args[0].(type) {
+			case *object.Range:
+				n, ok := args[1].(*object.Integer)
+				return nativeBooleanObject(ok && container.Contains(n.Value))
+			case *object.String:
+				if err := object.CheckArgType("contains", 2, args[1], object.STRING_OBJ); err != nil {
+					return err
+				}
+				return nativeBooleanObject(strings.Contains(container.Value, args[1].(*object.String).Value))
+			case *object.Array:
+				for _, el := range container.Elements {
+					if objectsEqual(el, args[1]) {
+						return TRUE // 最初に一致した時点で打ち切る
+					}
+				}
+				return FALSE
+			default:
+				if err := object.CheckHashableArg("contains", 2, args[1]); err != nil {
+					return err
+				}
+				_, ok := container.(*object.Hash).Pairs[args[1].(object.Hashable).HashKey()]
+				return nativeBooleanObject(ok)
+			}
+		},
+	},
+	"get": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			err := object.CheckArgs("get", args,
+				object.Arg(object.HASH_OBJ, object.ARRAY_OBJ), object.Arg(), object.OptionalArg())
+			if err != nil {
+				return err
+			}
+			// キーが存在しない場合に返す値
+			var fallback object.Object = NULL
+			if len(args) == 3 {
+				fallback = args[2]
+			}
+
+			switch container := args[0].(type) {
+			case *object.Hash:
+				if err := object.CheckHashableArg("get", 2, args[1]); err != nil {
+					return err
+				}
+				// 値がnullでもキーが存在すればその値を返す
+				if pair, ok := container.Pairs[args[1].(object.Hashable).HashKey()]; ok {
+					return pair.Value
+				}
+				return fallback
+			default:
+				if err := object.CheckArgType("get", 2, args[1], object.INTEGER_OBJ); err != nil {
+					return err
+				}
+				elements := container.(*object.Array).Elements
+				index := args[1].(*object.Integer).Value
+				if index < 0 || int64(len(elements)) <= index {
+					return fallback
+				}
+				return elements[index]
+			}
+		},
+	},
+	"keys": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("keys", args, object.Arg(object.HASH_OBJ)); err != nil {
+				return err
+			}
+			pairs := args[0].(*object.Hash).OrderedPairs()
+			elements := make([]object.Object, len(pairs))
+			for i, pair := range pairs {
+				elements[i] = pair.Key
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"values": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("values", args, object.Arg(object.HASH_OBJ)); err != nil {
+				return err
+			}
+			pairs := args[0].(*object.Hash).OrderedPairs()
+			elements := make([]object.Object, len(pairs))
+			for i, pair := range pairs {
+				elements[i] = pair.Value
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"merge": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("merge", args, object.Arg(object.HASH_OBJ), object.Arg(object.HASH_OBJ)); err != nil {
+				return err
+			}
+			// 元のハッシュは書き換えない。両方にあるキーは2つ目の値を使い、位置は1つ目のものを保つ
+			merged := object.NewHash()
+			for _, arg := range args {
+				for _, pair := range arg.(*object.Hash).OrderedPairs() {
+					merged.Set(pair.Key, pair.Value)
+				}
+			}
+			return merged
+		},
+	},
+	"set": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			// set(arr) は配列の要素から、set(a, b, c) は引数から集合を作る
+			if len(args) == 1 {
+				if array, ok := args[0].(*object.Array); ok {
+					set := object.NewSet()
+					for _, el := range array.Elements {
+						if _, ok := el.(object.Hashable); !ok {
+							return object.ArgError(object.TypeError, "set", 1, "must contain only hashable values, got %s", object.TypeName(el.Type()))
+						}
+						set.Add(el)
+					}
+					return set
+				}
+			}
+			set := object.NewSet()
+			for i, arg := range args {
+				if err := object.CheckHashableArg("set", i+1, arg); err != nil {
+					return err
+				}
+				set.Add(arg)
+			}
+			return set
+		},
+	},
+	"add": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("add", args, object.Arg(object.SET_OBJ), object.Arg()); err != nil {
+				return err
+			}
+			if err := object.CheckHashableArg("add", 2, args[1]); err != nil {
+				return err
+			}
+			// appendと同じく、元の集合そのものを書き換えて返す
+			set := args[0].(*object.Set)
+			if err := checkNotFrozen("add", set); err != nil {
+				return err
+			}
+			set.Add(args[1])
+			return set
+		},
+	},
+	"has": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("has", args, object.Arg(object.SET_OBJ), object.Arg()); err != nil {
+				return err
+			}
+			if err := object.CheckHashableArg("has", 2, args[1]); err != nil {
+				return err
+			}
+			return nativeBooleanObject(args[0].(*object.Set).Has(args[1].(object.Hashable).HashKey()))
+		},
+	},
+	"remove": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("remove", args, object.Arg(object.SET_OBJ), object.Arg()); err != nil {
+				return err
+			}
+			if err := object.CheckHashableArg("remove", 2, args[1]); err != nil {
+				return err
+			}
+			// 元の集合そのものを書き換えて返す
+			set := args[0].(*object.Set)
+			if err := checkNotFrozen("remove", set); err != nil {
+				return err
+			}
+			set.Remove(args[1].(object.Hashable).HashKey())
+			return set
+		},
+	},
+	"union": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("union", args, object.Arg(object.SET_OBJ), object.Arg(object.SET_OBJ)); err != nil {
+				return err
+			}
+			result := object.NewSet()
+			for _, arg := range args {
+				for _, el := range arg.(*object.Set).Members() {
+					result.Add(el)
+				}
+			}
+			return result
+		},
+	},
+	"intersect": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("intersect", args, object.Arg(object.SET_OBJ), object.Arg(object.SET_OBJ)); err != nil {
+				return err
+			}
+			// 1つ目の集合の順序を保つ
+			other := args[1].(*object.Set)
+			result := object.NewSet()
+			for _, el := range args[0].(*object.Set).Members() {
+				if other.Has(el.(object.Hashable).HashKey()) {
+					result.Add(el)
+				}
+			}
+			return result
+		},
+	},
+	"toArray": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("toArray", args, object.Arg(object.SET_OBJ, object.RANGE_OBJ)); err != nil {
+				return err
+			}
+			if set, ok := args[0].(*object.Set); ok {
+				return &object.Array{Elements: set.Members()}
+			}
+			r := args[0].(*object.Range)
+			elements := make([]object.Object, 0, r.Len())
+			for i := int64(0); i < r.Len(); i++ {
+				value, _ := r.At(i)
+				elements = append(elements, object.NewInteger(value))
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"range": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			err := object.CheckArgs("range", args,
+				object.Arg(object.INTEGER_OBJ), object.OptionalArg(object.INTEGER_OBJ), object.OptionalArg(object.INTEGER_OBJ))
+			if err != nil {
+				return err
+			}
+			// range(stop), range(start, stop), range(start, stop, step)
+			r := &object.Range{Stop: args[0].(*object.Integer).Value, Step: 1}
+			if len(args) >= 2 {
+				r.Start, r.Stop = r.Stop, args[1].(*object.Integer).Value
+			}
+			if len(args) == 3 {
+				r.Step = args[2].(*object.Integer).Value
+				if r.Step == 0 {
+					return object.ArgError(object.ValueError, "range", 3, "must be non-zero")
+				}
+			}
+			return r
+		},
+	},
+	"pow": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			err := object.CheckArgs("pow", args,
+				object.Arg(object.INTEGER_OBJ, object.BIG_INTEGER_OBJ), object.Arg(object.INTEGER_OBJ))
+			if err != nil {
+				return err
+			}
+			exponent := args[1].(*object.Integer).Value
+			if exponent < 0 {
+				return object.ArgError(object.ValueError, "pow", 2, "must be non-negative, got %d", exponent)
+			}
+			return newInteger(new(big.Int).Exp(toBigInt(args[0]), big.NewInt(exponent), nil))
+		},
+	},
+	// 小数がないので整数だけを扱う。小数部はすべて0になるため丸めは起きない
+	"toFixed": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			err := object.CheckArgs("toFixed", args,
+				object.Arg(object.INTEGER_OBJ, object.BIG_INTEGER_OBJ), object.Arg(object.INTEGER_OBJ))
+			if err != nil {
+				return err
+			}
+			digits := args[1].(*object.Integer).Value
+			if err := checkDecimals("toFixed", 2, "", digits); err != nil {
+				return err
+			}
+			return &object.String{Value: formatInteger(toBigInt(args[0]), "", digits)}
+		},
+	},
+	// formatNumber(x, {"thousands": ",", "decimals": 2}) は3桁ごとの区切りと小数部の桁数を指定して整数を文字列にする
+	"formatNumber": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			err := object.CheckArgs("formatNumber", args,
+				object.Arg(object.INTEGER_OBJ, object.BIG_INTEGER_OBJ), object.OptionalArg(object.HASH_OBJ))
+			if err != nil {
+				return err
+			}
+			thousands, decimals := "", int64(0)
+			if len(args) == 2 {
+				for _, pair := range args[1].(*object.Hash).OrderedPairs() {
+					key, _ := pair.Key.(*object.String)
+					switch {
+					case key != nil && key.Value == "thousands":
+						sep, ok := pair.Value.(*object.String)
+						if !ok {
+							return object.ArgError(object.TypeError, "formatNumber", 2, "option thousands must be string, got %s", object.TypeName(pair.Value.Type()))
+						}
+						thousands = sep.Value
+					case key != nil && key.Value == "decimals":
+						n, ok := pair.Value.(*object.Integer)
+						if !ok {
+							return object.ArgError(object.TypeError, "formatNumber", 2, "option decimals must be integer, got %s", object.TypeName(pair.Value.Type()))
+						}
+						if err := checkDecimals("formatNumber", 2, "option decimals ", n.Value); err != nil {
+							return err
+						}
+						decimals = n.Value
+					default:
+						return object.ArgError(object.ValueError, "formatNumber", 2, "has unknown option %s (want thousands or decimals)", pair.Key.Inspect())
+					}
+				}
+			}
+			return &object.String{Value: formatInteger(toBigInt(args[0]), thousands, decimals)}
+		},
+	},
+	"exit": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("exit", args, object.OptionalArg(object.INTEGER_OBJ)); err != nil {
+				return err
+			}
+			code := int64(0)
+			if len(args) == 1 {
+				code = args[0].(*object.Integer).Value
+			}
+			if code < 0 || code > 255 {
+				return object.ArgError(object.ValueError, "exit", 1, "must be between 0 and 255, got %d", code)
+			}
+			return &object.Error{Message: fmt.Sprintf("exit(%d)", code), Exit: true, ExitCode: int(code)}
+		},
+	},
+	"error": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			// error(message) または error(kind, message)
+			if err := object.CheckArgs("error", args, object.Arg(object.STRING_OBJ), object.OptionalArg(object.STRING_OBJ)); err != nil {
+				return err
+			}
+			if len(args) == 1 {
+				return &object.Error{Kind: object.Custom, Message: args[0].(*object.String).Value}
+			}
+			kind := args[0].(*object.String).Value
+			if kind == "" {
+				return object.ArgError(object.ValueError, "error", 1, "must be non-empty string, got empty string")
+			}
+			return &object.Error{Kind: object.ErrorKind(kind), Message: args[1].(*object.String).Value}
+		},
+	},
+	"throw": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			// 任意の値を投げる。捕まえなければ値を Inspect したものがメッセージになる
+			if err := object.CheckArgs("throw", args, object.Arg()); err != nil {
+				return err
+			}
+			return &object.Error{Kind: object.Thrown, Message: args[0].Inspect(), Value: args[0]}
+		},
+	},
+	// assert(cond) と assert(cond, message) は cond が偽なら AssertionError を起こす
+	"assert": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("assert", args, object.Arg(), object.OptionalArg(object.STRING_OBJ)); err != nil {
+				return err
+			}
+			if isTruthy(args[0]) {
+				return NULL
+			}
+			message := "assertion failed"
+			if len(args) == 2 {
+				message = args[1].(*object.String).Value
+			}
+			return &object.Error{Kind: object.AssertionError, Message: message}
+		},
+	},
+	"errorKind": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			// try/catch で受け取ったエラーの種類を返す
+			if err := object.CheckArgs("errorKind", args, object.Arg(object.HASH_OBJ)); err != nil {
+				return err
+			}
+			kind, ok := args[0].(*object.Hash).Pairs[(&object.String{Value: "kind"}).HashKey()]
+			if !ok || kind.Value.Type() != object.STRING_OBJ {
+				return object.ArgError(object.ValueError, "errorKind", 1, "must be an error caught by try/catch, got hash without kind")
+			}
+			return kind.Value
+		},
+	},
+	"freeze": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("freeze", args, object.Arg()); err != nil {
+				return err
+			}
+			// 中の配列やハッシュも含めて凍結し、同じオブジェクトを返す
+			freeze(args[0])
+			return args[0]
+		},
+	},
+	"isFrozen": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("isFrozen", args, object.Arg()); err != nil {
+				return err
+			}
+			switch arg := args[0].(type) {
+			case *object.Array:
+				return nativeBooleanObject(arg.Frozen)
+			case *object.Hash:
+				return nativeBooleanObject(arg.Frozen)
+			case *object.Set:
+				return nativeBooleanObject(arg.Frozen)
+			case *object.StringBuilder:
+				return nativeBooleanObject(arg.Frozen)
+			default:
+				// それ以外の値はもともと書き換えられない
+				return TRUE
+			}
+		},
+	},
+	"clone": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("clone", args, object.Arg()); err != nil {
+				return err
+			}
+			return deepCopy(args[0], map[object.Object]bool{})
+		},
+	},
+	"type": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("type", args, object.Arg()); err != nil {
+				return err
+			}
+			// エラーメッセージと同じ小文字の型名を返す。組み込み関数は "builtin"、それ以外の関数は "function"
+			return &object.String{Value: object.TypeName(args[0].Type())}
+		},
+	},
+	"inspect": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("inspect", args, object.Arg(), object.OptionalArg(object.BOOLEAN_OBJ)); err != nil {
+				return err
+			}
+			// 第2引数がtrueなら関数の本体なども含めて表示し、長い配列やハッシュは複数行に分ける
+			if len(args) == 2 && args[1] == TRUE {
+				if verbose, ok := args[0].(object.VerboseInspector); ok {
+					return &object.String{Value: verbose.InspectVerbose()}
+				}
+				return &object.String{Value: object.Pretty(args[0], object.PrettyWidth)}
+			}
+			return &object.String{Value: args[0].Inspect()}
+		},
+	},
+	"eval": newEvaluatorBuiltin((*Evaluator).evalSource),
+	"map": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		if err := object.CheckArgs("map", args, object.Arg(), object.Arg(object.FUNCTION_OBJ, object.BUILTIN_OBJ)); err != nil {
+			return err
+		}
+		if err := object.CheckIterableArg("map", 1, args[0]); err != nil {
+			return err
+		}
+		result := []object.Object{}
+		it := args[0].(object.Iterable).Iter()
+		for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+			mapped := e.callFunction(call, args[1], callbackArgs(args[1], key, value)...)
+			if isError(mapped) {
+				return mapped
+			}
+			result = append(result, mapped)
+		}
+		return &object.Array{Elements: result}
+	}),
+	"filter": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		if err := object.CheckArgs("filter", args, object.Arg(), object.Arg(object.FUNCTION_OBJ, object.BUILTIN_OBJ)); err != nil {
+			return err
+		}
+		if err := object.CheckIterableArg("filter", 1, args[0]); err != nil {
+			return err
+		}
+		result := []object.Object{}
+		it := args[0].(object.Iterable).Iter()
+		for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+			keep := e.callFunction(call, args[1], callbackArgs(args[1], key, value)...)
+			if isError(keep) {
+				return keep
+			}
+			if isTruthy(keep) {
+				result = append(result, value)
+			}
+		}
+		return &object.Array{Elements: result}
+	}),
+	"reduce": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		err := object.CheckArgs("reduce", args, object.Arg(), object.Arg(), object.Arg(object.FUNCTION_OBJ, object.BUILTIN_OBJ))
+		if err != nil {
+			return err
+		}
+		if err := object.CheckIterableArg("reduce", 1, args[0]); err != nil {
+			return err
+		}
+		// reduce(xs, initial, fn(acc, value)) 。fnが3つ以上の引数を取る場合はキーも渡す
+		acc := args[1]
+		it := args[0].(object.Iterable).Iter()
+		for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+			fnArgs := []object.Object{acc, value}
+			if function, ok := args[2].(*object.Function); ok && len(function.Parameters) >= 3 {
+				fnArgs = append(fnArgs, key)
+			}
+			acc = e.callFunction(call, args[2], fnArgs...)
+			if isError(acc) {
+				return acc
+			}
+		}
+		return acc
+	}),
+	// groupBy(xs, fn) は fn の結果をキーとし、その結果になった要素の配列を値とするハッシュを返す
+	// キーは最初に現れた順に、各配列の要素は元の順に並ぶ
+	"groupBy": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		return e.groupElements("groupBy", call, args, func(group object.Object, value object.Object) object.Object {
+			if group == nil {
+				return &object.Array{Elements: []object.Object{value}}
+			}
+			array := group.(*object.Array)
+			array.Elements = append(array.Elements, value)
+			return array
+		})
+	}),
+	// countBy(xs, fn) は fn の結果をキーとし、その結果になった要素の個数を値とするハッシュを返す
+	"countBy": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		return e.groupElements("countBy", call, args, func(count object.Object, value object.Object) object.Object {
+			if count == nil {
+				return object.NewInteger(1)
+			}
+			return object.NewInteger(count.(*object.Integer).Value + 1)
+		})
+	}),
+	// every(xs, fn) はすべての要素で fn が真になればtrueを返す（空ならtrue）
+	// 偽になった要素があればそこで打ち切り、残りの要素では fn を呼ばない
+	"every": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		found, _, err := e.findElement("every", call, args, false)
+		if err != nil {
+			return err
+		}
+		return nativeBooleanObject(found == nil)
+	}),
+	// any(xs, fn) はいずれかの要素で fn が真になればtrueを返す（空ならfalse）
+	// 真になった要素があればそこで打ち切る
+	"any": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		found, _, err := e.findElement("any", call, args, true)
+		if err != nil {
+			return err
+		}
+		return nativeBooleanObject(found != nil)
+	}),
+	// find(xs, fn) は fn が真になる最初の要素を返す。見つからなければnull（3番目の引数があればその値）を返す
+	// 2つ以上の引数を取る fn には each と同じく fn(キー, 値) の順に渡す
+	"find": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		err := object.CheckArgs("find", args, object.Arg(), object.Arg(object.FUNCTION_OBJ, object.BUILTIN_OBJ), object.OptionalArg())
+		if err != nil {
+			return err
+		}
+		found, _, callErr := e.findElement("find", call, args[:2], true)
+		switch {
+		case callErr != nil:
+			return callErr
+		case found != nil:
+			return found
+		case len(args) == 3:
+			return args[2]
+		default:
+			return NULL
+		}
+	}),
+	// findIndex(arr, fn) は fn が真になる最初の要素の位置を返す。見つからなければ-1を返す
+	// 2つ以上の引数を取る fn には fn(位置, 値) の順に渡す
+	"findIndex": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		err := object.CheckArgs("findIndex", args, object.Arg(object.ARRAY_OBJ), object.Arg(object.FUNCTION_OBJ, object.BUILTIN_OBJ))
+		if err != nil {
+			return err
+		}
+		found, index, callErr := e.findElement("findIndex", call, args, true)
+		switch {
+		case callErr != nil:
+			return callErr
+		case found != nil:
+			return index
+		default:
+			return object.NewInteger(-1)
+		}
+	}),
+	// sortBy(arr, fn) は fn が返すキー（整数か文字列）の順に並べた新しい配列を返す。3番目の引数がtrueなら降順
+	// キーは要素ごとに一度だけ求める。キーが等しい要素は元の順に並ぶ
+	"sortBy": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		err := object.CheckArgs("sortBy", args,
+			object.Arg(object.ARRAY_OBJ), object.Arg(object.FUNCTION_OBJ, object.BUILTIN_OBJ), object.OptionalArg(object.BOOLEAN_OBJ))
+		if err != nil {
+			return err
+		}
+		elements := args[0].(*object.Array).Elements
+		keys := make([]object.Object, len(elements))
+		for i, el := range elements {
+			key := e.callFunction(call, args[1], callbackArgs(args[1], object.NewInteger(int64(i)), el)...)
+			if isError(key) {
+				return key
+			}
+			if key.Type() != object.INTEGER_OBJ && key.Type() != object.STRING_OBJ {
+				return newError(object.TypeError, "sortBy: key of element %d must be integer or string, got %s", i, object.TypeName(key.Type()))
+			}
+			if i > 0 && key.Type() != keys[0].Type() {
+				return newError(object.TypeError, "sortBy: key of element %d is %s, but the keys before it are %s",
+					i, object.TypeName(key.Type()), object.TypeName(keys[0].Type()))
+			}
+			keys[i] = key
+		}
+
+		descending := len(args) == 3 && args[2] == TRUE
+		order := make([]int, len(elements))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			if descending {
+				return keyLess(keys[order[j]], keys[order[i]])
+			}
+			return keyLess(keys[order[i]], keys[order[j]])
+		})
+		sorted := make([]object.Object, len(elements))
+		for i, index := range order {
+			sorted[i] = elements[index]
+		}
+		return &object.Array{Elements: sorted}
+	}),
+	// each(xs, fn) は要素ごとに fn を呼び、nullを返す。fn のエラーでそこで打ち切る
+	// 2つ以上の引数を取る fn には、map などと違い every・any・find と同じ fn(キー, 値) の順に渡す（配列と文字列のキーは位置）
+	"each": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		if err := object.CheckArgs("each", args, object.Arg(), object.Arg(object.FUNCTION_OBJ, object.BUILTIN_OBJ)); err != nil {
+			return err
+		}
+		if err := object.CheckIterableArg("each", 1, args[0]); err != nil {
+			return err
+		}
+		it := args[0].(object.Iterable).Iter()
+		for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+			if result := e.callFunction(call, args[1], keyValueArgs(args[1], key, value)...); isError(result) {
+				return result
+			}
+		}
+		return NULL
+	}),
+	"vars": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		if err := object.CheckArgs("vars", args, object.OptionalArg(object.BOOLEAN_OBJ)); err != nil {
+			return err
+		}
+		// vars() は呼び出し元のスコープの束縛を、vars(true) は外側のスコープも含めて名前順のハッシュで返す
+		// 組み込み関数は環境に束縛されていないので含まない
+		includeOuter := len(args) == 1 && args[0] == TRUE
+		all := call.env.All(includeOuter)
+		names := make([]string, 0, len(all))
+		for name := range all {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		hash := object.NewHash()
+		for _, name := range names {
+			hash.Set(&object.String{Value: name}, all[name])
+		}
+		return hash
+	}),
+	"spawn": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		if err := object.CheckArgs("spawn", args, object.Arg(object.FUNCTION_OBJ)); err != nil {
+			return err
+		}
+		fn := args[0].(*object.Function)
+		if len(fn.Parameters) != 0 {
+			return object.ArgError(object.ArityError, "spawn", 1, "must take no arguments, got %d parameters", len(fn.Parameters))
+		}
+		return e.spawn(call, fn)
+	}),
+	"test": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		if err := object.CheckArgs("test", args, object.Arg(object.STRING_OBJ), object.Arg(object.FUNCTION_OBJ)); err != nil {
+			return err
+		}
+		name := args[0].(*object.String).Value
+		fn := args[1].(*object.Function)
+		if len(fn.Parameters) != 0 {
+			return object.ArgError(object.ArityError, "test", 2, "must take no arguments, got %d parameters", len(fn.Parameters))
+		}
+		for _, t := range e.tests {
+			if t.name == name {
+				return object.ArgError(object.ValueError, "test", 1, "must be a new test name, got %q twice", name)
+			}
+		}
+		e.tests = append(e.tests, registeredTest{name: name, fn: fn})
+		return NULL
+	}),
+	"runTests": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		if err := object.CheckArgs("runTests", args); err != nil {
+			return err
+		}
+		failed, exit := e.runTests(call.site)
+		if exit != nil {
+			return exit
+		}
+		return object.NewInteger(int64(failed))
+	}),
+	"wait": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		if err := object.CheckArgs("wait", args, object.Arg(object.TASK_OBJ)); err != nil {
+			return err
+		}
+		return e.wait(args[0].(*object.Task))
+	}),
+	"channel": &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if err := object.CheckArgs("channel", args, object.OptionalArg(object.INTEGER_OBJ)); err != nil {
+				return err
+			}
+			var size int64
+			if len(args) == 1 {
+				size = args[0].(*object.Integer).Value
+			}
+			if size < 0 || size > maxChannelSize {
+				return object.ArgError(object.ValueError, "channel", 1, "must be between 0 and %d, got %d", maxChannelSize, size)
+			}
+			return &object.Channel{Values: make(chan object.Object, size)}
+		},
+	},
+	"send": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		if err := object.CheckArgs("send", args, object.Arg(object.CHANNEL_OBJ), object.Arg()); err != nil {
+			return err
+		}
+		return e.send(args[0].(*object.Channel), args[1])
+	}),
+	"recv": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		if err := object.CheckArgs("recv", args, object.Arg(object.CHANNEL_OBJ)); err != nil {
+			return err
+		}
+		return e.recv(args[0].(*object.Channel))
+	}),
+	"puts": newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		return writeLines(e.out, args)
+	}),
+}
+
+// BuiltinNames は標準の組み込み関数の名前を名前順に返す
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupBuiltin は標準の組み込み関数 name を返す
+// 評価器を使う組み込み関数（map や eval など）の Fn は、呼び出すとエラーを返す。ただし puts の Fn は標準出力に書く
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// evaluatorBuiltinFunction は評価器と呼び出し元の情報を使う組み込み関数の本体
+// evalや、引数の関数を呼び出すmapなどに使う
+type evaluatorBuiltinFunction func(e *Evaluator, call builtinCall, args ...object.Object) object.Object
+
+// builtinCall は組み込み関数の呼び出し元の情報
+type builtinCall struct {
+	// 呼び出し元の環境
+	env *object.Environment
+	// 呼び出し箇所
+	site token.Token
+}
+
+// 評価器を使う組み込み関数の本体。applyFunction が Fn の代わりに呼ぶ
+var evaluatorBuiltins = map[*object.Builtin]evaluatorBuiltinFunction{}
+
+// newEvaluatorBuiltin は評価器を使う組み込み関数を生成する
+// 生成した組み込み関数の Fn を評価器の外から直接呼ぶとエラーを返す
+func newEvaluatorBuiltin(fn evaluatorBuiltinFunction) *object.Builtin {
+	builtin := &object.Builtin{}
+	builtin.Fn = func(args ...object.Object) object.Object {
+		return newError(object.TypeError, "%s: cannot be called outside of the evaluator", builtin.Name)
+	}
+	evaluatorBuiltins[builtin] = fn
+	return builtin
+}
+
+// 関数fnをcallの呼び出し箇所から呼び出す
+func (e *Evaluator) callFunction(call builtinCall, fn object.Object, args ...object.Object) object.Object {
+	return e.applyFunction(fn, args, call.site, call.env)
+}
+
+// args[0] の要素を順に args[1] に渡し、結果の真偽が want になった最初の要素とそのキーを返す
+// args[1] が2つ以上の引数を取るなら each と同じくキー、値の順に渡す
+// 見つかった時点で打ち切る。見つからなければ要素は nil
+func (e *Evaluator) findElement(name string, call builtinCall, args []object.Object, want bool) (element, key object.Object, err object.Object) {
+	if err := object.CheckArgs(name, args, object.Arg(), object.Arg(object.FUNCTION_OBJ, object.BUILTIN_OBJ)); err != nil {
+		return nil, nil, err
+	}
+	if err := object.CheckIterableArg(name, 1, args[0]); err != nil {
+		return nil, nil, err
+	}
+	it := args[0].(object.Iterable).Iter()
+	for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+		result := e.callFunction(call, args[1], keyValueArgs(args[1], key, value)...)
+		if isError(result) {
+			return nil, nil, result
+		}
+		if isTruthy(result) == want {
+			return value, key, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// groupBy と countBy の本体。args[0] の要素ごとに args[1] を呼んだ結果をキーにし、
+// そのキーの値を add(今の値, 要素) で更新したハッシュを返す。今の値はキーが初めて現れたときは nil
+func (e *Evaluator) groupElements(name string, call builtinCall, args []object.Object, add func(current, value object.Object) object.Object) object.Object {
+	if err := object.CheckArgs(name, args, object.Arg(), object.Arg(object.FUNCTION_OBJ, object.BUILTIN_OBJ)); err != nil {
+		return err
+	}
+	if err := object.CheckIterableArg(name, 1, args[0]); err != nil {
+		return err
+	}
+	groups := object.NewHash()
+	it := args[0].(object.Iterable).Iter()
+	for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+		groupKey := e.callFunction(call, args[1], callbackArgs(args[1], key, value)...)
+		if isError(groupKey) {
+			return groupKey
+		}
+		hashable, ok := groupKey.(object.Hashable)
+		if !ok {
+			return newError(object.TypeError, "%s: callback must return a hashable value, got %s", name, object.TypeName(groupKey.Type()))
+		}
+		var current object.Object
+		if pair, ok := groups.Pairs[hashable.HashKey()]; ok {
+			current = pair.Value
+		}
+		groups.Set(groupKey, add(current, value))
+	}
+	return groups
+}
+
+// map・filter・sortBy・groupBy のコールバックに渡す引数。2つ以上の引数を取る関数には値とキーを、それ以外には値だけを渡す
+func callbackArgs(fn object.Object, key, value object.Object) []object.Object {
+	if function, ok := fn.(*object.Function); ok && len(function.Parameters) >= 2 {
+		return []object.Object{value, key}
+	}
+	return []object.Object{value}
+}
+
+// each・every・any・find・findIndex のコールバックに渡す引数
+// 2つ以上の引数を取る関数にはキーと値を（配列と文字列のキーは位置）、それ以外には値だけを渡す
+func keyValueArgs(fn object.Object, key, value object.Object) []object.Object {
+	if function, ok := fn.(*object.Function); ok && len(function.Parameters) >= 2 {
+		return []object.Object{key, value}
+	}
+	return []object.Object{value}
+}
+
+func init() {
+	for name, builtin := range builtins {
+		builtin.Name = name
+	}
+	// VMなど評価器の外から呼んだ puts は標準出力に書く
+	builtins["puts"].Fn = func(args ...object.Object) object.Object {
+		return writeLines(os.Stdout, args)
+	}
+}
+
+// 引数を1行に1つずつ w に書き、NULLを返す
+func writeLines(w io.Writer, args []object.Object) object.Object {
+	for _, arg := range args {
+		fmt.Fprintln(w, arg.Inspect())
+	}
+	return NULL
+}
+
+// 配列・ハッシュ・集合を再帰的に凍結する。凍結済みのものはたどらないので循環していてもよい
+func freeze(obj object.Object) {
+	switch obj := obj.(type) {
+	case *object.Array:
+		if obj.Frozen {
+			return
+		}
+		obj.Frozen = true
+		for _, el := range obj.Elements {
+			freeze(el)
+		}
+	case *object.Hash:
+		if obj.Frozen {
+			return
+		}
+		obj.Frozen = true
+		for _, pair := range obj.Pairs {
+			freeze(pair.Value)
+		}
+	case *object.Set:
+		// 要素は不変なオブジェクトだけ
+		obj.Frozen = true
+	case *object.StringBuilder:
+		obj.Frozen = true
+	}
+}
+
+// appendString は append(b, s) で sb に s を書き足し、sb を返す
+func appendString(sb *object.StringBuilder, arg object.Object) object.Object {
+	if err := checkNotFrozen("append", sb); err != nil {
+		return err
+	}
+	str, ok := arg.(*object.String)
+	if !ok {
+		return object.ArgError(object.TypeError, "append", 2, "must be string when appending to a string_builder, got %s", object.TypeName(arg.Type()))
+	}
+	sb.WriteString(str.Value)
+	return sb
+}
+
+// 書き換えようとしているオブジェクトが凍結されていればエラーを返す
+func checkNotFrozen(name string, obj object.Object) *object.Error {
+	frozen := false
+	switch obj := obj.(type) {
+	case *object.Array:
+		frozen = obj.Frozen
+	case *object.Hash:
+		frozen = obj.Frozen
+	case *object.Set:
+		frozen = obj.Frozen
+	case *object.StringBuilder:
+		frozen = obj.Frozen
+	}
+	if frozen {
+		return newError(object.TypeError, "%s: cannot modify frozen %s", name, object.TypeName(obj.Type()))
+	}
+	return nil
+}
+
+// 配列を書き換える組み込み関数に範囲を渡した場合、エラーに配列へ変換する方法を書き添える
+func withRangeHint(err *object.Error, args ...object.Object) *object.Error {
+	if len(args) > 0 && args[0].Type() == object.RANGE_OBJ {
+		err.Message += "; convert the range with toArray first"
+	}
+	return err
+}
+
+// 2つのオブジェクトが値として等しいかを判定する（配列やハッシュは要素ごとに比較する）
+func objectsEqual(left, right object.Object) bool {
+	if left.Type() != right.Type() {
+		return false
+	}
+
+	switch l := left.(type) {
+	case *object.Integer:
+		return l.Value == right.(*object.Integer).Value
+	case *object.BigInteger:
+		return l.Value.Cmp(right.(*object.BigInteger).Value) == 0
+	case *object.String:
+		return l.Value == right.(*object.String).Value
+	case *object.Boolean:
+		return l.Value == right.(*object.Boolean).Value
+	case *object.Null:
+		return true
+	case *object.Array:
+		r := right.(*object.Array)
+		if len(l.Elements) != len(r.Elements) {
+			return false
+		}
+		for i, el := range l.Elements {
+			if !objectsEqual(el, r.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Range:
+		r := right.(*object.Range)
+		return l.Start == r.Start && l.Stop == r.Stop && l.Step == r.Step
+	case *object.Set:
+		r := right.(*object.Set)
+		if len(l.Elements) != len(r.Elements) {
+			return false
+		}
+		for key := range l.Elements {
+			if !r.Has(key) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		r := right.(*object.Hash)
+		if len(l.Pairs) != len(r.Pairs) {
+			return false
+		}
+		for key, pair := range l.Pairs {
+			other, ok := r.Pairs[key]
+			if !ok || !objectsEqual(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return left == right
+	}
+}
+
+// 配列または文字列の先頭（fromEndがtrueなら末尾）の要素を返す。空の場合はfallbackを返す
+// 文字列の要素は1文字（rune）の文字列とする
+func edgeElement(arg object.Object, fromEnd bool, fallback object.Object) object.Object {
+	if array, ok := arg.(*object.Array); ok {
+		length := len(array.Elements)
+		if length == 0 {
+			return fallback
+		}
+		if fromEnd {
+			return array.Elements[length-1]
+		}
+		return array.Elements[0]
+	}
+
+	runes := []rune(arg.(*object.String).Value)
+	if len(runes) == 0 {
+		return fallback
+	}
+	if fromEnd {
+		return &object.String{Value: string(runes[len(runes)-1])}
+	}
+	return &object.String{Value: string(runes[0])}
+}
+
+// 配列とハッシュを再帰的に複製する。visitingは複製途中の要素で、循環の検出に使う
+func deepCopy(obj object.Object, visiting map[object.Object]bool) object.Object {
+	switch obj := obj.(type) {
+	case *object.Array:
+		if visiting[obj] {
+			return object.ArgError(object.ValueError, "clone", 1, "must not be cyclic")
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		elements := make([]object.Object, len(obj.Elements))
+		for i, el := range obj.Elements {
+			copied := deepCopy(el, visiting)
+			if isError(copied) {
+				return copied
+			}
+			elements[i] = copied
+		}
+		return &object.Array{Elements: elements}
+	case *object.Hash:
+		if visiting[obj] {
+			return object.ArgError(object.ValueError, "clone", 1, "must not be cyclic")
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		hash := object.NewHash()
+		for _, pair := range obj.OrderedPairs() {
+			copied := deepCopy(pair.Value, visiting)
+			if isError(copied) {
+				return copied
+			}
+			// キーは不変なオブジェクトなのでそのまま使う
+			hash.Set(pair.Key, copied)
+		}
+		return hash
+	case *object.Set:
+		// 要素は不変なオブジェクトなので、集合だけを複製する
+		set := object.NewSet()
+		for _, el := range obj.Members() {
+			set.Add(el)
+		}
+		return set
+	case *object.StringBuilder:
+		sb := &object.StringBuilder{}
+		sb.WriteString(obj.String())
+		return sb
+	case *object.Function, *object.Builtin:
+		return object.ArgError(object.TypeError, "clone", 1, "must not contain %s", object.TypeName(obj.Type()))
+	default:
+		// 整数・文字列・真偽値・nullは不変なので複製しない
+		return obj
+	}
+}
+
+// repeat や padLeft などが作る文字列の最大の長さ（バイト数）
+const maxStringLength = 1 << 30
+
+// channel で作れるバッファの最大の大きさ
+const maxChannelSize = 1 << 20
+
+// padLeft と padRight の本体。left がtrueなら左を埋める
+func pad(name string, args []object.Object, left bool) object.Object {
+	err := object.CheckArgs(name, args, object.Arg(object.STRING_OBJ), object.Arg(object.INTEGER_OBJ), object.OptionalArg(object.STRING_OBJ))
+	if err != nil {
+		return err
+	}
+	s := args[0].(*object.String).Value
+	width := args[1].(*object.Integer).Value
+	fill := " "
+	if len(args) == 3 {
+		fill = args[2].(*object.String).Value
+		if utf8.RuneCountInString(fill) != 1 {
+			return object.ArgError(object.ValueError, name, 3, "must be a single character, got %q", fill)
+		}
+	}
+
+	// 幅はバイト数ではなく文字数で数える
+	missing := width - int64(utf8.RuneCountInString(s))
+	if missing <= 0 {
+		return args[0]
+	}
+	if missing > maxStringLength/int64(len(fill)) {
+		return object.ArgError(object.LimitError, name, 2, "is too large: the result would be longer than %d bytes", maxStringLength)
+	}
+	padding := strings.Repeat(fill, int(missing))
+	if left {
+		return &object.String{Value: padding + s}
+	}
+	return &object.String{Value: s + padding}
+}
+
+// foldCase は s の各文字を、strings.EqualFold で等しいとされる文字のうち最小のものに置き換える
+// 置き換えた文字列どうしは、元の文字列が1文字ずつ EqualFold で等しいときに限り等しい
+func foldCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		min := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < min {
+				min = f
+			}
+		}
+		return min
+	}, s)
+}
+
+// toFixed と formatNumber の小数部の桁数を調べる。option はエラーメッセージに書くオプション名（引数そのものなら空）
+func checkDecimals(name string, position int, option string, digits int64) *object.Error {
+	if digits < 0 {
+		return object.ArgError(object.ValueError, name, position, "%smust be non-negative, got %d", option, digits)
+	}
+	if digits > maxStringLength {
+		return object.ArgError(object.LimitError, name, position, "%sis too large: %d", option, digits)
+	}
+	return nil
+}
+
+// 整数 n を、整数部を thousands で3桁ごとに区切り、decimals 桁の0の小数部を付けた文字列にする
+func formatInteger(n *big.Int, thousands string, decimals int64) string {
+	digits := new(big.Int).Abs(n).String()
+	var out strings.Builder
+	if n.Sign() < 0 {
+		out.WriteByte('-')
+	}
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out.WriteString(thousands)
+		}
+		out.WriteRune(d)
+	}
+	if decimals > 0 {
+		out.WriteByte('.')
+		out.WriteString(strings.Repeat("0", int(decimals)))
+	}
+	return out.String()
+}
+
+// array の要素を depth 段まで展開して out に加える（depth が負ならすべて展開する）
+// visiting は展開途中の配列で、すべて展開する場合の循環の検出に使う
+func flatten(array *object.Array, depth int64, out []object.Object, visiting map[*object.Array]bool) ([]object.Object, *object.Error) {
+	if visiting[array] {
+		return nil, object.ArgError(object.ValueError, "flatten", 1, "must not be cyclic")
+	}
+	visiting[array] = true
+	defer delete(visiting, array)
+
+	for _, el := range array.Elements {
+		inner, ok := el.(*object.Array)
+		if !ok || depth == 0 {
+			out = append(out, el)
+			continue
+		}
+		var err *object.Error
+		if out, err = flatten(inner, depth-1, out, visiting); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// sortBy のキーを比べる。a と b は同じ型の整数か文字列
+func keyLess(a, b object.Object) bool {
+	if a, ok := a.(*object.Integer); ok {
+		return a.Value < b.(*object.Integer).Value
+	}
+	return a.(*object.String).Value < b.(*object.String).Value
+}
@@ -0,0 +1,1363 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`contains("hello", "ell")`, true},
+		{`contains("hello", "")`, true},
+		{`contains("hello", "world")`, false},
+		{`contains("", "a")`, false},
+		{`contains([1, 2, 3], 2)`, true},
+		{`contains([1, 2, 3], 4)`, false},
+		{`contains([], 1)`, false},
+		{`contains([1, "two", true], "two")`, true},
+		{`contains([1, "two", true], true)`, true},
+		{`contains([1, 2, 3], "1")`, false},
+		{`contains([[1, 2], [3, 4]], [3, 4])`, true},
+		{`contains([[1, 2], [3, 4]], [4, 3])`, false},
+		{`contains([{"a": [1]}], {"a": [1]})`, true},
+		{`contains([{"a": [1]}], {"a": [2]})`, false},
+		{`contains({"a": 1}, "a")`, true},
+		{`contains({"a": 1}, "b")`, false},
+		{`contains({1: "one", true: "yes"}, 1)`, true},
+		{`contains({1: "one", true: "yes"}, true)`, true},
+		{`contains({}, "a")`, false},
+		{`contains("hello")`, "contains: expected 2 arguments, got 1"},
+		{`contains([1], 1, 2)`, "contains: expected 2 arguments, got 3"},
+		{`contains(1, 1)`, "contains: argument 1 must be string, array, hash or range, got integer"},
+		{`contains("hello", 1)`, "contains: argument 2 must be string, got integer"},
+		{`contains({"a": 1}, [1])`, "contains: argument 2 must be hashable, got array"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+		return false
+	}
+	return true
+}
+
+func TestAppendAndPop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`append([], 1)`, []int64{1}},
+		{`append([1, 2], 3)`, []int64{1, 2, 3}},
+		{`let a = [1]; append(a, 2); a`, []int64{1, 2}},
+		{`let a = [1]; let b = a; append(b, 2); a`, []int64{1, 2}},
+		{`let a = [1]; let b = append(a, 2); append(b, 3); a`, []int64{1, 2, 3}},
+		{`let a = [1]; push(a, 2); a`, []int64{1}},
+		{`let a = [1]; let b = a; push(b, 2); a`, []int64{1}},
+		{`pop([1, 2, 3])`, 3},
+		{`let a = [1, 2, 3]; pop(a); a`, []int64{1, 2}},
+		{`let a = [1, 2, 3]; let b = a; pop(b); pop(b); a`, []int64{1}},
+		{`let a = [1]; pop(a); append(a, 5); a`, []int64{5}},
+		{`pop([])`, "pop: argument 1 must be non-empty array, got empty array"},
+		{`dropLast([1, 2, 3])`, []int64{1, 2}},
+		{`let a = [1, 2, 3]; dropLast(a); a`, []int64{1, 2, 3}},
+		{`let a = [1, 2, 3]; let b = a; dropLast(b); a`, []int64{1, 2, 3}},
+		{`let a = [1, 2]; let b = dropLast(a); append(b, 9); a`, []int64{1, 2}},
+		{`dropLast([])`, "dropLast: argument 1 must be non-empty array, got empty array"},
+		{`dropLast(1)`, "dropLast: argument 1 must be array, got integer"},
+		{`pop(1)`, "pop: argument 1 must be array, got integer"},
+		{`pop([1], 2)`, "pop: expected 1 argument, got 2"},
+		{`append(1, 1)`, "append: argument 1 must be array or string_builder, got integer"},
+		{`append([1])`, "append: expected 2 arguments, got 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestAppendReturnsSameArray(t *testing.T) {
+	evaluated := testEval(`let a = []; let b = append(a, 1); [a, b]`)
+	pair, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	if pair.Elements[0] != pair.Elements[1] {
+		t.Errorf("append returned a different array object")
+	}
+
+	evaluated = testEval(`let a = []; let b = push(a, 1); [a, b]`)
+	pair = evaluated.(*object.Array)
+	if pair.Elements[0] == pair.Elements[1] {
+		t.Errorf("push returned the same array object")
+	}
+}
+
+func BenchmarkBuildArrayWithPush(b *testing.B) {
+	benchmarkBuildArray(b, "push")
+}
+
+func BenchmarkBuildArrayWithAppend(b *testing.B) {
+	benchmarkBuildArray(b, "append")
+}
+
+// 10000要素の配列を再帰で組み立てる
+func benchmarkBuildArray(b *testing.B, builtin string) {
+	input := `
+let build = fn(arr, n) {
+  if (n == 0) { return arr; }
+  build(` + builtin + `(arr, n), n - 1);
+};
+len(build([], 10000));`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	for i := 0; i < b.N; i++ {
+		evaluated := New(WithMaxDepth(20000)).Eval(program, object.NewEnvironment())
+		if result, ok := evaluated.(*object.Integer); !ok || result.Value != 10000 {
+			b.Fatalf("unexpected result. got=%T (%+v)", evaluated, evaluated)
+		}
+	}
+}
+
+func TestStringBuilder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`build(builder())`, ""},
+		{`build(builder("ab"))`, "ab"},
+		{`let b = builder(); append(b, "foo"); append(b, "bar"); build(b)`, "foobar"},
+		{`build(append(append(builder("a"), "b"), "c"))`, "abc"},
+		{`let b = builder("x"); let s = build(b); append(b, "y"); s + build(b)`, "xxy"},
+		{`let b = builder(); for (w in ["a", "b", "c"]) { append(b, w + ",") }; build(b)`, "a,b,c,"},
+		{`len(append(builder("ab"), "cd"))`, 4},
+		{`let b = builder("ab"); let c = clone(b); append(c, "c"); build(b) + build(c)`, "ababc"},
+		{`let b = freeze(builder("a")); append(b, "b")`, errorMessage("append: cannot modify frozen string_builder")},
+		{`isFrozen(builder())`, false},
+		{`append(builder(), 1)`, errorMessage("append: argument 2 must be string when appending to a string_builder, got integer")},
+		{`build("a")`, errorMessage("build: argument 1 must be string_builder, got string")},
+		{`builder(1)`, errorMessage("builder: argument 1 must be string, got integer")},
+		{`inspect(builder("abc"))`, "builder(3 bytes)"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("wrong result for %s. want=%q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+// build の結果は普通の文字列として使える
+func TestStringBuilderResultIsString(t *testing.T) {
+	input := `
+let b = builder();
+for (i in range(0, 100000)) { append(b, "ab") };
+let s = build(b);
+[len(s), first(s), contains(s, "ba"), {s: 1}[build(b)], len(s + "!")]`
+	evaluated := testEval(input)
+	if evaluated.Inspect() != `[200000, "a", true, 1, 200001]` {
+		t.Errorf("wrong result. got=%s", evaluated.Inspect())
+	}
+}
+
+// 短い文字列を n 個つなげる。builder は n にほぼ比例し、+ は n の2乗に比例する
+func BenchmarkStringBuilder(b *testing.B) {
+	for _, n := range []int{10000, 100000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			benchmarkConcat(b, n, `
+let b = builder();
+for (i in range(0, N)) { append(b, "piece") };
+len(build(b))`)
+		})
+	}
+}
+
+func BenchmarkStringConcat(b *testing.B) {
+	for _, n := range []int{10000, 20000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			benchmarkConcat(b, n, `
+let concat = fn(s, i) { if (i == 0) { s } else { concat(s + "piece", i - 1) } };
+len(concat("", N))`)
+		})
+	}
+}
+
+func benchmarkConcat(b *testing.B, n int, input string) {
+	program := parser.New(lexer.New(strings.Replace(input, "N", fmt.Sprint(n), 1))).ParseProgram()
+	for i := 0; i < b.N; i++ {
+		evaluated := New().Eval(program, object.NewEnvironment())
+		if result, ok := evaluated.(*object.Integer); !ok || result.Value != int64(5*n) {
+			b.Fatalf("unexpected result. got=%T (%+v)", evaluated, evaluated)
+		}
+	}
+}
+
+func testIntegerArray(t *testing.T, obj object.Object, expected []int64) bool {
+	array, ok := obj.(*object.Array)
+	if !ok {
+		t.Errorf("object is not Array. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if len(array.Elements) != len(expected) {
+		t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+		return false
+	}
+	for i, el := range expected {
+		if !testIntegerObject(t, array.Elements[i], el) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`get({"a": 1}, "a")`, 1},
+		{`get({"a": 1}, "a", 2)`, 1},
+		{`get({"a": 1}, "b")`, nil},
+		{`get({"a": 1}, "b", 2)`, 2},
+		{`get({}, "b", 3)`, 3},
+		{`get({"a": if (false) { 1 }}, "a", 2)`, nil},
+		{`get({1: 10, true: 20}, true, 0)`, 20},
+		{`get([1, 2, 3], 0)`, 1},
+		{`get([1, 2, 3], 2, 9)`, 3},
+		{`get([1, 2, 3], 3)`, nil},
+		{`get([1, 2, 3], 3, 9)`, 9},
+		{`get([1, 2, 3], -1, 9)`, 9},
+		{`get([], 0, 9)`, 9},
+		{`get([if (false) { 1 }], 0, 9)`, nil},
+		{`get({"a": 1})`, "get: expected 2 or 3 arguments, got 1"},
+		{`get({"a": 1}, "a", 1, 2)`, "get: expected 2 or 3 arguments, got 4"},
+		{`get({"a": 1}, [1], 0)`, "get: argument 2 must be hashable, got array"},
+		{`get([1], "a", 0)`, "get: argument 2 must be integer, got string"},
+		{`get("abc", 0)`, "get: argument 1 must be hash or array, got string"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestFirstLastRest(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first("abc")`, "a"},
+		{`first("日本語")`, "日"},
+		{`first("")`, nil},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last("abc")`, "c"},
+		{`last("日本語")`, "語"},
+		{`last("")`, nil},
+		{`rest([1, 2, 3])`, []int64{2, 3}},
+		{`rest([1])`, []int64{}},
+		{`rest([])`, []int64{}},
+		{`rest(rest([]))`, []int64{}},
+		{`rest("abc")`, "bc"},
+		{`rest("日本語")`, "本語"},
+		{`rest("a")`, ""},
+		{`rest("")`, ""},
+		{`firstOr([1, 2], 0)`, 1},
+		{`firstOr([], 0)`, 0},
+		{`firstOr("abc", "z")`, "a"},
+		{`firstOr("", "z")`, "z"},
+		{`lastOr([1, 2], 0)`, 2},
+		{`lastOr([], 0)`, 0},
+		{`lastOr("abc", "z")`, "c"},
+		{`lastOr("", "z")`, "z"},
+		{`first(1)`, errorMessage("first: argument 1 must be array or string, got integer")},
+		{`last({})`, errorMessage("last: argument 1 must be array or string, got hash")},
+		{`rest(true)`, errorMessage("rest: argument 1 must be array or string, got boolean")},
+		{`firstOr(1, 0)`, errorMessage("firstOr: argument 1 must be array or string, got integer")},
+		{`lastOr([1])`, errorMessage("lastOr: expected 2 arguments, got 1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+// テーブル中で文字列の期待値とエラーメッセージを区別するための型
+type errorMessage string
+
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestClone(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`clone(1)`, 1},
+		{`clone("abc")`, "abc"},
+		{`clone([1, 2, 3])`, []int64{1, 2, 3}},
+		{`let a = [1, 2]; let b = clone(a); append(b, 3); a`, []int64{1, 2}},
+		{`let a = [1, 2]; let b = clone(a); append(b, 3); b`, []int64{1, 2, 3}},
+		{`let a = [[1], [2]]; let b = clone(a); append(b[0], 9); a[0]`, []int64{1}},
+		{`let a = [[[1]]]; let b = clone(a); append(b[0][0], 9); a[0][0]`, []int64{1}},
+		{`let h = {"xs": [1]}; let c = clone(h); append(c["xs"], 2); h["xs"]`, []int64{1}},
+		{`let h = {"a": {"xs": [1]}}; let c = clone(h); pop(c["a"]["xs"]); h["a"]["xs"]`, []int64{1}},
+		{`let a = [{"xs": [1]}]; let b = clone(a); append(b[0]["xs"], 2); a[0]["xs"]`, []int64{1}},
+		{`let x = [1]; let a = [x, x]; let b = clone(a); append(b[0], 2); b[1]`, []int64{1}},
+		{`let a = []; append(a, a); clone(a)`, errorMessage("clone: argument 1 must not be cyclic")},
+		{`let a = []; let h = {"a": a}; append(a, h); clone(h)`, errorMessage("clone: argument 1 must not be cyclic")},
+		{`clone(fn(x) { x })`, errorMessage("clone: argument 1 must not contain function")},
+		{`clone([len])`, errorMessage("clone: argument 1 must not contain builtin")},
+		{`clone()`, errorMessage("clone: expected 1 argument, got 0")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestCloneKeepsScalarsAndCopiesComposites(t *testing.T) {
+	evaluated := testEval(`let a = [1, [2], {"k": "v"}]; [a, clone(a)]`)
+	pair := evaluated.(*object.Array)
+	original := pair.Elements[0].(*object.Array)
+	copied := pair.Elements[1].(*object.Array)
+
+	if original == copied {
+		t.Fatalf("clone returned the same array")
+	}
+	if original.Elements[0] != copied.Elements[0] {
+		t.Errorf("integer was copied. want the same object")
+	}
+	if original.Elements[1] == copied.Elements[1] {
+		t.Errorf("nested array was not copied")
+	}
+	if original.Elements[2] == copied.Elements[2] {
+		t.Errorf("nested hash was not copied")
+	}
+	if !objectsEqual(original, copied) {
+		t.Errorf("clone is not equal to the original. got=%s", copied.Inspect())
+	}
+}
+
+// 0 から n-1 までの配列を Inspect した文字列
+func inspectRange(n int) string {
+	elements := make([]string, n)
+	for i := range elements {
+		elements[i] = strconv.Itoa(i)
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`inspect(1)`, "1"},
+		{`inspect([1, "a"])`, `[1, "a"]`},
+		// 自身を含む配列やハッシュは循環している部分を省略する
+		{`let a = [1]; append(a, a); inspect(a)`, "[1, [...]]"},
+		{`let a = []; let h = {"a": a}; append(a, h); inspect(h)`, `{"a":[{...}]}`},
+		{`let add = fn(a, b) { a + b }; inspect(add)`, "fn add(a, b) { ... }"},
+		{`inspect(fn(x) { x })`, "fn(x) { ... }"},
+		{`let add = fn(a, b) { a + b }; inspect(add, true)`, "fn add(a, b) {\n(a + b)\n}"},
+		{`inspect(fn(x) { x }, true)`, "fn(x) {\nx\n}"},
+		{`inspect(len)`, "builtin fn: len"},
+		{`inspect("a", true)`, "a"},
+		{`inspect([1, ["a"]], true)`, `[1, ["a"]]`},
+		{`inspect([toArray(0..20), toArray(0..20)], true)`, "[\n  " + inspectRange(20) + ",\n  " + inspectRange(20) + "\n]"},
+		{`inspect(1, true)`, "1"},
+		{`inspect(1, 2)`, errorMessage("inspect: argument 2 must be boolean, got integer")},
+		{`inspect()`, errorMessage("inspect: expected 1 or 2 arguments, got 0")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, "c": 3}`, `{"b":1, "a":2, "c":3}`},
+		{`{3: "x", 1: "y", 2: "z"}`, `{3:"x", 1:"y", 2:"z"}`},
+		{`{"a": 1, true: 2, 0: 3}`, `{"a":1, true:2, 0:3}`},
+		{`{"a": 1, "b": 2, "a": 3}`, `{"a":3, "b":2}`},
+		{`keys({"z": 1, "y": 2, "x": 3})`, `["z", "y", "x"]`},
+		{`values({"z": 1, "y": 2, "x": 3})`, `[1, 2, 3]`},
+		{`merge({"b": 1, "a": 2}, {"c": 3, "b": 4})`, `{"b":4, "a":2, "c":3}`},
+		{`let h = {"b": 1, "a": 2}; merge(h, {"c": 3}); h`, `{"b":1, "a":2}`},
+		{`clone({"m": 1, "k": [2], "a": 3})`, `{"m":1, "k":[2], "a":3}`},
+		{`keys({})`, `[]`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong order for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHashBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys([1])`, "keys: argument 1 must be hash, got array"},
+		{`values()`, "values: expected 1 argument, got 0"},
+		{`merge({}, 1)`, "merge: argument 2 must be hash, got integer"},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`set([1, 2, 2, 3, 1])`, "set{1, 2, 3}"},
+		{`set(3, 1, 3, 2)`, "set{3, 1, 2}"},
+		{`set()`, "set{}"},
+		{`set([])`, "set{}"},
+		{`set(["a", 1, true, "a", 1])`, `set{"a", 1, true}`},
+		{`len(set([1, 1, 2]))`, 2},
+		{`has(set(1, 2), 2)`, true},
+		{`has(set(1, 2), "2")`, false},
+		{`let s = set(1); add(s, 2); add(s, 1); s`, "set{1, 2}"},
+		{`let s = set(1, 2, 3); let t = s; remove(t, 2); s`, "set{1, 3}"},
+		{`remove(set(1), 5)`, "set{1}"},
+		{`union(set(1, 2), set(2, 3))`, "set{1, 2, 3}"},
+		{`let a = set(1); union(a, set(2)); a`, "set{1}"},
+		{`intersect(set(3, 1, 2), set(2, 3, 4))`, "set{3, 2}"},
+		{`intersect(set(1), set(2))`, "set{}"},
+		{`toArray(set([2, 1, 2]))`, "[2, 1]"},
+		{`let a = set(1); let b = clone(a); add(b, 2); a`, "set{1}"},
+		{`contains([set(1, 2)], set(2, 1))`, true},
+		{`set([1, [2]])`, errorMessage("set: argument 1 must contain only hashable values, got array")},
+		{`set(1, [2])`, errorMessage("set: argument 2 must be hashable, got array")},
+		{`add(set(), {})`, errorMessage("add: argument 2 must be hashable, got hash")},
+		{`has([1], 1)`, errorMessage("has: argument 1 must be set, got array")},
+		{`union(set(), [])`, errorMessage("union: argument 2 must be set, got array")},
+		{`toArray([1])`, errorMessage("toArray: argument 1 must be set or range, got array")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestMapFilterReduce(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`map([1, 2, 3], fn(x) { x * x })`, "[1, 4, 9]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`map(["a", "bc"], len)`, "[1, 2]"},
+		{`map(["a", "b"], fn(x, i) { i })`, "[0, 1]"},
+		{`map({"a": 1, "b": 2}, fn(v, k) { k + inspect(v) })`, `["a1", "b2"]`},
+		{`map("ab", fn(c) { c + c })`, `["aa", "bb"]`},
+		{`let n = 10; map([1], fn(x) { x + n })`, "[11]"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`filter([1, 2, 3], fn(x, i) { i == 1 })`, "[2]"},
+		{`filter({"a": 1, "b": 5}, fn(v) { v > 2 })`, "[5]"},
+		{`filter(set(1, 2, 3), fn(x) { x != 2 })`, "[1, 3]"},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`reduce([], 42, fn(acc, x) { acc + x })`, 42},
+		{`reduce("abc", "", fn(acc, c) { c + acc })`, "cba"},
+		{`reduce(["a", "b"], "", fn(acc, x, i) { acc + x + inspect(i) })`, "a0b1"},
+		{`map(1, fn(x) { x })`, errorMessage("map: argument 1 must be iterable, got integer")},
+		{`map([1], 1)`, errorMessage("map: argument 2 must be function or builtin, got integer")},
+		{`filter([1])`, errorMessage("filter: expected 2 arguments, got 1")},
+		{`reduce(true, 0, fn(a, x) { a })`, errorMessage("reduce: argument 1 must be iterable, got boolean")},
+		{`map([1, true], fn(x) { -x })`, errorMessage("unknown operator: -BOOLEAN")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestGroupByAndCountBy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`groupBy([1, 2, 3, 4, 5], fn(x) { x / 2 * 2 == x })`, "{false:[1, 3, 5], true:[2, 4]}"},
+		{`groupBy([2, 1, 4, 3], fn(x) { x / 2 * 2 == x })`, "{true:[2, 4], false:[1, 3]}"},
+		{`groupBy(["banana", "apple", "blueberry", "cherry", "avocado"], first)`,
+			`{"b":["banana", "blueberry"], "a":["apple", "avocado"], "c":["cherry"]}`},
+		{`groupBy([], fn(x) { x })`, "{}"},
+		{`groupBy(["a", "b", "c"], fn(x, i) { i < 2 })`, `{true:["a", "b"], false:["c"]}`},
+		{`groupBy({"x": 1, "y": 2, "z": 3}, fn(v, k) { v > 1 })`, "{false:[1], true:[2, 3]}"},
+		{`countBy([1, 2, 3, 4, 5], fn(x) { x / 2 * 2 == x })`, "{false:3, true:2}"},
+		{`countBy("hello", fn(c) { c })`, `{"h":1, "e":1, "l":2, "o":1}`},
+		{`countBy([], fn(x) { x })`, "{}"},
+		{`groupBy([1], fn(x) { [x] })`, errorMessage("groupBy: callback must return a hashable value, got array")},
+		{`countBy([1, true], fn(x) { -x })`, errorMessage("unknown operator: -BOOLEAN")},
+		{`groupBy(1, fn(x) { x })`, errorMessage("groupBy: argument 1 must be iterable, got integer")},
+		{`countBy([1])`, errorMessage("countBy: expected 2 arguments, got 1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestEveryAndAny(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`every([2, 4, 6], fn(x) { x / 2 * 2 == x })`, "true"},
+		{`every([2, 3, 6], fn(x) { x / 2 * 2 == x })`, "false"},
+		{`every([], fn(x) { false })`, "true"},
+		{`any([1, 3, 4], fn(x) { x / 2 * 2 == x })`, "true"},
+		{`any([1, 3, 5], fn(x) { x / 2 * 2 == x })`, "false"},
+		{`any([], fn(x) { true })`, "false"},
+		{`every("aaa", fn(c) { contains("a", c) })`, "true"},
+		{`any("abc", fn(c) { contains("z", c) })`, "false"},
+		{`every({"a": 1, "b": 2}, fn(v) { v > 0 })`, "true"},
+		{`any({"a": 1, "b": 2}, fn(k, v) { contains("b", k) })`, "true"},
+		{`every([1, 2], fn(i, x) { i < 1 })`, "false"},
+		// 2つの引数を取る関数には each と同じくキー、値の順に渡す
+		{`every({"a": 1, "b": 2}, fn(k, v) { v > 0 })`, "true"},
+		{`any({"a": 1, "b": 2}, fn(k, v) { v > 1 && contains("b", k) })`, "true"},
+		{`let seen = []; every({"z": 1, "a": 2}, fn(k, v) { append(seen, [k, v]) }); seen`, `[["z", 1], ["a", 2]]`},
+		{`let seen = []; any({"z": 1, "a": 2}, fn(k, v) { append(seen, [k, v]); false }); seen`, `[["z", 1], ["a", 2]]`},
+		{`any([0, 1], len)`, errorMessage("len: argument 1 must be string, array, hash, set, range or string_builder, got integer")},
+		// 答えが決まった後は呼び出さない
+		{`let calls = []; every([1, 2, 3, 4], fn(x) { append(calls, x); x < 2 }); calls`, "[1, 2]"},
+		{`let calls = []; any([1, 2, 3, 4], fn(x) { append(calls, x); x == 2 }); calls`, "[1, 2]"},
+		{`let calls = []; any([1, 2, 3], fn(x) { append(calls, x); false }); calls`, "[1, 2, 3]"},
+		{`every([1, true], fn(x) { -x })`, errorMessage("unknown operator: -BOOLEAN")},
+		{`any(1, fn(x) { x })`, errorMessage("any: argument 1 must be iterable, got integer")},
+		{`every([1])`, errorMessage("every: expected 2 arguments, got 1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestFindAndFindIndex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`find([5, 6, 7], fn(x) { x > 4 })`, "5"},
+		{`find([5, 6, 7], fn(x) { x > 5 })`, "6"},
+		{`find([5, 6, 7], fn(x) { x > 9 })`, "null"},
+		{`find([], fn(x) { true })`, "null"},
+		{`find([5, 6, 7], fn(x) { x > 9 }, 0)`, "0"},
+		{`find(["a", "b"], fn(i, x) { i == 1 })`, "b"},
+		// 2つの引数を取る関数には each と同じくキー（配列では位置）、値の順に渡す
+		{`find({"a": 1, "b": 2}, fn(k, v) { contains("b", k) })`, "2"},
+		{`let seen = []; find({"z": 1, "a": 2}, fn(k, v) { append(seen, [k, v]); false }); seen`, `[["z", 1], ["a", 2]]`},
+		{`find([10, 20, 30], fn(i, x) { x > 10 && i > 1 })`, "30"},
+		{`findIndex([10, 20, 30], fn(i, x) { x == 20 })`, "1"},
+		{`let seen = []; findIndex(["a", "b"], fn(i, x) { append(seen, [i, x]); false }); seen`, `[[0, "a"], [1, "b"]]`},
+		{`find({"a": 1, "b": 2}, fn(v) { v > 1 })`, "2"},
+		{`find("abc", fn(c) { contains("bc", c) })`, "b"},
+		// 見つかった要素がnullでも、既定値ではなくその要素を返す
+		{`let nothing = if (false) { 1 }; find([1, nothing, 3], fn(x) { !x }, "none")`, "null"},
+		{`let nothing = if (false) { 1 }; findIndex([1, nothing, 3], fn(x) { !x })`, "1"},
+		{`findIndex([5, 6, 7], fn(x) { x > 4 })`, "0"},
+		{`findIndex([5, 6, 7], fn(x) { x == 7 })`, "2"},
+		{`findIndex([5, 6, 7], fn(x) { x > 9 })`, "-1"},
+		{`findIndex([], fn(x) { true })`, "-1"},
+		{`let calls = []; find([1, 2, 3], fn(x) { append(calls, x); x == 2 }); calls`, "[1, 2]"},
+		{`let calls = []; findIndex([1, 2, 3], fn(i, x) { append(calls, i); i == 0 }); calls`, "[0]"},
+		{`find([1, true], fn(x) { -x > 0 })`, errorMessage("unknown operator: -BOOLEAN")},
+		{`findIndex([1, true], fn(x) { -x > 0 })`, errorMessage("unknown operator: -BOOLEAN")},
+		{`findIndex("abc", fn(c) { true })`, errorMessage("findIndex: argument 1 must be array, got string")},
+		{`find(1, fn(x) { x })`, errorMessage("find: argument 1 must be iterable, got integer")},
+		{`find([1])`, errorMessage("find: expected 2 or 3 arguments, got 1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	people := `let people = [{"name": "Carol", "age": 35}, {"name": "Alice", "age": 30}, {"name": "Bob", "age": 25}, {"name": "Dave", "age": 30}];`
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{people + `map(sortBy(people, fn(p) { p["age"] }), fn(p) { p["name"] })`, `["Bob", "Alice", "Dave", "Carol"]`},
+		{people + `map(sortBy(people, fn(p) { p["age"] }, true), fn(p) { p["name"] })`, `["Carol", "Alice", "Dave", "Bob"]`},
+		{people + `map(sortBy(people, fn(p) { p["name"] }), fn(p) { p["age"] })`, "[30, 25, 35, 30]"},
+		{`sortBy([3, 1, 2], identity)`, "[1, 2, 3]"},
+		{`sortBy(["bb", "a", "ccc"], len, true)`, `["ccc", "bb", "a"]`},
+		{`sortBy(["b", "c", "a"], fn(x, i) { -i })`, `["a", "c", "b"]`},
+		{`sortBy([], identity)`, "[]"},
+		// 元の配列は書き換えない
+		{`let a = [2, 1]; sortBy(a, identity); a`, "[2, 1]"},
+		// キーは要素ごとに一度だけ求める
+		{`let calls = []; sortBy([4, 2, 3, 1, 5], fn(x) { append(calls, x); x }); len(calls)`, "5"},
+		{`sortBy([1, "a"], identity)`, errorMessage("sortBy: key of element 1 is string, but the keys before it are integer")},
+		{`sortBy([1, [2]], identity)`, errorMessage("sortBy: key of element 1 must be integer or string, got array")},
+		{`sortBy([1, true], fn(x) { -x })`, errorMessage("unknown operator: -BOOLEAN")},
+		{`sortBy("ab", identity)`, errorMessage("sortBy: argument 1 must be array, got string")},
+		{`sortBy([1], identity, 1)`, errorMessage("sortBy: argument 3 must be boolean, got integer")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval("let identity = fn(x) { x };" + tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestEach(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let seen = []; each([3, 1, 2], fn(x) { append(seen, x) }); seen`, "[3, 1, 2]"},
+		{`let seen = []; each(["a", "b"], fn(i, x) { append(seen, [i, x]) }); seen`, `[[0, "a"], [1, "b"]]`},
+		{`let seen = []; each({"z": 1, "a": 2, "m": 3}, fn(v) { append(seen, v) }); seen`, "[1, 2, 3]"},
+		{`let seen = []; each({"z": 1, "a": 2}, fn(k, v) { append(seen, [k, v]) }); seen`, `[["z", 1], ["a", 2]]`},
+		{`let seen = []; each("héllo", fn(c) { append(seen, c) }); seen`, `["h", "é", "l", "l", "o"]`},
+		{`let seen = []; each("ab", fn(i, c) { append(seen, i) }); seen`, "[0, 1]"},
+		{`each([1, 2], fn(x) { x })`, "null"},
+		{`each([], fn(x) { x })`, "null"},
+		{`let seen = []; each([1, true, 3], fn(x) { append(seen, x); -x }); seen`, errorMessage("unknown operator: -BOOLEAN")},
+		{`each(1, fn(x) { x })`, errorMessage("each: argument 1 must be iterable, got integer")},
+		{`each([1])`, errorMessage("each: expected 2 arguments, got 1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+
+	// エラーで打ち切った後の要素では呼ばない
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New(`let seen = []; each([1, true, 3], fn(x) { append(seen, x); -x })`)).ParseProgram(), env)
+	seen, _ := env.Get("seen")
+	if seen.Inspect() != "[1, true]" {
+		t.Errorf("each should stop at the error. seen=%s", seen.Inspect())
+	}
+}
+
+func TestSpawnAndChannel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 生産者と消費者
+		{`let ch = channel(2);
+		  let producer = spawn(fn() { for (i in 1..6) { send(ch, i * i) }; "sent" });
+		  let consumer = spawn(fn() { reduce(1..6, 0, fn(acc, _) { acc + recv(ch) }) });
+		  [wait(producer), wait(consumer)]`, `["sent", 55]`},
+		// バッファのないチャネル
+		{`let ch = channel(); spawn(fn() { send(ch, [1, 2]) }); recv(ch)`, "[1, 2]"},
+		{`let n = 10; let t = spawn(fn() { let fib = fn(k) { if (k < 2) { k } else { fib(k - 1) + fib(k - 2) } }; fib(n) }); wait(t)`, "55"},
+		// 同じ Task を何度待ってもよい
+		{`let t = spawn(fn() { 1 + 1 }); [wait(t), wait(t)]`, "[2, 2]"},
+		{`let t = spawn(fn() { }); wait(t)`, "null"},
+		{`let t = spawn(fn() { 1 }); wait(t); t`, "task(done)"},
+		{`let ch = channel(3); send(ch, 1); ch`, "channel(1/3)"},
+		// spawn した関数の実行時エラーは wait が返す
+		{`let t = spawn(fn() { let x = 1; x + "a" }); wait(t)`, errorMessage("type mismatch: INTEGER + STRING")},
+		{`let t = spawn(fn() { 1 + "a" }); try { wait(t) } catch (e) { e["kind"] }`, "TypeError"},
+		{`spawn(fn(x) { x })`, errorMessage("spawn: argument 1 must take no arguments, got 1 parameters")},
+		{`spawn(len)`, errorMessage("spawn: argument 1 must be function, got builtin")},
+		{`wait(1)`, errorMessage("wait: argument 1 must be task, got integer")},
+		{`channel(-1)`, errorMessage("channel: argument 1 must be between 0 and 1048576, got -1")},
+		{`send(1, 2)`, errorMessage("send: argument 1 must be channel, got integer")},
+		{`recv([])`, errorMessage("recv: argument 1 must be channel, got array")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+
+	// 送られてこない recv はコンテキストで打ち切る
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	program := parser.New(lexer.New(`recv(channel(1))`)).ParseProgram()
+	testErrorObject(t, EvalContext(ctx, program, object.NewEnvironment()), "evaluation cancelled: context deadline exceeded")
+}
+
+func TestEvaluatorBuiltinsOutsideEvaluator(t *testing.T) {
+	result := builtins["map"].Fn(&object.Array{}, builtins["len"])
+	testErrorObject(t, result, "map: cannot be called outside of the evaluator")
+
+	// puts は評価器の外（VM）からも呼べる
+	if result := builtins["puts"].Fn(); result != NULL {
+		t.Errorf("puts outside of the evaluator should return NULL. got=%s", result.Inspect())
+	}
+}
+
+func TestUnhashableBuiltinArguments(t *testing.T) {
+	// 組み込み関数の引数も、ハッシュのキーや集合の要素にできないものは同じ型で断る
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`set([1, if (false) { 1 }])`, "set: argument 1 must contain only hashable values, got null"},
+		{`set(1, fn() { 1 })`, "set: argument 2 must be hashable, got function"},
+		{`add(set(), set())`, "add: argument 2 must be hashable, got set"},
+		{`has(set(1), [1])`, "has: argument 2 must be hashable, got array"},
+		{`remove(set(1), if (false) { 1 })`, "remove: argument 2 must be hashable, got null"},
+		{`contains({"a": 1}, {})`, "contains: argument 2 must be hashable, got hash"},
+		{`get({"a": 1}, if (false) { 1 })`, "get: argument 2 must be hashable, got null"},
+		{`unique([1, len])`, "unique: argument 1 must contain only hashable elements, got builtin"},
+		{`groupBy([1], fn(x) { if (false) { x } })`, "groupBy: callback must return a hashable value, got null"},
+		{`countBy([1], fn(x) { {} })`, "countBy: callback must return a hashable value, got hash"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if errObj.Kind != object.TypeError || errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%s: %q", tt.input, tt.expected, errObj.Kind, errObj.Message)
+		}
+	}
+}
+
+func TestBuiltinsAsCallbacks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`map(["a", "bb", ""], len)`, "[1, 2, 0]"},
+		{`map([[1, 2], [3]], first)`, "[1, 3]"},
+		{`let size = len; map([[1], [1, 2]], size)`, "[1, 2]"},
+		{`let fs = [len, type]; map(fs, fn(f) { f("ab") })`, `[2, "string"]`},
+		{`sortBy(["ccc", "a", "bb"], len)`, `["a", "bb", "ccc"]`},
+		// 関数の中で隠した len を渡しても外側の len は変わらない
+		{`let f = fn(xs) { let len = fn(x) { 0 }; map(xs, len) }; [f([[1]]), map([[1]], len)]`, "[[0], [1]]"},
+		{`map([1], type)`, `["integer"]`},
+		{`type()`, errorMessage("type: expected 1 argument, got 0")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`1..5`, "1..5"},
+		{`range(5)`, "0..5"},
+		{`range(2, 5)`, "2..5"},
+		{`range(10, 0, -3)`, "10..0 step -3"},
+		{`len(range(10))`, 10},
+		{`len(3..1)`, 0},
+		{`(1..4)[2]`, 3},
+		{`(1..4)[3]`, nil},
+		{`(1..4)[-1]`, nil},
+		{`range(0, 10, 2)[4]`, 8},
+		{`contains(range(0, 10, 2), 4)`, true},
+		{`contains(range(0, 10, 2), 5)`, false},
+		{`contains(1..3, "1")`, false},
+		{`toArray(1..4)`, "[1, 2, 3]"},
+		{`toArray(range(5, 0, -2))`, "[5, 3, 1]"},
+		{`1..3 == 1..3`, false},
+		{`contains([1..3], 1..3)`, true},
+		{`append(1..3, 4)`, errorMessage("append: argument 1 must be array or string_builder, got range; convert the range with toArray first")},
+		{`pop(range(3))`, errorMessage("pop: argument 1 must be array, got range; convert the range with toArray first")},
+		{`range(1, 5, 0)`, errorMessage("range: argument 3 must be non-zero")},
+		{`range("a")`, errorMessage("range: argument 1 must be integer, got string")},
+		{`1.."a"`, errorMessage("type mismatch: INTEGER .. STRING")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+// 範囲の反復は配列で同じ要素を反復した場合と同じ結果になる
+func TestRangeIteratesLikeArray(t *testing.T) {
+	pairs := [][2]string{
+		{`range(5)`, `[0, 1, 2, 3, 4]`},
+		{`range(10, 0, -3)`, `[10, 7, 4, 1]`},
+		{`3..3`, `[]`},
+	}
+
+	for _, pair := range pairs {
+		for _, program := range []string{
+			`map(%s, fn(x, i) { [i, x * x] })`,
+			`filter(%s, fn(x) { x > 2 })`,
+			`reduce(%s, 0, fn(acc, x) { acc + x })`,
+			`let out = []; for (i, x in %s) { append(out, [i, x]) }; out`,
+		} {
+			lazy := testEval(strings.Replace(program, "%s", pair[0], 1))
+			eager := testEval(strings.Replace(program, "%s", pair[1], 1))
+			if lazy.Inspect() != eager.Inspect() {
+				t.Errorf("%s differs for %s. range=%s, array=%s", program, pair[0], lazy.Inspect(), eager.Inspect())
+			}
+		}
+	}
+}
+
+func TestHugeRangeIsNotMaterialized(t *testing.T) {
+	input := `
+let r = range(1000000000000);
+let firstOver = fn(xs, n) { for (x in xs) { if (x > n) { return x; } } };
+[len(r), r[999999999999], contains(r, 123456789012), firstOver(r, 5)]`
+
+	// 配列を作っていれば上限に収まらない
+	ev := New(WithMaxSteps(1000))
+	evaluated := ev.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+	if evaluated.Inspect() != "[1000000000000, 999999999999, true, 6]" {
+		t.Errorf("wrong result. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = freeze([1, 2]); append(a, 3)`, errorMessage("append: cannot modify frozen array")},
+		{`let a = freeze([1, 2]); pop(a)`, errorMessage("pop: cannot modify frozen array")},
+		{`let s = freeze(set(1)); add(s, 2)`, errorMessage("add: cannot modify frozen set")},
+		{`let s = freeze(set(1)); remove(s, 1)`, errorMessage("remove: cannot modify frozen set")},
+		{`let h = freeze({"xs": [1]}); append(h["xs"], 2)`, errorMessage("append: cannot modify frozen array")},
+		{`let a = freeze([[1], {"k": set(2)}]); add(a[1]["k"], 3)`, errorMessage("add: cannot modify frozen set")},
+		{`let a = [1]; let b = a; freeze(b); append(a, 2)`, errorMessage("append: cannot modify frozen array")},
+		{`let a = []; append(a, a); freeze(a); isFrozen(a[0])`, true},
+		{`let a = freeze([1, 2]); a`, "[1, 2]"},
+		{`let a = freeze([1, 2]); push(a, 3)`, "[1, 2, 3]"},
+		{`let a = freeze([1, 2]); dropLast(a)`, "[1]"},
+		{`let a = freeze([1]); let b = clone(a); append(b, 2)`, "[1, 2]"},
+		{`let a = freeze([[1]]); let b = clone(a); append(b[0], 2); b`, "[[1, 2]]"},
+		{`let a = freeze([1]); isFrozen(clone(a))`, false},
+		{`let h = freeze({"a": [1]}); isFrozen(clone(h)["a"])`, false},
+		{`let s = freeze(set(1)); isFrozen(clone(s))`, false},
+		{`isFrozen([1])`, false},
+		{`isFrozen(freeze({}))`, true},
+		{`isFrozen(1)`, true},
+		{`freeze()`, errorMessage("freeze: expected 1 argument, got 0")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestPow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`pow(2, 10)`, 1024},
+		{`pow(-3, 3)`, -27},
+		{`pow(5, 0)`, 1},
+		{`pow(2, -1)`, "pow: argument 2 must be non-negative, got -1"},
+		{`pow("2", 1)`, "pow: argument 1 must be integer or big_integer, got string"},
+		{`pow(2)`, "pow: expected 2 arguments, got 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestPadAndRepeat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`padLeft("7", 3)`, "  7"},
+		{`padRight("ab", 4)`, "ab  "},
+		{`padLeft("7", 3, "0")`, "007"},
+		{`padRight("ab", 5, ".")`, "ab..."},
+		{`padLeft("日本", 4)`, "  日本"},
+		{`padRight("é", 3, "・")`, "é・・"},
+		{`padLeft("hello", 3)`, "hello"},
+		{`padRight("hello", 5)`, "hello"},
+		{`padLeft("", 0)`, ""},
+		{`padLeft("ab", -1)`, "ab"},
+		{`padLeft("a", 2, "")`, `padLeft: argument 3 must be a single character, got ""`},
+		{`padRight("a", 2, "xy")`, `padRight: argument 3 must be a single character, got "xy"`},
+		{`padLeft(1, 2)`, "padLeft: argument 1 must be string, got integer"},
+		{`padRight("a")`, "padRight: expected 2 or 3 arguments, got 1"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("日", 2)`, "日日"},
+		{`repeat("ab", 0)`, ""},
+		{`repeat("ab", -2)`, ""},
+		{`repeat("", 5)`, ""},
+		{`repeat("ab", 1073741824)`, "repeat: argument 2 is too large: the result would be longer than 1073741824 bytes"},
+		{`repeat(3, "ab")`, "repeat: argument 1 must be string, got integer"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		expected := tt.expected.(string)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			testErrorObject(t, errObj, expected)
+			continue
+		}
+		testStringObject(t, evaluated, expected)
+	}
+}
+
+func TestFoldAndCompare(t *testing.T) {
+	// 大文字と小文字の変換は Go の Unicode の単純な変換で、言語によらない
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`equalsFold("Go", "GO")`, true},
+		{`equalsFold("Straße", "STRASSE")`, false},
+		{`equalsFold("σ", "Σ")`, true},
+		{`equalsFold("ς", "Σ")`, true},
+		// ケルビン記号（U+212A）は K と等しい
+		{`equalsFold("K", "k")`, true},
+		// トルコ語の点付き・点なしの i は、ロケールによる変換をしないので ASCII の i と等しくない
+		{`equalsFold("İ", "i")`, false},
+		{`equalsFold("ı", "I")`, false},
+		{`equalsFold("ı", "i")`, false},
+		{`equalsFold("", "")`, true},
+		{`containsFold("Hello, World", "WORLD")`, true},
+		{`containsFold("ΟΔΥΣΣΕΥΣ", "δυσσ")`, true},
+		{`containsFold("Kelvin", "KEL")`, true},
+		{`containsFold("İstanbul", "istanbul")`, false},
+		{`containsFold("abc", "")`, true},
+		{`containsFold("abc", "abcd")`, false},
+		{`compare("a", "b")`, -1},
+		{`compare("b", "a")`, 1},
+		{`compare("a", "a")`, 0},
+		{`compare("B", "a")`, -1},
+		{`compare("", "a")`, -1},
+		{`equalsFold("a")`, errorMessage("equalsFold: expected 2 arguments, got 1")},
+		{`containsFold("a", 1)`, errorMessage("containsFold: argument 2 must be string, got integer")},
+		{`compare(1, 2)`, errorMessage("compare: argument 1 must be string, got integer")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestToFixedAndFormatNumber(t *testing.T) {
+	// 小数がないので、小数部は常に0になる
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`toFixed(5, 2)`, "5.00"},
+		{`toFixed(-5, 1)`, "-5.0"},
+		{`toFixed(0, 3)`, "0.000"},
+		{`toFixed(42, 0)`, "42"},
+		{`toFixed(pow(10, 20), 1)`, "100000000000000000000.0"},
+		{`toFixed(5, -1)`, "toFixed: argument 2 must be non-negative, got -1"},
+		{`toFixed("5", 2)`, "toFixed: argument 1 must be integer or big_integer, got string"},
+		{`toFixed(5)`, "toFixed: expected 2 arguments, got 1"},
+		{`formatNumber(1234567)`, "1234567"},
+		{`formatNumber(1234567, {"thousands": ","})`, "1,234,567"},
+		{`formatNumber(-1234567, {"thousands": ",", "decimals": 2})`, "-1,234,567.00"},
+		{`formatNumber(123, {"thousands": ","})`, "123"},
+		{`formatNumber(-123456, {"thousands": " "})`, "-123 456"},
+		{`formatNumber(0, {"thousands": ",", "decimals": 1})`, "0.0"},
+		{`formatNumber(pow(10, 20), {"thousands": "_"})`, "100_000_000_000_000_000_000"},
+		{`formatNumber(1, {"decimals": -2})`, "formatNumber: argument 2 option decimals must be non-negative, got -2"},
+		{`formatNumber(1, {"decimals": "2"})`, "formatNumber: argument 2 option decimals must be integer, got string"},
+		{`formatNumber(1, {"thousands": 1})`, "formatNumber: argument 2 option thousands must be string, got integer"},
+		{`formatNumber(1, {"digits": 2})`, "formatNumber: argument 2 has unknown option digits (want thousands or decimals)"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			testErrorObject(t, errObj, tt.expected)
+			continue
+		}
+		testStringObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestArrayUtilities(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`flatten([1, [2, 3], [], [4, [5, [6]]]])`, "[1, 2, 3, 4, [5, [6]]]"},
+		{`flatten([1, [2, [3, [4]]]], 2)`, "[1, 2, 3, [4]]"},
+		{`flatten([1, [2, [3, [4]]]], -1)`, "[1, 2, 3, 4]"},
+		{`flatten([[1], [2]], 0)`, "[[1], [2]]"},
+		{`flatten([])`, "[]"},
+		{`flatten([[], [[]]], -1)`, "[]"},
+		{`let a = [1]; append(a, a); flatten(a, -1)`, "flatten: argument 1 must not be cyclic"},
+		{`flatten(1)`, "flatten: argument 1 must be array, got integer"},
+		{`unique([3, 1, 3, 2, 1])`, "[3, 1, 2]"},
+		{`unique(["a", 1, "a", true, 1, true])`, `["a", 1, true]`},
+		{`unique([])`, "[]"},
+		{`unique([1, [2], [2]])`, "unique: argument 1 must contain only hashable elements, got array"},
+		{`unique([{"a": 1}])`, "unique: argument 1 must contain only hashable elements, got hash"},
+		{`zip([1, 2, 3], ["a", "b", "c"])`, `[[1, "a"], [2, "b"], [3, "c"]]`},
+		{`zip([1, 2, 3], ["a"], [true, false])`, `[[1, "a", true]]`},
+		{`zip([1, 2])`, "[[1], [2]]"},
+		{`zip([1, 2], [])`, "[]"},
+		{`zip()`, "[]"},
+		{`zip([1], 2)`, "zip: argument 2 must be array, got integer"},
+		{`concat([1], [], [2, [3]])`, "[1, 2, [3]]"},
+		{`concat([1])`, "[1]"},
+		{`concat()`, "[]"},
+		{`concat([1], "2")`, "concat: argument 2 must be array, got string"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			testErrorObject(t, errObj, tt.expected)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// どれも引数を書き換えない
+	evaluated := testEval(`let a = [[1], 1]; let b = [2]; flatten(a); unique(a[0]); zip(a, b); concat(a, b); [a, b]`)
+	if evaluated.Inspect() != "[[[1], 1], [2]]" {
+		t.Errorf("arguments were modified. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{`exit()`, 0},
+		{`exit(3)`, 3},
+		{`let f = fn() { exit(4); 99 }; f(); 100`, 4},
+		// exit() は try で捕まえない
+		{`try { exit(5) } catch (e) { 0 }`, 5},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok || !errObj.Exit {
+			t.Errorf("%s: expected exit. got=%#v", tt.input, errObj)
+			continue
+		}
+		if errObj.ExitCode != tt.expected {
+			t.Errorf("%s: wrong exit code. want=%d, got=%d", tt.input, tt.expected, errObj.ExitCode)
+		}
+	}
+
+	testErrorObject(t, testEval(`exit(256)`), "exit: argument 1 must be between 0 and 255, got 256")
+	testErrorObject(t, testEval(`exit("1")`), "exit: argument 1 must be integer, got string")
+}
+
+func TestVars(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let b = 1; let a = "x"; vars()`, `{"a":"x", "b":1}`},
+		{`vars()`, `{}`},
+		{`let g = 1; let f = fn(x) { let y = 2; vars() }; f(3)`, `{"x":3, "y":2}`},
+		{`let g = 1; let f = fn(x) { let g = 2; vars(true) }; f(3)`, `{"f":fn f(x) { ... }, "g":2, "x":3}`},
+		{`let g = 1; let f = fn(x) { vars(false) }; f(3)`, `{"x":3}`},
+		{`let f = fn() { let inner = fn() { vars(true) }; inner() }; keys(f())`, `["f", "inner"]`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// 組み込み関数は含まない
+	hash, ok := testEval(`vars(true)`).(*object.Hash)
+	if !ok || len(hash.Pairs) != 0 {
+		t.Errorf("vars should not include builtins. got=%v", hash)
+	}
+
+	testErrorObject(t, testEval(`vars(1)`), "vars: argument 1 must be boolean, got integer")
+	testErrorObject(t, testEval(`vars(true, true)`), "vars: expected 0 or 1 argument, got 2")
+}
+
+func TestTestAndRunTests(t *testing.T) {
+	var out strings.Builder
+	e := New(WithOutput(&out))
+	input := `
+let shared = 1;
+test("first", fn() { let shared = 2; assert(shared == 2) });
+test("second", fn() { assert(shared == 2, "shared was changed") });
+let failed = runTests();
+test("third", fn() { assert(true) });
+[failed, runTests(), runTests()]
+`
+	result := e.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+	if result.Inspect() != "[1, 0, 0]" {
+		t.Errorf("wrong failure counts. got=%s", result.Inspect())
+	}
+	want := "PASS first\n" +
+		"FAIL second: line 4, column 23: AssertionError: shared was changed\n" +
+		"1 passed, 1 failed\n" +
+		"PASS third\n" +
+		"1 passed, 0 failed\n" +
+		"0 passed, 0 failed\n"
+	if out.String() != want {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", want, out.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`assert(false)`, "assertion failed"},
+		{`assert(1 > 2, "one is not greater")`, "one is not greater"},
+		{`assert(true, 1)`, "assert: argument 2 must be string, got integer"},
+		{`test("t", fn(x) { x })`, "test: argument 2 must take no arguments, got 1 parameters"},
+		{`test("t", fn() { 1 }); test("t", fn() { 2 })`, `test: argument 1 must be a new test name, got "t" twice`},
+		{`runTests(1)`, "runTests: expected 0 arguments, got 1"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+	if testEval(`assert(1)`) != NULL {
+		t.Errorf("assert should return null for a truthy value")
+	}
+}
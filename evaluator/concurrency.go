@@ -0,0 +1,94 @@
+package evaluator
+
+import (
+	"io"
+	"monkey/object"
+	"sync"
+)
+
+// spawn は引数のない関数 fn を別の goroutine で評価し、結果を待つ Task を返す
+//
+// 評価器は1つの goroutine でしか使えないので、fn は設定を引き継いだ別の評価器で評価する
+// 呼び出し履歴・トレーサー・文のフック・読み込んだモジュールは引き継がない
+// fn が参照する環境は Share で複数の goroutine から使えるようにしてから渡す
+// 配列やハッシュなどの値は共有されるので、書き換えながら別の goroutine から読む場合は send と recv で受け渡す
+func (e *Evaluator) spawn(call builtinCall, fn *object.Function) *object.Task {
+	object.ShareValue(fn)
+	if _, ok := e.out.(*lockedWriter); !ok {
+		e.out = &lockedWriter{w: e.out}
+	}
+	child := &Evaluator{
+		builtins:      e.builtins,
+		docs:          e.docs,
+		allowOverride: e.allowOverride,
+		ctx:           e.ctx,
+		maxSteps:      e.maxSteps,
+		maxDepth:      e.maxDepth,
+		maxTailCalls:  e.maxTailCalls,
+		out:           e.out,
+		moduleDirs:    append([]string(nil), e.moduleDirs...),
+		strict:        e.strict,
+	}
+
+	task := object.NewTask()
+	go func() {
+		result := child.applyFunction(fn, nil, call.site, fn.Env)
+		if result == nil {
+			result = NULL
+		}
+		object.ShareValue(result)
+		task.Finish(result)
+	}()
+	return task
+}
+
+// wait は task の評価が終わるまで待ち、結果を返す。評価がエラーになった場合はそのエラーを返す
+func (e *Evaluator) wait(task *object.Task) object.Object {
+	select {
+	case <-task.Done():
+		return task.Result()
+	case <-e.done():
+		return e.checkContext()
+	}
+}
+
+// send は ch に空きができるまで待ってから value を送る
+func (e *Evaluator) send(ch *object.Channel, value object.Object) object.Object {
+	object.ShareValue(value)
+	select {
+	case ch.Values <- value:
+		return NULL
+	case <-e.done():
+		return e.checkContext()
+	}
+}
+
+// recv は ch に値が送られるまで待ち、受け取った値を返す
+func (e *Evaluator) recv(ch *object.Channel) object.Object {
+	select {
+	case value := <-ch.Values:
+		return value
+	case <-e.done():
+		return e.checkContext()
+	}
+}
+
+// コンテキストが終了すると閉じられるチャネル。キャンセルできない場合は nil（閉じられない）
+func (e *Evaluator) done() <-chan struct{} {
+	if e.ctx == nil {
+		return nil
+	}
+	return e.ctx.Done()
+}
+
+// lockedWriter は spawn した評価器と puts の出力先を共有するときに、書き込みが混ざらないようにする
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,170 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"sort"
+)
+
+// BuiltinDoc は組み込み関数の説明。REPLの :doc と help で表示する
+type BuiltinDoc struct {
+	// 呼び出し方。省略できる引数は [ ] で、任意の個数の引数は ... で表す
+	Signature string
+	// 1行の説明
+	Summary string
+	// :doc の一覧で分ける分類（DocCategories のどれか。空なら "other"）
+	Category string
+}
+
+// String は :doc name と help(name) で表示する形にする
+//
+//	len(x)
+//	  Returns the number of elements of an array, hash, set or range, or the length in bytes of a string or builder.
+func (d BuiltinDoc) String() string {
+	return d.Signature + "\n  " + d.Summary
+}
+
+// DocCategories は :doc の一覧で分類を表示する順
+var DocCategories = []string{"collections", "arrays", "strings", "hashes", "sets", "numbers", "values", "errors", "program", "concurrency", "other"}
+
+// 標準の組み込み関数の説明。組み込み関数を追加したらここにも追加する（TestBuiltinDocs が確かめる）
+var builtinDocs = map[string]BuiltinDoc{
+	"len":      {"len(x)", "Returns the number of elements of an array, hash, set or range, or the length in bytes of a string or builder.", "collections"},
+	"contains": {"contains(collection, x)", "Reports whether a string contains a substring, an array or range an element, or a hash a key.", "collections"},
+	"get":      {"get(collection, key[, default])", "Returns the value of a hash key or array index, or default (null) when it is missing.", "collections"},
+	"map":      {"map(collection, fn)", "Returns an array of fn(value) for each element; fn may also take the key or index second.", "collections"},
+	"filter":   {"filter(collection, fn)", "Returns an array of the elements for which fn(value) is truthy.", "collections"},
+	"reduce":   {"reduce(collection, initial, fn)", "Folds the elements into one value with fn(acc, value), starting from initial.", "collections"},
+	"each":     {"each(collection, fn)", "Calls fn(value), or fn(key, value) if it takes two parameters, for each element and returns null.", "collections"},
+	"find":     {"find(collection, fn[, default])", "Returns the first element for which fn(value), or fn(key, value) if it takes two parameters, is truthy, or default (null) when there is none.", "collections"},
+	"every":    {"every(collection, fn)", "Reports whether fn(value), or fn(key, value) if it takes two parameters, is truthy for every element; stops at the first falsy one.", "collections"},
+	"any":      {"any(collection, fn)", "Reports whether fn(value), or fn(key, value) if it takes two parameters, is truthy for some element; stops at the first truthy one.", "collections"},
+	"groupBy":  {"groupBy(collection, fn)", "Returns a hash from each key fn(value) to the array of elements with that key.", "collections"},
+	"countBy":  {"countBy(collection, fn)", "Returns a hash from each key fn(value) to the number of elements with that key.", "collections"},
+	"toArray":  {"toArray(x)", "Returns the members of a set or the integers of a range as an array.", "collections"},
+
+	"first":     {"first(x)", "Returns the first element of an array or string, or null when it is empty.", "arrays"},
+	"firstOr":   {"firstOr(x, default)", "Returns the first element of an array or string, or default when it is empty.", "arrays"},
+	"last":      {"last(x)", "Returns the last element of an array or string, or null when it is empty.", "arrays"},
+	"lastOr":    {"lastOr(x, default)", "Returns the last element of an array or string, or default when it is empty.", "arrays"},
+	"rest":      {"rest(x)", "Returns a new array or string without the first element.", "arrays"},
+	"push":      {"push(array, x)", "Returns a new array with x added at the end; the array itself is not changed.", "arrays"},
+	"append":    {"append(target, x)", "Adds x to the end of an array or string builder in place and returns it.", "arrays"},
+	"pop":       {"pop(array)", "Removes the last element of the array in place and returns it.", "arrays"},
+	"dropLast":  {"dropLast(array)", "Returns a new array without the last element; the array itself is not changed.", "arrays"},
+	"flatten":   {"flatten(array[, depth])", "Returns the array with nested arrays spliced in, depth levels deep (1 by default, all if negative).", "arrays"},
+	"unique":    {"unique(array)", "Returns the array without repeated elements, keeping the first of each.", "arrays"},
+	"zip":       {"zip(array...)", "Returns an array of arrays holding the elements at the same index, as long as the shortest array.", "arrays"},
+	"concat":    {"concat(array...)", "Returns a new array with the elements of all the arrays in order.", "arrays"},
+	"findIndex": {"findIndex(array, fn)", "Returns the index of the first element for which fn(value), or fn(index, value) if it takes two parameters, is truthy, or -1.", "arrays"},
+	"sortBy":    {"sortBy(array, fn[, descending])", "Returns a new array sorted stably by the integer or string key fn(value).", "arrays"},
+
+	"builder":  {"builder([s])", "Returns a string builder that starts with s, for building long strings piece by piece with append.", "strings"},
+	"build":    {"build(builder)", "Returns the string written to a string builder so far.", "strings"},
+	"padLeft":  {"padLeft(s, width[, fill])", "Pads s on the left with fill (a space by default) to at least width characters.", "strings"},
+	"padRight": {"padRight(s, width[, fill])", "Pads s on the right with fill (a space by default) to at least width characters.", "strings"},
+	"repeat":   {"repeat(s, n)", "Returns s repeated n times.", "strings"},
+
+	"equalsFold":   {"equalsFold(a, b)", "Reports whether a and b are equal under Unicode case folding, as Go's strings.EqualFold.", "strings"},
+	"containsFold": {"containsFold(s, sub)", "Reports whether s contains sub under Unicode case folding.", "strings"},
+	"compare":      {"compare(a, b)", "Returns -1, 0 or 1 as a sorts before, equal to or after b, comparing bytes.", "strings"},
+
+	"keys":   {"keys(hash)", "Returns the keys of the hash in insertion order.", "hashes"},
+	"values": {"values(hash)", "Returns the values of the hash in insertion order.", "hashes"},
+	"merge":  {"merge(a, b)", "Returns a new hash with the pairs of a and b; values from b win.", "hashes"},
+
+	"set":       {"set(x...)", "Returns a set of the arguments, or of the elements of a single array argument.", "sets"},
+	"add":       {"add(set, x)", "Adds x to the set in place and returns the set.", "sets"},
+	"has":       {"has(set, x)", "Reports whether x is a member of the set.", "sets"},
+	"remove":    {"remove(set, x)", "Removes x from the set in place and returns the set.", "sets"},
+	"union":     {"union(a, b)", "Returns a new set with the members of both sets.", "sets"},
+	"intersect": {"intersect(a, b)", "Returns a new set with the members common to both sets.", "sets"},
+
+	"range":        {"range([start, ]stop[, step])", "Returns the range of integers from start (0) up to but not including stop, by step (1).", "numbers"},
+	"pow":          {"pow(base, exponent)", "Returns base raised to a non-negative integer exponent, growing to a big integer if needed.", "numbers"},
+	"toFixed":      {"toFixed(n, digits)", "Formats the integer n with digits zeros after the decimal point.", "numbers"},
+	"formatNumber": {"formatNumber(n[, options])", "Formats the integer n with a thousands separator; options may set thousands and decimals.", "numbers"},
+
+	"type":     {"type(x)", "Returns the type name of x, such as \"integer\", \"function\" or \"builtin\".", "values"},
+	"inspect":  {"inspect(x[, verbose])", "Returns x as the REPL would print it; verbose shows function bodies and splits long values.", "values"},
+	"clone":    {"clone(x)", "Returns a deep copy of x that can be changed without affecting the original.", "values"},
+	"freeze":   {"freeze(x)", "Makes x and the arrays, hashes and sets inside it read-only, and returns x.", "values"},
+	"isFrozen": {"isFrozen(x)", "Reports whether x cannot be changed.", "values"},
+	"help":     {"help(name)", "Returns the documentation of a builtin, given its name or the builtin itself.", "values"},
+
+	"error":     {"error([kind, ]message)", "Raises an error with the given kind (Custom by default) and message.", "errors"},
+	"throw":     {"throw(x)", "Raises x as an error; a catch clause receives x itself.", "errors"},
+	"errorKind": {"errorKind(e)", "Returns the kind of an error caught by try/catch.", "errors"},
+	"assert":    {"assert(cond[, message])", "Raises an AssertionError with message (\"assertion failed\") unless cond is truthy.", "errors"},
+
+	"puts":     {"puts(x...)", "Prints each argument on its own line and returns null.", "program"},
+	"eval":     {"eval(source[, isolated])", "Evaluates source in the calling scope, or in a new inner scope if isolated is true.", "program"},
+	"vars":     {"vars([all])", "Returns a hash of the bindings of the current scope, or of all enclosing scopes too if all is true.", "program"},
+	"exit":     {"exit([code])", "Stops the program with the exit status code (0 by default).", "program"},
+	"test":     {"test(name, fn)", "Registers the zero-argument function fn as a test named name for runTests.", "program"},
+	"runTests": {"runTests()", "Runs the registered tests in order, prints a line for each and a summary, and returns the number that failed.", "program"},
+
+	"spawn":   {"spawn(fn)", "Runs the zero-argument function fn on another goroutine and returns a task.", "concurrency"},
+	"wait":    {"wait(task)", "Waits for a task to finish and returns its result, or its error.", "concurrency"},
+	"channel": {"channel([size])", "Returns a channel holding up to size values (0 by default) for send and recv.", "concurrency"},
+	"send":    {"send(channel, x)", "Sends x on the channel, waiting while it is full.", "concurrency"},
+	"recv":    {"recv(channel)", "Receives a value from the channel, waiting while it is empty.", "concurrency"},
+}
+
+func init() {
+	// help は Doc を通して builtins を参照するので、初期化が循環しないよう init で加える
+	help := newEvaluatorBuiltin(func(e *Evaluator, call builtinCall, args ...object.Object) object.Object {
+		if err := object.CheckArgs("help", args, object.Arg(object.STRING_OBJ, object.BUILTIN_OBJ)); err != nil {
+			return err
+		}
+		// help("len") と help(len) のどちらでもよい
+		var name string
+		switch arg := args[0].(type) {
+		case *object.String:
+			name = arg.Value
+		case *object.Builtin:
+			name = arg.Name
+		}
+		doc, ok := e.Doc(name)
+		if !ok {
+			return object.ArgError(object.ValueError, "help", 1, "must name a documented builtin, got %q", name)
+		}
+		return &object.String{Value: doc.String()}
+	})
+	help.Name = "help"
+	builtins["help"] = help
+}
+
+// RegisterDocumentedBuiltin は RegisterBuiltin と同じく組み込み関数を登録し、:doc と help で表示する説明も登録する
+func (e *Evaluator) RegisterDocumentedBuiltin(name string, fn object.BuiltinFunction, doc BuiltinDoc) error {
+	if err := e.RegisterBuiltin(name, fn); err != nil {
+		return err
+	}
+	if e.docs == nil {
+		e.docs = map[string]BuiltinDoc{}
+	}
+	e.docs[name] = doc
+	return nil
+}
+
+// Doc はこの評価器で使える組み込み関数 name の説明を返す
+// 説明を付けずに登録した組み込み関数（標準の組み込み関数を置き換えたものを含む）では ok が false になる
+func (e *Evaluator) Doc(name string) (doc BuiltinDoc, ok bool) {
+	if doc, ok := e.docs[name]; ok {
+		return doc, true
+	}
+	if builtin, exists := e.builtins[name]; !exists || builtin != builtins[name] {
+		return BuiltinDoc{}, false
+	}
+	doc, ok = builtinDocs[name]
+	return doc, ok
+}
+
+// BuiltinNames はこの評価器で使える組み込み関数の名前を辞書順で返す
+func (e *Evaluator) BuiltinNames() []string {
+	names := make([]string, 0, len(e.builtins))
+	for name := range e.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
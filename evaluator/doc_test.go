@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+// 説明のない組み込み関数を追加すると失敗する
+func TestBuiltinDocs(t *testing.T) {
+	e := New()
+	categories := map[string]bool{}
+	for _, c := range DocCategories {
+		categories[c] = true
+	}
+
+	for _, name := range e.BuiltinNames() {
+		doc, ok := e.Doc(name)
+		if !ok {
+			t.Errorf("builtin %q has no documentation in builtinDocs", name)
+			continue
+		}
+		if !strings.HasPrefix(doc.Signature, name+"(") {
+			t.Errorf("signature of %q should start with %q. got=%q", name, name+"(", doc.Signature)
+		}
+		if doc.Summary == "" {
+			t.Errorf("builtin %q has an empty summary", name)
+		}
+		if !categories[doc.Category] {
+			t.Errorf("builtin %q has an unknown category %q", name, doc.Category)
+		}
+	}
+	for name := range builtinDocs {
+		if _, ok := builtins[name]; !ok {
+			t.Errorf("builtinDocs documents %q, which is not a builtin", name)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`help("len")`, "len(x)\n  Returns the number of elements of an array, hash, set or range, or the length in bytes of a string or builder."},
+		{`help(sortBy)`, "sortBy(array, fn[, descending])\n  Returns a new array sorted stably by the integer or string key fn(value)."},
+		{`help("nope")`, errorMessage(`help: argument 1 must name a documented builtin, got "nope"`)},
+		{`help(1)`, errorMessage("help: argument 1 must be string or builtin, got integer")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("%s: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("%s: wrong value. want=%q, got=%q", tt.input, expected, str.Value)
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestRegisterDocumentedBuiltin(t *testing.T) {
+	double := func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}
+	doc := BuiltinDoc{Signature: "double(n)", Summary: "Returns n times two.", Category: "numbers"}
+
+	e := New(AllowBuiltinOverride())
+	if err := e.RegisterDocumentedBuiltin("double", double, doc); err != nil {
+		t.Fatalf("RegisterDocumentedBuiltin returned error: %s", err)
+	}
+	if got, ok := e.Doc("double"); !ok || got != doc {
+		t.Errorf("wrong doc for double. got=%+v, %t", got, ok)
+	}
+
+	program := parser.New(lexer.New(`help("double")`)).ParseProgram()
+	if got := e.Eval(program, object.NewEnvironment()).Inspect(); got != doc.String() {
+		t.Errorf("wrong help output. want=%q, got=%q", doc.String(), got)
+	}
+
+	// 説明なしで登録し直すと説明も消える。標準の組み込み関数を置き換えた場合も同じ
+	if err := e.RegisterBuiltin("double", double); err != nil {
+		t.Fatalf("RegisterBuiltin returned error: %s", err)
+	}
+	if err := e.RegisterBuiltin("len", double); err != nil {
+		t.Fatalf("RegisterBuiltin returned error: %s", err)
+	}
+	for _, name := range []string{"double", "len"} {
+		if _, ok := e.Doc(name); ok {
+			t.Errorf("%s should have no documentation after being replaced", name)
+		}
+	}
+	if _, ok := New().Doc("len"); !ok {
+		t.Errorf("replacing len should not affect other evaluators")
+	}
+}
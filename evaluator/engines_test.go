@@ -0,0 +1,305 @@
+package evaluator_test
+
+// 評価器と仮想マシンで同じ結果になることを確かめるテスト
+// compiler が evaluator の組み込み関数を使うので、evaluator の外のパッケージに置く
+
+import (
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"testing"
+)
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			testIntegerObject(t, engine.eval(tt.input), tt.expected)
+		}
+	}
+}
+
+func TestEnclosingEnvironments(t *testing.T) {
+	input := `
+let first = 10;
+let second = 10;
+let third = 10;
+
+let ourFunction = fn(first) {
+  let second = 20;
+
+  first + second + third;
+};
+
+ourFunction(20) + first + second;`
+
+	for _, engine := range engines {
+		testIntegerObject(t, engine.eval(input), 70)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`, 4},
+		{`
+let newAdder = fn(a, b) {
+  let c = a + b;
+  fn(d) { let e = d + c; fn(f) { e + f } };
+};
+let adder = newAdder(1, 2);
+adder(8)(9);`, 20},
+		{`
+let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1) };
+let wrapper = fn() { countDown(1) };
+wrapper();`, 0},
+		{`
+let wrapper = fn() {
+  let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1) };
+  countDown(1);
+};
+wrapper();`, 0},
+		{`
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(15);`, 610},
+		{`
+let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+if (isEven(10)) { 1 } else { 0 };`, 1},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			testIntegerObject(t, engine.eval(tt.input), tt.expected)
+		}
+	}
+}
+
+// クロージャが名前を参照で捕捉することを確かめる
+// 評価器は環境を、VMは大域変数を番号で参照するので、束縛し直した値が見える
+func TestClosureCapture(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 作った後で束縛し直した値が見える
+		{`let x = 1; let f = fn() { x }; let x = 2; f()`, "2"},
+		// 呼び出しごとに別の環境になるので、カウンタはそれぞれ独立に数える
+		{`
+let counter = fn() {
+  let calls = [];
+  fn() { append(calls, 1); len(calls) }
+};
+let a = counter();
+let b = counter();
+a(); a();
+[a(), b()]`, "[3, 1]"},
+		// 捕捉した配列の変更は外からも見える
+		{`let xs = [1]; let add = fn(x) { append(xs, x) }; add(2); add(3); xs`, "[1, 2, 3]"},
+		// 関数の中の let は新しい束縛で、捕捉した外側の名前は変わらない
+		{`let x = 1; let f = fn() { let x = 2; x }; [f(), x]`, "[2, 1]"},
+		{`let xs = [1]; let f = fn() { let xs = [2]; xs }; [f(), xs]`, "[[2], [1]]"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			evaluated := engine.eval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("%s: %s: wrong result. want=%s, got=%s", engine.name, tt.input, tt.expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestBuiltinValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = len; f("abc")`, "3"},
+		{`let fs = [len, first]; [fs[0]("ab"), fs[1]([7, 8])]`, "[2, 7]"},
+		{`let h = {"size": len}; h["size"]([1, 2, 3])`, "3"},
+		{`let apply = fn(g, x) { g(x) }; apply(len, "abcd")`, "4"},
+		// 関数の中で隠しても、外側では組み込み関数のまま
+		{`let f = fn() { let len = fn(x) { 99 }; len([1]) }; [f(), len([1])]`, "[99, 1]"},
+		{`[type(len), type(fn(x) { x }), type(1), type("a"), type([])]`, `["builtin", "function", "integer", "string", "array"]`},
+		{`len`, "builtin fn: len"},
+		{`[len, puts]`, "[builtin fn: len, builtin fn: puts]"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			evaluated := engine.eval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("%s: %s: wrong result. want=%s, got=%s", engine.name, tt.input, tt.expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestUnusableHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{[[1]]: 1}`, "unusable as hash key: ARRAY"},
+		{`{[{"a": 1}]: 1}`, "unusable as hash key: HASH"},
+		{`{[fn(x) { x }]: 1}`, "unusable as hash key: FUNCTION"},
+		{`{[len]: 1}`, "unusable as hash key: BUILTIN"},
+		{`{[if (false) { 1 }]: 1}`, "unusable as hash key: NULL"},
+		{`let k = [1]; {"a": 1, [k]: 2}`, "unusable as hash key: ARRAY"},
+		{`{"a": 1}[[1]]`, "unusable as hash key: ARRAY"},
+		{`{"a": 1}[{}]`, "unusable as hash key: HASH"},
+		{`{"a": 1}[fn() { 1 }]`, "unusable as hash key: FUNCTION"},
+		{`{"a": 1}[if (false) { 1 }]`, "unusable as hash key: NULL"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			errObj, ok := engine.eval(tt.input).(*object.Error)
+			if !ok {
+				t.Errorf("%s: %s: no error object returned", engine.name, tt.input)
+				continue
+			}
+			if errObj.Message != tt.expected {
+				t.Errorf("%s: %s: wrong error message. want=%q, got=%q", engine.name, tt.input, tt.expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestWrongNumberOfArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { 1; }(1);", "wrong number of arguments: want=0, got=1"},
+		{"fn(a) { a; }();", "wrong number of arguments: want=1, got=0"},
+		{"fn(a, b) { a + b; }(1);", "wrong number of arguments: want=2, got=1"},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			errObj, ok := engine.eval(tt.input).(*object.Error)
+			if !ok {
+				t.Errorf("%s: %s: no error object returned", engine.name, tt.input)
+				continue
+			}
+			if errObj.Message != tt.expected {
+				t.Errorf("%s: %s: wrong error message. want=%q, got=%q", engine.name, tt.input, tt.expected, errObj.Message)
+			}
+		}
+	}
+}
+
+// engines は同じ入力を評価器とVMのそれぞれで実行する
+var engines = []struct {
+	name string
+	eval func(input string) object.Object
+}{
+	{"eval", testEval},
+	{"vm", testVM},
+}
+
+func testEval(input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return evaluator.Eval(program, object.NewEnvironment())
+}
+
+// testVM は input をコンパイルしてVMで実行する。エラーは評価器と同じく *object.Error で返す
+func testVM(input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	machine := vm.New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return machine.LastPoppedStackElem()
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	t.Helper()
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestBlockStatements(t *testing.T) {
+	// 文の先頭のブロックは if のブロックと同じく新しいスコープを作らず、最後の式の値になる
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{ let x = 2; x * 3 }", "6"},
+		{"let x = 1; { let y = x + 1; }; y", "2"},
+		{"let f = fn() { { return 5; } 6 }; f()", "5"},
+		{"{}", "{}"},
+		{`{"a": 1}["a"]`, "1"},
+		{"let a = 1; let b = 2; {a, b}", `{"a":1, "b":2}`},
+		{`{ {"a": 1} }`, `{"a":1}`},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			if got := engine.eval(tt.input).Inspect(); got != tt.expected {
+				t.Errorf("%s: %s: want=%s, got=%s", engine.name, tt.input, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestTopLevelReturn(t *testing.T) {
+	// トップレベルの return はプログラムを終え、その値がプログラムの値になる。後の文は評価しない
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 5; 10", 5},
+		{"return 5; len(1)", 5},
+		{"return 5; let y = len(1);", 5},
+		{"let x = 1; if (x == 1) { return x + 1; } x + 100", 2},
+		{"if (false) { return 1; } 2", 2},
+		{"{ return 7; len(1) }; 9", 7},
+		{"let f = fn() { return 1; }; return f() + 1; len(1)", 2},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			if !testIntegerObject(t, engine.eval(tt.input), tt.expected) {
+				t.Errorf("%s: %s", engine.name, tt.input)
+			}
+		}
+	}
+}
@@ -1,214 +1,399 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"math"
 	"monkey/ast"
+	"monkey/lexer"
 	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"os"
+	"strings"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+	NULL  = object.NULL
 )
 
-var builtins = map[string]*object.Builtin{
-	"len": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-			switch arg := args[0].(type) {
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			default:
-				return newError("argument to `len` not supported, got %s", arg.Type())
-			}
-		},
-	},
-	"first": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
-			}
-			array := args[0].(*object.Array)
-			if len(array.Elements) == 0 {
-				return NULL
-			}
-			return array.Elements[0]
-		},
-	},
-	"last": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
-			}
-			array := args[0].(*object.Array)
-			if len(array.Elements) == 0 {
-				return NULL
-			}
-			return array.Elements[len(array.Elements)-1]
-		},
-	},
-	"rest": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
-			}
-			array := args[0].(*object.Array)
-			length := len(array.Elements)
-			if length == 0 {
-				return NULL
-			}
-			newElements := make([]object.Object, length-1, length-1) // 初期サイズlength-1のスライスを確保する
-			copy(newElements, array.Elements[1:length])
-			return &object.Array{Elements: newElements}
-		},
-	},
-	"push": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2", len(args))
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
-			}
-			array := args[0].(*object.Array)
-			length := len(array.Elements)
-			newElements := make([]object.Object, length+1, length+1)
-			copy(newElements, array.Elements)
-			newElements[length] = args[1]
-			return &object.Array{Elements: newElements}
-		},
-	},
-	"puts": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-			return NULL
-		},
-	},
+// Evaluator は評価器ごとの設定（組み込み関数の表など）と評価中の状態を保持する
+// 評価中の状態（呼び出し履歴やステップ数）を持つため、複数のgoroutineから同時に使ってはならない
+// 並行に評価する場合は goroutine ごとに New で生成する
+type Evaluator struct {
+	// 組み込み関数の表。RegisterBuiltin を呼ぶまでは標準の表を共有する
+	builtins      map[string]*object.Builtin
+	ownsBuiltins  bool
+	allowOverride bool
+	// RegisterDocumentedBuiltin で登録した組み込み関数の説明
+	docs map[string]BuiltinDoc
+	// 現在の呼び出し履歴（外側の呼び出しが先頭）
+	stack []object.StackFrame
+	// EvalContext で渡されたコンテキスト（キャンセルできない場合はnil）
+	ctx context.Context
+	// 前回コンテキストを確認してから評価したノード数
+	ticks int
+	// 評価できるノード数の上限（0は無制限）と、直近の評価で評価したノード数
+	maxSteps int
+	steps    int
+	// 関数呼び出しの入れ子の上限と、続けて置き換えられる末尾呼び出しの数の上限
+	maxDepth     int
+	maxTailCalls int
+	// 呼び出し履歴 stack のうち、末尾呼び出しで置き換えたが表示のために残しているフレームの数
+	// 入れ子の深さには数えない
+	tailFrames int
+	// 評価の進行を通知する先（通知しない場合はnil）
+	tracer Tracer
+	// puts の出力先
+	out io.Writer
+	// 各文を評価する前に呼ぶフック（呼ばない場合はnil）と、一時停止を解除する通知
+	statementHook StatementHook
+	resume        chan struct{}
+	// 読み込んだモジュール（絶対パスがキー）と、読み込み中のモジュールのパスとディレクトリ
+	modules    map[string]*object.Module
+	loading    map[string]bool
+	moduleDirs []string
+	// trueなら同じスコープで同じ名前を let で束縛し直すとエラーにする
+	strict bool
+	// test で登録し、まだ runTests で実行していないテスト（登録順）
+	tests []registeredTest
+	// 直前に評価したプログラムがトップレベルの return で終わったか
+	returned bool
+}
+
+// 関数呼び出しの入れ子の上限の既定値
+const DefaultMaxDepth = 10000
+
+// 続けて置き換えられる末尾呼び出しの数の上限の既定値
+// 末尾呼び出しだけの無限ループ（fn() { f() } など）も、この回数で入れ子の上限と同じエラーになる
+const DefaultMaxTailCalls = 2000000
+
+// コンテキストを確認する間隔（評価したノード数）
+const contextCheckInterval = 1024
+
+// Option は New に渡す評価器の設定
+type Option func(*Evaluator)
+
+// AllowBuiltinOverride は RegisterBuiltin で既存の組み込み関数を上書きすることを許可する
+func AllowBuiltinOverride() Option {
+	return func(e *Evaluator) {
+		e.allowOverride = true
+	}
+}
+
+// WithMaxSteps は1回の評価で評価できるノード数の上限を設定する。0は無制限
+func WithMaxSteps(n int) Option {
+	return func(e *Evaluator) {
+		e.maxSteps = n
+	}
+}
+
+// WithMaxDepth は関数呼び出しの入れ子の上限を設定する
+// 末尾呼び出しは呼び出し元の分を置き換えるので数えない。末尾呼び出しの数は WithMaxTailCalls で制限する
+func WithMaxDepth(n int) Option {
+	return func(e *Evaluator) {
+		e.maxDepth = n
+	}
 }
 
+// WithMaxTailCalls は、1つの呼び出しから続けて置き換えられる末尾呼び出しの数の上限を設定する
+// 超えると入れ子の上限と同じく "maximum recursion depth exceeded" になる
+func WithMaxTailCalls(n int) Option {
+	return func(e *Evaluator) {
+		e.maxTailCalls = n
+	}
+}
+
+// WithOutput は puts の出力先を設定する。既定は標準出力
+func WithOutput(w io.Writer) Option {
+	return func(e *Evaluator) {
+		e.out = w
+	}
+}
+
+// WithStrict は同じスコープですでに束縛されている名前を let で束縛し直すことをエラーにする
+// 外側のスコープ（プレリュードや関数の外）の名前を隠す let はエラーにしない
+func WithStrict() Option {
+	return func(e *Evaluator) {
+		e.strict = true
+	}
+}
+
+// New は標準の組み込み関数を持つ評価器を生成する
+func New(opts ...Option) *Evaluator {
+	e := &Evaluator{
+		builtins:     builtins,
+		maxDepth:     DefaultMaxDepth,
+		maxTailCalls: DefaultMaxTailCalls,
+		out:          os.Stdout,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// RegisterBuiltin はこの評価器だけで使える組み込み関数を登録する
+// 同名の組み込み関数がある場合、AllowBuiltinOverride を指定していなければエラーを返す
+func (e *Evaluator) RegisterBuiltin(name string, fn object.BuiltinFunction) error {
+	if name == "quote" {
+		// quote の呼び出しは引数を評価しないよう特別に扱うので、組み込み関数に置き換えられない
+		return fmt.Errorf("%q is reserved", name)
+	}
+	if _, exists := e.builtins[name]; exists && !e.allowOverride {
+		return fmt.Errorf("builtin %q is already defined", name)
+	}
+	if !e.ownsBuiltins {
+		// 標準の表は書き換えず、初めて登録するときに複製する
+		own := make(map[string]*object.Builtin, len(e.builtins)+1)
+		for n, builtin := range e.builtins {
+			own[n] = builtin
+		}
+		e.builtins, e.ownsBuiltins = own, true
+	}
+	e.builtins[name] = &object.Builtin{Fn: fn, Name: name}
+	// 以前に登録した説明は新しい関数のものではない
+	delete(e.docs, name)
+	return nil
+}
+
+// StepsUsed は直近の評価で評価したノード数を返す
+func (e *Evaluator) StepsUsed() int {
+	return e.steps
+}
+
+// Eval は標準の設定の評価器でノードを評価する
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalContext(context.Background(), node, env)
+}
+
+// EvalContext は標準の設定の評価器で、ctxがキャンセルされるまでノードを評価する
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return New().EvalContext(ctx, node, env)
+}
+
+// EvalContext はノードを評価する。ctxがキャンセルされるかタイムアウトすると評価を打ち切り、エラーを返す
+// コンテキストは関数呼び出しのたびと、一定数のノードを評価するたびに確認する
+func (e *Evaluator) EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	defer e.enter(ctx)()
+	return e.eval(node, env)
+}
+
+// enter は1回の評価を始める。ctx を確認するよう設定し、評価したノード数を数え直す
+// 返す関数を呼ぶと、元のコンテキストに戻す
+func (e *Evaluator) enter(ctx context.Context) func() {
+	outer := e.ctx
+	if ctx.Done() != nil {
+		e.ctx = ctx
+	} else {
+		e.ctx = nil // キャンセルされないコンテキストは確認しない
+	}
+	e.steps = 0
+	return func() { e.ctx = outer }
+}
+
+// Returned は直前に Eval・EvalStream で評価したプログラムが、トップレベルの return で終わったかどうかを返す
+// トップレベルの return（ブロックや if の中にあるものも含む）はプログラムの評価を終え、その値をプログラムの値にする
+// return より後の文は評価しない。結果がエラーの場合は意味を持たない
+func (e *Evaluator) Returned() bool {
+	return e.returned
+}
+
+// Eval はノードを評価する
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	return e.EvalContext(context.Background(), node, env)
+}
+
+// 評価の本体。評価中に生成されたエラーには、原因となった式の位置とその時点の呼び出し履歴を記録する
+func (e *Evaluator) eval(node ast.Node, env *object.Environment) object.Object {
+	if e.tracer != nil {
+		e.tracer.EnterNode(node)
+	}
+	result := e.checkLimits()
+	if result == nil {
+		result = e.evalNode(node, env)
+	}
+	result = e.annotateError(result, node)
+	if e.tracer != nil {
+		e.tracer.ExitNode(node, result)
+	}
+	return result
+}
+
+// resultがエラーで位置や呼び出し履歴が未記録なら、nodeの位置と現在の呼び出し履歴を記録する
+func (e *Evaluator) annotateError(result object.Object, node ast.Node) object.Object {
+	if err, ok := result.(*object.Error); ok {
+		if err.Line == 0 {
+			// 最も内側でエラーを返したノードの位置を使う
+			tok := nodeToken(node)
+			err.Line, err.Column = tok.Line, tok.Column
+		}
+		if err.Stack == nil {
+			err.Stack = e.stackTrace()
+		}
+	}
+	return result
+}
+
+func (e *Evaluator) evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// 文
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.eval(node.Expression, env)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := e.eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		if e.strict && env.HasLocal(node.Name.Value) {
+			return newError(object.NameError, "%s is already defined in this scope", node.Name.Value)
+		}
+		val := e.eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
+	case *ast.ImportStatement:
+		return e.evalImportStatement(node, env)
 		// 式
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return object.NewInteger(node.Value)
+	case *ast.BigIntegerLiteral:
+		return &object.BigInteger{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBooleanObject(node.Value)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := e.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		right := e.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+	case *ast.ForInExpression:
+		return e.evalForInExpression(node, env)
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := e.eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+	case *ast.OptionalIndexExpression:
+		left := e.eval(node.Left, env)
+		if isError(left) || left == object.NULL {
+			return left
+		}
+		index := e.eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
+		// クロージャは値ではなく環境そのものを持つ（参照による捕捉）
+		// 作った後で同じスコープの名前を let で束縛し直すと、クロージャからも新しい値が見える
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Body: body, Env: env, Name: node.Name}
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		if isQuoteCall(node) {
+			return e.evalQuote(node, env)
+		}
+		function := e.eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		args := e.evalCallArguments(function, node, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return e.applyFunction(function, args, callSite(node), env)
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
 	}
 
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (e *Evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
-
-		switch rslt := result.(type) {
-		case *object.ReturnValue:
-			return rslt.Value
-		case *object.Error:
-			return rslt
+		var done bool
+		if result, done = e.evalTopLevel(statement, env); done {
+			e.returned = !isError(result)
+			return result
 		}
 	}
 
+	e.returned = false
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+// evalTopLevel はプログラムの最上位の文を1つ評価する
+// return 文やエラーでプログラムを終える場合は done が true で、result はプログラムの値になる
+// return でエラーは返せないので、done が true で result がエラーでなければ return で終えたことになる
+func (e *Evaluator) evalTopLevel(statement ast.Statement, env *object.Environment) (result object.Object, done bool) {
+	if e.statementHook != nil {
+		if err := e.beforeStatement(statement, env); err != nil {
+			return err, true
+		}
+	}
+	result = e.eval(statement, env)
+
+	switch rslt := result.(type) {
+	case *object.ReturnValue:
+		return rslt.Value, true
+	case *object.Error:
+		return rslt, true
+	}
+	return result, false
+}
+
+func (e *Evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		if e.statementHook != nil {
+			if err := e.beforeStatement(statement, env); err != nil {
+				return err
+			}
+		}
+		result = e.eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
@@ -234,8 +419,14 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "+":
+		// 単項の + は整数をそのまま返す
+		if !isInteger(right) {
+			return newError(object.TypeError, "unknown operator: +%s", right.Type())
+		}
+		return right
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -254,18 +445,23 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 
 // 算術負号
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+	if !isInteger(right) {
+		return newError(object.TypeError, "unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return negateInteger(right)
 
 }
 
 func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	switch {
+	case operator == "is":
+		return nativeBooleanObject(identical(left, right))
+	case operator == ".." && left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return &object.Range{Start: left.(*object.Integer).Value, Stop: right.(*object.Integer).Value, Step: 1}
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isInteger(left) && isInteger(right) && operator != "..":
+		return evalBigIntegerInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
@@ -273,9 +469,35 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 	case operator == "!=":
 		return nativeBooleanObject(left != right)
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// left is right の判定。書き換えられる配列・ハッシュ・集合などは同じオブジェクトかどうかを、
+// 整数・文字列・真偽値・null・範囲のような不変の値は値が等しいかどうかを返す
+func identical(left, right object.Object) bool {
+	if left.Type() != right.Type() {
+		return false
+	}
+	switch l := left.(type) {
+	case *object.Integer:
+		// 小さい整数以外は同じ値でも別のオブジェクトになる
+		return l.Value == right.(*object.Integer).Value
+	case *object.BigInteger:
+		return l.Value.Cmp(right.(*object.BigInteger).Value) == 0
+	case *object.String:
+		return l.Value == right.(*object.String).Value
+	case *object.Boolean:
+		return l.Value == right.(*object.Boolean).Value
+	case *object.Null:
+		return true
+	case *object.Range:
+		r := right.(*object.Range)
+		return l.Start == r.Start && l.Stop == r.Stop && l.Step == r.Step
+	default:
+		return left == right
 	}
 }
 
@@ -283,15 +505,31 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	// 桁あふれする場合は BigInteger で計算し直す
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		if sum, ok := addInt64(leftVal, rightVal); ok {
+			return object.NewInteger(sum)
+		}
+		return evalBigIntegerInfixExpression(operator, left, right)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		if diff, ok := subInt64(leftVal, rightVal); ok {
+			return object.NewInteger(diff)
+		}
+		return evalBigIntegerInfixExpression(operator, left, right)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		if product, ok := mulInt64(leftVal, rightVal); ok {
+			return object.NewInteger(product)
+		}
+		return evalBigIntegerInfixExpression(operator, left, right)
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		if rightVal == 0 {
+			return newError(object.DivisionByZero, "division by zero")
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return evalBigIntegerInfixExpression(operator, left, right)
+		}
+		return object.NewInteger(leftVal / rightVal)
 	case "<":
 		return nativeBooleanObject(leftVal < rightVal)
 	case ">":
@@ -301,7 +539,7 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "!=":
 		return nativeBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -313,33 +551,114 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 	case "+":
 		return &object.String{Value: leftVal + rightVal}
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
+// 反復する対象の要素ごとに、変数を束縛した新しい環境で本体を評価する。値はnull
+// 環境は反復ごとに作るので、本体で作ったクロージャはそれぞれの反復の値を捕捉する
+func (e *Evaluator) evalForInExpression(fe *ast.ForInExpression, env *object.Environment) object.Object {
+	iterable := e.eval(fe.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	collection, ok := iterable.(object.Iterable)
+	if !ok {
+		return newError(object.TypeError, "not iterable: %s", iterable.Type())
+	}
+
+	it := collection.Iter()
+	for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+		loopEnv := object.NewEnclosedEnvironment(env)
+		if fe.Key != nil {
+			loopEnv.Set(fe.Key.Value, key)
+		}
+		loopEnv.Set(fe.Value.Value, value)
+
+		result := e.eval(fe.Body, loopEnv)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	return NULL
+}
+
+// try のブロックがエラーになった場合、そのエラーを値にして catch のブロックを評価する
+// exit() による終了と、評価ステップ数の上限やコンテキストによる中断は捕まえない
+func (e *Evaluator) evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := e.eval(te.Body, env)
+	err, ok := result.(*object.Error)
+	if !ok || !e.catchable(err) {
+		return result
+	}
+
+	handlerEnv := object.NewEnclosedEnvironment(env)
+	if err.Value != nil {
+		// throw() で投げた値はそのまま渡す
+		handlerEnv.Set(te.Param.Value, err.Value)
+	} else {
+		handlerEnv.Set(te.Param.Value, errorValue(err))
+	}
+	return e.eval(te.Handler, handlerEnv)
+}
+
+// err を try で捕まえてよい場合はtrueを返す
+func (e *Evaluator) catchable(err *object.Error) bool {
+	if err.Exit {
+		return false
+	}
+	if e.maxSteps > 0 && e.steps >= e.maxSteps {
+		return false
+	}
+	return e.ctx == nil || e.ctx.Err() == nil
+}
+
+// 捕まえたエラーを、種類・メッセージ・位置を持つハッシュにする
+// Error のまま束縛すると、参照しただけで再びエラーとして伝わってしまう
+func errorValue(err *object.Error) object.Object {
+	hash := object.NewHash()
+	hash.Set(&object.String{Value: "kind"}, &object.String{Value: string(err.Kind)})
+	hash.Set(&object.String{Value: "message"}, &object.String{Value: err.Message})
+	hash.Set(&object.String{Value: "line"}, object.NewInteger(int64(err.Line)))
+	hash.Set(&object.String{Value: "column"}, object.NewInteger(int64(err.Column)))
+	return hash
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		value, ok := left.(*object.Range).At(index.(*object.Integer).Value)
+		if !ok {
+			return NULL
+		}
+		return object.NewInteger(value)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.MODULE_OBJ:
+		return evalModuleIndexExpression(left.(*object.Module), index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newError(object.TypeError, "index operator not supported: %s", left.Type())
 	}
 }
 
@@ -356,45 +675,57 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+	if err := object.CheckHashKey(index); err != nil {
+		return err
 	}
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	pair, ok := hashObject.Pairs[index.(object.Hashable).HashKey()]
 	if !ok {
 		return NULL
 	}
 	return pair.Value
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+	// 記述した順に評価して挿入する
+	for _, keyNode := range node.Keys {
+		key := e.eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+		if err := object.CheckHashKey(key); err != nil {
+			return err
 		}
 
-		value := Eval(valueNode, env)
+		value := e.eval(node.Pairs[keyNode], env)
 		if isError(value) {
 			return value
 		}
-		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+		hash.Set(key, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (e *Evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
-	for _, e := range exps {
-		evaluated := Eval(e, env)
+	for _, exp := range exps {
+		if spread, ok := exp.(*ast.SpreadExpression); ok {
+			// ...xs は配列の要素をその位置に展開する
+			evaluated := e.eval(spread.Value, env)
+			if isError(evaluated) {
+				return []object.Object{evaluated}
+			}
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				return []object.Object{e.annotateError(newError(object.TypeError, "spread operator: expected ARRAY, got %s", evaluated.Type()), spread)}
+			}
+			result = append(result, array.Elements...)
+			continue
+		}
+		evaluated := e.eval(exp, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -405,17 +736,250 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 }
 
 // 関数の評価
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	switch function := fn.(type) {
-	case *object.Function:
-		extendedEnv := extendedFunctionEnv(function, args)
-		evaluated := Eval(function.Body, extendedEnv)
-		return unwrapReturnValue(evaluated) // return が伝搬しないために開ける
-	case *object.Builtin:
-		return function.Fn(args...)
+// siteは呼び出し箇所のトークンで、呼び出し履歴に記録する。envは呼び出し元の環境で、evalが使う
+// 関数本体の末尾位置での呼び出しは再帰せず、このループで続けて評価する（末尾呼び出しの最適化）
+// 置き換えた呼び出しは、呼び出し履歴が入れ子の上限に達するまではエラーの表示のために残す
+func (e *Evaluator) applyFunction(fn object.Object, args []object.Object, site token.Token, env *object.Environment) object.Object {
+	// このループで置き換えた末尾呼び出しの数、呼び出し履歴に積んだままのフレームの数、
+	// そのうち置き換えた呼び出しのものとして残したフレームの数
+	var tailCalls, frames, kept int
+	// 積んだフレームを取り除いて result を返す。エラーには取り除く前の呼び出し履歴を記録する
+	finish := func(result object.Object) object.Object {
+		if frames == 0 {
+			return result
+		}
+		if err, ok := result.(*object.Error); ok && err.Stack == nil {
+			err.Stack = e.stackTrace()
+		}
+		e.stack = e.stack[:len(e.stack)-frames]
+		e.tailFrames -= kept
+		return result
+	}
+
+	for {
+		switch function := fn.(type) {
+		case *object.Function:
+			if err := e.checkContext(); err != nil {
+				return finish(err)
+			}
+			if frames > 0 {
+				// 末尾呼び出し。呼び出し元のフレームは、履歴に余裕があれば残し、なければ置き換える
+				if tailCalls >= e.maxTailCalls {
+					return finish(newError(object.LimitError, "maximum recursion depth exceeded"))
+				}
+				tailCalls++
+				if len(e.stack) < e.maxDepth {
+					kept++
+					e.tailFrames++
+				} else {
+					e.popFrame()
+					frames--
+				}
+			}
+			if len(e.stack)-e.tailFrames >= e.maxDepth {
+				return finish(newError(object.LimitError, "maximum recursion depth exceeded"))
+			}
+			if len(args) != len(function.Parameters) {
+				err := newError(object.ArityError, "wrong number of arguments: want=%d, got=%d", len(function.Parameters), len(args))
+				err.Line, err.Column = site.Line, site.Column
+				return finish(err)
+			}
+			name := e.pushFrame(function.Name, site)
+			frames++
+			if e.tracer != nil {
+				e.tracer.EnterCall(name)
+			}
+			extendedEnv := extendedFunctionEnv(function, args)
+			evaluated := e.evalFunctionBody(function.Body, extendedEnv)
+			if e.tracer != nil {
+				e.tracer.ExitCall(name)
+			}
+
+			if call, ok := evaluated.(*tailCall); ok {
+				fn, args, site = call.function, call.args, call.site
+				continue
+			}
+			return finish(unwrapReturnValue(evaluated)) // return が伝搬しないために開ける
+		case *object.Builtin:
+			name := e.pushFrame(function.Name, site)
+			defer e.popFrame()
+			if e.tracer != nil {
+				e.tracer.EnterCall(name)
+				defer e.tracer.ExitCall(name)
+			}
+
+			var result object.Object
+			if impl, ok := evaluatorBuiltins[function]; ok {
+				result = impl(e, builtinCall{env: env, site: site}, args...)
+			} else {
+				result = function.Fn(args...)
+			}
+			if err, ok := result.(*object.Error); ok && err.Stack == nil {
+				err.Stack = e.stackTrace()
+			}
+			return result
+		case object.Callable:
+			name := e.pushFrame(object.TypeName(function.Type()), site)
+			defer e.popFrame()
+			if e.tracer != nil {
+				e.tracer.EnterCall(name)
+				defer e.tracer.ExitCall(name)
+			}
+
+			result := function.Call(args)
+			if err, ok := result.(*object.Error); ok && err.Stack == nil {
+				err.Stack = e.stackTrace()
+			}
+			return result
+		default:
+			err := newError(object.TypeError, "not a function: %s", fn.Type())
+			err.Line, err.Column = site.Line, site.Column
+			return err
+		}
+	}
+}
+
+// ノードを1つ評価する前に、評価ステップ数の上限とコンテキストを確認する
+func (e *Evaluator) checkLimits() object.Object {
+	if e.maxSteps > 0 && e.steps >= e.maxSteps {
+		return newError(object.LimitError, "evaluation budget exceeded after %d steps", e.maxSteps)
+	}
+	e.steps++
+	if e.ctx != nil && e.tick() {
+		return e.checkContext()
+	}
+	return nil
+}
+
+// 一定数のノードを評価するごとにtrueを返す
+func (e *Evaluator) tick() bool {
+	e.ticks++
+	if e.ticks < contextCheckInterval {
+		return false
+	}
+	e.ticks = 0
+	return true
+}
+
+// コンテキストが終了していればエラーを返す
+func (e *Evaluator) checkContext() object.Object {
+	if e.ctx == nil {
+		return nil
+	}
+	select {
+	case <-e.ctx.Done():
+		return newError(object.LimitError, "evaluation cancelled: %s", e.ctx.Err())
 	default:
-		return newError("not a function: %s", fn.Type())
+		return nil
+	}
+}
+
+// 呼び出し履歴に積み、履歴に記録した関数名を返す
+func (e *Evaluator) pushFrame(name string, site token.Token) string {
+	if name == "" {
+		name = "<anonymous>"
+	}
+	e.stack = append(e.stack, object.StackFrame{Function: name, Line: site.Line, Column: site.Column})
+	return name
+}
+
+func (e *Evaluator) popFrame() {
+	e.stack = e.stack[:len(e.stack)-1]
+}
+
+// 現在の呼び出し履歴の写しを、内側の呼び出しが先頭になるように返す
+func (e *Evaluator) stackTrace() []object.StackFrame {
+	trace := make([]object.StackFrame, len(e.stack))
+	for i, frame := range e.stack {
+		trace[len(e.stack)-1-i] = frame
 	}
+	return trace
+}
+
+// エラーの位置として使うノードのトークン
+func nodeToken(node ast.Node) token.Token {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token
+	case *ast.ReturnStatement:
+		return node.Token
+	case *ast.ImportStatement:
+		return node.Token
+	case *ast.ExpressionStatement:
+		return node.Token
+	case *ast.BlockStatement:
+		return node.Token
+	case *ast.Identifier:
+		return node.Token
+	case *ast.IntegerLiteral:
+		return node.Token
+	case *ast.BigIntegerLiteral:
+		return node.Token
+	case *ast.StringLiteral:
+		return node.Token
+	case *ast.Boolean:
+		return node.Token
+	case *ast.PrefixExpression:
+		return node.Token
+	case *ast.InfixExpression:
+		return node.Token
+	case *ast.IfExpression:
+		return node.Token
+	case *ast.ForInExpression:
+		return node.Token
+	case *ast.TryExpression:
+		return node.Token
+	case *ast.FunctionLiteral:
+		return node.Token
+	case *ast.CallExpression:
+		return callSite(node)
+	case *ast.ArrayLiteral:
+		return node.Token
+	case *ast.SpreadExpression:
+		return node.Token
+	case *ast.IndexExpression:
+		return node.Token
+	case *ast.OptionalIndexExpression:
+		return node.Token
+	case *ast.HashLiteral:
+		return node.Token
+	default:
+		return token.Token{}
+	}
+}
+
+// 呼び出し箇所として記録するトークン。関数名で呼び出している場合はその識別子を使う
+func callSite(node *ast.CallExpression) token.Token {
+	if ident, ok := node.Function.(*ast.Identifier); ok {
+		return ident.Token
+	}
+	return node.Token
+}
+
+// 文字列をMonkeyのプログラムとして呼び出し元の環境で評価する（組み込み関数evalの本体）
+// 第2引数にtrueを渡すと、呼び出し元の環境を外側に持つ新しい環境で評価する
+// 文字列中の位置は元のプログラムと対応しないので記録せず、エラーの位置はevalの呼び出し箇所になる
+func (e *Evaluator) evalSource(call builtinCall, args ...object.Object) object.Object {
+	env := call.env
+	if err := object.CheckArgs("eval", args, object.Arg(object.STRING_OBJ), object.OptionalArg(object.BOOLEAN_OBJ)); err != nil {
+		return err
+	}
+	source := args[0].(*object.String)
+	if len(args) == 2 && args[1] == TRUE {
+		env = object.NewEnclosedEnvironment(env)
+	}
+
+	p := parser.New(lexer.NewUnpositioned(source.Value))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return newError(object.SyntaxError, "parse error in eval: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	result := e.eval(program, env)
+	if result == nil {
+		return NULL
+	}
+	return result
 }
 
 func extendedFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
@@ -433,16 +997,17 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+// 名前は参照するたびに環境を内側からたどって探す。クロージャの中の参照も同じ
+func (e *Evaluator) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := e.builtins[node.Value]; ok {
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError(object.NameError, "identifier not found: %s", node.Value)
 }
 
 func isTruthy(obj object.Object) bool {
@@ -456,8 +1021,8 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newError(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
 }
 
 func isError(obj object.Object) bool {
@@ -1,10 +1,17 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -16,6 +23,12 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"10", 10},
 		{"-5", -5},
 		{"-10", -10},
+		{"+5", 5},
+		{"- -5", 5},
+		{"-(-5)", 5},
+		{"+-5", -5},
+		{"-+5", -5},
+		{"10 - +3", 7},
 		{"5 + 5 + 5 + 5 - 10", 10},
 		{"2 * 2 * 2 * 2 * 2", 32},
 		{"-50 + 100 + -50", 0},
@@ -156,6 +169,22 @@ func TestErrorHandling(t *testing.T) {
 			"-true",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"+true",
+			"unknown operator: +BOOLEAN",
+		},
+		{
+			`+"5"`,
+			"unknown operator: +STRING",
+		},
+		{
+			"+[1]",
+			"unknown operator: +ARRAY",
+		},
+		{
+			"(1 < 2) < 3",
+			"type mismatch: BOOLEAN < INTEGER",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -256,41 +285,6 @@ func TestFunctionObject(t *testing.T) {
 	}
 }
 
-func TestFunctionApplication(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"let identity = fn(x) { x; }; identity(5);", 5},
-		{"let identity = fn(x) { return x; }; identity(5);", 5},
-		{"let double = fn(x) { x * 2; }; double(5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
-		{"fn(x) { x; }(5)", 5},
-	}
-
-	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
-	}
-}
-
-func TestEnclosingEnvironments(t *testing.T) {
-	input := `
-let first = 10;
-let second = 10;
-let third = 10;
-
-let ourFunction = fn(first) {
-  let second = 20;
-
-  first + second + third;
-};
-
-ourFunction(20) + first + second;`
-
-	testIntegerObject(t, testEval(input), 70)
-}
-
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 
@@ -327,21 +321,29 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got INTEGER"},
-		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len(1)`, "len: argument 1 must be string, array, hash, set, range or string_builder, got integer"},
+		{`len(true)`, "len: argument 1 must be string, array, hash, set, range or string_builder, got boolean"},
+		{`len(len)`, "len: argument 1 must be string, array, hash, set, range or string_builder, got builtin"},
+		{`len(fn() { 1 })`, "len: argument 1 must be string, array, hash, set, range or string_builder, got function"},
+		{`len("one", "two")`, "len: expected 1 argument, got 2"},
 		{`len([1, 2, 3])`, 3},
 		{`len([])`, 0},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`len({"a": 1, "a": 2})`, 1},
+		{`len({})`, 0},
+		{`len(set())`, 0},
+		{`len(0..0)`, 0},
 		{`first([1, 2, 3])`, 1},
 		{`first([])`, nil},
-		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`first(1)`, "first: argument 1 must be array or string, got integer"},
 		{`last([1, 2, 3])`, 3},
 		{`last([])`, nil},
-		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`last(1)`, "last: argument 1 must be array or string, got integer"},
 		{`rest([1, 2, 3])`, []int{2, 3}},
 		{`rest([1, 2, 3])`, []int{2, 3}},
-		{`rest([])`, nil},
+		{`rest([])`, []int{}},
 		{`push([], 1)`, []int{1}},
-		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`push(1, 1)`, "push: argument 1 must be array, got integer"},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -351,6 +353,12 @@ func TestBuiltinFunctions(t *testing.T) {
 			testIntegerObject(t, evaluated, int64(expected))
 		case nil:
 			testNullObject(t, evaluated)
+		case []int:
+			elements := make([]int64, len(expected))
+			for i, el := range expected {
+				elements[i] = int64(el)
+			}
+			testIntegerArray(t, evaluated, elements)
 		case string:
 			errObj, ok := evaluated.(*object.Error)
 			if !ok {
@@ -483,6 +491,90 @@ func TestHashLiterals(t *testing.T) {
 	}
 }
 
+func TestHashKeysOfDifferentTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{1: "int", true: "bool", "1": "str"}[1]`, "int"},
+		{`{1: "int", true: "bool", "1": "str"}[true]`, "bool"},
+		{`{1: "int", true: "bool", "1": "str"}["1"]`, "str"},
+		{`{0: "int", false: "bool", "": "str"}[0]`, "int"},
+		{`{0: "int", false: "bool", "": "str"}[false]`, "bool"},
+		{`{0: "int", false: "bool", "": "str"}[""]`, "str"},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+
+	hash, ok := testEval(`{1: "int", true: "bool", "1": "str"}`).(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash")
+	}
+	if len(hash.Pairs) != 3 {
+		t.Errorf("Hash has wrong num of pairs. want=3, got=%d", len(hash.Pairs))
+	}
+}
+
+func TestHashLiteralShorthandAndComputedKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "Ann"; let age = 3; {name, age}`, `{"name":"Ann", "age":3}`},
+		{`let name = "Ann"; {name}["name"]`, "Ann"},
+		{`let k = "b"; {[k + "c"]: 1}["bc"]`, "1"},
+		{`{[1 + 1]: "two"}[2]`, "two"},
+		{`{[1 < 2]: "yes"}[true]`, "yes"},
+		{`let name = "Ann"; let k = "b"; {name, "a": 1, [k]: 2, name: 3}`, `{"name":"Ann", "a":1, "b":2, "Ann":3}`},
+		{`{name}`, "ERROR: line 1, column 2: NameError: identifier not found: name"},
+		{`{[[1]]: 1}`, "ERROR: line 1, column 1: TypeError: unusable as hash key: ARRAY"},
+		{`{[fn() { 1 }]: 1}`, "ERROR: line 1, column 1: TypeError: unusable as hash key: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestOptionalIndexExpressions(t *testing.T) {
+	cfg := `let none = if (false) { 1 }; let cfg = {"db": {"primary": {"host": "db1", "ports": [5432]}, "replica": none}};`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{cfg + `cfg?["db"]?["primary"]?["host"]`, "db1"},
+		{cfg + `cfg?["db"]?["primary"]?["ports"]?[0]`, "5432"},
+		// どの段で欠けても NULL になる
+		{cfg + `cfg?["cache"]?["primary"]?["host"]`, "null"},
+		{cfg + `cfg?["db"]?["backup"]?["host"]`, "null"},
+		{cfg + `cfg?["db"]?["replica"]?["host"]`, "null"},
+		{cfg + `cfg?["db"]?["primary"]?["user"]`, "null"},
+		{cfg + `cfg?["db"]?["primary"]?["ports"]?[3]`, "null"},
+		{`let none = if (false) { 1 }; none?["a"]`, "null"},
+		// 受け手が NULL なら添字は評価しない
+		{`let none = if (false) { 1 }; none?[1 + true]`, "null"},
+		{`{"a": 1}?[1 + true]`, "ERROR: line 1, column 13: TypeError: type mismatch: INTEGER + BOOLEAN"},
+		// 厳密なアクセスと混ぜた場合、?[ ] の段だけが NULL を許す
+		{cfg + `cfg["db"]?["backup"]?["host"]`, "null"},
+		{cfg + `cfg["cache"]?["primary"]`, "null"},
+		{cfg + `cfg?["db"]?["backup"]["host"]`, "ERROR: line 1, column 132: TypeError: index operator not supported: NULL"},
+		{cfg + `cfg["cache"]["primary"]`, "ERROR: line 1, column 123: TypeError: index operator not supported: NULL"},
+		{`1?[0]`, "ERROR: line 1, column 2: TypeError: index operator not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestHashIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -570,3 +662,1133 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	}
 	return true
 }
+
+func TestEvalBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`eval("1 + 2")`, 3},
+		{`eval("")`, nil},
+		{`let x = 10; eval("x * 2")`, 20},
+		{`let f = fn(y) { eval("y + 1") }; f(41)`, 42},
+		{`eval("let z = 5;"); z`, 5},
+		{`eval("let z = 5;", true); z`, "identifier not found: z"},
+		{`let x = 1; eval("x + 1", true)`, 2},
+		{`let inner = "1 + 2"; eval("eval(inner) * 2")`, 6},
+		{`let inner = "let w = 7;"; eval("eval(inner)"); w`, 7},
+		{`eval("return 3; 4")`, 3},
+		{`eval("1 + true")`, "type mismatch: INTEGER + BOOLEAN"},
+		{`eval("let = 1;")`, "parse error in eval: expected next token to be IDENT, got = instead; no prefix parse function for '=' found"},
+		{`eval(1)`, "eval: argument 1 must be string, got integer"},
+		{`eval("1", 1)`, "eval: argument 2 must be boolean, got integer"},
+		{`eval()`, "eval: expected 1 or 2 arguments, got 0"},
+		{`let eval = fn(s) { 99 }; eval("1 + 2")`, 99},
+		{`let g = eval; g("1 + 2")`, 3},
+		{`let fs = [eval]; fs[0]("2 * 3")`, 6},
+		{`let apply = fn(f, s) { f(s) }; let x = 4; apply(eval, "x")`, 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestEvalErrorPositions(t *testing.T) {
+	input := `let x = 1;
+let y = 2;
+  eval("1 + true");`
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error")
+	}
+	if errObj.Line != 3 || errObj.Column != 3 {
+		t.Errorf("error should point at the eval call. got=%d:%d", errObj.Line, errObj.Column)
+	}
+
+	// eval中で定義した関数の呼び出しは、位置の代わりにevalの中であることを示す
+	input = `let run = fn() {
+  eval("let f = fn() { 1 + true }; f()")
+};
+run() + 0;`
+	errObj, ok = testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error")
+	}
+	if errObj.Line != 2 || errObj.Column != 3 {
+		t.Errorf("error should point at the eval call. got=%d:%d", errObj.Line, errObj.Column)
+	}
+	expected := `  at f (in eval)
+  at eval (line 2, column 3)
+  at run (line 4, column 1)
+`
+	if errObj.StackTrace() != expected {
+		t.Errorf("wrong stack trace. want=%q, got=%q", expected, errObj.StackTrace())
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	double := func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}
+
+	withDouble := New()
+	if err := withDouble.RegisterBuiltin("double", double); err != nil {
+		t.Fatalf("RegisterBuiltin returned error: %s", err)
+	}
+	plain := New()
+
+	program := parser.New(lexer.New("double(21)")).ParseProgram()
+
+	testIntegerObject(t, withDouble.Eval(program, object.NewEnvironment()), 42)
+
+	evaluated := plain.Eval(program, object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "identifier not found: double" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	// パッケージレベルのEvalにも影響しない
+	if _, ok := Eval(program, object.NewEnvironment()).(*object.Error); !ok {
+		t.Errorf("builtin leaked into the default evaluator")
+	}
+}
+
+func TestRegisterBuiltinCopiesSharedTable(t *testing.T) {
+	a, b := New(), New()
+	if reflect.ValueOf(a.builtins).Pointer() != reflect.ValueOf(b.builtins).Pointer() {
+		t.Errorf("evaluators without registered builtins should share the default table")
+	}
+
+	err := a.RegisterBuiltin("answer", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 42}
+	})
+	if err != nil {
+		t.Fatalf("RegisterBuiltin returned error: %s", err)
+	}
+	if _, ok := builtins["answer"]; ok {
+		t.Errorf("RegisterBuiltin modified the default table")
+	}
+	if _, ok := b.builtins["answer"]; ok {
+		t.Errorf("RegisterBuiltin modified another evaluator's table")
+	}
+	if len(a.builtins) != len(builtins)+1 {
+		t.Errorf("wrong number of builtins. want=%d, got=%d", len(builtins)+1, len(a.builtins))
+	}
+}
+
+func TestRegisterBuiltinCollision(t *testing.T) {
+	answer := func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 42}
+	}
+
+	err := New().RegisterBuiltin("len", answer)
+	if err == nil {
+		t.Fatalf("expected error when overriding a core builtin")
+	}
+	if err.Error() != `builtin "len" is already defined` {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+
+	// evalも他の組み込み関数と同じく上書きを許可しなければ登録できない
+	if err := New().RegisterBuiltin("eval", answer); err == nil {
+		t.Errorf("expected error when overriding eval")
+	}
+	overridden := New(AllowBuiltinOverride())
+	if err := overridden.RegisterBuiltin("eval", answer); err != nil {
+		t.Fatalf("RegisterBuiltin returned error: %s", err)
+	}
+	evalProgram := parser.New(lexer.New(`eval("1 + 2")`)).ParseProgram()
+	testIntegerObject(t, overridden.Eval(evalProgram, object.NewEnvironment()), 42)
+
+	ev := New(AllowBuiltinOverride())
+	if err := ev.RegisterBuiltin("len", answer); err != nil {
+		t.Fatalf("RegisterBuiltin returned error: %s", err)
+	}
+	program := parser.New(lexer.New(`len("abc")`)).ParseProgram()
+	testIntegerObject(t, ev.Eval(program, object.NewEnvironment()), 42)
+	testIntegerObject(t, New().Eval(program, object.NewEnvironment()), 3)
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []object.StackFrame
+	}{
+		{
+			`let c = fn(x) { x + "a" };
+let b = fn(x) { c(x) };
+let a = fn() {
+  b(1)
+};
+a();`,
+			[]object.StackFrame{
+				{Function: "c", Line: 2, Column: 17},
+				{Function: "b", Line: 4, Column: 3},
+				{Function: "a", Line: 6, Column: 1},
+			},
+		},
+		{
+			`let f = fn(x) { len(x) };
+f(1);`,
+			[]object.StackFrame{
+				{Function: "len", Line: 1, Column: 17},
+				{Function: "f", Line: 2, Column: 1},
+			},
+		},
+		{
+			`fn() { -true }()`,
+			[]object.StackFrame{
+				{Function: "<anonymous>", Line: 1, Column: 15},
+			},
+		},
+		{
+			`let ok = fn() { 1 }; ok(); 1 + true`,
+			[]object.StackFrame{},
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if len(errObj.Stack) != len(tt.expected) {
+			t.Errorf("wrong number of frames. want=%d, got=%d (%+v)", len(tt.expected), len(errObj.Stack), errObj.Stack)
+			continue
+		}
+		for i, frame := range tt.expected {
+			if errObj.Stack[i] != frame {
+				t.Errorf("frame %d wrong. want=%+v, got=%+v", i, frame, errObj.Stack[i])
+			}
+		}
+	}
+}
+
+func TestErrorStackTraceString(t *testing.T) {
+	input := `let inner = fn() { 1 + true };
+let outer = fn() { inner() };
+outer()`
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error")
+	}
+	expected := `  at inner (line 2, column 20)
+  at outer (line 3, column 1)
+`
+	if errObj.StackTrace() != expected {
+		t.Errorf("wrong stack trace. want=%q, got=%q", expected, errObj.StackTrace())
+	}
+	if errObj.Inspect() != "ERROR: line 1, column 22: TypeError: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("Inspect should not include the stack trace. got=%q", errObj.Inspect())
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLine    int
+		expectedColumn  int
+		expectedMessage string
+	}{
+		{
+			`let a = 1;
+let b = 2;
+let c = a + b;
+let d = c + foo;`,
+			4, 13, "identifier not found: foo",
+		},
+		{
+			`let x = 5;
+
+  x + true;`,
+			3, 5, "type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			`let f = fn(s) {
+  s - "b"
+};
+f("a")`,
+			2, 5, "unknown operator: STRING - STRING",
+		},
+		{
+			`let x = 1;
+  -"x"`,
+			2, 3, "unknown operator: -STRING",
+		},
+		{
+			`let h = {"a": 1};
+h[fn() {}]`,
+			2, 2, "unusable as hash key: FUNCTION",
+		},
+		{
+			`let n = 5;
+n[0]`,
+			2, 2, "index operator not supported: INTEGER",
+		},
+		{
+			`let xs = [1];
+let n = 1 +
+  len(xs, xs);`,
+			3, 3, "len: expected 1 argument, got 2",
+		},
+		{
+			`let five = 5;
+five(1)`,
+			2, 1, "not a function: INTEGER",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+		if errObj.Line != tt.expectedLine || errObj.Column != tt.expectedColumn {
+			t.Errorf("wrong position for %q. expected=%d:%d, got=%d:%d",
+				tt.expectedMessage, tt.expectedLine, tt.expectedColumn, errObj.Line, errObj.Column)
+		}
+	}
+}
+
+func TestEvalContextCancellation(t *testing.T) {
+	input := `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(50);`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	evaluated := EvalContext(ctx, program, object.NewEnvironment())
+	elapsed := time.Since(start)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "evaluation cancelled: context deadline exceeded" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	if elapsed > time.Second {
+		t.Errorf("evaluation was not cancelled promptly. took %s", elapsed)
+	}
+}
+
+func TestEvalContextAlreadyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	program := parser.New(lexer.New("let f = fn() { 1 }; f()")).ParseProgram()
+	evaluated := EvalContext(ctx, program, object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "evaluation cancelled: context canceled" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestEvalContextCompletes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	input := `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(15);`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	ev := New()
+	testIntegerObject(t, ev.EvalContext(ctx, program, object.NewEnvironment()), 610)
+
+	// 同じ評価器をキャンセル済みのコンテキストなしで再利用できる
+	cancel()
+	testIntegerObject(t, ev.Eval(program, object.NewEnvironment()), 610)
+}
+
+func TestMaxSteps(t *testing.T) {
+	input := `
+let add = fn(a, b) { a + b };
+let twice = fn(x) { add(x, x) };
+twice(2);`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	unlimited := New()
+	testIntegerObject(t, unlimited.Eval(program, object.NewEnvironment()), 4)
+	used := unlimited.StepsUsed()
+	if used == 0 {
+		t.Fatalf("StepsUsed returned 0")
+	}
+
+	// 上限ちょうどなら完了する
+	exact := New(WithMaxSteps(used))
+	testIntegerObject(t, exact.Eval(program, object.NewEnvironment()), 4)
+	if exact.StepsUsed() != used {
+		t.Errorf("StepsUsed wrong. want=%d, got=%d", used, exact.StepsUsed())
+	}
+
+	limited := New(WithMaxSteps(used - 1))
+	evaluated := limited.Eval(program, object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	expected := fmt.Sprintf("evaluation budget exceeded after %d steps", used-1)
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. want=%q, got=%q", expected, errObj.Message)
+	}
+
+	// ステップ数は評価ごとに数え直す
+	testIntegerObject(t, exact.Eval(program, object.NewEnvironment()), 4)
+}
+
+func TestStepsCountNestedCalls(t *testing.T) {
+	direct := New()
+	direct.Eval(parser.New(lexer.New("1 + 1")).ParseProgram(), object.NewEnvironment())
+
+	nested := New()
+	nested.Eval(parser.New(lexer.New("let f = fn() { 1 + 1 }; let g = fn() { f() }; g()")).ParseProgram(), object.NewEnvironment())
+
+	if direct.StepsUsed() != 5 {
+		t.Errorf("wrong step count for 1 + 1. want=5, got=%d", direct.StepsUsed())
+	}
+	if nested.StepsUsed() <= direct.StepsUsed() {
+		t.Errorf("nested calls were not counted. direct=%d, nested=%d", direct.StepsUsed(), nested.StepsUsed())
+	}
+}
+
+func TestMaxStepsStopsRunawayRecursion(t *testing.T) {
+	input := `
+let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } };
+count(100000);`
+	ev := New(WithMaxSteps(1000))
+	evaluated := ev.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+	if _, ok := evaluated.(*object.Error); !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if ev.StepsUsed() != 1000 {
+		t.Errorf("StepsUsed wrong. want=1000, got=%d", ev.StepsUsed())
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	countdown := `
+let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } };
+count(%d);`
+
+	legal := parser.New(lexer.New(fmt.Sprintf(countdown, 5000))).ParseProgram()
+	testIntegerObject(t, New().Eval(legal, object.NewEnvironment()), 5000)
+
+	runaway := parser.New(lexer.New("let f = fn() { f() }; f();")).ParseProgram()
+	ev := New()
+	evaluated := ev.Eval(runaway, object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "maximum recursion depth exceeded" || errObj.Kind != object.LimitError {
+		t.Errorf("wrong error. got=%s %q", errObj.Kind, errObj.Message)
+	}
+	if len(errObj.Stack) != DefaultMaxDepth {
+		t.Errorf("wrong stack depth. want=%d, got=%d", DefaultMaxDepth, len(errObj.Stack))
+	}
+
+	// エラーの伝搬後も呼び出しの深さが元に戻っている
+	if len(ev.stack) != 0 {
+		t.Fatalf("call stack not unwound. got=%d frames", len(ev.stack))
+	}
+	testIntegerObject(t, ev.Eval(legal, object.NewEnvironment()), 5000)
+
+	shallow := New(WithMaxDepth(10))
+	limited := parser.New(lexer.New(fmt.Sprintf(countdown, 10))).ParseProgram()
+	if _, ok := shallow.Eval(limited, object.NewEnvironment()).(*object.Error); !ok {
+		t.Errorf("expected an error with WithMaxDepth(10)")
+	}
+	underLimit := parser.New(lexer.New(fmt.Sprintf(countdown, 9))).ParseProgram()
+	testIntegerObject(t, shallow.Eval(underLimit, object.NewEnvironment()), 9)
+}
+
+func TestForInExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let out = []; for (x in [1, 2, 3]) { append(out, x * 2) }; out`, "[2, 4, 6]"},
+		{`let out = []; for (i, x in ["a", "b"]) { append(out, [i, x]) }; out`, `[[0, "a"], [1, "b"]]`},
+		{`let out = []; for (c in "hé!") { append(out, c) }; out`, `["h", "é", "!"]`},
+		{`let out = []; for (k, v in {"b": 1, "a": 2}) { append(out, k + "=" + inspect(v)) }; out`, `["b=1", "a=2"]`},
+		{`let out = []; for (v in {"b": 1, "a": 2}) { append(out, v) }; out`, "[1, 2]"},
+		{`let out = []; for (x in set(3, 1, 3)) { append(out, x) }; out`, "[3, 1]"},
+		{`let out = []; for (x in []) { append(out, x) }; out`, "[]"},
+		{`for (x in [1]) { x }`, "null"},
+		{`let x = 10; for (x in [1, 2]) { x }; x`, "10"},
+		{`let find = fn(xs, y) { for (x in xs) { if (x == y) { return true; } }; false }; find([1, 2, 3], 2)`, "true"},
+		{`let find = fn(xs, y) { for (x in xs) { if (x == y) { return true; } }; false }; find([1, 2, 3], 5)`, "false"},
+		{`for (x in 5) { x }`, "ERROR: line 1, column 1: TypeError: not iterable: INTEGER"},
+		{`for (x in [1, true]) { x + 1 }`, "ERROR: line 1, column 26: TypeError: type mismatch: BOOLEAN + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSpreadExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 引数の個数は展開した後で確かめる
+		{`let add = fn(a, b, c) { a + b + c }; let args = [1, 2, 3]; add(...args)`, "6"},
+		{`let add = fn(a, b, c) { a + b + c }; add(1, ...[2, 3])`, "6"},
+		{`let add = fn(a, b, c) { a + b + c }; add(...[1], ...[], 2, ...[3])`, "6"},
+		{`let add = fn(a, b, c) { a + b + c }; add(...[1, 2])`, "ERROR: line 1, column 38: ArityError: wrong number of arguments: want=3, got=2"},
+		{`let add = fn(a, b, c) { a + b + c }; add(...[1, 2, 3, 4])`, "ERROR: line 1, column 38: ArityError: wrong number of arguments: want=3, got=4"},
+		// 可変長の引数をとる組み込み関数
+		{`let xs = [3, 1, 3, 2]; len(set(...xs))`, "3"},
+		{`let xs = [1, 2]; len(set(0, ...xs, 3))`, "4"},
+		{`len(set(...[]))`, "0"},
+		{`let rest = [2, 3]; [1, ...rest, 9]`, "[1, 2, 3, 9]"},
+		{`let empty = []; [1, ...empty, 9]`, "[1, 9]"},
+		{`[...[]]`, "[]"},
+		{`let xs = [1, 2]; [...xs, ...xs]`, "[1, 2, 1, 2]"},
+		{`[...[[1], [2]]]`, "[[1], [2]]"},
+		{`let xs = [1]; let ys = [...xs]; push(ys, 2); xs`, "[1]"},
+		{`[1, ...2]`, "ERROR: line 1, column 5: TypeError: spread operator: expected ARRAY, got INTEGER"},
+		{`len(...{"a": 1})`, "ERROR: line 1, column 5: TypeError: spread operator: expected ARRAY, got HASH"},
+		{`[...(1 + true)]`, "ERROR: line 1, column 8: TypeError: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 + 2 } catch (e) { 0 }`, "3"},
+		{`try { 1 + true } catch (e) { e }`, `{"kind":"TypeError", "message":"type mismatch: INTEGER + BOOLEAN", "line":1, "column":9}`},
+		{`try { 1 + true } catch (e) { e["message"] }`, "type mismatch: INTEGER + BOOLEAN"},
+		// 文字列から数を読めなかった場合
+		{`let parse = fn(s) { try { eval(s) } catch (e) { 0 } }; [parse("42"), parse("maybe a number")]`, "[42, 0]"},
+		{`let f = fn(x) { try { x["a"] } catch (e) { "bad" } }; [f({"a": 1}), f(1)]`, `[1, "bad"]`},
+		// 入れ子の try は内側が先に捕まえる
+		{`try { try { 1 + true } catch (e) { "inner" } } catch (e) { "outer" }`, "inner"},
+		{`try { try { 1 + true } catch (e) { e["nope"] + 1 } } catch (e) { e["message"] }`, "type mismatch: NULL + INTEGER"},
+		{`try { let x = try { 1 + true } catch (e) { 10 }; x + false } catch (e) { e["message"] }`, "type mismatch: INTEGER + BOOLEAN"},
+		// エラーの後の文は評価しない
+		{`let out = []; try { append(out, 1); 1 + true; append(out, 2) } catch (e) { append(out, 3) }; out`, "[1, 3]"},
+		{`let f = fn() { try { return 1; 2 } catch (e) { 3 }; 4 }; f()`, "1"},
+		// catch の変数は catch のブロックの中だけで見える
+		{`let e = 1; try { 1 + true } catch (e) { e }; e`, "1"},
+		// 捕まえないエラーはそのまま伝わる
+		{`try { 1 } catch (e) { 0 }; 1 + true`, "ERROR: line 1, column 30: TypeError: type mismatch: INTEGER + BOOLEAN"},
+		{`try { 1 + true } catch (e) { -true }`, "ERROR: line 1, column 30: TypeError: unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// 評価ステップ数の上限による中断は try で捕まえない
+func TestNamedArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let connect = fn(host, port, tls) { [host, port, tls] }; connect(host: "h", port: 80, tls: true)`, `["h", 80, true]`},
+		// 名前付き引数は仮引数と違う順に書いてもよい
+		{`let connect = fn(host, port, tls) { [host, port, tls] }; connect("h", tls: false, port: 443)`, `["h", 443, false]`},
+		{`let sub = fn(a, b) { a - b }; sub(b: 1, a: 10)`, "9"},
+		{`let f = fn(a, b, c) { [a, b, c] }; f(...[1, 2], c: 3)`, "[1, 2, 3]"},
+		// 記述した順に評価する
+		{`let log = []; let f = fn(a, b) { log }; f(b: append(log, "b"), a: append(log, "a"))`, `["b", "a"]`},
+		// 末尾呼び出しでも使える
+		{`let count = fn(n, acc) { if (n == 0) { acc } else { count(acc: acc + n, n: n - 1) } }; count(10000, 0)`, "50005000"},
+		{`let f = fn(a) { fn(b) { a + b } }; f(a: 1)(b: 2)`, "3"},
+		// エラー
+		{`let f = fn(a, b) { a }; f(1, a: 2)`, "ERROR: line 1, column 30: ArityError: argument a is already given by position"},
+		{`let f = fn(a, b) { a }; f(c: 2, a: 1)`, "ERROR: line 1, column 27: ArityError: unknown named argument: c"},
+		{`let f = fn(a, b) { a }; f(b: 2)`, "ERROR: line 1, column 25: ArityError: missing argument: a"},
+		{`let f = fn(a) { a }; f(1, 2, a: 3)`, "ERROR: line 1, column 22: ArityError: wrong number of arguments: want=1, got=3"},
+		{`let f = fn(a) { a }; f(a: 1 + true)`, "ERROR: line 1, column 29: TypeError: type mismatch: INTEGER + BOOLEAN"},
+		{`len(x: "abc")`, "ERROR: line 1, column 5: TypeError: len: named arguments are not supported by builtin functions"},
+		{`let g = fn() { 1 }; 5(a: g())`, "ERROR: line 1, column 22: TypeError: not a function: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected object.ErrorKind
+	}{
+		{`1 + true`, object.TypeError},
+		{`len(1)`, object.TypeError},
+		{`missing`, object.NameError},
+		{`pop([])`, object.IndexError},
+		{`range(1, 5, 0)`, object.ValueError},
+		{`fn(x) { x }(1, 2)`, object.ArityError},
+		{`len()`, object.ArityError},
+		{`10 / 0`, object.DivisionByZero},
+		{`import "testdata/no_such_module.mky"`, object.ImportError},
+		{`eval("1 +")`, object.SyntaxError},
+		{`error("boom")`, object.Custom},
+		{`error("NotFound", "no such user")`, "NotFound"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error returned", tt.input)
+			continue
+		}
+		if errObj.Kind != tt.expected {
+			t.Errorf("%s: wrong kind. want=%s, got=%s (%s)", tt.input, tt.expected, errObj.Kind, errObj.Message)
+		}
+	}
+}
+
+func TestUserErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`error("boom")`, "ERROR: line 1, column 1: Custom: boom"},
+		{`error("NotFound", "no such user")`, "ERROR: line 1, column 1: NotFound: no such user"},
+		// 捕まえると種類とメッセージがそのまま戻る
+		{`try { error("NotFound", "no such user") } catch (e) { [errorKind(e), e["message"]] }`, `["NotFound", "no such user"]`},
+		{`try { error("boom") } catch (e) { errorKind(e) }`, "Custom"},
+		{`try { 1 / 0 } catch (e) { errorKind(e) }`, "DivisionByZero"},
+		{`let check = fn(n) { if (n < 0) { error("ValueError", "negative") } else { n } };
+try { check(-1) } catch (e) { e }`, `{"kind":"ValueError", "message":"negative", "line":1, "column":34}`},
+		{`error("", "x")`, "ERROR: line 1, column 1: ValueError: error: argument 1 must be non-empty string, got empty string"},
+		{`error(1)`, "ERROR: line 1, column 1: TypeError: error: argument 1 must be string, got integer"},
+		{`errorKind({"message": "x"})`, "ERROR: line 1, column 1: ValueError: errorKind: argument 1 must be an error caught by try/catch, got hash without kind"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestThrow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 投げたハッシュがそのまま catch に渡る
+		{`let r = try { throw({"code": 404, "path": "/users/7"}) } catch (e) { e }; [r["code"], r["path"], len(r)]`, `[404, "/users/7", 2]`},
+		{`try { throw("oops") } catch (e) { e }`, "oops"},
+		{`try { throw([1, 2]) } catch (e) { e[1] }`, "2"},
+		{`let v = [1]; try { throw(v) } catch (e) { e is v }`, "true"},
+		{`try { throw(if (false) { 1 }) } catch (e) { e }`, "null"},
+		// 投げ直しても値は変わらない
+		{`try { try { throw({"code": 1}) } catch (e) { throw(e) } } catch (e) { e["code"] }`, "1"},
+		{`let f = fn(n) { if (n > 2) { throw({"at": n}) } else { n } }; try { f(1) + f(5) } catch (e) { e["at"] }`, "5"},
+		// map や filter のコールバックで投げると、その場で中断して伝わる
+		{`let seen = []; try { map([1, 2, 3], fn(x) { append(seen, x); if (x == 2) { throw("stop") } else { x } }) } catch (e) { [e, seen] }`, `["stop", [1, 2]]`},
+		{`try { filter([1, 2], fn(x) { throw(x * 10) }) } catch (e) { e }`, "10"},
+		// 捕まえなければ値を表示するエラーになる
+		{`throw({"code": 404})`, `ERROR: line 1, column 1: Thrown: {"code":404}`},
+		{`let f = fn() { throw("bad") }; f()`, "ERROR: line 1, column 16: Thrown: bad"},
+		{`throw()`, "ERROR: line 1, column 1: ArityError: throw: expected 1 argument, got 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTryDoesNotCatchLimits(t *testing.T) {
+	program := parser.New(lexer.New(`
+let loop = fn(n) { loop(n + 1) };
+try { loop(0) } catch (e) { "caught" }`)).ParseProgram()
+
+	evaluated := New(WithMaxSteps(1000)).Eval(program, object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "evaluation budget exceeded after 1000 steps" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestIsOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		// 構造が同じでも別の配列は同じオブジェクトではない
+		{`[1, 2] is [1, 2]`, false},
+		{`contains([[1, 2]], [1, 2])`, true},
+		{`let a = [1, 2]; let b = a; a is b`, true},
+		{`let a = [1, 2]; let b = a; append(b, 3); len(a) == 3`, true},
+		{`let a = []; a is clone(a)`, false},
+		{`let h = {"a": 1}; [h is h, h is {"a": 1}]`, true},
+		{`let s = set(1); s is s`, true},
+		{`set(1) is set(1)`, false},
+		{`let f = fn(x) { x }; [f is f, f is fn(x) { x }]`, true},
+		{`len is len`, true},
+		// 不変の値は値で比べる
+		{`1 is 1`, true},
+		{`5000 is 4999 + 1`, true},
+		{`9223372036854775807 + 1 is 9223372036854775806 + 2`, true},
+		{`"ab" is "a" + "b"`, true},
+		{`"a" is "b"`, false},
+		{`true is true`, true},
+		{`true is false`, false},
+		{`if (false) { 1 } is if (false) { 2 }`, true},
+		{`0..3 is 0..3`, true},
+		{`1 is "1"`, false},
+		{`1 is true`, false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if array, ok := evaluated.(*object.Array); ok {
+			// 配列の場合は最初の要素がtrueで、残りがfalseであることを確かめる
+			if len(array.Elements) != 2 || array.Elements[0] != TRUE || array.Elements[1] != FALSE {
+				t.Errorf("wrong result for %s. got=%s", tt.input, evaluated.Inspect())
+			}
+			continue
+		}
+		if !testBooleanObject(t, evaluated, tt.expected) {
+			t.Errorf("input: %s", tt.input)
+		}
+	}
+}
+
+// for-in とmapは同じ順序で同じ要素を返す
+func TestForInAndMapAgree(t *testing.T) {
+	iterables := []string{
+		`[1, "two", [3]]`,
+		`"héllo"`,
+		`{"z": 1, "y": 2, "x": 3}`,
+		`set(5, 4, 5, 3)`,
+		`[]`,
+	}
+
+	for _, iterable := range iterables {
+		viaFor := testEval(`let out = []; for (x in ` + iterable + `) { append(out, x) }; out`)
+		viaMap := testEval(`map(` + iterable + `, fn(x) { x })`)
+		if viaFor.Inspect() != viaMap.Inspect() {
+			t.Errorf("for-in and map disagree for %s. for=%s, map=%s", iterable, viaFor.Inspect(), viaMap.Inspect())
+		}
+
+		keysViaFor := testEval(`let out = []; for (k, v in ` + iterable + `) { append(out, k) }; out`)
+		keysViaMap := testEval(`map(` + iterable + `, fn(v, k) { k })`)
+		if keysViaFor.Inspect() != keysViaMap.Inspect() {
+			t.Errorf("for-in and map keys disagree for %s. for=%s, map=%s", iterable, keysViaFor.Inspect(), keysViaMap.Inspect())
+		}
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(50)`,
+			"30414093201713378043612608166064768844377641568960512000000000000"},
+		{`pow(2, 200)`, "1606938044258990275541962092341162602522202993782792835301376"},
+		{`pow(2, 63)`, "9223372036854775808"},
+		{`9223372036854775807 + 1`, "9223372036854775808"},
+		{`-9223372036854775807 - 2`, "-9223372036854775809"},
+		{`let min = -9223372036854775807 - 1; -min`, "9223372036854775808"},
+		{`let min = -9223372036854775807 - 1; min / -1`, "9223372036854775808"},
+		{`4294967296 * 4294967296`, "18446744073709551616"},
+		{`pow(2, 200) / pow(2, 190)`, "1024"},
+		{`pow(2, 64) - pow(2, 64) + 5`, "5"},
+		{`-pow(2, 70) / 3`, "-393530540239137101141"},
+		{`+pow(2, 64)`, "18446744073709551616"},
+		// int64 に収まらないリテラルは BigInteger になる
+		{`99999999999999999999`, "99999999999999999999"},
+		{`9223372036854775808`, "9223372036854775808"},
+		{`0o1000000000000000000000`, "9223372036854775808"},
+		{`-99999999999999999999 * 2`, "-199999999999999999998"},
+		{`99999999999999999999 == pow(10, 20) - 1`, "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want=%s, got=%s (%T)", tt.input, tt.expected, evaluated.Inspect(), evaluated)
+		}
+	}
+}
+
+func TestBigIntegersDemoteWhenTheyFit(t *testing.T) {
+	evaluated := testEval(`pow(2, 100) / pow(2, 98)`)
+	testIntegerObject(t, evaluated, 4)
+
+	// 9223372036854775808 は BigInteger だが、符号を反転すると int64 に収まる
+	evaluated = testEval(`-9223372036854775808`)
+	testIntegerObject(t, evaluated, -9223372036854775808)
+	evaluated = testEval(`99999999999999999999 - 99999999999999999998`)
+	testIntegerObject(t, evaluated, 1)
+
+	evaluated = testEval(`let big = pow(10, 30); {big - 1: "a", big: "b"}[pow(10, 30)]`)
+	testStringObject(t, evaluated, "b")
+}
+
+func TestBigIntegerComparisons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`pow(2, 100) > 1`, true},
+		{`1 < pow(2, 100)`, true},
+		{`-pow(2, 100) < -9223372036854775807`, true},
+		{`pow(2, 100) == pow(2, 100)`, true},
+		{`pow(2, 100) != pow(2, 100) + 1`, true},
+		{`pow(2, 64) == 0`, false},
+		{`pow(2, 64) / pow(2, 60) == 16`, true},
+		{`contains([pow(2, 80)], pow(2, 80))`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	for _, input := range []string{`1 / 0`, `pow(2, 100) / 0`} {
+		errObj, ok := testEval(input).(*object.Error)
+		if !ok || errObj.Message != "division by zero" {
+			t.Errorf("%s: expected division by zero error, got %v", input, testEval(input))
+		}
+	}
+}
+
+func TestConcurrentEvaluationWithSyncedEnvironment(t *testing.T) {
+	shared := object.NewSyncedEnvironment()
+	shared.Set("config", &object.Integer{Value: 1})
+	program := parser.New(lexer.New(`let double = fn(x) { x * 2 }; double(config) > 0`)).ParseProgram()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 評価器はゴルーチンごとに用意する
+			ev := New()
+			for j := 0; j < 20; j++ {
+				result := ev.Eval(program, object.NewEnclosedEnvironment(shared))
+				if result != TRUE {
+					t.Errorf("wrong result. got=%s", result.Inspect())
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(done)
+		for i := 2; i < 500; i++ {
+			shared.Set("config", &object.Integer{Value: int64(i)})
+		}
+	}()
+
+	wg.Wait()
+	<-done
+}
+
+// 埋め込み側で定義した呼び出せるオブジェクト
+type fakeDatabase struct {
+	rows map[string]object.Object
+}
+
+func (db *fakeDatabase) Type() object.ObjectType { return "DATABASE" }
+func (db *fakeDatabase) Inspect() string         { return "database" }
+func (db *fakeDatabase) Call(args []object.Object) object.Object {
+	if err := object.CheckArgs("database", args, object.Arg(object.STRING_OBJ)); err != nil {
+		return err
+	}
+	row, ok := db.rows[args[0].(*object.String).Value]
+	if !ok {
+		return &object.Error{Message: "database: no row " + args[0].Inspect()}
+	}
+	return row
+}
+
+func TestCallable(t *testing.T) {
+	db := &fakeDatabase{rows: map[string]object.Object{
+		"alice": &object.Integer{Value: 30},
+		"bob":   &object.Integer{Value: 25},
+	}}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`db("alice")`, 30},
+		{`db("alice") + db("bob")`, 55},
+		{`let query = fn(name) { db(name) }; query("bob")`, 25},
+		{`let query = fn(name) { db(name) + 0 }; query("bob")`, 25},
+		{`map(["alice", "bob"], fn(name) { db(name) })[1]`, 25},
+		{`db("carol")`, "database: no row carol"},
+		{`db(1)`, "database: argument 1 must be string, got integer"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("db", db)
+		evaluated := New().Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: expected error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%s: wrong message. want=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+			if errObj.Line != 1 || len(errObj.Stack) == 0 || errObj.Stack[0].Function != "database" {
+				t.Errorf("%s: error not attributed to the call. got=%d:%d %v", tt.input, errObj.Line, errObj.Column, errObj.Stack)
+			}
+		}
+	}
+}
+
+func TestInjectedValues(t *testing.T) {
+	env, err := object.NewEnvironmentWith(map[string]interface{}{
+		"page": map[string]interface{}{
+			"title": "Monkey",
+			"items": []interface{}{"lexer", "parser", "evaluator"},
+		},
+		"x": 1,
+	})
+	if err != nil {
+		t.Fatalf("NewEnvironmentWith failed: %s", err)
+	}
+
+	input := `
+let render = fn(page) {
+	let items = reduce(page["items"], "", fn(acc, item) { acc + "<li>" + item + "</li>" });
+	"<h1>" + page["title"] + "</h1><ul>" + items + "</ul>"
+};
+let rendered = render(page);
+let x = x + 41;
+`
+	New().Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+
+	rendered, err := env.GetValue("rendered")
+	if err != nil {
+		t.Fatalf("GetValue failed: %s", err)
+	}
+	expected := "<h1>Monkey</h1><ul><li>lexer</li><li>parser</li><li>evaluator</li></ul>"
+	if rendered != expected {
+		t.Errorf("wrong rendered. want=%q, got=%q", expected, rendered)
+	}
+
+	// トップレベルの let は設定した値を上書きする
+	x, err := env.GetValue("x")
+	if err != nil || x != int64(42) {
+		t.Errorf("let should overwrite the injected x. got=%#v, %v", x, err)
+	}
+
+	// 関数の中の let は外側の値を変更しない
+	New().Eval(parser.New(lexer.New(`let f = fn() { let x = 0; x }; f()`)).ParseProgram(), env)
+	if x, _ := env.GetValue("x"); x != int64(42) {
+		t.Errorf("let inside a function should not change x. got=%#v", x)
+	}
+}
+
+func TestSharedIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 == 1`, "true"},
+		{`1000 + 24 == 1024`, "true"},
+		{`1025 == 1024 + 1`, "true"},
+		{`-129 == -128 - 1`, "true"},
+		{`2000000 == 1000000 * 2`, "true"},
+		{`1 != 2`, "true"},
+		{`{1: "a", 5000: "b"}[2 - 1]`, "a"},
+		{`{1: "a", 5000: "b"}[2500 * 2]`, "b"},
+		{`set(1, 1000 + 1, 5000, 2500 + 2500)`, "set{1, 1001, 5000}"},
+		{`let a = [1, 2]; let b = [1, 2]; contains([a], b)`, "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// クロージャの捕捉のうち、VMでは使えない構文や束縛し直しを使うもの
+func TestClosureCaptureInEvaluator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// for-in は反復ごとに環境を作るので、それぞれのクロージャはその反復の値を持つ
+		{`let fs = []; for (i in [1, 2, 3]) { append(fs, fn() { i }) }; map(fs, fn(f) { f() })`, "[1, 2, 3]"},
+		{`let fs = []; for (k, v in {"a": 1, "b": 2}) { append(fs, fn() { [k, v] }) }; map(fs, fn(f) { f() })`,
+			`[["a", 1], ["b", 2]]`},
+		// 反復の中の let も反復ごと
+		{`let fs = []; for (i in [1, 2]) { let sq = i * i; append(fs, fn() { sq }) }; map(fs, fn(f) { f() })`, "[1, 4]"},
+		// 関数の中で、捕捉した後に束縛し直した値も見える（VMのコンパイラはエラーにする）
+		{`let g = fn() { let y = 1; let h = fn() { y }; let y = 2; h() }; g()`, "2"},
+		// 引数は呼び出しごとに束縛される
+		{`let adders = map([1, 2, 3], fn(n) { fn(x) { x + n } }); map(adders, fn(f) { f(10) })`, "[11, 12, 13]"},
+		// catch の変数も新しい環境に束縛される
+		{`let f = try { error("boom") } catch (e) { fn() { e["message"] } }; f()`, "boom"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x = 1; let x = 2; x`, "ERROR: line 1, column 12: NameError: x is already defined in this scope"},
+		{`let x = 1; let y = 2; x + y`, "3"},
+		// 外側のスコープの名前を隠すのはよい
+		{`let x = 1; let f = fn() { let x = 2; x }; f() + x`, "3"},
+		{`let x = 1; for (i in [1, 2]) { let x = i; x }; x`, "1"},
+		// 関数を呼ぶたびに新しいスコープになる
+		{`let f = fn(n) { let t = n; t }; f(1) + f(2)`, "3"},
+		// 仮引数と同じスコープ
+		{`let f = fn(n) { let n = 2; n }; f(1)`, "ERROR: line 1, column 17: NameError: n is already defined in this scope"},
+		// if のブロックは新しいスコープを作らない
+		{`let x = 1; if (true) { let x = 2 }; x`, "ERROR: line 1, column 24: NameError: x is already defined in this scope"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := New(WithStrict()).Eval(program, object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// 既定では束縛し直せる
+	if evaluated := testEval(`let x = 1; let x = 2; x`); evaluated.Inspect() != "2" {
+		t.Errorf("let should rebind without strict mode. got=%s", evaluated.Inspect())
+	}
+}
+
+// 1から1000000までを末尾再帰のループで足す
+func BenchmarkSumLoop(b *testing.B) {
+	benchmarkLoop(b, `let sum = fn(i, acc) { if (i > 1000000) { acc } else { sum(i + 1, acc + i) } };
+sum(1, 0)`, 500000500000)
+}
+
+// 値が小さいままのループ。途中の整数は共有したものを使う
+func BenchmarkSmallIntegerLoop(b *testing.B) {
+	benchmarkLoop(b, `let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, if (acc == 1000) { 0 } else { acc + 1 }) } };
+loop(100000, 0)`, 901)
+}
+
+func benchmarkLoop(b *testing.B, input string, expected int64) {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		evaluated := New().Eval(program, object.NewEnvironment())
+		if result, ok := evaluated.(*object.Integer); !ok || result.Value != expected {
+			b.Fatalf("unexpected result. got=%T (%+v)", evaluated, evaluated)
+		}
+	}
+}
+
+func TestOutputIsDeterministic(t *testing.T) {
+	// Goのマップを回す順は実行ごとに変わるので、何度評価しても出力が同じになることを確かめる
+	input := `
+let h = {"z": 1, "a": 2, 3: "x", true: [1], "m": {"b": 1, "a": 2}};
+puts(h, keys(h), values(h));
+puts(merge(h, {"a": 9, "new": 0}));
+let s = set(5, "5", 1, true, "a");
+puts(s, union(s, set(9, 0)), intersect(s, set("a", 5)), toArray(remove(s, 1)));
+puts(groupBy(1..20, fn(x) { x / 3 }), countBy(["b", "a", "b", "c"], fn(x) { x }));
+puts(unique([3, "3", 1, 3, true, "a", 1]), clone(h));
+puts(vars());
+try { merge(h, 1) } catch (e) { puts(e) };
+`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	run := func() string {
+		var out bytes.Buffer
+		New(WithOutput(&out)).Eval(program, object.NewEnvironment())
+		return out.String()
+	}
+
+	want := run()
+	if !strings.Contains(want, `{"z":1, "a":2, 3:"x", true:[1], "m":{"b":1, "a":2}}`) || !strings.Contains(want, "merge: argument 2 must be hash") {
+		t.Fatalf("unexpected output:\n%s", want)
+	}
+	for i := 0; i < 100; i++ {
+		if got := run(); got != want {
+			t.Fatalf("output changed between runs.\nfirst:\n%s\nnow:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package evaluator_test
+
+import (
+	"fmt"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+)
+
+func ExampleEvaluator_RegisterBuiltin() {
+	ev := evaluator.New()
+
+	// 実際のHTTP通信の代わりに固定の応答を返すスタブ
+	err := ev.RegisterBuiltin("httpGet", func(args ...object.Object) object.Object {
+		url, ok := args[0].(*object.String)
+		if !ok {
+			return &object.Error{Message: "httpGet: url must be STRING"}
+		}
+		res := object.NewHash()
+		res.Set(&object.String{Value: "status"}, &object.Integer{Value: 200})
+		res.Set(&object.String{Value: "body"}, &object.String{Value: "hello from " + url.Value})
+		return res
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	p := parser.New(lexer.New(`let res = httpGet("example.com"); res["body"]`))
+	result := ev.Eval(p.ParseProgram(), object.NewEnvironment())
+	fmt.Println(result.Inspect())
+	// Output: hello from example.com
+}
+
+// padRight と padLeft で列をそろえて表を出力する
+func Example_padTable() {
+	ev := evaluator.New(evaluator.WithOutput(os.Stdout))
+	src := `
+let rows = [["apple", "120"], ["banana", "5"], ["クルミ", "1980"]];
+for (row in rows) {
+  puts(padRight(row[0], 8, ".") + padLeft(row[1], 6))
+}
+puts(repeat("-", 14))
+`
+	ev.Eval(parser.New(lexer.New(src)).ParseProgram(), object.NewEnvironment())
+	// Output:
+	// apple...   120
+	// banana..     5
+	// クルミ.....  1980
+	// --------------
+}
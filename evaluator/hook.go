@@ -0,0 +1,70 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// HookAction は文を評価する前に呼ばれるフックが評価器に指示する動作
+type HookAction int
+
+const (
+	// Continue はそのまま文を評価する
+	Continue HookAction = iota
+	// Pause は Resume が呼ばれるまで評価を止めてから文を評価する
+	Pause
+	// Abort は評価を打ち切り、エラーを返す
+	Abort
+)
+
+// StatementHook はプログラムとブロックの各文を評価する前に呼ばれる
+// env は文を評価する環境そのものなので、デバッガは変数の値を調べられる
+type StatementHook func(stmt ast.Statement, env *object.Environment) HookAction
+
+// WithStatementHook は各文を評価する前に hook を呼ぶ
+func WithStatementHook(hook StatementHook) Option {
+	return func(e *Evaluator) {
+		e.statementHook = hook
+		e.resume = make(chan struct{}, 1)
+	}
+}
+
+// Resume はフックが Pause を返して止まっている評価を再開する。評価とは別の goroutine から呼ぶ
+// 止まっていない場合は、次に Pause が返されたときにすぐ再開する
+func (e *Evaluator) Resume() {
+	select {
+	case e.resume <- struct{}{}:
+	default:
+	}
+}
+
+// 文を評価する前にフックを呼ぶ。評価を打ち切る場合はエラーを返す
+func (e *Evaluator) beforeStatement(stmt ast.Statement, env *object.Environment) object.Object {
+	switch e.statementHook(stmt, env) {
+	case Pause:
+		var done <-chan struct{}
+		if e.ctx != nil {
+			done = e.ctx.Done()
+		}
+		select {
+		case <-e.resume:
+		case <-done:
+			return e.annotateError(newError(object.LimitError, "evaluation cancelled: %s", e.ctx.Err()), stmt)
+		}
+	case Abort:
+		return e.annotateError(newError(object.LimitError, "evaluation aborted by statement hook"), stmt)
+	}
+	return nil
+}
+
+// CallStack は現在の呼び出し履歴を返す（内側の呼び出しが先頭）
+// フックの中で呼ぶと、止めようとしている文の時点での履歴になる
+func (e *Evaluator) CallStack() []object.StackFrame {
+	return e.stackTrace()
+}
+
+// Position は node の位置（行と列）を返す。フックに渡された文がどの行にあるかを調べるのに使う
+func Position(node ast.Node) (line, column int) {
+	tok := nodeToken(node)
+	return tok.Line, tok.Column
+}
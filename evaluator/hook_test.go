@@ -0,0 +1,124 @@
+package evaluator
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatementHookSequence(t *testing.T) {
+	input := `let a = 1;
+let f = fn(x) { let y = x * 2; y };
+f(a);
+if (a == 1) { a + 1 }`
+
+	var seen []string
+	hook := func(stmt ast.Statement, env *object.Environment) HookAction {
+		seen = append(seen, stmt.String())
+		return Continue
+	}
+	result := New(WithStatementHook(hook)).Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+	testIntegerObject(t, result, 2)
+
+	expected := []string{
+		"let a = 1;",
+		"let f = fn(x)let y = (x * 2);y;",
+		"f(a)",
+		"let y = (x * 2);",
+		"y",
+		"if(a == 1) (a + 1)",
+		"(a + 1)",
+	}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Errorf("wrong statements.\nwant=%q\ngot =%q", expected, seen)
+	}
+}
+
+func TestStatementHookSeesLiveEnvironment(t *testing.T) {
+	var values []int64
+	hook := func(stmt ast.Statement, env *object.Environment) HookAction {
+		if x, ok := env.Get("x"); ok {
+			values = append(values, x.(*object.Integer).Value)
+		}
+		return Continue
+	}
+	New(WithStatementHook(hook)).Eval(parser.New(lexer.New(`let x = 1; let x = x + 1; let x = x * 10; x`)).ParseProgram(), object.NewEnvironment())
+
+	if !reflect.DeepEqual(values, []int64{1, 2, 20}) {
+		t.Errorf("wrong values. got=%v", values)
+	}
+}
+
+func TestStatementHookAbort(t *testing.T) {
+	hook := func(stmt ast.Statement, env *object.Environment) HookAction {
+		if _, ok := env.Get("b"); ok {
+			return Abort
+		}
+		return Continue
+	}
+	env := object.NewEnvironment()
+	result := New(WithStatementHook(hook)).Eval(parser.New(lexer.New("let a = 1;\nlet b = 2;\nlet c = 3;")).ParseProgram(), env)
+
+	errObj, ok := result.(*object.Error)
+	if !ok || errObj.Message != "evaluation aborted by statement hook" {
+		t.Fatalf("expected abort error. got=%v", result)
+	}
+	if errObj.Line != 3 {
+		t.Errorf("error should point at the aborted statement. got line %d", errObj.Line)
+	}
+	// 打ち切る前の文の結果は残る
+	if _, ok := env.Get("a"); !ok {
+		t.Errorf("a should be defined")
+	}
+	if _, ok := env.Get("c"); ok {
+		t.Errorf("c should not be defined")
+	}
+}
+
+func TestStatementHookPause(t *testing.T) {
+	paused := make(chan struct{}, 1)
+	hook := func(stmt ast.Statement, env *object.Environment) HookAction {
+		if _, ok := stmt.(*ast.ExpressionStatement); ok {
+			paused <- struct{}{}
+			return Pause
+		}
+		return Continue
+	}
+	ev := New(WithStatementHook(hook))
+	env := object.NewEnvironment()
+
+	done := make(chan object.Object)
+	go func() {
+		done <- ev.Eval(parser.New(lexer.New(`let a = 20; a + 22`)).ParseProgram(), env)
+	}()
+
+	<-paused
+	select {
+	case <-done:
+		t.Fatalf("evaluation should be paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if a, ok := env.Get("a"); !ok || a.(*object.Integer).Value != 20 {
+		t.Errorf("a should be defined while paused")
+	}
+
+	ev.Resume()
+	testIntegerObject(t, <-done, 42)
+}
+
+func TestStatementHookPauseCancelled(t *testing.T) {
+	hook := func(stmt ast.Statement, env *object.Environment) HookAction { return Pause }
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	result := New(WithStatementHook(hook)).EvalContext(ctx, parser.New(lexer.New(`1`)).ParseProgram(), object.NewEnvironment())
+	errObj, ok := result.(*object.Error)
+	if !ok || errObj.Message != "evaluation cancelled: context deadline exceeded" {
+		t.Errorf("expected cancellation error. got=%v", result)
+	}
+}
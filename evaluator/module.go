@@ -0,0 +1,130 @@
+package evaluator
+
+import (
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"path/filepath"
+	"strings"
+)
+
+// import文を評価する
+// 相対パスは、モジュールの中では そのモジュールのディレクトリから、それ以外では作業ディレクトリから解決する
+// モジュールは評価器ごとに絶対パスでキャッシュし、1回だけ評価する
+func (e *Evaluator) evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	path := node.Path
+	if !filepath.IsAbs(path) && len(e.moduleDirs) > 0 {
+		path = filepath.Join(e.moduleDirs[len(e.moduleDirs)-1], path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return newError(object.ImportError, "import %q: %s", node.Path, err)
+	}
+
+	module := e.modules[path]
+	if module == nil {
+		result := e.loadModule(node.Path, path)
+		if isError(result) {
+			return result
+		}
+		module = result.(*object.Module)
+	}
+
+	if module.Value != nil {
+		return importValue(node, module.Value, env)
+	}
+	if node.Alias != nil {
+		env.Set(node.Alias.Value, module)
+		return nil
+	}
+	// 別名がなければモジュールの束縛を現在のスコープに展開する
+	for _, pair := range module.Members.OrderedPairs() {
+		env.Set(pair.Key.(*object.String).Value, pair.Value)
+	}
+	return nil
+}
+
+// path のファイルを新しい環境で評価し、トップレベルの束縛を持つ Module を返す
+func (e *Evaluator) loadModule(name, path string) object.Object {
+	if e.loading[path] {
+		return newError(object.ImportError, "import %q: import cycle", name)
+	}
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return newError(object.ImportError, "import %q: %s", name, err)
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return newError(object.ImportError, "import %q: parse error: %s", name, strings.Join(p.Errors(), "; "))
+	}
+
+	if e.modules == nil {
+		e.modules = map[string]*object.Module{}
+		e.loading = map[string]bool{}
+	}
+	e.loading[path] = true
+	e.moduleDirs = append(e.moduleDirs, filepath.Dir(path))
+	defer func() {
+		delete(e.loading, path)
+		e.moduleDirs = e.moduleDirs[:len(e.moduleDirs)-1]
+	}()
+
+	// 読み込む側の環境とは別の環境で評価するので、モジュールの変数は読み込む側に漏れない
+	moduleEnv := object.NewEnvironment()
+	result := e.eval(program, moduleEnv)
+	if isError(result) {
+		return result
+	}
+
+	members := object.NewHash()
+	for _, memberName := range moduleEnv.Names() {
+		value, _ := moduleEnv.Get(memberName)
+		members.Set(&object.String{Value: memberName}, value)
+	}
+	module := &object.Module{Path: path, Members: members}
+	if e.returned {
+		module.Value = result
+	}
+	e.modules[path] = module
+	return module
+}
+
+// importValue はトップレベルの return で値を返したモジュールを読み込む
+// 別名があればその値を束縛する。別名がなければ、値は文字列をキーとするハッシュでなければならず、その各ペアを束縛する
+func importValue(node *ast.ImportStatement, value object.Object, env *object.Environment) object.Object {
+	if node.Alias != nil {
+		env.Set(node.Alias.Value, value)
+		return nil
+	}
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		return newError(object.ImportError, "import %q: module returns %s, not a hash; use import %q as name", node.Path, object.TypeName(value.Type()), node.Path)
+	}
+	pairs := hash.OrderedPairs()
+	for _, pair := range pairs {
+		if _, ok := pair.Key.(*object.String); !ok {
+			return newError(object.ImportError, "import %q: module returns a hash with %s key %s; use import %q as name", node.Path, object.TypeName(pair.Key.Type()), pair.Key.Inspect(), node.Path)
+		}
+	}
+	for _, pair := range pairs {
+		env.Set(pair.Key.(*object.String).Value, pair.Value)
+	}
+	return nil
+}
+
+// モジュールのメンバーを取り出す
+func evalModuleIndexExpression(module *object.Module, index object.Object) object.Object {
+	name, ok := index.(*object.String)
+	if !ok {
+		return newError(object.TypeError, "module member name must be STRING, got %s", index.Type())
+	}
+	pair, ok := module.Members.Pairs[name.HashKey()]
+	if !ok {
+		return newError(object.NameError, "module %s has no member %s", filepath.Base(module.Path), name.Value)
+	}
+	return pair.Value
+}
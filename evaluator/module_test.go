@@ -0,0 +1,210 @@
+package evaluator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dir にファイルを作成する
+func writeModules(t *testing.T, dir string, files map[string]string) {
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func evalInDir(ev *Evaluator, dir, input string) object.Object {
+	input = strings.Replace(input, "$DIR", filepath.ToSlash(dir), -1)
+	return ev.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+}
+
+func TestModuleImport(t *testing.T) {
+	dir := t.TempDir()
+	writeModules(t, dir, map[string]string{
+		"geometry.mky": `
+puts("loading geometry");
+let pi = 3;
+let area = fn(r) { pi * r * r };
+let helper = fn() { "geometry" };
+`,
+		"text.mky": `
+let helper = fn() { "text" };
+`,
+		"a.mky": `
+import "geometry.mky" as g;
+let a = g["area"](1);
+`,
+		"b.mky": `
+import "geometry.mky" as geo;
+let b = geo["area"](2);
+`,
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 名前空間を分けるので同名の helper が衝突しない
+		{`import "$DIR/geometry.mky" as g; import "$DIR/text.mky" as t; g["helper"]() + " " + t["helper"]()`, "geometry text"},
+		// モジュールは自身の環境で評価されるので、読み込む側の pi の影響を受けない
+		{`let pi = 100; import "$DIR/geometry.mky" as g; g["area"](2) + pi`, 112},
+		// モジュールの変数は読み込む側に漏れない
+		{`import "$DIR/geometry.mky" as g; pi`, "identifier not found: pi"},
+		// 別名のない import は束縛を展開する
+		{`import "$DIR/geometry.mky"; area(3)`, 27},
+		{`let helper = 1; import "$DIR/text.mky"; helper()`, "text"},
+		// モジュールの中の相対パスはモジュールのディレクトリから解決する
+		{`import "$DIR/a.mky" as a; import "$DIR/b.mky" as b; a["a"] + b["b"]`, 15},
+		{`import "$DIR/geometry.mky" as g; g`, "module(" + filepath.Join(dir, "geometry.mky") + ")"},
+		{`import "$DIR/geometry.mky" as g; g["volume"]`, "module geometry.mky has no member volume"},
+		{`import "$DIR/geometry.mky" as g; g[1]`, "module member name must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		evaluated := evalInDir(New(WithOutput(&out)), dir, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, expected, errObj.Message)
+				}
+			} else if evaluated.Inspect() != expected {
+				t.Errorf("%s: want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestModulesAreEvaluatedOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeModules(t, dir, map[string]string{
+		"counter.mky": `puts("loading counter"); let state = [0];`,
+		"a.mky":       `import "counter.mky" as c; let s = c["state"];`,
+		"b.mky":       `import "./counter.mky" as c; let s = c["state"];`,
+	})
+
+	var out bytes.Buffer
+	ev := New(WithOutput(&out))
+	evaluated := evalInDir(ev, dir, `
+import "$DIR/a.mky" as a;
+import "$DIR/b.mky" as b;
+import "$DIR/counter.mky" as c;
+append(a["s"], 1);
+[len(b["s"]), len(c["state"])]
+`)
+	if evaluated.Inspect() != "[2, 2]" {
+		t.Errorf("importers should share one module instance. got=%s", evaluated.Inspect())
+	}
+	if strings.Count(out.String(), "loading counter") != 1 {
+		t.Errorf("module should be evaluated once. output=%q", out.String())
+	}
+
+	// 同じ評価器で再び評価してもキャッシュを使う
+	evalInDir(ev, dir, `import "$DIR/counter.mky" as c;`)
+	if strings.Count(out.String(), "loading counter") != 1 {
+		t.Errorf("module should be cached across evaluations. output=%q", out.String())
+	}
+}
+
+// トップレベルの return で値を返したモジュールは、束縛の代わりにその値を公開する
+func TestModuleReturn(t *testing.T) {
+	dir := t.TempDir()
+	writeModules(t, dir, map[string]string{
+		"counter.mky": `
+let start = 10;
+return {"next": fn(n) { n + 1 }, "start": start};
+puts("unreachable");
+`,
+		"answer.mky": `
+if (true) { return 42; }
+let never = 1;
+`,
+		"numbered.mky": `return {1: "one"};`,
+		"plain.mky":    `let x = 1; if (false) { return 2; }`,
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "$DIR/answer.mky" as a; a`, 42},
+		{`import "$DIR/answer.mky" as a; import "$DIR/answer.mky" as b; a + b`, 84},
+		{`import "$DIR/counter.mky" as c; c["next"](c["start"])`, 11},
+		// 別名がなければ返したハッシュのペアを束縛する。モジュールの変数は公開しない
+		{`import "$DIR/counter.mky"; next(start)`, 11},
+		{`import "$DIR/counter.mky"; never`, "identifier not found: never"},
+		{`import "$DIR/answer.mky"; never`, `import "$DIR/answer.mky": module returns integer, not a hash; use import "$DIR/answer.mky" as name`},
+		{`import "$DIR/numbered.mky";`, `import "$DIR/numbered.mky": module returns a hash with integer key 1; use import "$DIR/numbered.mky" as name`},
+		// return を実行しなかったモジュールはこれまでどおり束縛を公開する
+		{`import "$DIR/plain.mky" as p; p["x"]`, 1},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		ev := New(WithOutput(&out))
+		evaluated := evalInDir(ev, dir, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			expected = strings.Replace(expected, "$DIR", filepath.ToSlash(dir), -1)
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, expected, errObj.Message)
+				}
+			} else if evaluated.Inspect() != expected {
+				t.Errorf("%s: want=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		}
+		if out.Len() != 0 {
+			t.Errorf("%s: statements after return should not run. output=%q", tt.input, out.String())
+		}
+		// モジュールの return は読み込んだプログラムの return ではない
+		if ev.Returned() {
+			t.Errorf("%s: Returned should be false for the importing program", tt.input)
+		}
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeModules(t, dir, map[string]string{
+		"broken.mky": `let = 1;`,
+		"failing.mky": `let x = 1;
+x + true;`,
+		"cycle_a.mky": `import "cycle_b.mky" as b;`,
+		"cycle_b.mky": `import "cycle_a.mky" as a;`,
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "$DIR/missing.mky" as m;`, `import "$DIR/missing.mky": open `},
+		{`import "$DIR/broken.mky" as m;`, `import "$DIR/broken.mky": parse error: expected next token to be IDENT, got = instead`},
+		{`import "$DIR/failing.mky" as m;`, `type mismatch: INTEGER + BOOLEAN`},
+		{`import "$DIR/cycle_a.mky" as m;`, `import "cycle_a.mky": import cycle`},
+	}
+
+	for _, tt := range tests {
+		evaluated := evalInDir(New(), dir, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		expected := strings.Replace(tt.expected, "$DIR", filepath.ToSlash(dir), -1)
+		if !ok || !strings.HasPrefix(errObj.Message, expected) {
+			t.Errorf("%s: want error starting with %q, got %v", tt.input, expected, evaluated)
+		}
+	}
+}
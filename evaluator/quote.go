@@ -0,0 +1,96 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"strconv"
+)
+
+// quote(式) の呼び出しかどうか。quote の引数は評価しない
+func isQuoteCall(node *ast.CallExpression) bool {
+	ident, ok := node.Function.(*ast.Identifier)
+	return ok && ident.Value == "quote"
+}
+
+func isUnquoteCall(node *ast.CallExpression) bool {
+	ident, ok := node.Function.(*ast.Identifier)
+	return ok && ident.Value == "unquote"
+}
+
+// quote の引数の構文木を Quote として返す
+// 構文木の中の unquote(式) は、式を評価した値を表すノードに置き換える
+func (e *Evaluator) evalQuote(node *ast.CallExpression, env *object.Environment) object.Object {
+	if len(node.Arguments) != 1 {
+		return newError(object.ArityError, "quote: expected 1 argument, got %d", len(node.Arguments))
+	}
+
+	// 関数の本体などにある元の構文木は書き換えない
+	quoted := ast.Copy(node.Arguments[0])
+
+	var err object.Object
+	quoted = ast.Modify(quoted, func(n ast.Node) ast.Node {
+		call, ok := n.(*ast.CallExpression)
+		if !ok || err != nil || !isUnquoteCall(call) {
+			return n
+		}
+		if len(call.Arguments) != 1 {
+			err = e.annotateError(newError(object.ArityError, "unquote: expected 1 argument, got %d", len(call.Arguments)), call)
+			return n
+		}
+
+		value := e.eval(call.Arguments[0], env)
+		if isError(value) {
+			err = value
+			return n
+		}
+		replacement, ok := objectToExpression(value, callSite(call))
+		if !ok {
+			err = e.annotateError(newError(object.TypeError, "unquote: cannot convert %s to an expression", object.TypeName(value.Type())), call)
+			return n
+		}
+		return replacement
+	})
+	if err != nil {
+		return err
+	}
+
+	return &object.Quote{Node: quoted}
+}
+
+// 値をその値に評価される式に変換する。変換できない値の場合はokがfalse
+// 作成したノードは unquote の呼び出し箇所の位置を持つ
+func objectToExpression(obj object.Object, site token.Token) (ast.Expression, bool) {
+	pos := func(tt token.TokenType, literal string) token.Token {
+		return token.Token{Type: tt, Literal: literal, Line: site.Line, Column: site.Column}
+	}
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return &ast.IntegerLiteral{Token: pos(token.INT, strconv.FormatInt(obj.Value, 10)), Value: obj.Value}, true
+	case *object.BigInteger:
+		return &ast.BigIntegerLiteral{Token: pos(token.INT, obj.Value.String()), Value: obj.Value}, true
+	case *object.Boolean:
+		if obj.Value {
+			return &ast.Boolean{Token: pos(token.TRUE, "true"), Value: true}, true
+		}
+		return &ast.Boolean{Token: pos(token.FALSE, "false"), Value: false}, true
+	case *object.String:
+		return &ast.StringLiteral{Token: pos(token.STRING, obj.Value), Value: obj.Value}, true
+	case *object.Array:
+		elements := make([]ast.Expression, len(obj.Elements))
+		for i, el := range obj.Elements {
+			exp, ok := objectToExpression(el, site)
+			if !ok {
+				return nil, false
+			}
+			elements[i] = exp
+		}
+		return &ast.ArrayLiteral{Token: pos(token.LBRACKET, "["), Elements: elements}, true
+	case *object.Quote:
+		exp, ok := obj.Node.(ast.Expression)
+		return exp, ok
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,99 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfixExpression = quote(4 + 4);
+		  quote(unquote(4 + 4) + unquote(quotedInfixExpression))`, `(8 + (4 + 4))`},
+		{`quote(unquote("a" + "b"))`, `ab`},
+		{`quote(unquote(0 - 3) * 2)`, `(-3 * 2)`},
+		{`quote(unquote([1, 1 + 1]))`, `[1, 2]`},
+		{`let f = fn(x) { quote(unquote(x) + 1) }; f(2)`, `(2 + 1)`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteDoesNotModifyTheSource(t *testing.T) {
+	// 同じ関数を2回呼んでも、1回目の unquote の結果が本体に残らない
+	evaluated := testEval(`let f = fn(x) { quote(unquote(x)) }; f(1); f(2)`)
+	testQuoteObject(t, evaluated, `2`)
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote()`, "quote: expected 1 argument, got 0"},
+		{`quote(1, 2)`, "quote: expected 1 argument, got 2"},
+		{`quote(unquote())`, "unquote: expected 1 argument, got 0"},
+		{`quote(unquote(missing))`, "identifier not found: missing"},
+		{`quote(unquote(fn() { 1 }))`, "unquote: cannot convert function to an expression"},
+		{`unquote(1)`, "identifier not found: unquote"},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func testQuoteObject(t *testing.T, obj object.Object, expected string) {
+	quote, ok := obj.(*object.Quote)
+	if !ok {
+		t.Errorf("expected *object.Quote. got=%T (%+v)", obj, obj)
+		return
+	}
+	if quote.Node == nil {
+		t.Errorf("quote.Node is nil")
+		return
+	}
+	if quote.Node.String() != expected {
+		t.Errorf("not equal. want=%q, got=%q", expected, quote.Node.String())
+	}
+	if quote.Inspect() != "QUOTE("+expected+")" {
+		t.Errorf("wrong Inspect. got=%q", quote.Inspect())
+	}
+}
+
+func TestQuoteIsReserved(t *testing.T) {
+	ev := New(AllowBuiltinOverride())
+	err := ev.RegisterBuiltin("quote", func(args ...object.Object) object.Object { return NULL })
+	if err == nil || err.Error() != `"quote" is reserved` {
+		t.Errorf("expected reserved error. got=%v", err)
+	}
+}
@@ -0,0 +1,263 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"monkey/object"
+	"sort"
+)
+
+// 環境の保存形式のバージョン
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version  int                    `json:"version"`
+	Bindings map[string]interface{} `json:"bindings"`
+}
+
+// SaveEnvironment は env の現在のスコープの束縛をJSONで w に書き出す
+//
+// 保存できるのは整数・文字列・真偽値・null・配列・ハッシュ・セット・範囲だけで、
+// 関数や組み込み関数を含む束縛は保存せず、その名前と理由を skipped に返す
+// freeze の状態は保存しない
+func SaveEnvironment(w io.Writer, env *object.Environment) (skipped []string, err error) {
+	all := env.All(false)
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	snap := snapshot{Version: snapshotVersion, Bindings: map[string]interface{}{}}
+	for _, name := range names {
+		value, err := encodeValue(all[name], map[object.Object]bool{})
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+		snap.Bindings[name] = value
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return skipped, enc.Encode(snap)
+}
+
+// LoadEnvironment は SaveEnvironment が書き出した束縛を r から読み込み env に設定する
+// 読み込みに失敗した場合は env を変更しない
+func LoadEnvironment(r io.Reader, env *object.Environment) error {
+	var snap snapshot
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&snap); err != nil {
+		return fmt.Errorf("invalid snapshot: %s", err)
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	// 壊れた束縛が複数あっても同じエラーになるよう、名前の順に読み込む
+	names := make([]string, 0, len(snap.Bindings))
+	for name := range snap.Bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	loaded := make([]object.Object, len(names))
+	for i, name := range names {
+		obj, err := decodeValue(snap.Bindings[name])
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		loaded[i] = obj
+	}
+
+	for i, name := range names {
+		env.Set(name, loaded[i])
+	}
+	return nil
+}
+
+// 値をJSONに対応する値に変換する
+// 配列はJSONの配列、ハッシュ・セット・範囲は {"hash": [[キー, 値], ...]} のように種類を表すキーを持つオブジェクトにする
+// visitingは変換途中の配列とハッシュで、循環していればエラーにする
+func encodeValue(obj object.Object, visiting map[object.Object]bool) (interface{}, error) {
+	switch obj.(type) {
+	case *object.Array, *object.Hash:
+		if visiting[obj] {
+			return nil, fmt.Errorf("cannot save cyclic %s", object.TypeName(obj.Type()))
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+	}
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return json.Number(obj.Inspect()), nil
+	case *object.BigInteger:
+		return json.Number(obj.Inspect()), nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Null:
+		return nil, nil
+	case *object.Array:
+		elements, err := encodeValues(obj.Elements, visiting)
+		if err != nil {
+			return nil, err
+		}
+		return elements, nil
+	case *object.Hash:
+		pairs := make([][2]interface{}, 0, len(obj.Pairs))
+		for _, pair := range obj.OrderedPairs() {
+			key, err := encodeValue(pair.Key, visiting)
+			if err != nil {
+				return nil, err
+			}
+			value, err := encodeValue(pair.Value, visiting)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, [2]interface{}{key, value})
+		}
+		return map[string]interface{}{"hash": pairs}, nil
+	case *object.Set:
+		members, err := encodeValues(obj.Members(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"set": members}, nil
+	case *object.Range:
+		return map[string]interface{}{"range": []int64{obj.Start, obj.Stop, obj.Step}}, nil
+	default:
+		return nil, fmt.Errorf("cannot save %s", object.TypeName(obj.Type()))
+	}
+}
+
+func encodeValues(objs []object.Object, visiting map[object.Object]bool) ([]interface{}, error) {
+	values := make([]interface{}, len(objs))
+	for i, obj := range objs {
+		value, err := encodeValue(obj, visiting)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// encodeValue で変換した値を元に戻す
+func decodeValue(value interface{}) (object.Object, error) {
+	switch value := value.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		return nativeBooleanObject(value), nil
+	case string:
+		return &object.String{Value: value}, nil
+	case json.Number:
+		n, ok := new(big.Int).SetString(string(value), 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %s", value)
+		}
+		return newInteger(n), nil
+	case []interface{}:
+		elements, err := decodeValues(value)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Array{Elements: elements}, nil
+	case map[string]interface{}:
+		if len(value) != 1 {
+			return nil, fmt.Errorf("unexpected object %v", value)
+		}
+		for tag, body := range value {
+			return decodeTaggedValue(tag, body)
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected value %v", value)
+	}
+}
+
+// {"hash": ...} などの種類を表すキーを持つ値を元に戻す
+func decodeTaggedValue(tag string, body interface{}) (object.Object, error) {
+	items, ok := body.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array", tag)
+	}
+	switch tag {
+	case "hash":
+		hash := object.NewHash()
+		for _, item := range items {
+			pair, ok := item.([]interface{})
+			if !ok || len(pair) != 2 {
+				return nil, fmt.Errorf("hash pair must be [key, value]")
+			}
+			key, err := decodeValue(pair[0])
+			if err != nil {
+				return nil, err
+			}
+			if err := object.CheckHashKey(key); err != nil {
+				return nil, errors.New(err.Message)
+			}
+			v, err := decodeValue(pair[1])
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(key, v)
+		}
+		return hash, nil
+	case "set":
+		members, err := decodeValues(items)
+		if err != nil {
+			return nil, err
+		}
+		set := object.NewSet()
+		for _, member := range members {
+			if err := object.CheckHashKey(member); err != nil {
+				return nil, errors.New(err.Message)
+			}
+			set.Add(member)
+		}
+		return set, nil
+	case "range":
+		bounds, err := decodeValues(items)
+		if err != nil {
+			return nil, err
+		}
+		if len(bounds) != 3 {
+			return nil, fmt.Errorf("range must be [start, stop, step]")
+		}
+		values := make([]int64, 3)
+		for i, bound := range bounds {
+			n, ok := bound.(*object.Integer)
+			if !ok {
+				return nil, fmt.Errorf("range bound must be INTEGER")
+			}
+			values[i] = n.Value
+		}
+		if values[2] == 0 {
+			return nil, fmt.Errorf("range step must not be zero")
+		}
+		return &object.Range{Start: values[0], Stop: values[1], Step: values[2]}, nil
+	default:
+		return nil, fmt.Errorf("unknown value kind %q", tag)
+	}
+}
+
+func decodeValues(values []interface{}) ([]object.Object, error) {
+	objs := make([]object.Object, len(values))
+	for i, value := range values {
+		obj, err := decodeValue(value)
+		if err != nil {
+			return nil, err
+		}
+		objs[i] = obj
+	}
+	return objs, nil
+}
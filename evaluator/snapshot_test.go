@@ -0,0 +1,124 @@
+package evaluator
+
+import (
+	"bytes"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSaveAndLoadEnvironment(t *testing.T) {
+	env := object.NewEnvironment()
+	input := `
+let n = 42;
+let big = pow(2, 100);
+let s = "hello";
+let t = true;
+let nothing = if (false) { 1 };
+let xs = [1, "two", [false], {"k": 3}];
+let h = {"b": 1, 2: "two", true: [1]};
+let members = set(3, 1, 2);
+let r = 0..10 step 2;
+`
+	ev := New()
+	ev.Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+
+	var buf bytes.Buffer
+	skipped, err := SaveEnvironment(&buf, env)
+	if err != nil {
+		t.Fatalf("SaveEnvironment failed: %s", err)
+	}
+	if len(skipped) != 0 {
+		t.Errorf("nothing should be skipped. got=%v", skipped)
+	}
+
+	loaded := object.NewEnvironment()
+	if err := LoadEnvironment(&buf, loaded); err != nil {
+		t.Fatalf("LoadEnvironment failed: %s", err)
+	}
+
+	if !reflect.DeepEqual(loaded.Names(), env.Names()) {
+		t.Fatalf("wrong names. want=%v, got=%v", env.Names(), loaded.Names())
+	}
+	for _, name := range env.Names() {
+		want, _ := env.Get(name)
+		got, _ := loaded.Get(name)
+		if got.Type() != want.Type() || got.Inspect() != want.Inspect() {
+			t.Errorf("%s: want=%s (%s), got=%s (%s)", name, want.Inspect(), want.Type(), got.Inspect(), got.Type())
+		}
+	}
+
+	// 読み込んだ真偽値やnullも評価器の値と同じように扱える
+	result := ev.Eval(parser.New(lexer.New(`if (t) { nothing == if (false) { 1 } } else { false }`)).ParseProgram(), loaded)
+	testBooleanObject(t, result, true)
+}
+
+func TestSaveEnvironmentSkipsFunctions(t *testing.T) {
+	env := object.NewEnvironment()
+	New().Eval(parser.New(lexer.New(`let f = fn(x) { x }; let fs = [len]; let x = 1;`)).ParseProgram(), env)
+
+	var buf bytes.Buffer
+	skipped, err := SaveEnvironment(&buf, env)
+	if err != nil {
+		t.Fatalf("SaveEnvironment failed: %s", err)
+	}
+	expected := []string{"f: cannot save function", "fs: cannot save builtin"}
+	if !reflect.DeepEqual(skipped, expected) {
+		t.Errorf("wrong skipped bindings. want=%v, got=%v", expected, skipped)
+	}
+
+	loaded := object.NewEnvironment()
+	if err := LoadEnvironment(&buf, loaded); err != nil {
+		t.Fatalf("LoadEnvironment failed: %s", err)
+	}
+	if !reflect.DeepEqual(loaded.Names(), []string{"x"}) {
+		t.Errorf("only x should be loaded. got=%v", loaded.Names())
+	}
+}
+
+func TestSaveEnvironmentSkipsCycles(t *testing.T) {
+	env := object.NewEnvironment()
+	New().Eval(parser.New(lexer.New(`let a = [1]; append(a, a); let b = []; let h = {"b": b}; append(b, h); let x = [a[0], a[0]];`)).ParseProgram(), env)
+
+	var buf bytes.Buffer
+	skipped, err := SaveEnvironment(&buf, env)
+	if err != nil {
+		t.Fatalf("SaveEnvironment failed: %s", err)
+	}
+	expected := []string{"a: cannot save cyclic array", "b: cannot save cyclic array", "h: cannot save cyclic hash"}
+	if !reflect.DeepEqual(skipped, expected) {
+		t.Errorf("wrong skipped bindings. want=%v, got=%v", expected, skipped)
+	}
+}
+
+func TestLoadEnvironmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`not json`, "invalid snapshot"},
+		{`{"version": 2, "bindings": {}}`, "unsupported snapshot version 2"},
+		{`{"version": 1, "bindings": {"x": {"hash": [[[1], 2]]}}}`, "x: unusable as hash key: ARRAY"},
+		{`{"version": 1, "bindings": {"x": {"hash": [[null, 2]]}}}`, "x: unusable as hash key: NULL"},
+		{`{"version": 1, "bindings": {"x": {"set": [1, {"hash": []}]}}}`, "x: unusable as hash key: HASH"},
+		{`{"version": 1, "bindings": {"x": {"func": []}}}`, `x: unknown value kind "func"`},
+		{`{"version": 1, "bindings": {"x": {"range": [0, 1, 0]}}}`, "x: range step must not be zero"},
+		// 壊れた束縛が複数あれば名前の順で最初のものを報告する
+		{`{"version": 1, "bindings": {"z": {"func": []}, "b": {"range": [0, 1, 0]}, "m": {"func": []}}}`, "b: range step must not be zero"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("x", TRUE)
+		err := LoadEnvironment(strings.NewReader(tt.input), env)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("%s: want error %q, got %v", tt.input, tt.expected, err)
+		}
+		if x, _ := env.Get("x"); x != TRUE {
+			t.Errorf("%s: environment changed on failure", tt.input)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package evaluator
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/object"
+)
+
+// StatementReader は評価する最上位の文を1つずつ返す
+// 文がなくなると (nil, nil) を返す。構文エラーなどで続けられない場合はエラーを返す
+type StatementReader func() (ast.Statement, error)
+
+// EvalStream は next が返す最上位の文を1つずつ評価し、最後の文の値を返す
+// プログラム全体を構文解析してから Eval するのと同じ結果になるが、評価し終えた文の構文木は保持しない
+// next がエラーを返した場合は、それまでの文を評価した状態でそのエラーを返す
+// 評価中のエラーは Eval と同じく *object.Error の値として返す
+func (e *Evaluator) EvalStream(ctx context.Context, next StatementReader, env *object.Environment) (object.Object, error) {
+	defer e.enter(ctx)()
+
+	var result object.Object
+	for {
+		statement, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if statement == nil {
+			e.returned = false
+			return result, nil
+		}
+		var done bool
+		if result, done = e.evalTopLevel(statement, env); done {
+			e.returned = !isError(result)
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var streamPrograms = []string{
+	`let a = 1; let b = a + 1; let add = fn(x, y) { x + y }; add(a, b)`,
+	`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+[isEven(10), isOdd(7)]`,
+	`puts("one"); let xs = map([1, 2], fn(x) { x * 10 }); puts(xs); return len(xs); puts("never")`,
+	`let h = {"k": [1, 2]}; let f = fn() { h["k"][1] }; f() + missing`,
+	`let x = 1;`,
+	``,
+}
+
+// 1文ずつ評価しても、全体を評価するのと同じ値と出力になる
+func TestEvalStreamMatchesEval(t *testing.T) {
+	for _, input := range streamPrograms {
+		var wantOut, gotOut bytes.Buffer
+		wantEv := New(WithOutput(&wantOut))
+		want := wantEv.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+
+		p := parser.New(lexer.New(input))
+		gotEv := New(WithOutput(&gotOut))
+		got, err := gotEv.EvalStream(context.Background(), statementsOf(p), object.NewEnvironment())
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", input, err)
+		}
+		if inspect(got) != inspect(want) || gotOut.String() != wantOut.String() {
+			t.Errorf("%q: results differ.\nwant=%s %q\ngot=%s %q", input, inspect(want), wantOut.String(), inspect(got), gotOut.String())
+		}
+		if gotEv.Returned() != wantEv.Returned() {
+			t.Errorf("%q: Returned differs. want=%t, got=%t", input, wantEv.Returned(), gotEv.Returned())
+		}
+	}
+}
+
+func TestEvalStreamStopsAtReaderError(t *testing.T) {
+	var out bytes.Buffer
+	p := parser.New(lexer.New(`puts("before"); let = 1; puts("after")`))
+	_, err := New(WithOutput(&out)).EvalStream(context.Background(), statementsOf(p), object.NewEnvironment())
+	if err == nil || err.Error() != "1:21: expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	if out.String() != "before\n" {
+		t.Errorf("statements before the error should be evaluated. got=%q", out.String())
+	}
+}
+
+// 1文ずつ評価する間に持つ構文木は、いちばん大きい文の分だけ
+func TestEvalStreamPeakNodes(t *testing.T) {
+	var src strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&src, "let v%s = fn(x) { if (x < %d) { [x, x + 1] } else { {\"k\": x * 2} } };\n", strings.Repeat("a", i%26+1), i)
+	}
+	src.WriteString("1 + 2")
+
+	total := countNodes(reflect.ValueOf(parser.New(lexer.New(src.String())).ParseProgram()))
+
+	p := parser.New(lexer.New(src.String()))
+	peak := 0
+	next := statementsOf(p)
+	counting := func() (ast.Statement, error) {
+		stmt, err := next()
+		if stmt != nil {
+			if n := countNodes(reflect.ValueOf(stmt)); n > peak {
+				peak = n
+			}
+		}
+		return stmt, err
+	}
+	result, err := New().EvalStream(context.Background(), counting, object.NewEnvironment())
+	if err != nil || inspect(result) != "3" {
+		t.Fatalf("wrong result. got=%s, err=%v", inspect(result), err)
+	}
+	if peak == 0 || peak*100 > total {
+		t.Errorf("peak AST nodes should be about 1/200 of the whole program. peak=%d, total=%d", peak, total)
+	}
+}
+
+// statementsOf は p から文を1つずつ読む。構文エラーがあればエラーを返す
+func statementsOf(p *parser.Parser) StatementReader {
+	return func() (ast.Statement, error) {
+		stmt := p.ParseStatement()
+		if errs := p.ErrorDetails(); len(errs) > 0 {
+			return nil, errs[0]
+		}
+		return stmt, nil
+	}
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return obj.Inspect()
+}
+
+// countNodes は v からたどれる構文木のノードの数を返す
+func countNodes(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return 0
+		}
+		n := countNodes(v.Elem())
+		if _, ok := v.Interface().(ast.Node); ok {
+			n++
+		}
+		return n
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return countNodes(v.Elem())
+	case reflect.Struct:
+		n := 0
+		for i := 0; i < v.NumField(); i++ {
+			n += countNodes(v.Field(i))
+		}
+		return n
+	case reflect.Slice:
+		n := 0
+		for i := 0; i < v.Len(); i++ {
+			n += countNodes(v.Index(i))
+		}
+		return n
+	case reflect.Map:
+		n := 0
+		for _, key := range v.MapKeys() {
+			n += countNodes(key) + countNodes(v.MapIndex(key))
+		}
+		return n
+	default:
+		return 0
+	}
+}
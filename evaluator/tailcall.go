@@ -0,0 +1,128 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+)
+
+// tailCall は末尾位置で評価を保留した関数呼び出し
+// applyFunction の中でだけ使い、評価器の外には出さない
+type tailCall struct {
+	function object.Object
+	args     []object.Object
+	site     token.Token
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// 関数本体を評価する。末尾位置の関数呼び出しは評価せずに tailCall として返す
+// 末尾位置とは、ブロックの最後の式文、return文の式、およびそれらの位置にあるif式の各分岐のこと
+func (e *Evaluator) evalFunctionBody(block *ast.BlockStatement, env *object.Environment) object.Object {
+	if err := e.checkLimits(); err != nil {
+		return err
+	}
+
+	var result object.Object
+
+	for i, statement := range block.Statements {
+		if e.statementHook != nil {
+			if err := e.beforeStatement(statement, env); err != nil {
+				return err
+			}
+		}
+		switch stmt := statement.(type) {
+		case *ast.ReturnStatement:
+			if err := e.checkLimits(); err != nil {
+				return err
+			}
+			result = e.evalTailExpression(stmt.ReturnValue, env)
+			if _, ok := result.(*tailCall); ok || isError(result) {
+				return result
+			}
+			if _, ok := result.(*object.ReturnValue); !ok {
+				result = &object.ReturnValue{Value: result}
+			}
+		case *ast.ExpressionStatement:
+			if i != len(block.Statements)-1 {
+				result = e.eval(stmt, env)
+				break
+			}
+			if err := e.checkLimits(); err != nil {
+				return err
+			}
+			result = e.evalTailExpression(stmt.Expression, env)
+		default:
+			result = e.eval(statement, env)
+		}
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+// 末尾位置の式を評価する
+func (e *Evaluator) evalTailExpression(exp ast.Expression, env *object.Environment) object.Object {
+	if e.tracer == nil {
+		return e.annotateError(e.evalTailNode(exp, env), exp)
+	}
+
+	e.tracer.EnterNode(exp)
+	result := e.annotateError(e.evalTailNode(exp, env), exp)
+	if _, ok := result.(*tailCall); ok {
+		// 保留した呼び出しはまだ値を持たない
+		e.tracer.ExitNode(exp, nil)
+	} else {
+		e.tracer.ExitNode(exp, result)
+	}
+	return result
+}
+
+func (e *Evaluator) evalTailNode(exp ast.Expression, env *object.Environment) object.Object {
+	switch node := exp.(type) {
+	case *ast.CallExpression:
+		if err := e.checkLimits(); err != nil {
+			return err
+		}
+		if isQuoteCall(node) {
+			return e.evalQuote(node, env)
+		}
+		function := e.eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := e.evalCallArguments(function, node, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		// 組み込み関数は再帰しないので、呼び出し履歴に残すためその場で呼ぶ
+		if _, ok := function.(*object.Function); !ok {
+			return e.applyFunction(function, args, callSite(node), env)
+		}
+		return &tailCall{function: function, args: args, site: callSite(node)}
+	case *ast.IfExpression:
+		if err := e.checkLimits(); err != nil {
+			return err
+		}
+		condition := e.eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if isTruthy(condition) {
+			return e.evalFunctionBody(node.Consequence, env)
+		} else if node.Alternative != nil {
+			return e.evalFunctionBody(node.Alternative, env)
+		} else {
+			return NULL
+		}
+	default:
+		return e.eval(exp, env)
+	}
+}
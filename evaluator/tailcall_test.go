@@ -0,0 +1,169 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 既定の深さの上限を大きく超える末尾再帰
+		{`let count = fn(n) { if (n == 0) { "done" } else { count(n - 1) } };
+count(1000000);`, "done"},
+		{`let sum = fn(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); };
+sum(100000, 0);`, 5000050000},
+		// 相互再帰
+		{`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+isEven(100001);`, false},
+		// クロージャ
+		{`let adder = fn(n) { fn(x) { x + n } };
+let apply = fn(f, x) { f(x) };
+apply(adder(5), 10);`, 15},
+		{`let make = fn(n) { if (n == 0) { fn() { "bottom" } } else { make(n - 1) } };
+make(20000)();`, "bottom"},
+		// returnの値は呼び出し元に漏れない
+		{`let f = fn(x) { return x; 99 };
+let g = fn(x) { return f(x); 100 };
+g(5);`, 5},
+		{`let inner = fn() { return 1; };
+let outer = fn() { inner(); 2 };
+outer();`, 2},
+		{`let f = fn() { if (true) { return 1; } 2 };
+let g = fn() { f() + 10 };
+g();`, 11},
+		{`let f = fn(x) { if (x > 1) { f(1) } };
+f(2);`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestTailCallsKeepBoundedStack(t *testing.T) {
+	ev := New(WithMaxDepth(100))
+	err := ev.RegisterBuiltin("depth", func(args ...object.Object) object.Object {
+		return object.NewInteger(int64(len(ev.stack)))
+	})
+	if err != nil {
+		t.Fatalf("RegisterBuiltin returned error: %s", err)
+	}
+
+	input := `let f = fn(n) { if (n == 0) { depth() } else { f(n - 1) } };
+f(1000);`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	// 置き換えた f は入れ子の上限まで履歴に残り、それ以上は増えない。depth の分が1つ加わる
+	testIntegerObject(t, ev.Eval(program, object.NewEnvironment()), 101)
+	if len(ev.stack) != 0 || ev.tailFrames != 0 {
+		t.Errorf("call stack not unwound. got=%d frames (%d tail)", len(ev.stack), ev.tailFrames)
+	}
+}
+
+func TestNonTailRecursionStillLimited(t *testing.T) {
+	input := `let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } };
+count(1000000);`
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error")
+	}
+	if errObj.Message != "maximum recursion depth exceeded" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestMaxTailCalls(t *testing.T) {
+	countdown := `let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } };
+count(%d);`
+	ev := New(WithMaxTailCalls(100))
+	testIntegerObject(t, ev.Eval(parser.New(lexer.New(fmt.Sprintf(countdown, 100))).ParseProgram(), object.NewEnvironment()), 0)
+
+	errObj, ok := ev.Eval(parser.New(lexer.New(fmt.Sprintf(countdown, 101))).ParseProgram(), object.NewEnvironment()).(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error")
+	}
+	if errObj.Message != "maximum recursion depth exceeded" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	if len(ev.stack) != 0 || ev.tailFrames != 0 {
+		t.Errorf("call stack not unwound. got=%d frames (%d tail)", len(ev.stack), ev.tailFrames)
+	}
+}
+
+func TestTailSelfLoopStoppedBySteps(t *testing.T) {
+	program := parser.New(lexer.New("let f = fn() { f() }; f();")).ParseProgram()
+	ev := New(WithMaxSteps(10000))
+	errObj, ok := ev.Eval(program, object.NewEnvironment()).(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error")
+	}
+	if errObj.Message != "evaluation budget exceeded after 10000 steps" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestTailCallsKeepCallerFrames(t *testing.T) {
+	input := `let c = fn(x) { x + "a" };
+let b = fn(x) { c(x) };
+let a = fn(x) { b(x) };
+a(1);`
+	tests := []struct {
+		ev       *Evaluator
+		expected []object.StackFrame
+	}{
+		// 置き換えた呼び出しも履歴に残る
+		{New(), []object.StackFrame{
+			{Function: "c", Line: 2, Column: 17},
+			{Function: "b", Line: 3, Column: 17},
+			{Function: "a", Line: 4, Column: 1},
+		}},
+		// 履歴が入れ子の上限に達したら、最も内側の呼び出しを置き換える
+		{New(WithMaxDepth(2)), []object.StackFrame{
+			{Function: "c", Line: 2, Column: 17},
+			{Function: "a", Line: 4, Column: 1},
+		}},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := tt.ev.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment()).(*object.Error)
+		if !ok {
+			t.Fatalf("object is not Error")
+		}
+		if !reflect.DeepEqual(errObj.Stack, tt.expected) {
+			t.Errorf("wrong stack. want=%+v, got=%+v", tt.expected, errObj.Stack)
+		}
+	}
+}
+
+func BenchmarkTailRecursiveCountdown(b *testing.B) {
+	program := parser.New(lexer.New(`let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } };
+count(100000);`)).ParseProgram()
+	for i := 0; i < b.N; i++ {
+		New().Eval(program, object.NewEnvironment())
+	}
+}
+
+func BenchmarkNonTailRecursiveCountdown(b *testing.B) {
+	program := parser.New(lexer.New(`let count = fn(n) { if (n == 0) { 0 } else { 0 + count(n - 1) } };
+count(100000);`)).ParseProgram()
+	for i := 0; i < b.N; i++ {
+		New(WithMaxDepth(200000)).Eval(program, object.NewEnvironment())
+	}
+}
@@ -0,0 +1,46 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/object"
+	"monkey/token"
+	"strings"
+)
+
+// registeredTest は test で登録したテスト
+type registeredTest struct {
+	name string
+	fn   *object.Function
+}
+
+// RunTests は test で登録したテストを登録順に実行する。runTests() と同じ
+// テストごとに "PASS name" か "FAIL name: エラー" の行を、最後に集計の行を puts の出力先に書く
+// エラー（assert の失敗を含む）を返したテストを失敗とし、失敗したテストの数を返す
+// テストの中で exit() が呼ばれた場合は残りのテストを実行せず、その終了を exit として返す
+// 実行したテストは登録から外すので、続けて呼ぶとその後に登録したテストだけを実行する
+func (e *Evaluator) RunTests() (failed int, exit *object.Error) {
+	return e.runTests(token.Token{})
+}
+
+func (e *Evaluator) runTests(site token.Token) (failed int, exit *object.Error) {
+	tests := e.tests
+	e.tests = nil
+	passed := 0
+	for _, t := range tests {
+		// 関数の呼び出しと同じく、テストの let は新しい環境に束縛され、他のテストには見えない
+		result := e.applyFunction(t.fn, nil, site, t.fn.Env)
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			passed++
+			fmt.Fprintf(e.out, "PASS %s\n", t.name)
+			continue
+		}
+		if errObj.Exit {
+			return failed, errObj
+		}
+		failed++
+		fmt.Fprintf(e.out, "FAIL %s: %s\n", t.name, strings.TrimPrefix(errObj.Inspect(), "ERROR: "))
+	}
+	fmt.Fprintf(e.out, "%d passed, %d failed\n", passed, failed)
+	return failed, nil
+}
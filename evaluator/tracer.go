@@ -0,0 +1,116 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/object"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Tracer は評価の進行を受け取る
+// WithTracer で設定した場合だけ呼ばれ、設定しない場合は呼び出しのコストもかからない
+type Tracer interface {
+	// ノードの評価の開始と終了
+	// 末尾位置の関数呼び出しは評価を保留して呼び出し元の関数から抜けた後で呼ぶので、ExitNode の値は nil になる
+	EnterNode(node ast.Node)
+	ExitNode(node ast.Node, result object.Object)
+	// 関数（組み込み関数を含む）の呼び出しの開始と終了。無名関数の名前は "<anonymous>"
+	EnterCall(fnName string)
+	ExitCall(fnName string)
+}
+
+// WithTracer は評価の進行を tracer に通知する
+func WithTracer(tracer Tracer) Option {
+	return func(e *Evaluator) {
+		e.tracer = tracer
+	}
+}
+
+// CountingTracer は関数ごとの呼び出し回数と累積時間、ノードの種類ごとの評価回数を集計する Tracer
+type CountingTracer struct {
+	// 関数名ごとの集計
+	Calls map[string]*CallStats
+	// ノードの種類（"InfixExpression" など）ごとの評価回数
+	Nodes map[string]int
+
+	// 評価中の呼び出しの開始時刻（外側の呼び出しが先頭）
+	starts []time.Time
+	// 関数名ごとの評価中の呼び出しの数。再帰呼び出しの時間を二重に数えないために使う
+	active map[string]int
+}
+
+// CallStats は1つの関数の集計結果
+type CallStats struct {
+	Calls int
+	// 呼び出しから戻るまでの時間の合計（内側の呼び出しの時間を含む）
+	Time time.Duration
+}
+
+// NewCountingTracer は空の CountingTracer を生成する
+func NewCountingTracer() *CountingTracer {
+	return &CountingTracer{
+		Calls:  map[string]*CallStats{},
+		Nodes:  map[string]int{},
+		active: map[string]int{},
+	}
+}
+
+func (t *CountingTracer) EnterNode(node ast.Node) {
+	t.Nodes[strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")]++
+}
+
+func (t *CountingTracer) ExitNode(node ast.Node, result object.Object) {}
+
+func (t *CountingTracer) EnterCall(fnName string) {
+	stats, ok := t.Calls[fnName]
+	if !ok {
+		stats = &CallStats{}
+		t.Calls[fnName] = stats
+	}
+	stats.Calls++
+	t.active[fnName]++
+	t.starts = append(t.starts, time.Now())
+}
+
+func (t *CountingTracer) ExitCall(fnName string) {
+	start := t.starts[len(t.starts)-1]
+	t.starts = t.starts[:len(t.starts)-1]
+	t.active[fnName]--
+	// 再帰呼び出しは最も外側の呼び出しの時間だけを数える
+	if t.active[fnName] == 0 {
+		t.Calls[fnName].Time += time.Since(start)
+	}
+}
+
+// Report は関数ごとの集計を累積時間の長い順に w に書き出す
+//
+//	function  calls  time
+//	fib       177    1.2ms
+func (t *CountingTracer) Report(w io.Writer) error {
+	names := make([]string, 0, len(t.Calls))
+	for name := range t.Calls {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := t.Calls[names[i]], t.Calls[names[j]]
+		if a.Time != b.Time {
+			return a.Time > b.Time
+		}
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+		return names[i] < names[j]
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "function\tcalls\ttime")
+	for _, name := range names {
+		stats := t.Calls[name]
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", name, stats.Calls, stats.Time)
+	}
+	return tw.Flush()
+}
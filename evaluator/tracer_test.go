@@ -0,0 +1,143 @@
+package evaluator
+
+import (
+	"bytes"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func evalWithTracer(input string, tracer Tracer) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return New(WithTracer(tracer)).Eval(program, object.NewEnvironment())
+}
+
+func TestCountingTracerCalls(t *testing.T) {
+	input := `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } };
+let twice = fn(f, x) { f(f(x)) };
+fib(10);
+countdown(5);
+twice(fn(s) { s + "!" }, "a");
+len("abc");
+map([1, 2, 3], fn(x) { x * 2 });
+`
+	tracer := NewCountingTracer()
+	evalWithTracer(input, tracer)
+
+	expected := map[string]int{
+		"fib":         177,
+		"countdown":   6,
+		"twice":       1,
+		"<anonymous>": 5,
+		"len":         1,
+		"map":         1,
+	}
+	got := map[string]int{}
+	for name, stats := range tracer.Calls {
+		got[name] = stats.Calls
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong call counts. want=%v, got=%v", expected, got)
+	}
+	if len(tracer.starts) != 0 {
+		t.Errorf("unbalanced EnterCall/ExitCall. %d calls still open", len(tracer.starts))
+	}
+	for name, active := range tracer.active {
+		if active != 0 {
+			t.Errorf("%s still active: %d", name, active)
+		}
+	}
+}
+
+func TestCountingTracerNodes(t *testing.T) {
+	tracer := NewCountingTracer()
+	evalWithTracer(`let x = 1 + 2; -x`, tracer)
+
+	expected := map[string]int{
+		"Program":             1,
+		"LetStatement":        1,
+		"InfixExpression":     1,
+		"IntegerLiteral":      2,
+		"ExpressionStatement": 1,
+		"PrefixExpression":    1,
+		"Identifier":          1,
+	}
+	if !reflect.DeepEqual(tracer.Nodes, expected) {
+		t.Errorf("wrong node counts. want=%v, got=%v", expected, tracer.Nodes)
+	}
+}
+
+func TestCountingTracerReport(t *testing.T) {
+	tracer := NewCountingTracer()
+	evalWithTracer(`let f = fn() { 1 }; let g = fn() { f() + f() }; g(); f()`, tracer)
+
+	var out bytes.Buffer
+	if err := tracer.Report(&out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("wrong number of lines. got=%q", out.String())
+	}
+	if fields := strings.Fields(lines[0]); !reflect.DeepEqual(fields, []string{"function", "calls", "time"}) {
+		t.Errorf("wrong header. got=%q", lines[0])
+	}
+	rows := map[string]string{}
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		rows[fields[0]] = fields[1]
+	}
+	if rows["f"] != "3" || rows["g"] != "1" {
+		t.Errorf("wrong rows. got=%v", rows)
+	}
+}
+
+// 記録した通知
+type recordingTracer struct {
+	events []string
+}
+
+func (r *recordingTracer) EnterNode(node ast.Node) {}
+func (r *recordingTracer) ExitNode(node ast.Node, result object.Object) {
+	if _, ok := result.(*tailCall); ok {
+		r.events = append(r.events, "leaked tail call")
+	}
+}
+func (r *recordingTracer) EnterCall(fnName string) { r.events = append(r.events, "enter "+fnName) }
+func (r *recordingTracer) ExitCall(fnName string)  { r.events = append(r.events, "exit "+fnName) }
+
+func TestTracerTailCallOrder(t *testing.T) {
+	tracer := &recordingTracer{}
+	evalWithTracer(`let a = fn() { b() }; let b = fn() { len("") }; a()`, tracer)
+
+	// 末尾呼び出しでは呼び出し元から抜けた後で呼び出し先に入る
+	expected := []string{"enter a", "exit a", "enter b", "enter len", "exit len", "exit b"}
+	if !reflect.DeepEqual(tracer.events, expected) {
+		t.Errorf("wrong events. want=%v, got=%v", expected, tracer.events)
+	}
+}
+
+const tracerBenchmarkProgram = `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(15)
+`
+
+func BenchmarkTracer(b *testing.B) {
+	program := parser.New(lexer.New(tracerBenchmarkProgram)).ParseProgram()
+	b.Run("none", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			New().Eval(program, object.NewEnvironment())
+		}
+	})
+	b.Run("counting", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			New(WithTracer(NewCountingTracer())).Eval(program, object.NewEnvironment())
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fmtOptions は monkey fmt のフラグ
+type fmtOptions struct {
+	// 整形した結果でファイルを書き換える
+	write bool
+	// 整形前との差分を表示する
+	diff bool
+	// 整形で変わるファイルの名前を表示する
+	list bool
+}
+
+// runFmt は monkey fmt を実行し、終了コードを返す
+// 引数がなければ in を整形して out に書く。ディレクトリか "dir/..." を指定すると、その下の .mky ファイルをすべて整形する
+func runFmt(args []string, in io.Reader, out, errOut io.Writer) int {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	var opts fmtOptions
+	fs.BoolVar(&opts.write, "w", false, "write the result to the file instead of stdout")
+	fs.BoolVar(&opts.diff, "d", false, "show a diff instead of the formatted source")
+	fs.BoolVar(&opts.list, "l", false, "list files whose formatting differs")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() == 0 {
+		if opts.write {
+			fmt.Fprintln(errOut, "cannot use -w with standard input")
+			return 2
+		}
+		src, err := ioutil.ReadAll(in)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+		return formatSource("<stdin>", string(src), out, errOut, opts)
+	}
+
+	status := 0
+	for _, arg := range fs.Args() {
+		paths, err := expandFmtArg(arg)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			status = 1
+			continue
+		}
+		for _, path := range paths {
+			if formatFile(path, out, errOut, opts) != 0 {
+				status = 1
+			}
+		}
+	}
+	return status
+}
+
+// "dir/..." とディレクトリはその下の .mky ファイルに、それ以外はそのまま展開する
+func expandFmtArg(arg string) ([]string, error) {
+	root := arg
+	if strings.HasSuffix(arg, "/...") {
+		root = strings.TrimSuffix(arg, "/...")
+	} else if info, err := os.Stat(arg); err != nil || !info.IsDir() {
+		return []string{arg}, nil
+	}
+
+	var paths []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(path) == ".mky" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+func formatFile(path string, out, errOut io.Writer, opts fmtOptions) int {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	return formatSource(path, string(src), out, errOut, opts)
+}
+
+// formatSource は src を整形し、opts に従って結果を書く
+// 構文エラーがある場合は整形せずに1を返す
+func formatSource(name, src string, out, errOut io.Writer, opts fmtOptions) int {
+	formatted, errors := formatProgram(src)
+	if len(errors) > 0 {
+		for _, err := range errors {
+			fmt.Fprintf(errOut, "%s:%d:%d: %s\n", name, err.Line, err.Column, err.Message)
+		}
+		return 1
+	}
+
+	changed := formatted != src
+	if opts.list && changed {
+		fmt.Fprintln(out, name)
+	}
+	if opts.diff && changed {
+		io.WriteString(out, unifiedDiff(name+".orig", name, src, formatted))
+	}
+	if opts.write && changed {
+		info, err := os.Stat(name)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+		if err := ioutil.WriteFile(name, []byte(formatted), info.Mode().Perm()); err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+	}
+	if !opts.list && !opts.diff && !opts.write {
+		io.WriteString(out, formatted)
+	}
+	return 0
+}
+
+// formatProgram は src を構文解析して正規の形にする
+func formatProgram(src string) (string, []parser.Error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return "", p.ErrorDetails()
+	}
+	return ast.Format(program), nil
+}
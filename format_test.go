@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parseFixture(t *testing.T, name, src string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("%s: parse errors: %v", name, p.Errors())
+	}
+	return program
+}
+
+func TestFormatFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "fmt", "*.mky"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+
+	for _, path := range paths {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		original := parseFixture(t, path, string(src))
+
+		once, errs := formatProgram(string(src))
+		if len(errs) > 0 {
+			t.Fatalf("%s: format failed: %v", path, errs)
+		}
+		// 整形しても意味は変わらない
+		if !ast.Equal(original, parseFixture(t, path, once)) {
+			t.Errorf("%s: formatting changed the AST:\n%s", path, once)
+		}
+		// 整形した結果をもう一度整形しても変わらない
+		twice, _ := formatProgram(once)
+		if twice != once {
+			t.Errorf("%s: format is not idempotent.\nfirst:\n%s\nsecond:\n%s", path, once, twice)
+		}
+	}
+}
+
+// testdata/fmt をコピーした一時ディレクトリを返す
+func copyFmtFixtures(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "monkeyfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"basic.mky", "formatted.mky", "nested.mky"} {
+		src, err := ioutil.ReadFile(filepath.Join("testdata", "fmt", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := dir
+		if name == "nested.mky" {
+			target = sub
+		}
+		if err := ioutil.WriteFile(filepath.Join(target, name), src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunFmtList(t *testing.T) {
+	dir := copyFmtFixtures(t)
+
+	for _, arg := range []string{dir, dir + "/..."} {
+		var out, errOut bytes.Buffer
+		if status := runFmt([]string{"-l", arg}, nil, &out, &errOut); status != 0 {
+			t.Fatalf("wrong status %d. stderr=%q", status, errOut.String())
+		}
+		expected := filepath.Join(dir, "basic.mky") + "\n" + filepath.Join(dir, "sub", "nested.mky") + "\n"
+		if out.String() != expected {
+			t.Errorf("wrong list. want=%q, got=%q", expected, out.String())
+		}
+	}
+}
+
+func TestRunFmtWrite(t *testing.T) {
+	dir := copyFmtFixtures(t)
+	path := filepath.Join(dir, "basic.mky")
+
+	var out, errOut bytes.Buffer
+	if status := runFmt([]string{"-w", path}, nil, &out, &errOut); status != 0 {
+		t.Fatalf("wrong status %d. stderr=%q", status, errOut.String())
+	}
+	if out.Len() > 0 {
+		t.Errorf("-w should not write to stdout. got=%q", out.String())
+	}
+
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `let x = 1 + 2 * 3;
+let y = (x + 1) * 2;
+let add = fn(a, b) { a + b };
+puts(add(x, y));
+if (x > y) { puts("x") } else { puts("y") }
+`
+	if string(written) != expected {
+		t.Errorf("wrong file content. want=%q, got=%q", expected, string(written))
+	}
+
+	out.Reset()
+	runFmt([]string{"-l", path}, nil, &out, &errOut)
+	if out.Len() > 0 {
+		t.Errorf("formatted file should not be listed. got=%q", out.String())
+	}
+}
+
+func TestRunFmtDiff(t *testing.T) {
+	var out, errOut bytes.Buffer
+	in := strings.NewReader("let a = 1;\nlet b = 2;\nlet c = 3;\nlet d = 4;\nlet e=(5);\nlet f = 6;\n")
+	if status := runFmt([]string{"-d"}, in, &out, &errOut); status != 0 {
+		t.Fatalf("wrong status %d. stderr=%q", status, errOut.String())
+	}
+
+	expected := `--- <stdin>.orig
++++ <stdin>
+@@ -2,5 +2,5 @@
+ let b = 2;
+ let c = 3;
+ let d = 4;
+-let e=(5);
++let e = 5;
+ let f = 6;
+`
+	if out.String() != expected {
+		t.Errorf("wrong diff. want=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestRunFmtStdin(t *testing.T) {
+	var out, errOut bytes.Buffer
+	status := runFmt(nil, strings.NewReader("let  x=fn(a){a+1}"), &out, &errOut)
+	if status != 0 {
+		t.Fatalf("wrong status %d. stderr=%q", status, errOut.String())
+	}
+	if out.String() != "let x = fn(a) { a + 1 };\n" {
+		t.Errorf("wrong output %q", out.String())
+	}
+}
+
+func TestRunFmtParseError(t *testing.T) {
+	var out, errOut bytes.Buffer
+	status := runFmt(nil, strings.NewReader("let x = 1;\nlet = 2;\n"), &out, &errOut)
+	if status != 1 {
+		t.Errorf("wrong status. want=1, got=%d", status)
+	}
+	if out.Len() > 0 {
+		t.Errorf("nothing should be formatted. got=%q", out.String())
+	}
+	expected := "<stdin>:2:5: expected next token to be IDENT, got = instead\n"
+	if !strings.HasPrefix(errOut.String(), expected) {
+		t.Errorf("wrong error. want=%q, got=%q", expected, errOut.String())
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\n", "a\nb\n", "--- x\n+++ y\n@@ -1 +1,2 @@\n a\n+b\n"},
+		{"a\nb\n", "b\n", "--- x\n+++ y\n@@ -1,2 +1 @@\n-a\n b\n"},
+		{"", "a\n", "--- x\n+++ y\n@@ -0,0 +1 @@\n+a\n"},
+		// 離れた変更は別のハンクにする
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "x\n2\n3\n4\n5\n6\n7\n8\n9\ny\n",
+			"--- x\n+++ y\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+y\n"},
+	}
+
+	for _, tt := range tests {
+		if got := unifiedDiff("x", "y", tt.a, tt.b); got != tt.expected {
+			t.Errorf("wrong diff for %q -> %q. want=%q, got=%q", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package interp
+
+import (
+	"io"
+	"monkey/compiler"
+	"monkey/object"
+	"monkey/vm"
+)
+
+// Compile はソースコードをバイトコードにコンパイルする
+// 結果は Encode で保存しておき、LoadBytecode で読み込めば構文解析せずに実行できる
+// 構文エラーの場合は *ParseError を、コンパイルできない構文の場合は *compiler.Error を返す
+func Compile(src string) (*compiler.Bytecode, error) {
+	p := getParser(src)
+	program := p.ParseProgram()
+	messages := p.Errors()
+	putParser(p)
+	if len(messages) > 0 {
+		return nil, &ParseError{Messages: messages}
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	return comp.Bytecode(), nil
+}
+
+// LoadBytecode は Encode で保存したバイトコードを読み込む
+// 別の版の monkey で保存したものや途中で切れたものにはエラーを返す
+func LoadBytecode(r io.Reader) (*compiler.Bytecode, error) {
+	return compiler.Decode(r)
+}
+
+// RunBytecode はバイトコードを仮想マシンで実行し、最後の式の値を返す
+// 実行中のエラーの場合は *RuntimeError を返す
+func RunBytecode(bytecode *compiler.Bytecode) (object.Object, error) {
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		if vmErr, ok := err.(*vm.Error); ok {
+			return nil, &RuntimeError{Object: vmErr.Object}
+		}
+		return nil, &RuntimeError{Object: &object.Error{Message: err.Error()}}
+	}
+	result := machine.LastPoppedStackElem()
+	if result == nil {
+		result = object.NULL
+	}
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package interp
+
+import (
+	"bytes"
+	"monkey/compiler"
+	"testing"
+)
+
+// コンパイルして保存したものを読み込んで実行しても、直接評価した結果と同じになる
+func TestBytecodeRoundTrip(t *testing.T) {
+	programs := []string{
+		`1 + 2 * 3`,
+		`9223372036854775807 + 1`,
+		`if (1 > 2) { 10 } else { 20 }`,
+		`if (false) { 10 }`,
+		`let x = 5; let y = x * 2; x + y`,
+		`"hello" + ", " + "world"`,
+		`let greet = fn(name) { "hello " + name }; greet("monkey")`,
+		`let newAdder = fn(a) { fn(b) { a + b } }; newAdder(2)(3)`,
+		`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)`,
+		`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } }; let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } }; isOdd(7)`,
+		`let f = fn() { return 1; 2 }; f()`,
+		`let x = 1;`,
+	}
+
+	for _, src := range programs {
+		expected, err := New().Run(src)
+		if err != nil {
+			t.Fatalf("%s: eval error: %s", src, err)
+		}
+
+		bytecode, err := Compile(src)
+		if err != nil {
+			t.Fatalf("%s: compile error: %s", src, err)
+		}
+		var buf bytes.Buffer
+		if err := bytecode.Encode(&buf); err != nil {
+			t.Fatalf("%s: encode error: %s", src, err)
+		}
+		loaded, err := LoadBytecode(&buf)
+		if err != nil {
+			t.Fatalf("%s: load error: %s", src, err)
+		}
+		result, err := RunBytecode(loaded)
+		if err != nil {
+			t.Fatalf("%s: run error: %s", src, err)
+		}
+
+		if result.Type() != expected.Type() || result.Inspect() != expected.Inspect() {
+			t.Errorf("%s: results differ. eval=%s, bytecode=%s", src, expected.Inspect(), result.Inspect())
+		}
+	}
+}
+
+func TestBytecodeErrors(t *testing.T) {
+	if _, err := Compile(`let = 1;`); err == nil {
+		t.Errorf("expected parse error")
+	} else if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected *ParseError. got=%T (%v)", err, err)
+	}
+
+	_, err := Compile(`missing + 1`)
+	if compileErr, ok := err.(*compiler.Error); !ok || compileErr.Message != "undefined variable missing" {
+		t.Errorf("expected compile error. got=%T (%v)", err, err)
+	}
+
+	bytecode, err := Compile(`let f = fn(a) { a }; f(1, 2)`)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	_, err = RunBytecode(bytecode)
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok || runtimeErr.Error() != "wrong number of arguments: want=1, got=2" {
+		t.Errorf("expected runtime error. got=%T (%v)", err, err)
+	}
+
+	if _, err := LoadBytecode(bytes.NewReader([]byte("1 + 2"))); err == nil || err.Error() != "not a monkey bytecode file" {
+		t.Errorf("wrong load error. got=%v", err)
+	}
+}
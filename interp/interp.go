@@ -0,0 +1,256 @@
+/*
+Package interp はGoのプログラムにMonkeyを組み込むためのパッケージ
+字句解析・構文解析・評価をまとめて行い、結果やエラーをGoの値として返す
+*/
+package interp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Interp は1つの環境を持つインタプリタ
+// Run で定義した変数は次の Run でも使える
+// Evaluator と同じく、複数のgoroutineから同時に使ってはならない
+type Interp struct {
+	ev       *evaluator.Evaluator
+	env      *object.Environment
+	filename string
+
+	evalOpts []evaluator.Option
+	builtins map[string]object.BuiltinFunction
+	docs     map[string]evaluator.BuiltinDoc
+	err      error
+}
+
+// Option は New に渡すインタプリタの設定
+type Option func(*Interp)
+
+// WithBuiltin は組み込み関数を追加する。標準の組み込み関数と同名の場合は置き換える
+func WithBuiltin(name string, fn object.BuiltinFunction) Option {
+	return func(in *Interp) {
+		in.builtins[name] = fn
+		delete(in.docs, name)
+	}
+}
+
+// WithDocumentedBuiltin は WithBuiltin と同じく組み込み関数を追加し、help で表示する説明も設定する
+func WithDocumentedBuiltin(name string, fn object.BuiltinFunction, doc evaluator.BuiltinDoc) Option {
+	return func(in *Interp) {
+		in.builtins[name] = fn
+		in.docs[name] = doc
+	}
+}
+
+// WithOutput は puts の出力先を設定する。既定は標準出力
+func WithOutput(w io.Writer) Option {
+	return func(in *Interp) {
+		in.evalOpts = append(in.evalOpts, evaluator.WithOutput(w))
+	}
+}
+
+// WithMaxSteps は1回の Run で評価できるノード数の上限を設定する
+func WithMaxSteps(n int) Option {
+	return func(in *Interp) {
+		in.evalOpts = append(in.evalOpts, evaluator.WithMaxSteps(n))
+	}
+}
+
+// WithMaxDepth は関数呼び出しの入れ子の上限を設定する
+func WithMaxDepth(n int) Option {
+	return func(in *Interp) {
+		in.evalOpts = append(in.evalOpts, evaluator.WithMaxDepth(n))
+	}
+}
+
+// WithFilename はエラーメッセージに表示するファイル名を設定する
+func WithFilename(name string) Option {
+	return func(in *Interp) {
+		in.filename = name
+	}
+}
+
+// New はインタプリタを生成する
+func New(opts ...Option) *Interp {
+	in := &Interp{
+		env:      object.NewEnvironment(),
+		builtins: map[string]object.BuiltinFunction{},
+		docs:     map[string]evaluator.BuiltinDoc{},
+	}
+	for _, opt := range opts {
+		opt(in)
+	}
+
+	in.ev = evaluator.New(append(in.evalOpts, evaluator.AllowBuiltinOverride())...)
+	// 実行のたびに同じエラーを報告するよう、名前の順に登録する
+	names := make([]string, 0, len(in.builtins))
+	for name := range in.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fn := in.builtins[name]
+		var err error
+		if doc, ok := in.docs[name]; ok {
+			err = in.ev.RegisterDocumentedBuiltin(name, fn, doc)
+		} else {
+			err = in.ev.RegisterBuiltin(name, fn)
+		}
+		if err != nil && in.err == nil {
+			// 登録できない名前（quote）は最初の Run で報告する
+			in.err = err
+		}
+	}
+	return in
+}
+
+// ParseError はソースコードの構文エラー
+type ParseError struct {
+	Filename string
+	Messages []string
+}
+
+// Error はファイル名と構文エラーのメッセージを返す
+//
+//	script.mk: parse error: expected next token to be IDENT, got = instead
+func (e *ParseError) Error() string {
+	msg := "parse error: " + strings.Join(e.Messages, "; ")
+	if e.Filename == "" {
+		return msg
+	}
+	return e.Filename + ": " + msg
+}
+
+// RuntimeError は評価中に発生したエラー
+type RuntimeError struct {
+	Filename string
+	// 評価器が返したエラー（位置と呼び出し履歴を含む）
+	Object *object.Error
+}
+
+// Error はファイル名と位置を付けたエラーメッセージを返す
+//
+//	script.mk:2:3: type mismatch: INTEGER + BOOLEAN
+func (e *RuntimeError) Error() string {
+	var pos []string
+	if e.Filename != "" {
+		pos = append(pos, e.Filename)
+	}
+	if e.Object.Line != 0 {
+		pos = append(pos, fmt.Sprintf("%d:%d", e.Object.Line, e.Object.Column))
+	}
+	if len(pos) == 0 {
+		return e.Object.Message
+	}
+	return strings.Join(pos, ":") + ": " + e.Object.Message
+}
+
+// Run はソースコードを評価し、最後の式の値を返す
+// 構文エラーの場合は *ParseError を、評価中のエラーの場合は *RuntimeError を返す
+func (in *Interp) Run(src string) (object.Object, error) {
+	return in.RunContext(context.Background(), src)
+}
+
+// RunContext は ctx がキャンセルされるまでソースコードを評価する
+func (in *Interp) RunContext(ctx context.Context, src string) (object.Object, error) {
+	if in.err != nil {
+		return nil, in.err
+	}
+
+	p := getParser(src)
+	program := p.ParseProgram()
+	messages := p.Errors()
+	putParser(p)
+	if len(messages) > 0 {
+		return nil, &ParseError{Filename: in.filename, Messages: messages}
+	}
+
+	result := in.ev.EvalContext(ctx, program, in.env)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Filename: in.filename, Object: errObj}
+	}
+	if result == nil {
+		// let 文だけのプログラムなど
+		result = object.NULL
+	}
+	return result, nil
+}
+
+// 小さなスクリプトを何度も評価するときに構文解析器を作り直さないよう、Reset して使い回す
+// 構文解析器は同時に使えないので、取り出してから戻すまでは1つのgoroutineだけが使う
+var parsers = sync.Pool{
+	New: func() interface{} { return parser.New(lexer.New("")) },
+}
+
+func getParser(src string) *parser.Parser {
+	p := parsers.Get().(*parser.Parser)
+	p.Reset(src)
+	return p
+}
+
+func putParser(p *parser.Parser) {
+	parsers.Put(p)
+}
+
+// Eval は1つの式を評価して値を返す。表計算のセルのように、式だけを受け付けたい場合に使う
+// let などの文や、式の後に入力が残っている場合は *ParseError を返す
+func (in *Interp) Eval(expr string) (object.Object, error) {
+	return in.EvalContext(context.Background(), expr)
+}
+
+// EvalContext は ctx がキャンセルされるまで1つの式を評価する
+func (in *Interp) EvalContext(ctx context.Context, expr string) (object.Object, error) {
+	if in.err != nil {
+		return nil, in.err
+	}
+
+	p := getParser(expr)
+	node, errs := p.ParseExpressionOnly()
+	putParser(p)
+	if len(errs) > 0 {
+		messages := make([]string, len(errs))
+		for i, err := range errs {
+			messages[i] = err.Error()
+		}
+		return nil, &ParseError{Filename: in.filename, Messages: messages}
+	}
+
+	result := in.ev.EvalContext(ctx, node, in.env)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Filename: in.filename, Object: errObj}
+	}
+	return result, nil
+}
+
+// Set は v をMonkeyの値に変換して変数 name に束縛する
+// 変換できない値の場合はエラーを返す（object.FromGo を参照）
+func (in *Interp) Set(name string, v interface{}) error {
+	return in.env.SetValue(name, v)
+}
+
+// Get は変数 name の値をGoの値に変換して返す（object.ToGo を参照）
+// 関数などGoの値に変換できない場合は object.Object のまま返す
+func (in *Interp) Get(name string) (interface{}, bool) {
+	obj, ok := in.env.Get(name)
+	if !ok {
+		return nil, false
+	}
+	v, err := object.ToGo(obj)
+	if err != nil {
+		return obj, true
+	}
+	return v, true
+}
+
+// Environment はインタプリタの環境を返す
+func (in *Interp) Environment() *object.Environment {
+	return in.env
+}
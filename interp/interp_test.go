@@ -0,0 +1,206 @@
+package interp
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/evaluator"
+	"monkey/object"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	in := New(WithOutput(&out))
+
+	if err := in.Set("config", map[string]interface{}{"name": "monkey", "retries": 3}); err != nil {
+		t.Fatalf("Set failed: %s", err)
+	}
+
+	result, err := in.Run(`
+let greeting = "hello " + config["name"];
+puts(greeting);
+let doubled = config["retries"] * 2;
+[doubled, greeting]
+`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if result.Inspect() != `[6, "hello monkey"]` {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+	if out.String() != "hello monkey\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	doubled, ok := in.Get("doubled")
+	if !ok || doubled != int64(6) {
+		t.Errorf("wrong doubled. got=%#v", doubled)
+	}
+	if _, ok := in.Get("missing"); ok {
+		t.Errorf("missing variable should not be found")
+	}
+
+	// 前回の Run で定義した変数を使える
+	result, err = in.Run(`doubled + 1`)
+	if err != nil || result.Inspect() != "7" {
+		t.Errorf("variables should persist between runs. got=%v, %v", result, err)
+	}
+
+	// 関数はGoの値に変換せずに返す
+	in.Run(`let f = fn(x) { x }`)
+	if f, ok := in.Get("f"); !ok || reflect.TypeOf(f) != reflect.TypeOf(&object.Function{}) {
+		t.Errorf("functions should be returned as objects. got=%#v", f)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	in := New(WithFilename("script.mk"))
+
+	_, err := in.Run(`let = 1;`)
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected *ParseError. got=%T (%v)", err, err)
+	}
+	if len(parseErr.Messages) == 0 || parseErr.Error() != "script.mk: parse error: "+strings.Join(parseErr.Messages, "; ") {
+		t.Errorf("wrong parse error. got=%q", parseErr.Error())
+	}
+
+	_, err = in.Run("let x = 1;\nx + true")
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected *RuntimeError. got=%T (%v)", err, err)
+	}
+	if runtimeErr.Error() != "script.mk:2:3: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong runtime error. got=%q", runtimeErr.Error())
+	}
+	if runtimeErr.Object.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error object. got=%q", runtimeErr.Object.Message)
+	}
+	if runtimeErr.Object.Kind != object.TypeError {
+		t.Errorf("wrong error kind. got=%q", runtimeErr.Object.Kind)
+	}
+
+	_, err = New().Run(`1 + true`)
+	if err == nil || err.Error() != "1:3: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong runtime error without filename. got=%v", err)
+	}
+
+	if err := in.Set("f", func() {}); err == nil {
+		t.Errorf("Set should fail for Go functions")
+	}
+}
+
+func TestEval(t *testing.T) {
+	in := New(WithFilename("cell"))
+	if _, err := in.Run(`let price = 120; let tax = fn(x) { x / 10 };`); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	result, err := in.Eval(`price + tax(price)`)
+	if err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+	if result.Inspect() != "132" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let total = price", "cell: parse error: 1:1: expected an expression, got let statement"},
+		{"price; tax(price)", `cell: parse error: 1:8: unexpected trailing input "tax"`},
+		{"price + true", "cell:1:7: type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, tt := range tests {
+		_, err := in.Eval(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+	// 失敗した Eval は束縛を残さない
+	if _, ok := in.Get("total"); ok {
+		t.Errorf("total should not be defined")
+	}
+}
+
+// 構文解析器はインタプリタの間で使い回すので、別々のgoroutineで使っても結果が混ざらない
+func TestConcurrentRun(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			in := New()
+			for j := 0; j < 50; j++ {
+				src := fmt.Sprintf("let x = %d; x * %d", i, j)
+				result, err := in.Run(src)
+				if err != nil || result.Inspect() != fmt.Sprint(i*j) {
+					t.Errorf("%q: wrong result. got=%v, %v", src, result, err)
+					return
+				}
+				if _, err := in.Eval("let = 1"); err == nil {
+					t.Errorf("Eval should fail for a let statement")
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkRunSmallScripts(b *testing.B) {
+	in := New()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := in.Run(`let total = fn(xs) { reduce(xs, 0, fn(acc, x) { acc + x }) }; total([1, 2, 3])`); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	in := New(
+		WithBuiltin("double", func(args ...object.Object) object.Object {
+			return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+		}),
+		WithMaxSteps(1000),
+		WithMaxDepth(10),
+	)
+
+	result, err := in.Run(`double(21)`)
+	if err != nil || result.Inspect() != "42" {
+		t.Errorf("custom builtin not available. got=%v, %v", result, err)
+	}
+
+	_, err = in.Run(`let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100)`)
+	if err == nil || err.(*RuntimeError).Object.Message != "maximum recursion depth exceeded" {
+		t.Errorf("max depth not applied. got=%v", err)
+	}
+
+	_, err = in.Run(`let loop = fn() { loop() }; loop()`)
+	if err == nil || err.(*RuntimeError).Object.Message != "evaluation budget exceeded after 1000 steps" {
+		t.Errorf("max steps not applied. got=%v", err)
+	}
+
+	in = New(WithDocumentedBuiltin("double", func(args ...object.Object) object.Object {
+		return args[0]
+	}, evaluator.BuiltinDoc{Signature: "double(n)", Summary: "Returns n times two.", Category: "numbers"}))
+	result, err = in.Run(`help("double")`)
+	if err != nil || result.Inspect() != "double(n)\n  Returns n times two." {
+		t.Errorf("documented builtin should have help. got=%v, %v", result, err)
+	}
+
+	_, err = New(WithBuiltin("quote", nil)).Run(`1`)
+	if err == nil {
+		t.Errorf("registering a reserved name should be reported")
+	}
+	identity := func(args ...object.Object) object.Object { return args[0] }
+	_, err = New(WithBuiltin("zz", identity), WithBuiltin("quote", nil), WithBuiltin("aa", identity)).Run(`1`)
+	if err == nil || err.Error() != `"quote" is reserved` {
+		t.Errorf("wrong error for a reserved name among others. got=%v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package lexer
+
+import (
+	. "monkey/token"
+)
+
+// 開き括弧に対応する閉じ括弧
+var closers = map[TokenType]TokenType{
+	LPAREN:   RPAREN,
+	LBRACE:   RBRACE,
+	LBRACKET: RBRACKET,
+}
+
+// Incomplete は input が括弧や文字列リテラルを閉じないまま終わっている場合にtrueを返す
+// REPLで続きの行を読むかどうかの判定に使う
+// { はブロック文でもハッシュリテラルでも閉じるまで続きを読むので、構文解析器がどちらと読むかによらない
+// 対応しない閉じ括弧があるなど、続きを読んでも正しくならない入力にはfalseを返す
+func Incomplete(input string) bool {
+	l := New(input)
+	var open []TokenType
+	for tok := l.NextToken(); tok.Type != EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case LPAREN, LBRACE, LBRACKET:
+			open = append(open, closers[tok.Type])
+		case RPAREN, RBRACE, RBRACKET:
+			if len(open) == 0 || open[len(open)-1] != tok.Type {
+				return false
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	return l.unterminated || len(open) > 0
+}
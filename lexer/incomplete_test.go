@@ -0,0 +1,34 @@
+package lexer
+
+import "testing"
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`let x = 1;`, false},
+		{``, false},
+		{`let f = fn(x) {`, true},
+		{"let f = fn(x) {\n  x + 1\n", true},
+		{"let f = fn(x) {\n  x + 1\n};", false},
+		{`[1, 2,`, true},
+		{`f(1, {"a": [`, true},
+		{`"abc`, true},
+		{"\"abc\ndef\"", false},
+		{"{\n  \"a\": 1,", true},
+		{"{\n  let x = 1;\n  x", true},
+		{"{\n  let x = 1;\n  x\n}", false},
+		{`{}`, false},
+		{`"{"`, false},
+		{`)`, false},
+		{`fn(x) { x ]`, false},
+		{`(1 + 2))`, false},
+	}
+
+	for _, tt := range tests {
+		if got := Incomplete(tt.input); got != tt.expected {
+			t.Errorf("Incomplete(%q) = %t, want %t", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	. "monkey/token"
+	"strings"
 )
 
 type Lexer struct {
@@ -9,15 +10,66 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+	// chの位置（1始まり）
+	line   int
+	column int
+	// trueならトークンに位置を記録しない
+	unpositioned bool
+	// 閉じていない文字列リテラルを読んだ場合はtrue
+	unterminated bool
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
+	l.skipShebang()
 	return l
 }
 
+// Reset は字句解析器を input の先頭から読み直すように戻す。New で生成し直したのと同じトークンを返す
+// NewUnpositioned で生成したものは位置を記録しないままになる
+// 字句解析器は複数のgoroutineから同時に使ってはならない
+func (l *Lexer) Reset(input string) {
+	*l = Lexer{input: input, line: 1, unpositioned: l.unpositioned}
+	l.readChar()
+	l.skipShebang()
+}
+
+// 入力の先頭が "#!" で始まる場合は、その行を改行の手前まで読み飛ばす
+// 改行は空白として読むので、次の行は2行目のままになる
+func (l *Lexer) skipShebang() {
+	if l.ch != '#' || l.peekChar() != '!' {
+		return
+	}
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+// NewUnpositioned はトークンに位置（行・列）を記録しない字句解析器を生成する
+// evalに渡された文字列のように、位置が元のプログラムと対応しない入力に使う
+func NewUnpositioned(input string) *Lexer {
+	l := New(input)
+	l.unpositioned = true
+	return l
+}
+
+// Tokenize は input を最後まで字句解析し、EOF を除くトークンを順に返す
+func Tokenize(input string) []Token {
+	l := New(input)
+	var tokens []Token
+	for tok := l.NextToken(); tok.Type != EOF; tok = l.NextToken() {
+		tokens = append(tokens, tok)
+	}
+	return tokens
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -27,120 +79,177 @@ func (l *Lexer) readChar() {
 	l.readPosition += 1
 }
 
+// skipTo は同じ行の end の位置まで一度に進める。途中に改行があってはならない
+// 1文字ずつ readChar を呼ぶのと同じ位置になる
+func (l *Lexer) skipTo(end int) {
+	l.column += end - l.position
+	if end < len(l.input) {
+		l.ch = l.input[end]
+	} else {
+		l.ch = 0
+	}
+	l.position = end
+	l.readPosition = end + 1
+}
+
+// 1文字のトークンの種類（1文字のトークンでなければ空）
+var singleCharTokens = [256]TokenType{
+	';': SEMICOLON,
+	':': COLON,
+	'(': LPAREN,
+	')': RPAREN,
+	',': COMMA,
+	'+': PLUS,
+	'-': MINUS,
+	'*': ASTARISK,
+	'/': SLASH,
+	'{': LBRACE,
+	'}': RBRACE,
+	'<': LT,
+	'>': GT,
+	'[': LBRACKET,
+	']': RBRACKET,
+}
+
 func (l *Lexer) NextToken() Token {
 	l.skipWhiteSpace()
-	var tok Token
+	line, column := l.line, l.column
+	tokenType, literal := l.nextToken()
+	if l.unpositioned {
+		return Token{Type: tokenType, Literal: literal}
+	}
+	return Token{Type: tokenType, Literal: literal, Line: line, Column: column}
+}
+
+// nextToken は今の文字から始まるトークンの種類とリテラルを返す
+// リテラルは入力の一部を切り出したもので、トークンごとに割り当てない
+func (l *Lexer) nextToken() (TokenType, string) {
+	if tokenType := singleCharTokens[l.ch]; tokenType != "" {
+		literal := l.input[l.position : l.position+1]
+		l.readChar()
+		return tokenType, literal
+	}
+
+	var tokenType TokenType
+	var literal string
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
 			l.readChar()
-			tok = newTokenStr(EQ, "==")
+			tokenType, literal = EQ, "=="
 		} else {
-			tok = newToken(ASSIGN, l.ch)
+			tokenType, literal = ASSIGN, "="
 		}
 	case '!':
 		if l.peekChar() == '=' {
 			l.readChar()
-			tok = newTokenStr(NOT_EQ, "!=")
+			tokenType, literal = NOT_EQ, "!="
 		} else {
-			tok = newToken(BANG, l.ch)
+			tokenType, literal = BANG, "!"
+		}
+	case '?':
+		if l.peekChar() == '[' {
+			l.readChar()
+			tokenType, literal = OPTIONAL_LBRACKET, "?["
+		} else {
+			tokenType, literal = ILLEGAL, "?"
+		}
+	case '.':
+		if strings.HasPrefix(l.input[l.position:], "...") {
+			l.readChar()
+			l.readChar()
+			tokenType, literal = ELLIPSIS, "..."
+		} else if l.peekChar() == '.' {
+			l.readChar()
+			tokenType, literal = DOTDOT, ".."
+		} else {
+			tokenType, literal = ILLEGAL, "."
 		}
-	case ';':
-		tok = newToken(SEMICOLON, l.ch)
-	case ':':
-		tok = newToken(COLON, l.ch)
-	case '(':
-		tok = newToken(LPAREN, l.ch)
-	case ')':
-		tok = newToken(RPAREN, l.ch)
-	case ',':
-		tok = newToken(COMMA, l.ch)
-	case '+':
-		tok = newToken(PLUS, l.ch)
-	case '-':
-		tok = newToken(MINUS, l.ch)
-	case '*':
-		tok = newToken(ASTARISK, l.ch)
-	case '/':
-		tok = newToken(SLASH, l.ch)
-	case '{':
-		tok = newToken(LBRACE, l.ch)
-	case '}':
-		tok = newToken(RBRACE, l.ch)
-	case '<':
-		tok = newToken(LT, l.ch)
-	case '>':
-		tok = newToken(GT, l.ch)
-	case '[':
-		tok = newToken(LBRACKET, l.ch)
-	case ']':
-		tok = newToken(RBRACKET, l.ch)
 	case 0:
-		tok = eof()
+		tokenType, literal = EOF, ""
 	case '"':
-		tok.Type = STRING
-		tok.Literal = l.readString()
+		tokenType, literal = STRING, l.readString()
 	default:
 		if isLetter(l.ch) {
-			tok.Literal = l.readIdentifier()
-			tok.Type = LookuptIdent(tok.Literal)
-			return tok
+			literal = l.readIdentifier()
+			return LookuptIdent(literal), literal
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = INT
-			return tok
-		} else {
-			tok = newToken(ILLEGAL, l.ch)
+			return INT, l.readNumber()
 		}
+		// ASCII 以外のバイトは1文字の文字列として表す
+		tokenType, literal = ILLEGAL, string(l.ch)
 	}
 
 	l.readChar() // これを忘れるとカーソルが次に進まない
-	return tok
-}
-
-func newToken(tokenType TokenType, ch byte) Token {
-	return Token{Type: tokenType, Literal: string(ch)}
-}
-
-func newTokenStr(tokenType TokenType, literal string) Token {
-	return Token{Type: tokenType, Literal: literal}
-}
-
-func eof() Token {
-	return Token{Type: EOF, Literal: ""}
+	return tokenType, literal
 }
 
 func (l *Lexer) skipWhiteSpace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
-		l.readChar()
+	end := l.position
+	for end < len(l.input) {
+		switch l.input[end] {
+		case ' ', '\t', '\r':
+			end++
+		case '\n':
+			end++
+			l.line++
+			// skipTo で進めたときに、改行の次の文字が1列目になるよう合わせる
+			l.column = l.position - end + 1
+		default:
+			l.skipTo(end)
+			return
+		}
 	}
+	l.skipTo(end)
 }
 
+// 識別子や数値は先に終わりを探し、入力を1回だけ切り出す
 func (l *Lexer) readIdentifier() string {
-	position := l.position
-	for isLetter(l.ch) {
-		l.readChar()
+	start, end := l.position, l.position
+	for end < len(l.input) && isLetter(l.input[end]) {
+		end++
 	}
-	return l.input[position:l.position]
+	l.skipTo(end)
+	return l.input[start:end]
 }
 
+// 0o（0O）で始まる8進数は、続く数字までを1つのリテラルにする。8や9が含まれていてもここでは区切らず、構文解析器がエラーにする
+// 0 で始まる2桁以上の10進数も1つのリテラルにする（構文解析器がエラーにする）
 func (l *Lexer) readNumber() string {
-	position := l.position
-	for isDigit(l.ch) {
-		l.readChar()
+	start, end := l.position, l.position
+	if l.ch == '0' && (l.peekChar() == 'o' || l.peekChar() == 'O') {
+		end += 2
+	}
+	for end < len(l.input) && isDigit(l.input[end]) {
+		end++
 	}
-	return l.input[position:l.position]
+	l.skipTo(end)
+	return l.input[start:end]
 }
 
+// 閉じる引用符の手前までを返し、閉じる引用符の位置まで進む
+// 閉じる前に入力が終わった（またはNUL文字があった）場合は、そこまでを返す
 func (l *Lexer) readString() string {
-	position := l.position + 1
-	for {
-		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
-		}
+	start := l.position + 1
+	end := len(l.input)
+	if i := strings.IndexByte(l.input[start:], '"'); i >= 0 {
+		end = start + i
+	}
+	if i := strings.IndexByte(l.input[start:end], 0); i >= 0 {
+		end = start + i
+	}
+	literal := l.input[start:end]
+	// 文字列の中の改行の分だけ行を進める
+	if n := strings.Count(literal, "\n"); n > 0 {
+		l.line += n
+		newline := start + strings.LastIndexByte(literal, '\n')
+		l.column = l.position - newline
 	}
-	return l.input[position:l.position]
+	l.skipTo(end)
+	if l.ch == 0 {
+		l.unterminated = true
+	}
+	return literal
 }
 
 func (l *Lexer) peekChar() byte {
@@ -155,6 +264,10 @@ func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
 
+func isWhiteSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
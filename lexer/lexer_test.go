@@ -1,7 +1,9 @@
 package lexer
 
 import (
+	"fmt"
 	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -139,3 +141,320 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "ab"
+
+	[1]`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.PLUS, 2, 5},
+		{token.STRING, 2, 7},
+		{token.LBRACKET, 4, 2},
+		{token.INT, 4, 3},
+		{token.RBRACKET, 4, 4},
+		{token.EOF, 4, 5},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestUnpositionedTokens(t *testing.T) {
+	l := NewUnpositioned("let x\n= 5;")
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Line != 0 || tok.Column != 0 {
+			t.Errorf("token %q has a position. got=%d:%d", tok.Literal, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	inputs := []string{"let x\n= 5;", "#!/usr/bin/env monkey\nputs(\"a\")", `"unterminated`, ""}
+
+	l := New("fn(x) { x }")
+	l.NextToken()
+	for _, input := range inputs {
+		l.Reset(input)
+		want := New(input)
+		for {
+			got, expected := l.NextToken(), want.NextToken()
+			if got != expected {
+				t.Errorf("%q: reset lexer gave a different token. want=%+v, got=%+v", input, expected, got)
+				break
+			}
+			if got.Type == token.EOF {
+				break
+			}
+		}
+	}
+
+	// NewUnpositioned で生成したものは位置を記録しないまま
+	l = NewUnpositioned("x")
+	l.Reset("let x\n= 5;")
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Line != 0 || tok.Column != 0 {
+			t.Errorf("token %q has a position after Reset. got=%d:%d", tok.Literal, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize(`let x = "a";`)
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.STRING, token.SEMICOLON}
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. want=%d, got=%d", len(expected), len(tokens))
+	}
+	for i, tt := range expected {
+		if tokens[i].Type != tt {
+			t.Errorf("tokens[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tokens[i].Type)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	l := New("#!/usr/bin/env monkey\nlet x = 1;\n  x")
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 2, 1},
+		{token.IDENT, 2, 5},
+		{token.ASSIGN, 2, 7},
+		{token.INT, 2, 9},
+		{token.SEMICOLON, 2, 10},
+		{token.IDENT, 3, 3},
+		{token.EOF, 3, 4},
+	}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+
+	// 先頭以外の "#!" は読み飛ばさない
+	for _, input := range []string{" #!x", "x\n#!y"} {
+		l := New(input)
+		var types []token.TokenType
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			types = append(types, tok.Type)
+		}
+		hasIllegal := false
+		for _, tt := range types {
+			if tt == token.ILLEGAL {
+				hasIllegal = true
+			}
+		}
+		if !hasIllegal {
+			t.Errorf("%q: \"#!\" should not be skipped. got=%v", input, types)
+		}
+	}
+
+	// シバンだけの入力
+	if tok := New("#!/usr/bin/env monkey").NextToken(); tok.Type != token.EOF {
+		t.Errorf("expected EOF. got=%q", tok.Type)
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	// 0 で始まる数字や 0o の後の数字は、正しくなくても1つのリテラルにする（構文解析器がエラーにする）
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"0", []string{"0"}},
+		{"00", []string{"00"}},
+		{"0755", []string{"0755"}},
+		{"0o755", []string{"0o755"}},
+		{"0O17", []string{"0O17"}},
+		{"0o", []string{"0o"}},
+		{"0o78", []string{"0o78"}},
+		{"0ox", []string{"0o", "x"}},
+		{"10o7", []string{"10", "o", "7"}},
+	}
+
+	for _, tt := range tests {
+		var literals []string
+		for _, tok := range Tokenize(tt.input) {
+			literals = append(literals, tok.Literal)
+		}
+		if strings.Join(literals, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("%q: wrong tokens. want=%q, got=%q", tt.input, tt.expected, literals)
+		}
+		if tok := New(tt.input).NextToken(); tok.Type != token.INT {
+			t.Errorf("%q: first token should be INT. got=%s", tt.input, tok.Type)
+		}
+	}
+}
+
+func TestDotDot(t *testing.T) {
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "1"},
+		{token.DOTDOT, ".."},
+		{token.INT, "10"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "a"},
+		{token.EOF, ""},
+	}
+
+	l := New("1..10 .a")
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestEllipsis(t *testing.T) {
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "xs"},
+		{token.RPAREN, ")"},
+		{token.INT, "1"},
+		{token.DOTDOT, ".."},
+		{token.INT, "2"},
+		{token.ELLIPSIS, "..."},
+		{token.ILLEGAL, "."},
+		{token.EOF, ""},
+	}
+
+	l := New("f(...xs) 1..2 ....")
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestOptionalIndex(t *testing.T) {
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.OPTIONAL_LBRACKET, "?["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.ILLEGAL, "?"},
+		{token.LBRACKET, "["},
+		{token.EOF, ""},
+	}
+
+	l := New("a?[0] ? [")
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+// syntheticProgram は size バイト以上の、いろいろなトークンを含むプログラムを生成する
+func syntheticProgram(size int) string {
+	var b strings.Builder
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, "let value_%d = fn(x, y) {\n", i)
+		fmt.Fprintf(&b, "\tlet total = x * %d + y / 3 - (x - y);\n", i)
+		fmt.Fprintf(&b, "\tif (total <= %d) { \"small\" } else { \"big\n line\" };\n", i*7)
+		b.WriteString("\tlet items = [1, 2, 3, \"four\", {\"k\": true, \"j\": false}];\n")
+		b.WriteString("\tfor (n in 0..10) { items[n] != null };\r\n")
+		b.WriteString("\t!total == -x;\n};\n")
+	}
+	return b.String()
+}
+
+// 各トークンのリテラルは、その位置から始まる入力と一致する
+// 空白と文字列の引用符以外の入力は、どれかのトークンに含まれる
+func TestSyntheticProgramTokens(t *testing.T) {
+	input := syntheticProgram(64 * 1024)
+
+	// 各行の先頭の位置
+	lineStarts := []int{0}
+	for i := 0; i < len(input); i++ {
+		if input[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	covered := make([]bool, len(input))
+	tokens := Tokenize(input)
+	for i, tok := range tokens {
+		offset := lineStarts[tok.Line-1] + tok.Column - 1
+		start := offset
+		if tok.Type == token.STRING {
+			start++
+			covered[offset], covered[start+len(tok.Literal)] = true, true
+		}
+		if input[start:start+len(tok.Literal)] != tok.Literal {
+			t.Fatalf("tokens[%d] %q at %d:%d does not match the input %q",
+				i, tok.Literal, tok.Line, tok.Column, input[start:start+len(tok.Literal)])
+		}
+		if tok.Type == token.ILLEGAL {
+			t.Fatalf("tokens[%d] is illegal: %q", i, tok.Literal)
+		}
+		for j := start; j < start+len(tok.Literal); j++ {
+			covered[j] = true
+		}
+	}
+
+	for i, ok := range covered {
+		if !ok && !strings.ContainsRune(" \t\r\n", rune(input[i])) {
+			t.Fatalf("byte %d (%q) is not in any token", i, input[i])
+		}
+	}
+}
+
+func BenchmarkTokenize(b *testing.B) {
+	input := syntheticProgram(1 << 20)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := New(input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+	}
+}
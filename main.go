@@ -1,18 +1,339 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/optimizer"
+	"monkey/parser"
 	"monkey/repl"
 	"os"
-	"os/user"
+	"path/filepath"
+	"strings"
 )
 
 func main() {
-	user, err := user.Current()
+	fold := flag.Bool("fold", false, "fold constant expressions before evaluation")
+	profile := flag.Bool("profile", false, "print call counts and times per function after running a script")
+	noPrelude := flag.Bool("no-prelude", false, "do not load the standard prelude")
+	preludePath := flag.String("prelude", "", "load this file as the prelude instead of the standard one")
+	historyPath := flag.String("history", defaultHistoryPath(), "save REPL input history to this `file` (empty to disable)")
+	noColor := flag.Bool("no-color", false, "do not color REPL output (also disabled by NO_COLOR or when stdout is not a terminal)")
+	quiet := flag.Bool("quiet", false, "read from stdin without the banner and prompts, even on a terminal")
+	dumpTokensFlag := flag.Bool("dump-tokens", false, "print the tokens of the script instead of running it")
+	dumpASTFlag := flag.Bool("dump-ast", false, "print the syntax tree of the script instead of running it")
+	dumpBytecodeFlag := flag.Bool("dump-bytecode", false, "print the compiled bytecode of the script instead of running it")
+	strict := flag.Bool("strict", false, "make it an error to let a name that is already defined in the same scope (eval engine only)")
+	stream := flag.Bool("stream", false, "parse and evaluate a script one top-level statement at a time instead of building the whole syntax tree first (eval engine only)")
+	engine := flag.String("engine", repl.EngineEval, "`backend` that runs the code: eval (tree-walking evaluator) or vm (bytecode compiler and virtual machine)")
+	printLast := flag.Bool("print-last", false, "print the value of the script's last expression statement, as the REPL and -e do")
+	format := flag.String("format", formatText, "output `format` of -dump-tokens and -dump-ast: text or json (-dump-bytecode is text only)")
+	var exprs stringList
+	flag.Var(&exprs, "e", "evaluate `source` and print its value (repeatable)")
+	flag.Var(&exprs, "eval", "same as -e")
+	flag.Parse()
+	opts := repl.Options{Fold: *fold, NoPrelude: *noPrelude, PreludePath: *preludePath, HistoryPath: *historyPath, Engine: *engine, Strict: *strict}
+	if *engine != repl.EngineEval && *engine != repl.EngineVM {
+		fmt.Fprintf(os.Stderr, "unknown engine %q (want eval or vm)\n", *engine)
+		os.Exit(2)
+	}
+
+	if *stream && *engine != repl.EngineEval {
+		fmt.Fprintln(os.Stderr, "-stream is supported only with -engine=eval")
+		os.Exit(2)
+	}
+	if *strict && *engine != repl.EngineEval {
+		fmt.Fprintln(os.Stderr, "-strict is supported only with -engine=eval")
+		os.Exit(2)
+	}
+
+	runOpts := runOptions{Options: opts, Profile: *profile, Format: *format, Stream: *stream, PrintLast: *printLast}
+	for _, d := range []struct {
+		set  bool
+		name string
+	}{{*dumpTokensFlag, dumpTokens}, {*dumpASTFlag, dumpAST}, {*dumpBytecodeFlag, dumpBytecode}} {
+		if !d.set {
+			continue
+		}
+		if runOpts.Dump != "" {
+			fmt.Fprintf(os.Stderr, "cannot use -dump-%s together with -dump-%s\n", runOpts.Dump, d.name)
+			os.Exit(2)
+		}
+		runOpts.Dump = d.name
+	}
+	if *format != formatText && *format != formatJSON {
+		fmt.Fprintf(os.Stderr, "unknown format %q (want text or json)\n", *format)
+		os.Exit(2)
+	}
+	if runOpts.Dump == dumpBytecode && *format != formatText {
+		fmt.Fprintln(os.Stderr, "-dump-bytecode supports only -format=text")
+		os.Exit(2)
+	}
+
+	// monkey fmt [flags] [path ...]
+	// monkey build file.mky [-o file.mkc]
+	// monkey run file.mkc
+	// monkey bench [-engine eval|vm|all] [-run regexp] [-time 1s] [-json]
+	// monkey vet [-no-prelude] [-prelude file] path ...
+	// monkey test [-no-prelude] [-prelude file] path ...
+	switch flag.Arg(0) {
+	case "fmt":
+		os.Exit(runFmt(flag.Args()[1:], os.Stdin, os.Stdout, os.Stderr))
+	case "build":
+		os.Exit(runBuild(flag.Args()[1:], os.Stderr))
+	case "run":
+		os.Exit(runBytecodeFile(flag.Args()[1:], os.Stdout, os.Stderr))
+	case "bench":
+		os.Exit(runBench(flag.Args()[1:], os.Stdout, os.Stderr))
+	case "vet":
+		os.Exit(runVet(flag.Args()[1:], os.Stdout, os.Stderr))
+	case "test":
+		os.Exit(runTest(flag.Args()[1:], os.Stdout, os.Stderr))
+	}
+
+	// -e が指定された場合はそのソースを実行する
+	if len(exprs) > 0 {
+		if flag.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, "cannot use -e together with a script file")
+			os.Exit(2)
+		}
+		os.Exit(runExpressions(exprs, os.Stdout, os.Stderr, runOpts))
+	}
+
+	// スクリプトのファイルが指定された場合はそれを実行する
+	if flag.NArg() > 0 {
+		os.Exit(runFile(flag.Arg(0), os.Stdout, os.Stderr, runOpts))
+	}
+
+	// 評価しない場合は標準入力を読んで出力する
+	if runOpts.Dump != "" {
+		os.Exit(runReader("<stdin>", os.Stdin, os.Stdout, os.Stderr, runOpts))
+	}
+
+	// 入力が端末でなければ、バナーやプロンプトを出さずに評価する
+	if *quiet || !repl.IsTerminal(os.Stdin) {
+		os.Exit(repl.RunNonInteractive(os.Stdin, os.Stdout, os.Stderr, opts))
+	}
+
+	r := repl.New(os.Stdin, os.Stdout)
+	r.Options = opts
+	r.ShowBanner = true
+	r.Color = !*noColor
+	r.Start()
+}
+
+// ホームディレクトリの .monkey_history。ホームディレクトリが分からなければ空
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		panic(err)
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+// stringList は繰り返し指定できるフラグの値
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, " ") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// runOptions はスクリプト実行の設定
+type runOptions struct {
+	repl.Options
+	// 実行後に関数ごとの呼び出し回数と時間を errOut に出力する
+	Profile bool
+	// 空でなければ評価せずに、dumpTokens か dumpAST の結果を出力する
+	Dump string
+	// Dump の出力の形式。formatText か formatJSON
+	Format string
+	// trueなら最上位の文を1つずつ構文解析して評価する（評価器のみ）
+	Stream bool
+	// trueならスクリプトの最後の値を -e と同じように表示する
+	PrintLast bool
+}
+
+// source は実行するソースとエラーの表示に使う名前
+type source struct {
+	name string
+	text string
+	// trueなら最後の値を REPL と同じように表示する（repl.ShouldEcho を参照）
+	printResult bool
+}
+
+// runFile は path のスクリプトを新しい環境で実行し、終了コードを返す
+// スクリプトの出力は out に、エラーは errOut に書く
+// 構文エラーと実行時エラーは1、exit(n) はnを返す
+func runFile(path string, out, errOut io.Writer, opts runOptions) int {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	return run([]source{{name: path, text: string(src)}}, out, errOut, opts)
+}
+
+// runReader は r から読んだソースを新しい環境で実行し、終了コードを返す
+func runReader(name string, r io.Reader, out, errOut io.Writer, opts runOptions) int {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	return run([]source{{name: name, text: string(src)}}, out, errOut, opts)
+}
+
+// runExpressions は -e で渡されたソースを順に1つの環境で実行し、終了コードを返す
+func runExpressions(exprs []string, out, errOut io.Writer, opts runOptions) int {
+	sources := make([]source, len(exprs))
+	for i, expr := range exprs {
+		sources[i] = source{name: fmt.Sprintf("-e #%d", i+1), text: expr, printResult: true}
+	}
+	return run(sources, out, errOut, opts)
+}
+
+// run は sources を順に1つの環境で実行し、終了コードを返す
+// エラーが起きた時点で残りのソースは実行しない
+// opts.Dump が指定されていれば、評価せずにすべてのソースを出力する
+func run(sources []source, out, errOut io.Writer, opts runOptions) int {
+	if opts.Dump != "" {
+		status := 0
+		for _, src := range sources {
+			if dump(src, out, errOut, opts) != 0 {
+				status = 1
+			}
+		}
+		return status
+	}
+
+	evalOpts := []evaluator.Option{evaluator.WithOutput(out)}
+	if opts.Strict {
+		evalOpts = append(evalOpts, evaluator.WithStrict())
+	}
+	tracer := evaluator.NewCountingTracer()
+	if opts.Profile {
+		evalOpts = append(evalOpts, evaluator.WithTracer(tracer))
+		defer tracer.Report(errOut)
+	}
+	ev := evaluator.New(evalOpts...)
+	machine := repl.NewVMRunner()
+	env, err := repl.NewEnvironment(ev, opts.Options)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+
+	for _, src := range sources {
+		var result object.Object
+		// 最後に評価した文と、トップレベルの return で終えたか。結果を表示するかどうかを決める
+		var last ast.Statement
+		var returned bool
+		if opts.Stream {
+			var ok bool
+			if result, last, ok = evalStream(ev, env, src, errOut, opts.Fold); !ok {
+				return 1
+			}
+			returned = ev.Returned()
+		} else {
+			p := parser.New(lexer.New(src.text))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				printParseErrors(errOut, src, p.ErrorDetails())
+				return 1
+			}
+			if opts.Fold {
+				program = optimizer.Fold(program)
+			}
+			last = repl.LastStatement(program)
+
+			if opts.Engine == repl.EngineVM {
+				result = machine.Run(program)
+				returned = machine.Returned()
+			} else {
+				result = ev.Eval(program, env)
+				returned = ev.Returned()
+			}
+		}
+		if errObj, ok := result.(*object.Error); ok {
+			if errObj.Exit {
+				return errObj.ExitCode
+			}
+			fmt.Fprintf(errOut, "%s: %s\n", src.name, errObj.Inspect())
+			fmt.Fprint(errOut, errObj.StackTrace())
+			return 1
+		}
+		// トップレベルの return で終えたスクリプトは、return した値がスクリプトの値になる
+		echo := repl.ShouldEcho(last, result)
+		if returned {
+			echo = result != object.NULL
+		}
+		if (src.printResult || opts.PrintLast) && echo {
+			fmt.Fprintln(out, result.Inspect())
+		}
+	}
+	return 0
+}
+
+// evalStream は src を最上位の文ごとに構文解析して評価する（-stream）
+// 評価し終えた文の構文木は捨てるので、大きなプログラムでも構文木全体を持たない
+// 構文エラーがあれば、それより前の文を評価した後でエラーを書いて ok を false にする
+// last は最後に評価した文
+func evalStream(ev *evaluator.Evaluator, env *object.Environment, src source, errOut io.Writer, fold bool) (result object.Object, last ast.Statement, ok bool) {
+	p := parser.New(lexer.New(src.text))
+	// 畳み込みで1つの文が複数の文になった場合の残り
+	var pending []ast.Statement
+	next := func() (ast.Statement, error) {
+		for len(pending) == 0 {
+			stmt := p.ParseStatement()
+			if errs := p.ErrorDetails(); len(errs) > 0 {
+				return nil, errs[0]
+			}
+			if stmt == nil || !fold {
+				if stmt != nil {
+					last = stmt
+				}
+				return stmt, nil
+			}
+			pending = optimizer.Fold(&ast.Program{Statements: []ast.Statement{stmt}}).Statements
+		}
+		stmt := pending[0]
+		pending = pending[1:]
+		last = stmt
+		return stmt, nil
+	}
+
+	result, err := ev.EvalStream(context.Background(), next, env)
+	if err != nil {
+		printParseErrors(errOut, src, p.ErrorDetails())
+		return nil, nil, false
+	}
+	return result, last, true
+}
+
+// printCompileError はコンパイルのエラーを構文エラーと同じ形で書く
+func printCompileError(errOut io.Writer, src source, err error) {
+	if compileErr, ok := err.(*compiler.Error); ok && compileErr.Line > 0 {
+		fmt.Fprint(errOut, repl.Snippet(src.text, compileErr.Line, compileErr.Column))
+		fmt.Fprintf(errOut, "%s:%d:%d: compile error: %s\n", src.name, compileErr.Line, compileErr.Column, compileErr.Message)
+		return
+	}
+	fmt.Fprintf(errOut, "%s: compile error: %s\n", src.name, err)
+}
+
+// printParseErrors は構文エラーを、該当する行と "name:line:col: message" の形で書く
+func printParseErrors(errOut io.Writer, src source, errors []parser.Error) {
+	for _, err := range errors {
+		fmt.Fprint(errOut, repl.Snippet(src.text, err.Line, err.Column))
+		fmt.Fprintf(errOut, "%s:%d:%d: %s\n", src.name, err.Line, err.Column, err.Message)
 	}
-	fmt.Printf("Hello %s! This is the Monkey programing language!\n", user.Username)
-	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
 }
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"monkey/repl"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunFile(t *testing.T) {
+	tests := []struct {
+		file   string
+		status int
+		out    string
+		errOut string
+	}{
+		{"hello.mky", 0, "Hello, Monkey!\n6\n", ""},
+		{"parse_error.mky", 1, "", "let = 2;\n    ^\ntestdata/parse_error.mky:2:5: expected next token to be IDENT, got = instead\n"},
+		{"runtime_error.mky", 1, "", "runtime_error.mky: ERROR: line 1, column 19: TypeError: type mismatch: INTEGER + BOOLEAN"},
+		{"exit.mky", 3, "before\n", ""},
+		{"throw.mky", 1, "", "throw.mky: ERROR: line 1, column 21: Thrown: {\"code\":404, \"id\":7}\n  at throw (line 1, column 21)\n  at load (line 2, column 1)\n"},
+		{"shebang.mky", 1, "", "shebang.mky: ERROR: line 3, column 3: TypeError: type mismatch: INTEGER + BOOLEAN"},
+		{"missing.mky", 1, "", "no such file or directory"},
+	}
+
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		status := runFile(filepath.Join("testdata", tt.file), &out, &errOut, runOptions{})
+		if status != tt.status {
+			t.Errorf("%s: wrong status. want=%d, got=%d (stderr=%q)", tt.file, tt.status, status, errOut.String())
+		}
+		if out.String() != tt.out {
+			t.Errorf("%s: wrong output. want=%q, got=%q", tt.file, tt.out, out.String())
+		}
+		if tt.errOut == "" && errOut.Len() > 0 {
+			t.Errorf("%s: unexpected stderr %q", tt.file, errOut.String())
+		}
+		if !strings.Contains(errOut.String(), tt.errOut) {
+			t.Errorf("%s: stderr should contain %q. got=%q", tt.file, tt.errOut, errOut.String())
+		}
+	}
+}
+
+// -stream でも、構文エラーがなければ全体を読んでから評価するのと同じ結果になる
+// 構文エラーがあると、-stream はその文で止まるので後に続くエラーを報告しない
+func TestRunFileStream(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.mky"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+
+	for _, file := range files {
+		if strings.HasSuffix(file, "parse_error.mky") {
+			continue
+		}
+		for _, fold := range []bool{false, true} {
+			var wantOut, wantErr, out, errOut bytes.Buffer
+			opts := runOptions{Options: repl.Options{Fold: fold}}
+			wantStatus := runFile(file, &wantOut, &wantErr, opts)
+			opts.Stream = true
+			status := runFile(file, &out, &errOut, opts)
+			if status != wantStatus || out.String() != wantOut.String() || errOut.String() != wantErr.String() {
+				t.Errorf("%s (fold=%t): stream differs.\nwant status=%d out=%q err=%q\ngot  status=%d out=%q err=%q",
+					file, fold, wantStatus, wantOut.String(), wantErr.String(), status, out.String(), errOut.String())
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	runFile(filepath.Join("testdata", "stream.mky"), &out, &out, runOptions{Stream: true})
+	if out.String() != "[1, 4, 9, 16, 25]\nbig\ntrue\n56\n" {
+		t.Errorf("wrong output of stream.mky. got=%q", out.String())
+	}
+}
+
+// -stream では構文エラーの前の文はもう評価されている
+func TestRunFileStreamParseError(t *testing.T) {
+	var out, errOut bytes.Buffer
+	status := runFile(filepath.Join("testdata", "stream_parse_error.mky"), &out, &errOut, runOptions{Stream: true})
+	if status != 1 || out.String() != "before\n" {
+		t.Errorf("wrong result. status=%d, out=%q", status, out.String())
+	}
+	if !strings.HasSuffix(errOut.String(), "stream_parse_error.mky:2:5: expected next token to be IDENT, got = instead\n") {
+		t.Errorf("wrong stderr. got=%q", errOut.String())
+	}
+}
+
+func TestRunExpressions(t *testing.T) {
+	tests := []struct {
+		exprs  []string
+		status int
+		out    string
+		errOut string
+	}{
+		{[]string{`puts(1 + 2)`}, 0, "3\n", ""},
+		{[]string{`1 + 2`}, 0, "3\n", ""},
+		{[]string{`let x = 2`, `let y = x * 3`, `[x, y]`}, 0, "[2, 6]\n", ""},
+		{[]string{`if (false) { 1 }`}, 0, "", ""},
+		{[]string{`1`, `let = 2`, `3`}, 1, "1\n", "let = 2\n    ^\n-e #2:1:5: expected next token to be IDENT, got = instead\n"},
+		{[]string{`missing`}, 1, "", "-e #1: ERROR: line 1, column 1: NameError: identifier not found: missing"},
+		{[]string{`exit(5)`, `puts("unreachable")`}, 5, "", ""},
+	}
+
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		status := runExpressions(tt.exprs, &out, &errOut, runOptions{})
+		if status != tt.status {
+			t.Errorf("%q: wrong status. want=%d, got=%d (stderr=%q)", tt.exprs, tt.status, status, errOut.String())
+		}
+		if out.String() != tt.out {
+			t.Errorf("%q: wrong output. want=%q, got=%q", tt.exprs, tt.out, out.String())
+		}
+		if tt.errOut == "" && errOut.Len() > 0 {
+			t.Errorf("%q: unexpected stderr %q", tt.exprs, errOut.String())
+		}
+		if !strings.Contains(errOut.String(), tt.errOut) {
+			t.Errorf("%q: stderr should contain %q. got=%q", tt.exprs, tt.errOut, errOut.String())
+		}
+	}
+}
+
+func TestPrintLast(t *testing.T) {
+	// スクリプトは -print-last を付けた場合だけ、-e は常に、最後の式文の値（return で終えた場合はその値）を表示する
+	tests := []struct {
+		src string
+		// -print-last を付けない場合と付けた場合の出力
+		plain    string
+		expected string
+	}{
+		{"1 + 2", "", "3\n"},
+		{"let x = 3", "", ""},
+		// トップレベルの return はスクリプトを終え、return した値がスクリプトの値になる
+		{"return 4", "", "4\n"},
+		{"return 4;\nputs(\"never\")", "", "4\n"},
+		{"let x = 1;\nif (x > 0) { return x * 10; }\nx + 100\n", "", "10\n"},
+		{"if (false) { return 1; }\nlet z = 2;\n", "", ""},
+		{`puts("p")`, "p\n", "p\n"},
+		{"if (false) { 1 }", "", ""},
+		{"{ let y = 5; y }", "", "5\n"},
+		{"let x = 3;\nx * 2\n", "", "6\n"},
+	}
+
+	dir := t.TempDir()
+	for i, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("script%d.mky", i))
+		if err := ioutil.WriteFile(path, []byte(tt.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, engine := range []string{repl.EngineEval, repl.EngineVM} {
+			if engine == repl.EngineVM && strings.Contains(tt.src, "puts") {
+				// 仮想マシンの puts は標準出力に書く
+				continue
+			}
+			for _, mode := range []struct {
+				name     string
+				opts     runOptions
+				expected string
+			}{
+				{"file", runOptions{}, tt.plain},
+				{"file -print-last", runOptions{PrintLast: true}, tt.expected},
+				{"file -stream -print-last", runOptions{PrintLast: true, Stream: true}, tt.expected},
+			} {
+				if mode.opts.Stream && engine == repl.EngineVM {
+					continue
+				}
+				mode.opts.Options = repl.Options{NoPrelude: true, Engine: engine}
+				var out, errOut bytes.Buffer
+				if status := runFile(path, &out, &errOut, mode.opts); status != 0 {
+					t.Errorf("%s %s: %q: wrong status %d (stderr=%q)", engine, mode.name, tt.src, status, errOut.String())
+				}
+				if out.String() != mode.expected {
+					t.Errorf("%s %s: %q: wrong output. want=%q, got=%q", engine, mode.name, tt.src, mode.expected, out.String())
+				}
+			}
+
+			var out, errOut bytes.Buffer
+			runExpressions([]string{tt.src}, &out, &errOut, runOptions{Options: repl.Options{NoPrelude: true, Engine: engine}})
+			if out.String() != tt.expected {
+				t.Errorf("%s -e: %q: wrong output. want=%q, got=%q", engine, tt.src, tt.expected, out.String())
+			}
+		}
+	}
+}
+
+func TestRunStrict(t *testing.T) {
+	var out, errOut bytes.Buffer
+	status := runExpressions([]string{`let x = 1`, `let x = 2`}, &out, &errOut, runOptions{Options: repl.Options{Strict: true}})
+	if status != 1 || errOut.String() != "-e #2: ERROR: line 1, column 1: NameError: x is already defined in this scope\n" {
+		t.Errorf("wrong result. status=%d, stderr=%q", status, errOut.String())
+	}
+
+	errOut.Reset()
+	if status := runExpressions([]string{`let x = 1`, `let x = 2`}, &out, &errOut, runOptions{}); status != 0 {
+		t.Errorf("let should rebind without -strict. status=%d, stderr=%q", status, errOut.String())
+	}
+}
+
+func TestRunEngineVM(t *testing.T) {
+	tests := []struct {
+		exprs  []string
+		status int
+		out    string
+		errOut string
+	}{
+		{[]string{`1 + 2`, `if (1 < 2) { 10 } else { 20 }`}, 0, "3\n10\n", ""},
+		{[]string{`5 + true`}, 1, "", "-e #1: ERROR: TypeError: type mismatch: INTEGER + BOOLEAN"},
+		{[]string{`let x = 2`, `let y = x * 3`, `x + y`}, 0, "8\n", ""},
+		{[]string{`let a = 1; a + missing`}, 1, "", "-e #1: ERROR: line 1, column 16: compile error: undefined variable missing"},
+		{[]string{`"a" + "b"`}, 0, "ab\n", ""},
+		{[]string{`len([1, 2])`, `exit(4)`, `1`}, 4, "2\n", ""},
+		{[]string{`for (x in [1]) { x }`}, 1, "", "-e #1: ERROR: compile error: unsupported node *ast.ForInExpression"},
+	}
+
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		opts := runOptions{Options: repl.Options{NoPrelude: true, Engine: repl.EngineVM}}
+		status := runExpressions(tt.exprs, &out, &errOut, opts)
+		if status != tt.status {
+			t.Errorf("%v: wrong status. want=%d, got=%d (stderr=%q)", tt.exprs, tt.status, status, errOut.String())
+		}
+		if out.String() != tt.out {
+			t.Errorf("%v: wrong output. want=%q, got=%q", tt.exprs, tt.out, out.String())
+		}
+		if !strings.Contains(errOut.String(), tt.errOut) {
+			t.Errorf("%v: stderr should contain %q. got=%q", tt.exprs, tt.errOut, errOut.String())
+		}
+	}
+}
+
+func TestNumberPrinting(t *testing.T) {
+	// 数値を表示するすべての経路で同じ表記になる
+	values := []struct {
+		expr     string
+		expected string
+	}{
+		{`0`, "0"},
+		{`-42`, "-42"},
+		{`1025`, "1025"},
+		{`9223372036854775807`, "9223372036854775807"},
+		{`-9223372036854775807 - 1`, "-9223372036854775808"},
+		{`pow(2, 64)`, "18446744073709551616"},
+		{`-pow(2, 64)`, "-18446744073709551616"},
+	}
+	paths := []struct {
+		name     string
+		template string
+		want     string
+		engines  []string
+	}{
+		{"result", "%s", "%s", []string{repl.EngineEval, repl.EngineVM}},
+		{"array", "[%s]", "[%s]", []string{repl.EngineEval, repl.EngineVM}},
+		{"hash value", `{"n": %s}`, `{"n":%s}`, []string{repl.EngineEval, repl.EngineVM}},
+		{"hash key", `{[%s]: 1}`, `{%s:1}`, []string{repl.EngineEval, repl.EngineVM}},
+		{"inspect", "inspect(%s)", "%s", []string{repl.EngineEval, repl.EngineVM}},
+		{"pretty", "inspect(%s, true)", "%s", []string{repl.EngineEval, repl.EngineVM}},
+		{"puts", "puts(%s); 1", "%s\n1", []string{repl.EngineEval}},
+	}
+
+	for _, path := range paths {
+		for _, engine := range path.engines {
+			for _, v := range values {
+				expr := strings.Replace(path.template, "%s", v.expr, 1)
+				want := strings.Replace(path.want, "%s", v.expected, 1) + "\n"
+				var out, errOut bytes.Buffer
+				runExpressions([]string{expr}, &out, &errOut, runOptions{Options: repl.Options{NoPrelude: true, Engine: engine}})
+				if out.String() != want {
+					t.Errorf("%s (%s): %s: want=%q, got=%q (stderr=%q)", path.name, engine, expr, want, out.String(), errOut.String())
+				}
+			}
+		}
+	}
+
+	// REPL の表示
+	for _, v := range values {
+		var out bytes.Buffer
+		repl.StartWithOptions(strings.NewReader(v.expr+"\n"), &out, repl.Options{NoPrelude: true})
+		if out.String() != v.expected+"\n" {
+			t.Errorf("repl: %s: want=%q, got=%q", v.expr, v.expected+"\n", out.String())
+		}
+	}
+}
+
+func TestStringListFlag(t *testing.T) {
+	var exprs stringList
+	fs := flag.NewFlagSet("monkey", flag.ContinueOnError)
+	fs.Var(&exprs, "e", "")
+	fs.Var(&exprs, "eval", "")
+	if err := fs.Parse([]string{"-e", "1", "--eval", "2", "-e=3"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(exprs) != 3 || exprs[0] != "1" || exprs[1] != "2" || exprs[2] != "3" {
+		t.Errorf("wrong flag values. got=%q", exprs)
+	}
+}
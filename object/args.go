@@ -0,0 +1,140 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ArgSpec は組み込み関数の1つの引数に対する期待を表す
+type ArgSpec struct {
+	// 受け付ける型。空の場合はどの型でもよい
+	Types []ObjectType
+	// 省略できるか
+	Optional bool
+	// 残りの引数をすべてこの仕様で受け付けるか（最後の仕様にのみ指定できる）
+	Variadic bool
+}
+
+// Arg は必須の引数の仕様を返す
+func Arg(types ...ObjectType) ArgSpec {
+	return ArgSpec{Types: types}
+}
+
+// OptionalArg は省略可能な引数の仕様を返す
+func OptionalArg(types ...ObjectType) ArgSpec {
+	return ArgSpec{Types: types, Optional: true}
+}
+
+// VariadicArg は0個以上の残りの引数の仕様を返す
+func VariadicArg(types ...ObjectType) ArgSpec {
+	return ArgSpec{Types: types, Optional: true, Variadic: true}
+}
+
+// CheckArgs は組み込み関数 name の引数の個数と型を検査し、問題があればエラーを返す
+//
+//	len: expected 1 argument, got 2
+//	len: argument 1 must be string or array, got integer
+func CheckArgs(name string, args []Object, specs ...ArgSpec) *Error {
+	min, max := 0, len(specs)
+	for _, spec := range specs {
+		if !spec.Optional {
+			min++
+		}
+		if spec.Variadic {
+			max = -1
+		}
+	}
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return &Error{Kind: ArityError, Message: fmt.Sprintf("%s: expected %s, got %d", name, arityString(min, max), len(args))}
+	}
+
+	for i, arg := range args {
+		spec := specs[len(specs)-1]
+		if i < len(specs) {
+			spec = specs[i]
+		}
+		if err := CheckArgType(name, i+1, arg, spec.Types...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckArgType は position 番目（1始まり）の引数 arg の型を検査する
+// 他の引数の値によって期待する型が変わる場合に使う
+func CheckArgType(name string, position int, arg Object, types ...ObjectType) *Error {
+	if len(types) == 0 {
+		return nil
+	}
+	for _, t := range types {
+		if arg.Type() == t {
+			return nil
+		}
+	}
+	return ArgError(TypeError, name, position, "must be %s, got %s", typeListString(types), TypeName(arg.Type()))
+}
+
+// CheckHashableArg は position 番目の引数がハッシュのキーに使えるかを検査する
+//
+//	get: argument 2 must be hashable, got array
+func CheckHashableArg(name string, position int, arg Object) *Error {
+	if _, ok := arg.(Hashable); ok {
+		return nil
+	}
+	return ArgError(TypeError, name, position, "must be hashable, got %s", TypeName(arg.Type()))
+}
+
+// CheckIterableArg は position 番目の引数が要素を順に取り出せるかを検査する
+//
+//	map: argument 1 must be iterable, got integer
+func CheckIterableArg(name string, position int, arg Object) *Error {
+	if _, ok := arg.(Iterable); ok {
+		return nil
+	}
+	return ArgError(TypeError, name, position, "must be iterable, got %s", TypeName(arg.Type()))
+}
+
+// ArgError は position 番目の引数についての kind のエラーを、他の引数のエラーと同じ形式で返す
+// 型以外の条件（空でないことなど）を満たさない場合に使う
+//
+//	pop: argument 1 must be non-empty array, got empty array
+func ArgError(kind ErrorKind, name string, position int, format string, a ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf("%s: argument %d ", name, position) + fmt.Sprintf(format, a...)}
+}
+
+// TypeName はエラーメッセージ用の型名（小文字）を返す
+func TypeName(t ObjectType) string {
+	return strings.ToLower(string(t))
+}
+
+func arityString(min, max int) string {
+	switch {
+	case max < 0:
+		return "at least " + pluralArguments(min)
+	case min == max:
+		return pluralArguments(min)
+	case max == min+1:
+		return fmt.Sprintf("%d or %s", min, pluralArguments(max))
+	default:
+		return fmt.Sprintf("%d to %s", min, pluralArguments(max))
+	}
+}
+
+func pluralArguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+// [string array hash] -> "string, array or hash"
+func typeListString(types []ObjectType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = TypeName(t)
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
@@ -0,0 +1,67 @@
+package object
+
+import "testing"
+
+func TestCheckArgs(t *testing.T) {
+	one := &Integer{Value: 1}
+	str := &String{Value: "s"}
+	arr := &Array{}
+
+	tests := []struct {
+		args     []Object
+		specs    []ArgSpec
+		expected string
+	}{
+		{[]Object{str}, []ArgSpec{Arg(STRING_OBJ, ARRAY_OBJ)}, ""},
+		{[]Object{arr}, []ArgSpec{Arg(STRING_OBJ, ARRAY_OBJ)}, ""},
+		{[]Object{one}, []ArgSpec{Arg()}, ""},
+		{[]Object{str, str}, []ArgSpec{Arg(STRING_OBJ)}, "f: expected 1 argument, got 2"},
+		{[]Object{}, []ArgSpec{Arg(), Arg()}, "f: expected 2 arguments, got 0"},
+		{[]Object{}, []ArgSpec{}, ""},
+		{[]Object{one}, []ArgSpec{}, "f: expected 0 arguments, got 1"},
+		{[]Object{one}, []ArgSpec{Arg(STRING_OBJ, ARRAY_OBJ)}, "f: argument 1 must be string or array, got integer"},
+		{[]Object{one}, []ArgSpec{Arg(STRING_OBJ, ARRAY_OBJ, HASH_OBJ)}, "f: argument 1 must be string, array or hash, got integer"},
+		{[]Object{str, str}, []ArgSpec{Arg(STRING_OBJ), Arg(INTEGER_OBJ)}, "f: argument 2 must be integer, got string"},
+		{[]Object{arr, one}, []ArgSpec{Arg(), Arg(), OptionalArg()}, ""},
+		{[]Object{arr}, []ArgSpec{Arg(), Arg(), OptionalArg()}, "f: expected 2 or 3 arguments, got 1"},
+		{[]Object{arr}, []ArgSpec{Arg(), OptionalArg(), OptionalArg()}, ""},
+		{[]Object{arr, one, one, one}, []ArgSpec{Arg(), OptionalArg(), OptionalArg()}, "f: expected 1 to 3 arguments, got 4"},
+		{[]Object{arr, one, str}, []ArgSpec{Arg(), OptionalArg(INTEGER_OBJ)}, "f: expected 1 or 2 arguments, got 3"},
+		{[]Object{arr, str}, []ArgSpec{Arg(), OptionalArg(INTEGER_OBJ)}, "f: argument 2 must be integer, got string"},
+		{[]Object{}, []ArgSpec{VariadicArg()}, ""},
+		{[]Object{one, one, one}, []ArgSpec{VariadicArg(INTEGER_OBJ)}, ""},
+		{[]Object{one, one, str}, []ArgSpec{VariadicArg(INTEGER_OBJ)}, "f: argument 3 must be integer, got string"},
+		{[]Object{}, []ArgSpec{Arg(ARRAY_OBJ), VariadicArg(ARRAY_OBJ)}, "f: expected at least 1 argument, got 0"},
+		{[]Object{str}, []ArgSpec{Arg(), Arg(), VariadicArg()}, "f: expected at least 2 arguments, got 1"},
+	}
+
+	for i, tt := range tests {
+		err := CheckArgs("f", tt.args, tt.specs...)
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("tests[%d] - unexpected error: %q", i, err.Message)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("tests[%d] - expected error %q, got nil", i, tt.expected)
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("tests[%d] - wrong message. expected=%q, got=%q", i, tt.expected, err.Message)
+		}
+	}
+}
+
+func TestCheckHashableArg(t *testing.T) {
+	if err := CheckHashableArg("f", 2, &String{Value: "k"}); err != nil {
+		t.Errorf("unexpected error: %q", err.Message)
+	}
+	err := CheckHashableArg("f", 2, &Array{})
+	if err == nil || err.Message != "f: argument 2 must be hashable, got array" {
+		t.Errorf("wrong error. got=%+v", err)
+	}
+	if msg := ArgError(IndexError, "f", 1, "must be non-empty array, got empty array").Message; msg != "f: argument 1 must be non-empty array, got empty array" {
+		t.Errorf("wrong ArgError message. got=%q", msg)
+	}
+}
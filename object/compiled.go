@@ -0,0 +1,44 @@
+package object
+
+import (
+	"fmt"
+	"monkey/code"
+	"strings"
+)
+
+// CompiledFunction はコンパイルした関数の本体。定数プールに置き、OpClosure で Closure にしてから呼び出す
+type CompiledFunction struct {
+	Instructions code.Instructions
+	// 局所変数の名前を番号の順に並べたもの。先頭の NumParameters 個が引数
+	LocalNames    []string
+	NumParameters int
+	// let文で束縛された関数の名前（無名の場合は空）
+	Name string
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// NumLocals は引数を含めた局所変数の数を返す
+func (cf *CompiledFunction) NumLocals() int {
+	return len(cf.LocalNames)
+}
+
+// Closure はVMで呼び出せる関数。作成時に捕捉した自由変数の値を持つ
+// 評価器の Function と同じく、型は FUNCTION で表示も同じ
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	name := ""
+	if c.Fn.Name != "" {
+		name = " " + c.Fn.Name
+	}
+	params := strings.Join(c.Fn.LocalNames[:c.Fn.NumParameters], ", ")
+	return "fn" + name + "(" + params + ") { ... }"
+}
@@ -0,0 +1,199 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+// FromGo はGoの値をMonkeyの値に変換する
+//
+//	整数（すべての幅）        -> Integer（int64に収まらない場合は BigInteger）
+//	小数部のない浮動小数点数  -> Integer（Monkeyには浮動小数点数がないので、小数部があればエラー）
+//	string, bool, nil         -> String, Boolean, Null
+//	スライス・配列            -> Array
+//	キーが文字列のマップ      -> Hash（キーの辞書順）
+//	Object                    -> そのまま
+//
+// 関数など、それ以外の値はエラーになる
+func FromGo(v interface{}) (Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return NULL, nil
+	case Object:
+		return v, nil
+	case bool:
+		if v {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case string:
+		return &String{Value: v}, nil
+	case *big.Int:
+		if v.IsInt64() {
+			return NewInteger(v.Int64()), nil
+		}
+		return &BigInteger{Value: new(big.Int).Set(v)}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewInteger(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n := rv.Uint()
+		if n > math.MaxInt64 {
+			return &BigInteger{Value: new(big.Int).SetUint64(n)}, nil
+		}
+		return NewInteger(int64(n)), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("cannot convert %v: floating-point numbers are not supported", f)
+		}
+		n, _ := big.NewFloat(f).Int(nil)
+		return FromGo(n)
+	case reflect.String:
+		return &String{Value: rv.String()}, nil
+	case reflect.Bool:
+		return FromGo(rv.Bool())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return NULL, nil
+		}
+		elements := make([]Object, rv.Len())
+		for i := range elements {
+			el, err := FromGo(rv.Index(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %s", i, err)
+			}
+			elements[i] = el
+		}
+		return &Array{Elements: elements}, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("cannot convert %s: map keys must be strings", rv.Type())
+		}
+		if rv.IsNil() {
+			return NULL, nil
+		}
+		keys := make([]string, 0, rv.Len())
+		for _, key := range rv.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+
+		hash := NewHash()
+		for _, key := range keys {
+			value, err := FromGo(rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("[%q]: %s", key, err)
+			}
+			hash.Set(&String{Value: key}, value)
+		}
+		return hash, nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return NULL, nil
+		}
+		return FromGo(rv.Elem().Interface())
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to a Monkey value", v)
+}
+
+// ToGo はMonkeyの値をGoの値に変換する
+//
+//	Integer, BigInteger       -> int64, *big.Int
+//	String, Boolean, Null     -> string, bool, nil
+//	Array, Set                -> []interface{}
+//	Hash                      -> キーがすべて文字列なら map[string]interface{}、
+//	                             それ以外は map[interface{}]interface{}（BigInteger のキーは10進表記の文字列）
+//
+// 関数や範囲など、それ以外の値と、自身を要素に含む配列・ハッシュはエラーになる（範囲は toArray で配列にしてから変換する）
+func ToGo(obj Object) (interface{}, error) {
+	return toGo(obj, map[Object]bool{})
+}
+
+// visiting は変換途中の配列とハッシュで、循環の検出に使う
+func toGo(obj Object, visiting map[Object]bool) (interface{}, error) {
+	switch obj.(type) {
+	case *Array, *Hash:
+		if visiting[obj] {
+			return nil, fmt.Errorf("cannot convert cyclic %s to a Go value", TypeName(obj.Type()))
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+	}
+
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value, nil
+	case *BigInteger:
+		return new(big.Int).Set(obj.Value), nil
+	case *String:
+		return obj.Value, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Null:
+		return nil, nil
+	case *Array:
+		return toGoSlice(obj.Elements, visiting)
+	case *Set:
+		return toGoSlice(obj.Members(), visiting)
+	case *Hash:
+		allStrings := true
+		for _, pair := range obj.OrderedPairs() {
+			if _, ok := pair.Key.(*String); !ok {
+				allStrings = false
+				break
+			}
+		}
+
+		if allStrings {
+			m := make(map[string]interface{}, len(obj.Pairs))
+			for _, pair := range obj.OrderedPairs() {
+				value, err := toGo(pair.Value, visiting)
+				if err != nil {
+					return nil, err
+				}
+				m[pair.Key.(*String).Value] = value
+			}
+			return m, nil
+		}
+
+		m := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.OrderedPairs() {
+			key, err := toGo(pair.Key, visiting)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := key.(*big.Int); ok {
+				// *big.Int はポインタなので値で比べられない
+				key = pair.Key.Inspect()
+			}
+			value, err := toGo(pair.Value, visiting)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Go value", TypeName(obj.Type()))
+	}
+}
+
+func toGoSlice(objs []Object, visiting map[Object]bool) ([]interface{}, error) {
+	values := make([]interface{}, len(objs))
+	for i, obj := range objs {
+		value, err := toGo(obj, visiting)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
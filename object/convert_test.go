@@ -0,0 +1,170 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFromGo(t *testing.T) {
+	type label string
+
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{42, "42"},
+		{int8(-8), "-8"},
+		{int16(16), "16"},
+		{int32(32), "32"},
+		{int64(math.MinInt64), "-9223372036854775808"},
+		{uint8(255), "255"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{3.0, "3"},
+		{float32(-2), "-2"},
+		{1e20, "100000000000000000000"},
+		{"hello", "hello"},
+		{label("typed"), "typed"},
+		{true, "true"},
+		{nil, "null"},
+		{[]interface{}{1, "two", []int{3}}, `[1, "two", [3]]`},
+		{[]string{"a", "b"}, `["a", "b"]`},
+		{[2]int{1, 2}, "[1, 2]"},
+		{map[string]interface{}{"b": 1, "a": []interface{}{true, nil}}, `{"a":[true, null], "b":1}`},
+		{map[string]int{"x": 1}, `{"x":1}`},
+		{&Integer{Value: 7}, "7"},
+		{big.NewInt(5), "5"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%#v) failed: %s", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v): want=%s, got=%s", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	if obj, _ := FromGo(true); obj != TRUE {
+		t.Errorf("FromGo(true) should return TRUE")
+	}
+	if obj, _ := FromGo(nil); obj != NULL {
+		t.Errorf("FromGo(nil) should return NULL")
+	}
+	if obj, _ := FromGo(uint64(math.MaxUint64)); obj.Type() != BIG_INTEGER_OBJ {
+		t.Errorf("large uint64 should become BIG_INTEGER. got=%s", obj.Type())
+	}
+}
+
+func TestFromGoErrors(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{1.5, "cannot convert 1.5: floating-point numbers are not supported"},
+		{math.NaN(), "cannot convert NaN: floating-point numbers are not supported"},
+		{func() {}, "cannot convert func() to a Monkey value"},
+		{map[int]string{1: "a"}, "cannot convert map[int]string: map keys must be strings"},
+		{[]interface{}{1, func() {}}, "[1]: cannot convert func() to a Monkey value"},
+		{map[string]interface{}{"f": 0.5}, `["f"]: cannot convert 0.5: floating-point numbers are not supported`},
+	}
+
+	for _, tt := range tests {
+		_, err := FromGo(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("want error %q, got %v", tt.expected, err)
+		}
+	}
+}
+
+func TestToGo(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "name"}, &String{Value: "monkey"})
+	hash.Set(&String{Value: "tags"}, &Array{Elements: []Object{&Integer{Value: 1}, NULL}})
+	mixed := NewHash()
+	mixed.Set(&Integer{Value: 1}, TRUE)
+	mixed.Set(&String{Value: "a"}, FALSE)
+	set := NewSet()
+	set.Add(&Integer{Value: 2})
+	set.Add(&Integer{Value: 1})
+
+	tests := []struct {
+		input    Object
+		expected interface{}
+	}{
+		{&Integer{Value: 5}, int64(5)},
+		{&String{Value: "s"}, "s"},
+		{TRUE, true},
+		{NULL, nil},
+		{&Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "x"}}}, []interface{}{int64(1), "x"}},
+		{hash, map[string]interface{}{"name": "monkey", "tags": []interface{}{int64(1), nil}}},
+		{mixed, map[interface{}]interface{}{int64(1): true, "a": false}},
+		{set, []interface{}{int64(2), int64(1)}},
+	}
+
+	for _, tt := range tests {
+		got, err := ToGo(tt.input)
+		if err != nil {
+			t.Errorf("ToGo(%s) failed: %s", tt.input.Inspect(), err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ToGo(%s): want=%#v, got=%#v", tt.input.Inspect(), tt.expected, got)
+		}
+	}
+
+	n, _ := ToGo(&BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 70)})
+	if n.(*big.Int).String() != "1180591620717411303424" {
+		t.Errorf("wrong big integer. got=%v", n)
+	}
+}
+
+func TestToGoErrors(t *testing.T) {
+	tests := []Object{
+		&Function{Body: nil},
+		&Builtin{Name: "len"},
+		&Range{Start: 0, Stop: 3, Step: 1},
+		&Array{Elements: []Object{&Builtin{Name: "len"}}},
+		cyclicArray(),
+	}
+
+	for _, obj := range tests {
+		_, err := ToGo(obj)
+		if err == nil || !strings.HasPrefix(err.Error(), "cannot convert ") {
+			t.Errorf("ToGo(%T) should fail. got=%v", obj, err)
+		}
+	}
+}
+
+// 要素に自身を含む配列を返す
+func cyclicArray() *Array {
+	a := &Array{Elements: []Object{NewInteger(1)}}
+	a.Elements = append(a.Elements, a)
+	return a
+}
+
+func TestGoRoundTrip(t *testing.T) {
+	original := map[string]interface{}{
+		"name":  "monkey",
+		"count": int64(3),
+		"ok":    true,
+		"none":  nil,
+		"items": []interface{}{int64(1), []interface{}{"nested", false}, map[string]interface{}{"deep": int64(-1)}},
+	}
+
+	obj, err := FromGo(original)
+	if err != nil {
+		t.Fatalf("FromGo failed: %s", err)
+	}
+	back, err := ToGo(obj)
+	if err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	if !reflect.DeepEqual(back, original) {
+		t.Errorf("round trip changed the value.\nwant=%#v\ngot =%#v", original, back)
+	}
+}
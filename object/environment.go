@@ -1,5 +1,11 @@
 package object
 
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
@@ -11,20 +17,202 @@ func NewEnvironment() *Environment {
 	return &Environment{store: s}
 }
 
+// NewEnvironmentWith は values のGoの値を FromGo で変換して束縛した環境を生成する
+// 変換できない値が複数あっても同じエラーになるよう、名前の順に変換して最初のエラーを返す
+func NewEnvironmentWith(values map[string]interface{}) (*Environment, error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := NewEnvironment()
+	for _, name := range names {
+		if err := env.SetValue(name, values[name]); err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+// NewSyncedEnvironment は複数のゴルーチンから同時に Get や Set をしてもよい環境を生成する
+// 設定値などを入れた1つの環境を、ゴルーチンごとの評価器で共有する場合に使う
+// 1回の評価自体はこれまでどおり1つのゴルーチンで行い、評価器も共有してはならない
+func NewSyncedEnvironment() *Environment {
+	env := NewEnvironment()
+	env.mu = &sync.RWMutex{}
+	return env
+}
+
+// Share は環境とその外側の環境を、NewSyncedEnvironment で生成した環境と同じく複数の goroutine から使えるようにする
+// 環境を他の goroutine に渡す前に、まだこの goroutine だけが使っている間に呼ぶ
+func (e *Environment) Share() {
+	for env := e; env != nil; env = env.outer {
+		if env.mu == nil {
+			env.mu = &sync.RWMutex{}
+		}
+	}
+}
+
+// ShareValue は obj からたどれる関数の環境をすべて Share する
+// 環境に束縛された値もたどるので、関数が呼ぶ別の関数の環境も含まれる
+func ShareValue(obj Object) {
+	shareValue(obj, map[interface{}]bool{})
+}
+
+// seen はたどった値と環境
+func shareValue(obj Object, seen map[interface{}]bool) {
+	switch obj := obj.(type) {
+	case *Function:
+		if seen[obj] {
+			return
+		}
+		seen[obj] = true
+		for env := obj.Env; env != nil && !seen[env]; env = env.outer {
+			seen[env] = true
+			env.Share()
+			for _, value := range env.All(false) {
+				shareValue(value, seen)
+			}
+		}
+	case *Array:
+		if seen[obj] {
+			return
+		}
+		seen[obj] = true
+		for _, el := range obj.Elements {
+			shareValue(el, seen)
+		}
+	case *Hash:
+		if seen[obj] {
+			return
+		}
+		seen[obj] = true
+		for _, key := range obj.Order {
+			shareValue(obj.Pairs[key].Value, seen)
+		}
+	case *Module:
+		shareValue(obj.Members, seen)
+		shareValue(obj.Value, seen)
+	}
+}
+
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	// NewSyncedEnvironment で生成した場合だけ store を保護する。それ以外は nil
+	mu *sync.RWMutex
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
+	if e.mu != nil {
+		e.mu.RLock()
+	}
 	obj, ok := e.store[name]
+	if e.mu != nil {
+		e.mu.RUnlock()
+	}
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
 	return obj, ok
 }
 
+// HasLocal は現在のスコープで name が束縛されていればtrueを返す。外側のスコープは調べない
+func (e *Environment) HasLocal(name string) bool {
+	if e.mu != nil {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+	}
+	_, ok := e.store[name]
+	return ok
+}
+
+// Set は現在のスコープで name に obj を束縛し、obj を返す
+// 同じスコープにすでに束縛されている場合は置き換える。外側のスコープは変更しない
+// スクリプトの let 文も同じ動作なので、評価前に設定した値はトップレベルの let で上書きされ、
+// 評価後の Get ではスクリプトが最後に束縛した値が返る
+// 同期された環境に束縛した値は ShareValue で共有する
 func (e *Environment) Set(name string, obj Object) Object {
+	if e.mu != nil {
+		// 同期された環境の値は他の goroutine からも呼ばれうるので、束縛する関数の環境も同期する
+		ShareValue(obj)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+	}
 	e.store[name] = obj
 	return obj
 }
+
+// SetValue はGoの値 v を FromGo で変換して現在のスコープの name に束縛する
+func (e *Environment) SetValue(name string, v interface{}) error {
+	obj, err := FromGo(v)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	e.Set(name, obj)
+	return nil
+}
+
+// GetValue は name の値を ToGo でGoの値に変換して返す
+// 束縛されていない場合や変換できない場合はエラーを返す
+func (e *Environment) GetValue(name string) (interface{}, error) {
+	obj, ok := e.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%s: not defined", name)
+	}
+	v, err := ToGo(obj)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return v, nil
+}
+
+// GetAll は Get で参照できるすべての束縛（外側のスコープを含む）のコピーを返す
+func (e *Environment) GetAll() map[string]Object {
+	return e.All(true)
+}
+
+// Outer は外側の環境を返す。最も外側の環境では nil
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Names は現在のスコープで束縛されている名前を辞書順で返す
+// 外側のスコープの名前は含まない
+func (e *Environment) Names() []string {
+	if e.mu != nil {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+	}
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// All は束縛されている名前と値のコピーを返す
+// includeOuter が true の場合は外側のスコープもたどり、同じ名前は内側の値を優先する
+// 組み込み関数は評価器が持っているので含まない
+func (e *Environment) All(includeOuter bool) map[string]Object {
+	all := make(map[string]Object)
+	for env := e; env != nil; env = env.outer {
+		if env.mu != nil {
+			env.mu.RLock()
+		}
+		for name, obj := range env.store {
+			if _, ok := all[name]; !ok {
+				all[name] = obj
+			}
+		}
+		if env.mu != nil {
+			env.mu.RUnlock()
+		}
+		if !includeOuter {
+			break
+		}
+	}
+	return all
+}
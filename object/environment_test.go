@@ -0,0 +1,168 @@
+package object
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestEnvironmentIntrospection(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("b", &Integer{Value: 1})
+	global.Set("a", &Integer{Value: 2})
+	local := NewEnclosedEnvironment(global)
+	local.Set("c", &Integer{Value: 3})
+	local.Set("a", &Integer{Value: 4})
+
+	if got := global.Names(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("wrong global names. got=%v", got)
+	}
+	if got := local.Names(); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Errorf("wrong local names. got=%v", got)
+	}
+	if local.Outer() != global || global.Outer() != nil {
+		t.Errorf("wrong outer environments")
+	}
+
+	tests := []struct {
+		includeOuter bool
+		expected     map[string]int64
+	}{
+		{false, map[string]int64{"a": 4, "c": 3}},
+		{true, map[string]int64{"a": 4, "b": 1, "c": 3}},
+	}
+	for _, tt := range tests {
+		all := local.All(tt.includeOuter)
+		got := map[string]int64{}
+		for name, obj := range all {
+			got[name] = obj.(*Integer).Value
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("All(%t): want=%v, got=%v", tt.includeOuter, tt.expected, got)
+		}
+	}
+
+	// 返した map を変更しても環境には影響しない
+	local.All(false)["d"] = &Integer{Value: 5}
+	if _, ok := local.Get("d"); ok {
+		t.Errorf("All should return a copy")
+	}
+}
+
+func TestSyncedEnvironmentConcurrentAccess(t *testing.T) {
+	shared := NewSyncedEnvironment()
+	shared.Set("config", &Integer{Value: 0})
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			// 関数呼び出しと同じく、同期されていない内側の環境から外側をたどる
+			local := NewEnclosedEnvironment(shared)
+			for j := 0; j < 100; j++ {
+				local.Set("x", &Integer{Value: int64(j)})
+				if _, ok := local.Get("config"); !ok {
+					t.Errorf("config not found")
+					return
+				}
+				local.All(true)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(done)
+		for i := 1; i <= 1000; i++ {
+			shared.Set("config", &Integer{Value: int64(i)})
+			shared.Names()
+		}
+	}()
+
+	readers.Wait()
+	<-done
+	if obj, _ := shared.Get("config"); obj.(*Integer).Value != 1000 {
+		t.Errorf("wrong final value. got=%d", obj.(*Integer).Value)
+	}
+}
+
+// 同期された環境に後から束縛したクロージャの環境も同期される
+// go test -race で、クロージャを呼ぶ goroutine と環境を書き換える goroutine が競合しないことを確かめる
+func TestSyncedEnvironmentSharesBoundClosures(t *testing.T) {
+	shared := NewSyncedEnvironment()
+	local := NewEnclosedEnvironment(shared)
+	local.Set("x", &Integer{Value: 0})
+	shared.Set("f", &Function{Env: local})
+	shared.Set("fs", &Array{Elements: []Object{&Function{Env: NewEnclosedEnvironment(local)}}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, _ := shared.Get("f")
+			fs, _ := shared.Get("fs")
+			for j := 0; j < 100; j++ {
+				f.(*Function).Env.Get("x")
+				fs.(*Array).Elements[0].(*Function).Env.Get("x")
+			}
+		}()
+	}
+	for i := 1; i <= 100; i++ {
+		local.Set("x", &Integer{Value: int64(i)})
+	}
+	wg.Wait()
+
+	if local.mu == nil {
+		t.Errorf("environment of a closure bound in a synced environment should be synced")
+	}
+}
+
+func TestEnvironmentGoValues(t *testing.T) {
+	env, err := NewEnvironmentWith(map[string]interface{}{
+		"n":     1,
+		"names": []string{"a", "b"},
+	})
+	if err != nil {
+		t.Fatalf("NewEnvironmentWith failed: %s", err)
+	}
+
+	n, err := env.GetValue("n")
+	if err != nil || n != int64(1) {
+		t.Errorf("wrong n. got=%#v, %v", n, err)
+	}
+	names, err := env.GetValue("names")
+	if err != nil || !reflect.DeepEqual(names, []interface{}{"a", "b"}) {
+		t.Errorf("wrong names. got=%#v, %v", names, err)
+	}
+
+	if err := env.SetValue("f", func() {}); err == nil || err.Error() != "f: cannot convert func() to a Monkey value" {
+		t.Errorf("wrong SetValue error. got=%v", err)
+	}
+	if _, err := env.GetValue("missing"); err == nil || err.Error() != "missing: not defined" {
+		t.Errorf("wrong GetValue error. got=%v", err)
+	}
+	env.Set("fn", &Builtin{Name: "len"})
+	if _, err := env.GetValue("fn"); err == nil || err.Error() != "fn: cannot convert builtin to a Go value" {
+		t.Errorf("wrong GetValue error. got=%v", err)
+	}
+
+	if _, err := NewEnvironmentWith(map[string]interface{}{"bad": 0.5}); err == nil {
+		t.Errorf("NewEnvironmentWith should fail for floats")
+	}
+	// 変換できない値が複数あれば、名前が最初のもののエラーを返す
+	for i := 0; i < 20; i++ {
+		_, err := NewEnvironmentWith(map[string]interface{}{"c": 0.5, "a": func() {}, "b": 1.5})
+		if err == nil || err.Error() != "a: cannot convert func() to a Monkey value" {
+			t.Fatalf("wrong NewEnvironmentWith error. got=%v", err)
+		}
+	}
+
+	local := NewEnclosedEnvironment(env)
+	local.Set("n", &Integer{Value: 2})
+	all := local.GetAll()
+	if len(all) != 3 || all["n"].(*Integer).Value != 2 {
+		t.Errorf("wrong GetAll. got=%v", all)
+	}
+}
@@ -0,0 +1,174 @@
+package object
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 1つの配列・ハッシュ・集合について Inspect で表示する要素数の上限。超えた分は … にまとめる
+const inspectMaxElements = 1000
+
+// Pretty で1段の字下げに使う空白
+const prettyIndent = "  "
+
+// PrettyWidth は inspect(x, true) と REPL の :pretty で使う1行の文字数
+const PrettyWidth = 80
+
+// FormatNumber は数値 obj を表示する文字列を返す。obj が数値でなければ ok は false
+// Inspect・puts・inspect()・REPLの表示など、数値を表示する処理はすべてここを通す
+//
+// 整数は大きさによらず、小数点も指数も付けずに10進で書く（BigInteger も同じ）
+// 浮動小数点数を加えるときもここで書く。整数と区別できるよう常に小数点か指数を付け（1 ではなく 1.0）、
+// 非常に大きい値と小さい値は指数表記に、NaN と無限大は nan・inf・-inf にする
+func FormatNumber(obj Object) (s string, ok bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return strconv.FormatInt(obj.Value, 10), true
+	case *BigInteger:
+		return obj.Value.String(), true
+	default:
+		return "", false
+	}
+}
+
+// inspector は配列・ハッシュ・集合を表示する
+// 配列とハッシュは要素に自身を含められるので、表示途中のものを visiting に記録し、
+// 再び現れたら [...] や {...} と表示する
+type inspector struct {
+	visiting map[Object]bool
+	// 0より大きければ、この文字数に収まらない配列・ハッシュ・集合を複数行に分ける
+	width int
+	// true なら要素数の上限を設けずにすべて表示する
+	all bool
+}
+
+func inspect(obj Object) string {
+	var out strings.Builder
+	in := &inspector{visiting: map[Object]bool{}}
+	in.write(&out, obj, 0, 0)
+	return out.String()
+}
+
+// Pretty は obj を Inspect と同じ形で返す
+// ただし width 文字に収まらない配列・ハッシュ・集合は、要素を1行に1つずつ、深さごとに2つの空白で字下げして並べる
+func Pretty(obj Object, width int) string {
+	switch obj.(type) {
+	case *Array, *Hash, *Set:
+		var out strings.Builder
+		in := &inspector{visiting: map[Object]bool{}, width: width}
+		in.write(&out, obj, 0, 0)
+		return out.String()
+	default:
+		return obj.Inspect()
+	}
+}
+
+// InspectAll は obj を Pretty(obj, width) と同じ形で返すが、要素数の上限を設けない。width が0なら1行で書く
+// 巨大な値をすべて表示したいとき（REPL の :full など）に使う
+func InspectAll(obj Object, width int) string {
+	switch obj.(type) {
+	case *Array, *Hash, *Set:
+		var out strings.Builder
+		in := &inspector{visiting: map[Object]bool{}, width: width, all: true}
+		in.write(&out, obj, 0, 0)
+		return out.String()
+	default:
+		return obj.Inspect()
+	}
+}
+
+// write は obj を out に書く。depth は複数行に分けたときの字下げの深さ、col は書き始める桁
+func (in *inspector) write(out *strings.Builder, obj Object, depth, col int) {
+	switch obj := obj.(type) {
+	case *String:
+		// 要素の文字列は、区切りや他の型の値と見分けられるように引用符で囲む
+		out.WriteString(strconv.Quote(obj.Value))
+	case *Array:
+		if in.visiting[obj] {
+			out.WriteString("[...]")
+			return
+		}
+		in.visiting[obj] = true
+		defer delete(in.visiting, obj)
+
+		in.writeElements(out, "[", "]", len(obj.Elements), depth, col, func(in *inspector, out *strings.Builder, i, depth, col int) {
+			in.write(out, obj.Elements[i], depth, col)
+		})
+	case *Hash:
+		if in.visiting[obj] {
+			out.WriteString("{...}")
+			return
+		}
+		in.visiting[obj] = true
+		defer delete(in.visiting, obj)
+
+		pairs := obj.OrderedPairs()
+		in.writeElements(out, "{", "}", len(pairs), depth, col, func(in *inspector, out *strings.Builder, i, depth, col int) {
+			// キーは不変なオブジェクトなので循環せず、複数行にもならない
+			var key strings.Builder
+			in.write(&key, pairs[i].Key, depth, col)
+			out.WriteString(key.String())
+			out.WriteString(":")
+			in.write(out, pairs[i].Value, depth, col+utf8.RuneCountInString(key.String())+1)
+		})
+	case *Set:
+		members := obj.Members()
+		in.writeElements(out, "set{", "}", len(members), depth, col, func(in *inspector, out *strings.Builder, i, depth, col int) {
+			in.write(out, members[i], depth, col)
+		})
+	default:
+		out.WriteString(obj.Inspect())
+	}
+}
+
+// writeElements は n 個の要素を open と close で囲んで書く。要素は element で書く
+// 上限を超えた要素は … にまとめる
+func (in *inspector) writeElements(out *strings.Builder, open, close string, n, depth, col int, element func(in *inspector, out *strings.Builder, i, depth, col int)) {
+	truncated := !in.all && n > inspectMaxElements
+	if truncated {
+		n = inspectMaxElements + 1
+	}
+	writeElement := func(in *inspector, out *strings.Builder, i, depth, col int) {
+		if truncated && i == inspectMaxElements {
+			out.WriteString("…")
+			return
+		}
+		element(in, out, i, depth, col)
+	}
+
+	if in.width > 0 && n > 0 {
+		// 1行に収まるかを確かめるため、まず1行で書いてみる
+		var line strings.Builder
+		compact := &inspector{visiting: in.visiting, all: in.all}
+		compact.writeElements(&line, open, close, n, depth, col, writeElement)
+		if col+utf8.RuneCountInString(line.String()) <= in.width {
+			out.WriteString(line.String())
+			return
+		}
+
+		indent := strings.Repeat(prettyIndent, depth+1)
+		out.WriteString(open)
+		for i := 0; i < n; i++ {
+			out.WriteString("\n")
+			out.WriteString(indent)
+			writeElement(in, out, i, depth+1, len(indent))
+			if i < n-1 {
+				out.WriteString(",")
+			}
+		}
+		out.WriteString("\n")
+		out.WriteString(strings.Repeat(prettyIndent, depth))
+		out.WriteString(close)
+		return
+	}
+
+	out.WriteString(open)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		writeElement(in, out, i, depth, col)
+	}
+	out.WriteString(close)
+}
@@ -0,0 +1,97 @@
+package object
+
+// Iterator はコレクションの要素を順に返す
+type Iterator interface {
+	// Next は次の要素のキーと値を返す。要素が残っていない場合はokがfalse
+	Next() (key Object, value Object, ok bool)
+}
+
+// Iterable は for-in や map などで要素を順に取り出せるオブジェクト
+// 配列と文字列のキーは添字、ハッシュのキーはハッシュのキー、集合のキーは添字になる
+type Iterable interface {
+	Iter() Iterator
+}
+
+type arrayIterator struct {
+	elements []Object
+	index    int
+}
+
+func (it *arrayIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.elements) {
+		return nil, nil, false
+	}
+	key := NewInteger(int64(it.index))
+	value := it.elements[it.index]
+	it.index++
+	return key, value, true
+}
+
+// Iter は要素を添字の順に返す。反復中に追加された要素も返す
+func (a *Array) Iter() Iterator {
+	return &arrayIterator{elements: a.Elements}
+}
+
+type stringIterator struct {
+	runes []rune
+	index int
+}
+
+func (it *stringIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.runes) {
+		return nil, nil, false
+	}
+	key := NewInteger(int64(it.index))
+	value := &String{Value: string(it.runes[it.index])}
+	it.index++
+	return key, value, true
+}
+
+// Iter は1文字（rune）ずつ1文字の文字列として返す
+func (s *String) Iter() Iterator {
+	return &stringIterator{runes: []rune(s.Value)}
+}
+
+type hashIterator struct {
+	pairs []HashPair
+	index int
+}
+
+func (it *hashIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.pairs) {
+		return nil, nil, false
+	}
+	pair := it.pairs[it.index]
+	it.index++
+	return pair.Key, pair.Value, true
+}
+
+// Iter はキーと値の組を挿入した順に返す
+func (h *Hash) Iter() Iterator {
+	return &hashIterator{pairs: h.OrderedPairs()}
+}
+
+// Iter は要素を追加した順に返す
+func (s *Set) Iter() Iterator {
+	return &arrayIterator{elements: s.Members()}
+}
+
+type rangeIterator struct {
+	r     *Range
+	index int64
+}
+
+func (it *rangeIterator) Next() (Object, Object, bool) {
+	value, ok := it.r.At(it.index)
+	if !ok {
+		return nil, nil, false
+	}
+	key := NewInteger(it.index)
+	it.index++
+	return key, NewInteger(value), true
+}
+
+// Iter は要素を1つずつ計算して返す
+func (r *Range) Iter() Iterator {
+	return &rangeIterator{r: r}
+}
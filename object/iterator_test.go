@@ -0,0 +1,42 @@
+package object
+
+import "testing"
+
+func TestIterables(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "b"}, &Integer{Value: 1})
+	hash.Set(&String{Value: "a"}, &Integer{Value: 2})
+
+	set := NewSet()
+	set.Add(&Integer{Value: 3})
+	set.Add(&String{Value: "x"})
+
+	tests := []struct {
+		iterable Iterable
+		expected []string
+	}{
+		{&Array{Elements: []Object{&Integer{Value: 5}, &String{Value: "s"}}}, []string{"0:5", "1:s"}},
+		{&Array{}, []string{}},
+		{&String{Value: "aé"}, []string{"0:a", "1:é"}},
+		{&String{Value: ""}, []string{}},
+		{hash, []string{"b:1", "a:2"}},
+		{set, []string{"0:3", "1:x"}},
+	}
+
+	for _, tt := range tests {
+		got := []string{}
+		it := tt.iterable.Iter()
+		for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+			got = append(got, key.Inspect()+":"+value.Inspect())
+		}
+		if len(got) != len(tt.expected) {
+			t.Errorf("wrong number of elements. want=%v, got=%v", tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("element %d wrong. want=%q, got=%q", i, tt.expected[i], got[i])
+			}
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math/big"
 	"monkey/ast"
+	"sort"
 	"strings"
 )
 
@@ -21,6 +23,17 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	SET_OBJ          = "SET"
+	RANGE_OBJ        = "RANGE"
+	BIG_INTEGER_OBJ  = "BIG_INTEGER"
+	QUOTE_OBJ        = "QUOTE"
+	MODULE_OBJ       = "MODULE"
+	TASK_OBJ         = "TASK"
+	CHANNEL_OBJ      = "CHANNEL"
+
+	STRING_BUILDER_OBJ = "STRING_BUILDER"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type Object interface {
@@ -40,18 +53,187 @@ func (s *String) Inspect() string {
 	return fmt.Sprintf("%s", s.Value)
 }
 
+// StringBuilder は文字列を少しずつ書き足すためのバッファ
+// s + piece を繰り返すと毎回全体を複製するが、これは書き足した分だけ複製する
+// builder() で作り、append で書き足し、build で文字列にする
+type StringBuilder struct {
+	builder strings.Builder
+	// trueなら書き足せない
+	Frozen bool
+}
+
+// WriteString は s を末尾に書き足す
+func (sb *StringBuilder) WriteString(s string) {
+	sb.builder.WriteString(s)
+}
+
+// String はこれまでに書き足した文字列を返す
+func (sb *StringBuilder) String() string {
+	return sb.builder.String()
+}
+
+// Len はこれまでに書き足したバイト数を返す
+func (sb *StringBuilder) Len() int {
+	return sb.builder.Len()
+}
+
+func (sb *StringBuilder) Type() ObjectType {
+	return STRING_BUILDER_OBJ
+}
+
+func (sb *StringBuilder) Inspect() string {
+	return fmt.Sprintf("builder(%d bytes)", sb.Len())
+}
+
+// Integer は整数。小さい値は NewInteger で共有するので、作った後に Value を書き換えてはならない
 type Integer struct {
 	Value int64
 }
 
+// 共有する整数の範囲
+const (
+	minSharedInteger = -128
+	maxSharedInteger = 1024
+)
+
+var sharedIntegers = func() []*Integer {
+	ints := make([]*Integer, maxSharedInteger-minSharedInteger+1)
+	for i := range ints {
+		ints[i] = &Integer{Value: int64(i + minSharedInteger)}
+	}
+	return ints
+}()
+
+// NewInteger は値が value の Integer を返す
+// -128 から 1024 までは毎回同じオブジェクトを返し、割り当てを減らす
+func NewInteger(value int64) *Integer {
+	if value >= minSharedInteger && value <= maxSharedInteger {
+		return sharedIntegers[value-minSharedInteger]
+	}
+	return &Integer{Value: value}
+}
+
 func (i *Integer) Type() ObjectType {
 	return INTEGER_OBJ
 }
 
 func (i *Integer) Inspect() string {
-	return fmt.Sprintf("%d", i.Value)
+	s, _ := FormatNumber(i)
+	return s
 }
 
+// BigInteger はint64に収まらない整数
+// 評価器は演算結果がint64に収まる場合は Integer に戻すので、同じ値が Integer と BigInteger の両方で表されることはない
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (i *BigInteger) Type() ObjectType {
+	return BIG_INTEGER_OBJ
+}
+
+func (i *BigInteger) Inspect() string {
+	s, _ := FormatNumber(i)
+	return s
+}
+
+// Module は import で読み込んだファイル
+// Members はファイルのトップレベルの束縛を名前順に並べたもの
+type Module struct {
+	// ファイルの絶対パス
+	Path    string
+	Members *Hash
+	// ファイルがトップレベルの return で返した値。return しなかった場合は nil
+	// 値を返したモジュールは、束縛の代わりにこの値を公開する
+	Value Object
+}
+
+func (m *Module) Type() ObjectType {
+	return MODULE_OBJ
+}
+
+func (m *Module) Inspect() string {
+	return "module(" + m.Path + ")"
+}
+
+// Task は spawn で別の goroutine で評価している関数
+// 評価が終わると Finish で結果を設定し、Done を閉じる
+type Task struct {
+	done   chan struct{}
+	result Object
+}
+
+// NewTask は評価中の Task を生成する
+func NewTask() *Task {
+	return &Task{done: make(chan struct{})}
+}
+
+// Finish は評価の結果を設定する。1つの Task で1回だけ呼ぶ
+func (t *Task) Finish(result Object) {
+	t.result = result
+	close(t.done)
+}
+
+// Done は評価が終わると閉じられるチャネルを返す
+func (t *Task) Done() <-chan struct{} {
+	return t.done
+}
+
+// Result は評価の結果を返す。Done が閉じられる前は nil
+func (t *Task) Result() Object {
+	select {
+	case <-t.done:
+		return t.result
+	default:
+		return nil
+	}
+}
+
+func (t *Task) Type() ObjectType {
+	return TASK_OBJ
+}
+
+func (t *Task) Inspect() string {
+	if t.Result() == nil {
+		return "task(running)"
+	}
+	return "task(done)"
+}
+
+// Channel は goroutine の間で値を受け渡すバッファ付きのチャネル
+type Channel struct {
+	Values chan Object
+}
+
+func (c *Channel) Type() ObjectType {
+	return CHANNEL_OBJ
+}
+
+func (c *Channel) Inspect() string {
+	return fmt.Sprintf("channel(%d/%d)", len(c.Values), cap(c.Values))
+}
+
+// Quote は quote で評価せずに取り出した構文木
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType {
+	return QUOTE_OBJ
+}
+
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// 真偽値とnullは値ごとに1つのインスタンスを使いまわす
+// 評価器は == をインスタンスが同じかどうかで判定するので、これ以外のインスタンスを作ってはならない
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
 type Boolean struct {
 	Value bool
 }
@@ -87,8 +269,68 @@ func (i *ReturnValue) Inspect() string {
 	return i.Value.Inspect()
 }
 
+// StackFrame は呼び出し履歴中の1つの関数呼び出しを表す
+type StackFrame struct {
+	// 関数名。無名関数の場合は <anonymous>
+	Function string
+	// 呼び出し箇所の位置（evalで評価した文字列の中の場合は0）
+	Line   int
+	Column int
+}
+
+func (f StackFrame) String() string {
+	if f.Line == 0 {
+		// 位置を記録しない入力（evalで評価した文字列）の中での呼び出し
+		return fmt.Sprintf("at %s (in eval)", f.Function)
+	}
+	return fmt.Sprintf("at %s (line %d, column %d)", f.Function, f.Line, f.Column)
+}
+
+// ErrorKind はエラーの種類。try/catch や埋め込み側がメッセージを解析せずに区別するために使う
+type ErrorKind string
+
+const (
+	// 演算や引数の型が合わない
+	TypeError ErrorKind = "TypeError"
+	// 変数やモジュールのメンバーが見つからない
+	NameError ErrorKind = "NameError"
+	// 空の配列から取り出すなど、添字や位置が範囲外
+	IndexError ErrorKind = "IndexError"
+	// 型は合っているが値が使えない
+	ValueError ErrorKind = "ValueError"
+	// 引数の個数が合わない
+	ArityError ErrorKind = "ArityError"
+	// 0で割った
+	DivisionByZero ErrorKind = "DivisionByZero"
+	// モジュールを読み込めない
+	ImportError ErrorKind = "ImportError"
+	// eval などに渡した文字列を構文解析できない
+	SyntaxError ErrorKind = "SyntaxError"
+	// 再帰の深さや実行ステップ数の上限、キャンセルによる中断
+	LimitError ErrorKind = "LimitError"
+	// error() でユーザーが作ったエラーの既定の種類
+	Custom ErrorKind = "Custom"
+	// throw() で値を投げた
+	Thrown ErrorKind = "Thrown"
+	// assert() の条件が偽だった
+	AssertionError ErrorKind = "AssertionError"
+)
+
 type Error struct {
+	// エラーの種類（exit() やコンパイルエラーなどでは空）
+	Kind    ErrorKind
 	Message string
+	// throw() で投げた値（それ以外のエラーでは nil）。catch ではこの値をそのまま束縛する
+	Value Object
+	// エラーの原因となった式の位置（不明な場合は0）
+	Line   int
+	Column int
+	// エラー発生時の呼び出し履歴（内側の呼び出しが先頭）
+	Stack []StackFrame
+	// exit() による終了の場合はtrue。エラーと同じように評価を中断させる
+	Exit bool
+	// exit() に渡された終了コード
+	ExitCode int
 }
 
 func (i *Error) Type() ObjectType {
@@ -96,41 +338,98 @@ func (i *Error) Type() ObjectType {
 }
 
 func (i *Error) Inspect() string {
-	return "ERROR: " + i.Message
+	message := i.Message
+	if i.Kind != "" {
+		message = string(i.Kind) + ": " + message
+	}
+	if i.Line > 0 {
+		return fmt.Sprintf("ERROR: line %d, column %d: %s", i.Line, i.Column, message)
+	}
+	return "ERROR: " + message
+}
+
+// StackTrace で先頭と末尾それぞれに表示するフレーム数の上限
+const stackTraceEdge = 10
+
+// StackTrace は呼び出し履歴を1行1フレームで返す。履歴がない場合は空文字列
+// 深い再帰などでフレームが多すぎる場合は中間を省略する
+func (i *Error) StackTrace() string {
+	var out bytes.Buffer
+	for n, frame := range i.Stack {
+		if len(i.Stack) > stackTraceEdge*2 && n >= stackTraceEdge && n < len(i.Stack)-stackTraceEdge {
+			if n == stackTraceEdge {
+				out.WriteString(fmt.Sprintf("  ... %d more frames ...\n", len(i.Stack)-stackTraceEdge*2))
+			}
+			continue
+		}
+		out.WriteString("  " + frame.String() + "\n")
+	}
+	return out.String()
 }
 
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	// let文で束縛された関数の名前（無名の場合は空）
+	Name string
 }
 
 func (f *Function) Type() ObjectType {
 	return FUNCTION_OBJ
 }
 
+// Inspect は関数名と引数だけを返す。本体を含めた表示は InspectVerbose を使う
+//
+//	fn add(a, b) { ... }
 func (f *Function) Inspect() string {
+	return f.signature() + " { ... }"
+}
+
+// InspectVerbose は本体を含めた関数全体を返す
+func (f *Function) InspectVerbose() string {
 	var out bytes.Buffer // Bufferは初期化なしでいきなり使える
 
+	out.WriteString(f.signature())
+	out.WriteString(" {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// fn name(a, b) の部分。無名関数の場合は fn(a, b)
+func (f *Function) signature() string {
 	params := []string{}
 	for _, p := range f.Parameters {
 		params = append(params, p.String())
 	}
 
-	out.WriteString("fn")
-	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
-	out.WriteString("\n}")
+	name := ""
+	if f.Name != "" {
+		name = " " + f.Name
+	}
+	return "fn" + name + "(" + strings.Join(params, ", ") + ")"
+}
 
-	return out.String()
+// VerboseInspector は詳細な表示を持つオブジェクト
+type VerboseInspector interface {
+	InspectVerbose() string
 }
 
 type BuiltinFunction func(args ...Object) Object
 
+// Callable はMonkeyから関数として呼び出せる、埋め込み側で定義したオブジェクト
+// データベースの接続などの振る舞いを持つ値を環境に渡す場合に使う
+type Callable interface {
+	Object
+	Call(args []Object) Object
+}
+
 type Builtin struct {
 	Fn BuiltinFunction
+	// 組み込み関数の名前
+	Name string
 }
 
 func (b *Builtin) Type() ObjectType {
@@ -138,40 +437,53 @@ func (b *Builtin) Type() ObjectType {
 }
 
 func (b *Builtin) Inspect() string {
-	return "buildin function"
+	return "builtin fn: " + b.Name
 }
 
 type Array struct {
 	Elements []Object
+	// trueなら要素を書き換えられない
+	Frozen bool
 }
 
 func (a *Array) Type() ObjectType {
 	return ARRAY_OBJ
 }
 
+// Inspect は要素を表示する。循環している部分は [...] に、上限を超えた要素は … にまとめる
 func (a *Array) Inspect() string {
-	var out bytes.Buffer
-
-	elements := []string{}
-	for _, el := range a.Elements {
-		elements = append(elements, el.Inspect())
-	}
-
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
-	return out.String()
+	return inspect(a)
 }
 
+// HashKey はハッシュのキーとして使う値
+// 型も含めて比較するので、整数の1と真偽値のtrue、文字列の"1"はそれぞれ別のキーになる
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
 }
 
+// Hashable はハッシュのキーや集合の要素に使えるオブジェクト
+// 同じ型で値が等しいオブジェクトは同じ HashKey を返さなければならない
+//
+// 挿入した後でキーの値が変わると HashKey も変わって見つからなくなるので、
+// Hashable にするのは作った後で値が変わらない Integer・BigInteger・Boolean・String だけにする
+// 配列・ハッシュ・集合は freeze しても、関数は捕捉した環境が変わりうるので Hashable にしない
+// NULL は get や ?[ ] がキーのないことを表すのに返す値なので、キーにはできない
 type Hashable interface {
 	HashKey() HashKey
 }
 
+// CheckHashKey は key がハッシュのキーや集合の要素に使えなければ TypeError を返す
+// ハッシュリテラル・添字・スナップショットの読み込みで同じメッセージにするために使う
+//
+//	unusable as hash key: ARRAY
+func CheckHashKey(key Object) *Error {
+	if _, ok := key.(Hashable); ok {
+		return nil
+	}
+	return &Error{Kind: TypeError, Message: fmt.Sprintf("unusable as hash key: %s", key.Type())}
+}
+
 func (b *Boolean) HashKey() HashKey {
 	var value uint64
 
@@ -187,6 +499,14 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// 10進表記のFNV-1aの64ビットのハッシュ値を使う
+func (i *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(i.Value.String()))
+	return HashKey{Type: i.Type(), Value: h.Sum64()}
+}
+
+// 文字列はFNV-1aの64ビットのハッシュ値を使う
 func (str *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(str.Value))
@@ -198,25 +518,233 @@ type HashPair struct {
 	Value Object
 }
 
+// Hash はキーを挿入した順序を保つハッシュ
+// Pairsを直接書き換えると順序が失われるので、要素の追加と削除は Set と Delete を使う
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	// Pairsのキーを挿入した順に並べたもの
+	Order []HashKey
+	// trueなら組を追加・削除できない
+	Frozen bool
+}
+
+// NewHash は空のハッシュを生成する
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+// Set はキーと値の組を追加する。既存のキーの場合は値だけを置き換え、順序は変えない
+// keyは Hashable でなければならない（CheckHashKey で確かめてから呼ぶ）
+func (h *Hash) Set(key Object, value Object) {
+	hashKey := key.(Hashable).HashKey()
+	if h.Pairs == nil {
+		h.Pairs = make(map[HashKey]HashPair)
+	}
+	if _, exists := h.Pairs[hashKey]; !exists {
+		h.Order = append(h.Order, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key, Value: value}
+}
+
+// Delete はキーの組を削除する。削除した場合はtrueを返す
+func (h *Hash) Delete(hashKey HashKey) bool {
+	if _, exists := h.Pairs[hashKey]; !exists {
+		return false
+	}
+	delete(h.Pairs, hashKey)
+	for i, key := range h.Order {
+		if key == hashKey {
+			h.Order = append(h.Order[:i], h.Order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// OrderedPairs はキーと値の組を挿入した順に返す
+// Set を使わずにPairsへ直接入れた組は、キーの表示順に並べて最後に加える
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	ordered := make(map[HashKey]bool, len(h.Order))
+	for _, key := range h.Order {
+		if pair, ok := h.Pairs[key]; ok && !ordered[key] {
+			pairs = append(pairs, pair)
+			ordered[key] = true
+		}
+	}
+	if len(pairs) == len(h.Pairs) {
+		return pairs
+	}
+
+	var rest []HashKey
+	for key := range h.Pairs {
+		if !ordered[key] {
+			rest = append(rest, key)
+		}
+	}
+	sortKeys(rest, func(key HashKey) Object { return h.Pairs[key].Key })
+	for _, key := range rest {
+		pairs = append(pairs, h.Pairs[key])
+	}
+	return pairs
+}
+
+// sortKeys は挿入した順が分からないキーを、キーの表示・型・ハッシュ値の順に並べる
+// Goのマップを回す順は毎回変わるので、"1" と 1 のように表示が同じキーも順を決めておく
+func sortKeys(keys []HashKey, object func(HashKey) Object) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := object(keys[i]).Inspect(), object(keys[j]).Inspect()
+		if a != b {
+			return a < b
+		}
+		if keys[i].Type != keys[j].Type {
+			return keys[i].Type < keys[j].Type
+		}
+		return keys[i].Value < keys[j].Value
+	})
 }
 
 func (h *Hash) Type() ObjectType {
 	return HASH_OBJ
 }
 
+// Inspect は組を表示する。循環している部分は {...} に、上限を超えた組は … にまとめる
 func (h *Hash) Inspect() string {
-	var out bytes.Buffer
+	return inspect(h)
+}
 
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s:%s", pair.Key.Inspect(), pair.Value.Inspect()))
+// Set は重複のない値の集まり。要素は Hashable でなければならず、追加した順序を保つ
+type Set struct {
+	Elements map[HashKey]Object
+	// Elementsのキーを追加した順に並べたもの
+	Order []HashKey
+	// trueなら要素を追加・削除できない
+	Frozen bool
+}
+
+// NewSet は空の集合を生成する
+func NewSet() *Set {
+	return &Set{Elements: make(map[HashKey]Object)}
+}
+
+// Add は要素を追加する。すでにある場合は何もしない
+// elementは Hashable でなければならない（CheckHashKey で確かめてから呼ぶ）
+func (s *Set) Add(element Object) {
+	key := element.(Hashable).HashKey()
+	if _, exists := s.Elements[key]; exists {
+		return
+	}
+	if s.Elements == nil {
+		s.Elements = make(map[HashKey]Object)
 	}
+	s.Elements[key] = element
+	s.Order = append(s.Order, key)
+}
 
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
+// Has は要素が含まれているかを返す
+func (s *Set) Has(key HashKey) bool {
+	_, ok := s.Elements[key]
+	return ok
+}
 
-	return out.String()
+// Remove は要素を取り除く。取り除いた場合はtrueを返す
+func (s *Set) Remove(key HashKey) bool {
+	if _, exists := s.Elements[key]; !exists {
+		return false
+	}
+	delete(s.Elements, key)
+	for i, k := range s.Order {
+		if k == key {
+			s.Order = append(s.Order[:i], s.Order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Members は要素を追加した順に返す
+// Add を使わずにElementsへ直接入れた要素は、表示順に並べて最後に加える
+func (s *Set) Members() []Object {
+	members := make([]Object, 0, len(s.Elements))
+	ordered := make(map[HashKey]bool, len(s.Order))
+	for _, key := range s.Order {
+		if el, ok := s.Elements[key]; ok && !ordered[key] {
+			members = append(members, el)
+			ordered[key] = true
+		}
+	}
+	if len(members) == len(s.Elements) {
+		return members
+	}
+
+	var rest []HashKey
+	for key := range s.Elements {
+		if !ordered[key] {
+			rest = append(rest, key)
+		}
+	}
+	sortKeys(rest, func(key HashKey) Object { return s.Elements[key] })
+	for _, key := range rest {
+		members = append(members, s.Elements[key])
+	}
+	return members
+}
+
+func (s *Set) Type() ObjectType {
+	return SET_OBJ
+}
+
+func (s *Set) Inspect() string {
+	return inspect(s)
+}
+
+// Range は start から stop の手前まで step ずつ進む整数の列
+// 要素を配列として持たず、必要になったときに計算する
+type Range struct {
+	Start int64
+	Stop  int64
+	// 0以外
+	Step int64
+}
+
+// Len は要素数を返す
+func (r *Range) Len() int64 {
+	switch {
+	case r.Step > 0 && r.Start < r.Stop:
+		return (r.Stop - r.Start + r.Step - 1) / r.Step
+	case r.Step < 0 && r.Start > r.Stop:
+		return (r.Start - r.Stop - r.Step - 1) / -r.Step
+	default:
+		return 0
+	}
+}
+
+// At は index 番目の要素を返す。範囲外の場合はokがfalse
+func (r *Range) At(index int64) (value int64, ok bool) {
+	if index < 0 || index >= r.Len() {
+		return 0, false
+	}
+	return r.Start + index*r.Step, true
+}
+
+// Contains は n が要素に含まれるかを返す
+func (r *Range) Contains(n int64) bool {
+	offset := n - r.Start
+	if offset%r.Step != 0 {
+		return false
+	}
+	_, ok := r.At(offset / r.Step)
+	return ok
+}
+
+func (r *Range) Type() ObjectType {
+	return RANGE_OBJ
+}
+
+// Inspect は 1..10 の形で返す。stepが1以外の場合は 0..10 step 2 とする
+func (r *Range) Inspect() string {
+	if r.Step == 1 {
+		return fmt.Sprintf("%d..%d", r.Start, r.Stop)
+	}
+	return fmt.Sprintf("%d..%d step %d", r.Start, r.Stop, r.Step)
 }
@@ -1,6 +1,12 @@
 package object
 
-import "testing"
+import (
+	"math/big"
+	"monkey/ast"
+	"monkey/token"
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -21,6 +27,26 @@ func TestStringHashKey(t *testing.T) {
 	}
 }
 
+func TestNewInteger(t *testing.T) {
+	for _, v := range []int64{-128, -1, 0, 1, 1024} {
+		if NewInteger(v) != NewInteger(v) {
+			t.Errorf("NewInteger(%d) should return the shared object", v)
+		}
+	}
+	for _, v := range []int64{-129, 1025, 1 << 40} {
+		a, b := NewInteger(v), NewInteger(v)
+		if a == b {
+			t.Errorf("NewInteger(%d) should allocate a new object", v)
+		}
+		if a.Value != v || a.HashKey() != b.HashKey() {
+			t.Errorf("NewInteger(%d) has wrong value or hash key. got=%d", v, a.Value)
+		}
+	}
+	if NewInteger(7).HashKey() != (&Integer{Value: 7}).HashKey() {
+		t.Errorf("shared integer has different hash key")
+	}
+}
+
 func TestBooleanHashKey(t *testing.T) {
 	true1 := &Boolean{Value: true}
 	true2 := &Boolean{Value: true}
@@ -58,3 +84,364 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestErrorStackTraceElidesDeepStacks(t *testing.T) {
+	err := &Error{Message: "boom"}
+	for i := 0; i < 25; i++ {
+		err.Stack = append(err.Stack, StackFrame{Function: "f", Line: i + 1, Column: 1})
+	}
+
+	lines := strings.Split(strings.TrimSuffix(err.StackTrace(), "\n"), "\n")
+	if len(lines) != 21 {
+		t.Fatalf("wrong number of lines. want=21, got=%d", len(lines))
+	}
+	if lines[0] != "  at f (line 1, column 1)" {
+		t.Errorf("wrong first frame. got=%q", lines[0])
+	}
+	if lines[10] != "  ... 5 more frames ..." {
+		t.Errorf("wrong elision line. got=%q", lines[10])
+	}
+	if lines[20] != "  at f (line 25, column 1)" {
+		t.Errorf("wrong last frame. got=%q", lines[20])
+	}
+}
+
+func TestFunctionInspect(t *testing.T) {
+	params := []*ast.Identifier{
+		{Token: token.Token{Type: token.IDENT, Literal: "a"}, Value: "a"},
+		{Token: token.Token{Type: token.IDENT, Literal: "b"}, Value: "b"},
+	}
+	body := &ast.BlockStatement{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Expression: &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: "a"}, Value: "a"}},
+	}}
+
+	named := &Function{Parameters: params, Body: body, Name: "add"}
+	anonymous := &Function{Parameters: params, Body: body}
+
+	tests := []struct {
+		got      string
+		expected string
+	}{
+		{named.Inspect(), "fn add(a, b) { ... }"},
+		{anonymous.Inspect(), "fn(a, b) { ... }"},
+		{(&Function{Body: body}).Inspect(), "fn() { ... }"},
+		{named.InspectVerbose(), "fn add(a, b) {\na\n}"},
+		{anonymous.InspectVerbose(), "fn(a, b) {\na\n}"},
+		{(&Builtin{Name: "len"}).Inspect(), "builtin fn: len"},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, tt.got)
+		}
+	}
+}
+
+func TestHashKeysDoNotCollideAcrossTypes(t *testing.T) {
+	keys := []Hashable{
+		&Integer{Value: 1},
+		&Boolean{Value: true},
+		&String{Value: "1"},
+		&Integer{Value: 0},
+		&Boolean{Value: false},
+		&String{Value: ""},
+		&String{Value: "true"},
+	}
+
+	seen := map[HashKey]Hashable{}
+	for _, key := range keys {
+		if other, ok := seen[key.HashKey()]; ok {
+			t.Errorf("%s and %s have the same hash key", other.(Object).Inspect(), key.(Object).Inspect())
+		}
+		seen[key.HashKey()] = key
+	}
+}
+
+func TestHashKeepsInsertionOrder(t *testing.T) {
+	h := NewHash()
+	for _, k := range []string{"c", "a", "b", "d"} {
+		h.Set(&String{Value: k}, &Integer{Value: 1})
+	}
+	h.Set(&String{Value: "a"}, &Integer{Value: 2})
+	if !h.Delete((&String{Value: "b"}).HashKey()) {
+		t.Errorf("Delete returned false for an existing key")
+	}
+	if h.Delete((&String{Value: "b"}).HashKey()) {
+		t.Errorf("Delete returned true for a missing key")
+	}
+	h.Set(&String{Value: "b"}, &Integer{Value: 3})
+
+	if h.Inspect() != `{"c":1, "a":2, "d":1, "b":3}` {
+		t.Errorf("wrong order. got=%s", h.Inspect())
+	}
+}
+
+func TestHashWithoutOrderIsDeterministic(t *testing.T) {
+	h := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, k := range []string{"c", "a", "b"} {
+		key := &String{Value: k}
+		h.Pairs[key.HashKey()] = HashPair{Key: key, Value: &Integer{Value: 1}}
+	}
+	if h.Inspect() != `{"a":1, "b":1, "c":1}` {
+		t.Errorf("pairs added without Set should be sorted. got=%s", h.Inspect())
+	}
+}
+
+func TestUnorderedKeysAreDeterministic(t *testing.T) {
+	// 表示が同じキーも、Goのマップを回す順によらず同じ順に並ぶ
+	str, integer, boolean := &String{Value: "true"}, &Integer{Value: 1}, TRUE
+	build := func() (*Hash, *Set) {
+		h := &Hash{Pairs: map[HashKey]HashPair{}}
+		set := &Set{Elements: map[HashKey]Object{}}
+		for _, key := range []Hashable{str, integer, &String{Value: "1"}, boolean} {
+			h.Pairs[key.HashKey()] = HashPair{Key: key.(Object), Value: NULL}
+			set.Elements[key.HashKey()] = key.(Object)
+		}
+		return h, set
+	}
+
+	h, set := build()
+	wantHash, wantSet := h.Inspect(), set.Inspect()
+	for i := 0; i < 100; i++ {
+		h, set := build()
+		if got := h.Inspect(); got != wantHash {
+			t.Fatalf("hash order changed. first=%s, now=%s", wantHash, got)
+		}
+		if got := set.Inspect(); got != wantSet {
+			t.Fatalf("set order changed. first=%s, now=%s", wantSet, got)
+		}
+	}
+}
+
+func TestToGoErrorIsDeterministic(t *testing.T) {
+	// 変換できない値が複数あれば、挿入した順で最初のものを報告する
+	for i := 0; i < 100; i++ {
+		h := NewHash()
+		h.Set(&String{Value: "b"}, &Function{})
+		h.Set(&String{Value: "a"}, &Builtin{Name: "len"})
+		_, err := ToGo(h)
+		if err == nil || err.Error() != "cannot convert function to a Go value" {
+			t.Fatalf("wrong error. got=%v", err)
+		}
+	}
+}
+
+func TestCheckHashKey(t *testing.T) {
+	usable := []Object{NewInteger(1), &BigInteger{Value: big.NewInt(1)}, TRUE, &String{Value: "a"}}
+	for _, key := range usable {
+		if err := CheckHashKey(key); err != nil {
+			t.Errorf("%s should be usable as hash key. got=%s", key.Type(), err.Message)
+		}
+	}
+
+	// 変更できる値と NULL はキーにできない
+	unusable := []Object{&Array{}, NewHash(), NewSet(), &Function{}, &Builtin{}, &Closure{Fn: &CompiledFunction{}}, NULL, &StringBuilder{}}
+	for _, key := range unusable {
+		err := CheckHashKey(key)
+		if err == nil {
+			t.Errorf("%s should not be usable as hash key", key.Type())
+			continue
+		}
+		want := "unusable as hash key: " + string(key.Type())
+		if err.Kind != TypeError || err.Message != want {
+			t.Errorf("wrong error. want=%s: %q, got=%s: %q", TypeError, want, err.Kind, err.Message)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	big64, _ := new(big.Int).SetString("18446744073709551616", 10)
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{NewInteger(0), "0"},
+		{NewInteger(-1), "-1"},
+		{NewInteger(1025), "1025"},
+		{NewInteger(9223372036854775807), "9223372036854775807"},
+		{NewInteger(-9223372036854775808), "-9223372036854775808"},
+		// 大きな整数も指数表記にしない
+		{&BigInteger{Value: big64}, "18446744073709551616"},
+		{&BigInteger{Value: new(big.Int).Neg(big64)}, "-18446744073709551616"},
+	}
+
+	for _, tt := range tests {
+		got, ok := FormatNumber(tt.obj)
+		if !ok || got != tt.expected {
+			t.Errorf("FormatNumber(%s) wrong. want=%q, got=%q (ok=%t)", tt.obj.Type(), tt.expected, got, ok)
+		}
+		if tt.obj.Inspect() != tt.expected {
+			t.Errorf("Inspect should agree with FormatNumber. want=%q, got=%q", tt.expected, tt.obj.Inspect())
+		}
+	}
+
+	for _, obj := range []Object{&String{Value: "1"}, TRUE, NULL, &Array{}} {
+		if _, ok := FormatNumber(obj); ok {
+			t.Errorf("FormatNumber(%s) should not format a non-number", obj.Type())
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		r        *Range
+		expected []int64
+		inspect  string
+	}{
+		{&Range{Start: 0, Stop: 5, Step: 1}, []int64{0, 1, 2, 3, 4}, "0..5"},
+		{&Range{Start: 1, Stop: 10, Step: 3}, []int64{1, 4, 7}, "1..10 step 3"},
+		{&Range{Start: 1, Stop: 11, Step: 5}, []int64{1, 6}, "1..11 step 5"},
+		{&Range{Start: 5, Stop: 0, Step: -2}, []int64{5, 3, 1}, "5..0 step -2"},
+		{&Range{Start: 5, Stop: 5, Step: 1}, []int64{}, "5..5"},
+		{&Range{Start: 5, Stop: 1, Step: 1}, []int64{}, "5..1"},
+		{&Range{Start: -3, Stop: 0, Step: 1}, []int64{-3, -2, -1}, "-3..0"},
+	}
+
+	for _, tt := range tests {
+		if tt.r.Len() != int64(len(tt.expected)) {
+			t.Errorf("%s: wrong Len. want=%d, got=%d", tt.inspect, len(tt.expected), tt.r.Len())
+			continue
+		}
+		for i, value := range tt.expected {
+			got, ok := tt.r.At(int64(i))
+			if !ok || got != value {
+				t.Errorf("%s: wrong element %d. want=%d, got=%d", tt.inspect, i, value, got)
+			}
+			if !tt.r.Contains(value) {
+				t.Errorf("%s: should contain %d", tt.inspect, value)
+			}
+		}
+		if _, ok := tt.r.At(tt.r.Len()); ok {
+			t.Errorf("%s: At(Len()) should be out of range", tt.inspect)
+		}
+		if tt.r.Contains(tt.r.Stop) {
+			t.Errorf("%s: should not contain the stop value", tt.inspect)
+		}
+		if tt.r.Inspect() != tt.inspect {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.inspect, tt.r.Inspect())
+		}
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	array := cyclicArray()
+
+	hash := NewHash()
+	inner := &Array{}
+	hash.Set(&String{Value: "self"}, hash)
+	hash.Set(&String{Value: "list"}, inner)
+	inner.Elements = append(inner.Elements, hash, NewInteger(2))
+
+	// 循環していなければ、同じ値が何度現れても省略しない
+	shared := &Array{Elements: []Object{NewInteger(1)}}
+	twice := &Array{Elements: []Object{shared, shared}}
+
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{array, "[1, [...]]"},
+		{hash, `{"self":{...}, "list":[{...}, 2]}`},
+		{inner, `[{"self":{...}, "list":[...]}, 2]`},
+		{twice, "[[1], [1]]"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.obj.Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestInspectLimitsElements(t *testing.T) {
+	array := &Array{}
+	hash := NewHash()
+	set := NewSet()
+	for i := 0; i < inspectMaxElements+500; i++ {
+		array.Elements = append(array.Elements, NewInteger(int64(i)))
+		hash.Set(NewInteger(int64(i)), TRUE)
+		set.Add(NewInteger(int64(i)))
+	}
+
+	tests := []struct {
+		obj    Object
+		prefix string
+		suffix string
+	}{
+		{array, "[0, 1, 2, ", ", 998, 999, …]"},
+		{hash, "{0:true, 1:true, ", ", 999:true, …}"},
+		{set, "set{0, 1, ", ", 999, …}"},
+	}
+
+	for _, tt := range tests {
+		got := tt.obj.Inspect()
+		if !strings.HasPrefix(got, tt.prefix) || !strings.HasSuffix(got, tt.suffix) {
+			t.Errorf("wrong Inspect for %s. want %q...%q, got %q...%q", tt.obj.Type(),
+				tt.prefix, tt.suffix, got[:len(tt.prefix)], got[len(got)-len(tt.suffix):])
+		}
+		if strings.Contains(got, "1000") {
+			t.Errorf("Inspect for %s shows more than %d elements", tt.obj.Type(), inspectMaxElements)
+		}
+	}
+
+	// 上限ちょうどなら省略しない
+	exact := &Array{Elements: array.Elements[:inspectMaxElements]}
+	if strings.Contains(exact.Inspect(), "…") {
+		t.Errorf("Inspect should not elide %d elements", inspectMaxElements)
+	}
+
+	// InspectAll は上限を設けない。入れ子の配列や Pretty の形でも同じ
+	for _, tt := range tests {
+		got := InspectAll(tt.obj, 0)
+		if strings.Contains(got, "…") || !strings.Contains(got, "1499") {
+			t.Errorf("InspectAll for %s should show all elements", tt.obj.Type())
+		}
+	}
+	nested := &Array{Elements: []Object{array}}
+	if got := InspectAll(nested, PrettyWidth); strings.Contains(got, "…") || !strings.HasSuffix(got, "    1499\n  ]\n]") {
+		t.Errorf("InspectAll with width should show all nested elements. got suffix %q", got[len(got)-20:])
+	}
+}
+
+func TestPretty(t *testing.T) {
+	str := func(s string) *String { return &String{Value: s} }
+	inner := NewHash()
+	inner.Set(str("k"), &Array{Elements: []Object{NewInteger(1), NewInteger(2)}})
+	outer := &Array{Elements: []Object{str("abc"), inner, &Array{}}}
+
+	tests := []struct {
+		obj      Object
+		width    int
+		expected string
+	}{
+		{str("abc"), 1, "abc"},
+		{NewInteger(1), 1, "1"},
+		{outer, 80, `["abc", {"k":[1, 2]}, []]`},
+		{outer, 20, "[\n  \"abc\",\n  {\"k\":[1, 2]},\n  []\n]"},
+		// キーの後ろの値は、キーの分だけ右から始まるものとして幅を測る
+		{outer, 13, "[\n  \"abc\",\n  {\n    \"k\":[\n      1,\n      2\n    ]\n  },\n  []\n]"},
+		{cyclicArray(), 1, "[\n  1,\n  [...]\n]"},
+	}
+
+	for _, tt := range tests {
+		if got := Pretty(tt.obj, tt.width); got != tt.expected {
+			t.Errorf("wrong Pretty with width %d.\nwant=%q\ngot=%q", tt.width, tt.expected, got)
+		}
+	}
+}
+
+func TestBigIntegerHashKey(t *testing.T) {
+	big1 := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 100)}
+	big2 := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 100)}
+	other := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 101)}
+
+	if big1.HashKey() != big2.HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+	if big1.HashKey() == other.HashKey() {
+		t.Errorf("big integers with different values have same hash keys")
+	}
+	if big1.Inspect() != "1267650600228229401496703205376" {
+		t.Errorf("wrong Inspect. got=%s", big1.Inspect())
+	}
+}
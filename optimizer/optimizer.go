@@ -0,0 +1,222 @@
+/*
+Package optimizer は評価前に抽象構文木を書き換えて最適化するパッケージ
+*/
+package optimizer
+
+import (
+	"math"
+	"math/big"
+	"monkey/ast"
+	"monkey/token"
+	"strconv"
+)
+
+// Fold は定数どうしの前置・中置演算を畳み込み、条件が定数の if 式を実行される側の式に置き換える
+// 識別子や呼び出しを含む式は変更しない
+// 桁あふれやゼロ除算になる演算は、実行時に同じエラーや結果になるよう畳み込まない
+// program はその場で書き換えられる
+func Fold(program *ast.Program) *ast.Program {
+	return ast.Modify(program, fold).(*ast.Program)
+}
+
+func fold(node ast.Node) ast.Node {
+	switch node := node.(type) {
+	case *ast.PrefixExpression:
+		return foldPrefix(node)
+	case *ast.InfixExpression:
+		return foldInfix(node)
+	case *ast.IfExpression:
+		return foldIf(node)
+	case *ast.Program:
+		node.Statements = spliceConstantIfs(node.Statements)
+	case *ast.BlockStatement:
+		node.Statements = spliceConstantIfs(node.Statements)
+	}
+	return node
+}
+
+func foldPrefix(node *ast.PrefixExpression) ast.Node {
+	switch right := node.Right.(type) {
+	case *ast.IntegerLiteral:
+		switch node.Operator {
+		case "-":
+			if right.Value == math.MinInt64 {
+				return node
+			}
+			return integerLiteral(node.Token, -right.Value)
+		case "+":
+			return right
+		case "!":
+			// 整数は常に真とみなされる
+			return booleanLiteral(node.Token, false)
+		}
+	case *ast.BigIntegerLiteral:
+		switch node.Operator {
+		case "-":
+			// -9223372036854775808 は int64 に収まる
+			if negated := new(big.Int).Neg(right.Value); negated.IsInt64() {
+				return integerLiteral(node.Token, negated.Int64())
+			}
+		case "+":
+			return right
+		case "!":
+			return booleanLiteral(node.Token, false)
+		}
+	case *ast.Boolean:
+		if node.Operator == "!" {
+			return booleanLiteral(node.Token, !right.Value)
+		}
+	case *ast.StringLiteral:
+		if node.Operator == "!" {
+			return booleanLiteral(node.Token, false)
+		}
+	}
+	return node
+}
+
+func foldInfix(node *ast.InfixExpression) ast.Node {
+	switch left := node.Left.(type) {
+	case *ast.IntegerLiteral:
+		if right, ok := node.Right.(*ast.IntegerLiteral); ok {
+			return foldIntegerInfix(node, left.Value, right.Value)
+		}
+	case *ast.StringLiteral:
+		// 文字列の == は同じオブジェクトかどうかを比べるので畳み込まない
+		if right, ok := node.Right.(*ast.StringLiteral); ok && node.Operator == "+" {
+			return stringLiteral(node.Token, left.Value+right.Value)
+		}
+	case *ast.Boolean:
+		if right, ok := node.Right.(*ast.Boolean); ok {
+			switch node.Operator {
+			case "==":
+				return booleanLiteral(node.Token, left.Value == right.Value)
+			case "!=":
+				return booleanLiteral(node.Token, left.Value != right.Value)
+			}
+		}
+	}
+	return node
+}
+
+func foldIntegerInfix(node *ast.InfixExpression, left, right int64) ast.Node {
+	switch node.Operator {
+	case "+":
+		sum := left + right
+		if (left^sum)&(right^sum) < 0 {
+			return node
+		}
+		return integerLiteral(node.Token, sum)
+	case "-":
+		diff := left - right
+		if (left^right)&(left^diff) < 0 {
+			return node
+		}
+		return integerLiteral(node.Token, diff)
+	case "*":
+		if left == 0 || right == 0 {
+			return integerLiteral(node.Token, 0)
+		}
+		product := left * right
+		if product/right != left || (left == -1 && right == math.MinInt64) || (right == -1 && left == math.MinInt64) {
+			return node
+		}
+		return integerLiteral(node.Token, product)
+	case "/":
+		if right == 0 || (left == math.MinInt64 && right == -1) {
+			return node
+		}
+		return integerLiteral(node.Token, left/right)
+	case "<":
+		return booleanLiteral(node.Token, left < right)
+	case ">":
+		return booleanLiteral(node.Token, left > right)
+	case "==":
+		return booleanLiteral(node.Token, left == right)
+	case "!=":
+		return booleanLiteral(node.Token, left != right)
+	}
+	return node
+}
+
+// 条件が定数で、実行される側のブロックが1つの式だけからなる if 式はその式に置き換える
+func foldIf(node *ast.IfExpression) ast.Node {
+	block, ok := takenBranch(node)
+	if !ok || block == nil || len(block.Statements) != 1 {
+		return node
+	}
+	if stmt, ok := block.Statements[0].(*ast.ExpressionStatement); ok && stmt.Expression != nil {
+		return stmt.Expression
+	}
+	return node
+}
+
+// 式文としての if 式は、実行される側のブロックの文を展開する
+// ブロックは新しいスコープを作らないので、let 文があっても意味は変わらない
+func spliceConstantIfs(statements []ast.Statement) []ast.Statement {
+	var result []ast.Statement
+	for i, statement := range statements {
+		stmt, ok := statement.(*ast.ExpressionStatement)
+		if !ok {
+			result = append(result, statement)
+			continue
+		}
+		ifExp, ok := stmt.Expression.(*ast.IfExpression)
+		if !ok {
+			result = append(result, statement)
+			continue
+		}
+		block, ok := takenBranch(ifExp)
+		// 空のブロックは null に評価されるので、最後の文の場合は残す
+		if !ok || ((block == nil || len(block.Statements) == 0) && i == len(statements)-1) {
+			result = append(result, statement)
+			continue
+		}
+		if block != nil {
+			result = append(result, block.Statements...)
+		}
+	}
+	return result
+}
+
+// 条件が定数の場合に実行される側のブロックを返す。実行されるブロックがない場合は nil
+func takenBranch(node *ast.IfExpression) (*ast.BlockStatement, bool) {
+	var truthy bool
+	switch condition := node.Condition.(type) {
+	case *ast.Boolean:
+		truthy = condition.Value
+	case *ast.IntegerLiteral, *ast.BigIntegerLiteral, *ast.StringLiteral:
+		truthy = true
+	default:
+		return nil, false
+	}
+	if truthy {
+		return node.Consequence, true
+	}
+	return node.Alternative, true
+}
+
+// 畳み込んだリテラルは元の式の位置を引き継ぐ
+func integerLiteral(tok token.Token, value int64) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{
+		Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10), Line: tok.Line, Column: tok.Column},
+		Value: value,
+	}
+}
+
+func booleanLiteral(tok token.Token, value bool) *ast.Boolean {
+	tt := token.TokenType(token.FALSE)
+	if value {
+		tt = token.TRUE
+	}
+	return &ast.Boolean{
+		Token: token.Token{Type: tt, Literal: strconv.FormatBool(value), Line: tok.Line, Column: tok.Column},
+		Value: value,
+	}
+}
+
+func stringLiteral(tok token.Token, value string) *ast.StringLiteral {
+	return &ast.StringLiteral{
+		Token: token.Token{Type: token.STRING, Literal: value, Line: tok.Line, Column: tok.Column},
+		Value: value,
+	}
+}
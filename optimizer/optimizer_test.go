@@ -0,0 +1,173 @@
+package optimizer
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+func parse(t testing.TB, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`60 * 60 * 24`, `86400`},
+		{`1 + 2 * 3 - 4 / 2`, `5`},
+		{`1 < 2`, `true`},
+		{`3 == 4`, `false`},
+		{`3 != 4`, `true`},
+		{`!true`, `false`},
+		{`!!false`, `false`},
+		{`!5`, `false`},
+		{`true == false`, `false`},
+		{`"foo" + "bar"`, `"foobar"`},
+		{`x + 60 * 60`, `x + 3600`},
+		{`f(1 + 1, [2 * 3])`, `f(2, [6])`},
+		{`let day = 60 * 60 * 24; day`, `let day = 86400; day`},
+		{`fn(x) { x * (2 + 3) }`, `fn(x) { x * 5 }`},
+		{`{"a" + "b": 1 + 1}`, `{"ab": 2}`},
+		{`x + 1 + 2`, `x + 1 + 2`},
+		{`f() + 1`, `f() + 1`},
+		{`"a" == "a"`, `"a" == "a"`},
+		{`1 == true`, `1 == true`},
+		{`1 .. 1 + 2`, `1 .. 3`},
+
+		// if 式
+		{`let x = if (true) { 1 + 1 } else { y }; x`, `let x = 2; x`},
+		{`let x = if (1 > 2) { y } else { 3 }; x`, `let x = 3; x`},
+		{`let x = if (false) { y }; x`, `let x = if (false) { y }; x`},
+		{`let x = if (true) { let a = 1; a }; x`, `let x = if (true) { let a = 1; a }; x`},
+		{`if (true) { let a = 1; a + 1 } else { b }`, `let a = 1; a + 1`},
+		{`if (false) { a } else { let b = 2; b }`, `let b = 2; b`},
+		{`if (false) { a }; 1`, `1`},
+		{`1; if (false) { a }`, `1; if (false) { a }`},
+		{`if (x) { 1 + 1 } else { 2 }`, `if (x) { 2 } else { 2 }`},
+		{`fn() { if (true) { return 1 + 1; }; 3 }`, `fn() { return 2; 3 }`},
+		{`if ("s") { 1 } else { 2 }`, `1`},
+
+		// 実行時のエラーや桁あふれを保つため畳み込まない
+		{`1 / 0`, `1 / 0`},
+		{`9223372036854775807 + 1`, `9223372036854775807 + 1`},
+		{`4294967296 * 4294967296`, `4294967296 * 4294967296`},
+		{`"a" - "b"`, `"a" - "b"`},
+		{`-true`, `-true`},
+	}
+
+	for _, tt := range tests {
+		folded := Fold(parse(t, tt.input))
+		expected := parse(t, tt.expected)
+		if !ast.Equal(folded, expected) {
+			t.Errorf("%s: want=%s, got=%s", tt.input, expected.String(), folded.String())
+		}
+	}
+}
+
+func TestFoldNegativeNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`-5`, `-5`},
+		{`2 - 7`, `-5`},
+		{`-(3 * 4)`, `-12`},
+		{`1 - -5`, `6`},
+		{`+5`, `5`},
+		{`- -5`, `5`},
+		{`+-5`, `-5`},
+		{`+a`, `(+a)`},
+		{`-9223372036854775807 - 1`, `-9223372036854775808`},
+		{`-9223372036854775807 - 2`, `(-9223372036854775807 - 2)`},
+		{`-9223372036854775808`, `-9223372036854775808`},
+		{`-99999999999999999999`, `(-99999999999999999999)`},
+		{`+99999999999999999999`, `99999999999999999999`},
+	}
+
+	for _, tt := range tests {
+		folded := Fold(parse(t, tt.input))
+		if folded.String() != tt.expected {
+			t.Errorf("%s: want=%s, got=%s", tt.input, tt.expected, folded.String())
+		}
+	}
+}
+
+func TestFoldKeepsPositions(t *testing.T) {
+	folded := Fold(parse(t, "let a = 1;\nlet b = 2 * 3;"))
+	literal := folded.Statements[1].(*ast.LetStatement).Value.(*ast.IntegerLiteral)
+	if literal.Token.Line != 2 || literal.Token.Column != 11 {
+		t.Errorf("folded literal lost its position. got=%d:%d", literal.Token.Line, literal.Token.Column)
+	}
+}
+
+func TestFoldPreservesEvaluation(t *testing.T) {
+	inputs := []string{
+		`60 * 60 * 24`,
+		`let f = fn(x) { x * (60 * 60) + (10 - 4) / 2 }; f(2)`,
+		`if (1 < 2) { "yes" + "!" } else { "no" }`,
+		`if (false) { 1 }`,
+		`let x = if (true) { let a = 5; a * 2 }; x + a`,
+		`let g = fn() { if (true) { return 1 + 1; }; 3 }; g()`,
+		`1 / 0`,
+		`9223372036854775807 + 1`,
+		`4294967296 * 4294967296`,
+		`-9223372036854775807 - 2`,
+		`-9223372036854775808`,
+		`-99999999999999999999 * 2`,
+		`if (99999999999999999999) { 1 }`,
+		`"a" == "a"`,
+		`!(1 == 1)`,
+		`let xs = [1 + 1, 2 * 2]; xs[3 - 2]`,
+		`len("ab" + "cd")`,
+		`for (x in 0..2 + 1) { x * (2 + 2) }`,
+		`if (true) { 1 + "a" }`,
+	}
+
+	for _, input := range inputs {
+		want := evaluator.New().Eval(parse(t, input), object.NewEnvironment())
+		got := evaluator.New().Eval(Fold(parse(t, input)), object.NewEnvironment())
+		if want.Type() != got.Type() || want.Inspect() != got.Inspect() {
+			t.Errorf("%s: evaluation changed. want=%s, got=%s", input, want.Inspect(), got.Inspect())
+		}
+		if wantErr, ok := want.(*object.Error); ok {
+			gotErr := got.(*object.Error)
+			if wantErr.Line != gotErr.Line || wantErr.Column != gotErr.Column {
+				t.Errorf("%s: error position changed. want=%d:%d, got=%d:%d",
+					input, wantErr.Line, wantErr.Column, gotErr.Line, gotErr.Column)
+			}
+		}
+	}
+}
+
+const foldHeavyProgram = `
+let seconds = fn(days) { days * (60 * 60 * 24) + (1000 - 999) * 0 };
+let loop = fn(n, acc) {
+	if (n == 0) { acc } else { loop(n - 1, acc + seconds(1) - (24 * 60 * 60) + (2 * 3 - 6)) }
+};
+loop(2000, 0)
+`
+
+func BenchmarkFoldHeavyProgram(b *testing.B) {
+	b.Run("unfolded", func(b *testing.B) {
+		program := parse(b, foldHeavyProgram)
+		for i := 0; i < b.N; i++ {
+			evaluator.New().Eval(program, object.NewEnvironment())
+		}
+	})
+	b.Run("folded", func(b *testing.B) {
+		program := Fold(parse(b, foldHeavyProgram))
+		for i := 0; i < b.N; i++ {
+			evaluator.New().Eval(program, object.NewEnvironment())
+		}
+	})
+}
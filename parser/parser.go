@@ -2,10 +2,12 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"strings"
 )
 
 // 優先順位を管理するための定数
@@ -14,6 +16,7 @@ const (
 	LOWEST
 	EQUALS      // ==
 	LESSGREATER // > or <
+	RANGE       // ..
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // - or !
@@ -24,17 +27,20 @@ const (
 
 // 優先順位テーブル
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTARISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
-	token.LBRACE:   HASH,
+	token.EQ:                EQUALS,
+	token.NOT_EQ:            EQUALS,
+	token.IS:                EQUALS,
+	token.LT:                LESSGREATER,
+	token.GT:                LESSGREATER,
+	token.DOTDOT:            RANGE,
+	token.PLUS:              SUM,
+	token.MINUS:             SUM,
+	token.SLASH:             PRODUCT,
+	token.ASTARISK:          PRODUCT,
+	token.LPAREN:            CALL,
+	token.LBRACKET:          INDEX,
+	token.OPTIONAL_LBRACKET: INDEX,
+	token.LBRACE:            HASH,
 }
 
 type (
@@ -42,9 +48,25 @@ type (
 	infixParseFn  func(ast.Expression) ast.Expression
 )
 
+// Error は位置付きの構文エラー
+type Error struct {
+	Message string
+	// エラーの原因となったトークンの位置（不明な場合は0）
+	Line   int
+	Column int
+}
+
+// Error は "行:列: メッセージ" を返す。位置が不明な場合はメッセージだけを返す
+func (e Error) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []Error
 
 	curToken  token.Token
 	peekToken token.Token
@@ -56,7 +78,7 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []Error{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn) //マップ、スライスの初期化にはmakeを使う
@@ -64,14 +86,18 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.PLUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupdExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.FOR, p.parseForInExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.ELLIPSIS, p.parseMisplacedSpread)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -80,10 +106,13 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.IS, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
+	p.registerInfix(token.DOTDOT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.OPTIONAL_LBRACKET, p.parseOptionalIndexExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -91,13 +120,39 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// Reset は構文解析器を、字句解析器を Reset して input を先頭から解析するように戻す
+// 登録した構文解析関数の表はそのまま使うので、New で生成し直すより割り当てが少ない
+// それまでの構文エラーは消えるが、以前に ErrorDetails で返したスライスは書き換えない
+// 構文解析器は複数のgoroutineから同時に使ってはならない
+func (p *Parser) Reset(input string) {
+	p.l.Reset(input)
+	p.errors = []Error{}
+	p.curToken = token.Token{}
+	p.peekToken = token.Token{}
+	p.nextToken()
+	p.nextToken()
+}
+
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		msgs[i] = err.Message
+	}
+	return msgs
+}
+
+// ErrorDetails は構文エラーを位置付きで返す
+func (p *Parser) ErrorDetails() []Error {
 	return p.errors
 }
 
+// tok の位置で構文エラーを記録する
+func (p *Parser) addError(tok token.Token, format string, a ...interface{}) {
+	p.errors = append(p.errors, Error{Message: fmt.Sprintf(format, a...), Line: tok.Line, Column: tok.Column})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
 }
 
 func (p *Parser) nextToken() {
@@ -120,17 +175,102 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// ParseStatement は最上位の文を1つ構文解析して返す。文がなくなると nil を返す
+// ParseProgram と違い、読んだ文を保持しないので、大きなプログラムを1文ずつ評価するのに使う
+// 構文エラーは ErrorDetails に追加される。エラーがあった文は評価せずに止めること
+func (p *Parser) ParseStatement() ast.Statement {
+	if p.curTokenIs(token.EOF) {
+		return nil
+	}
+	stmt := p.parseStatement()
+	p.nextToken()
+	return stmt
+}
+
+// ParseExpressionOnly は入力全体を1つの式として構文解析する
+// 式の後には ; を1つだけ書ける。let などの文や、式の後に入力が残っている場合はエラーを返す
+// エラーは Error（位置付き）の値で、ErrorDetails と同じものを返す
+func (p *Parser) ParseExpressionOnly() (ast.Expression, []error) {
+	switch p.curToken.Type {
+	case token.LET, token.RETURN, token.IMPORT:
+		p.addError(p.curToken, "expected an expression, got %s statement", p.curToken.Literal)
+	case token.EOF:
+		p.addError(p.curToken, "expected an expression, got end of input")
+	default:
+		expr := p.parseExpression(LOWEST)
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		if len(p.errors) == 0 && !p.peekTokenIs(token.EOF) {
+			p.addError(p.peekToken, "unexpected trailing input %q", p.peekToken.Literal)
+		}
+		if len(p.errors) == 0 {
+			return expr, nil
+		}
+	}
+
+	errs := make([]error, len(p.errors))
+	for i, err := range p.errors {
+		errs[i] = err
+	}
+	return nil, errs
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.LBRACE:
+		// 文の先頭の { はハッシュリテラルに見えなければブロック文を始める。式の途中の { は常にハッシュリテラル
+		if p.startsHashLiteral() {
+			return p.parseExpressionStatement()
+		}
+		return p.parseBareBlock()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
+// startsHashLiteral は文の先頭の { の後を先読みし、ハッシュリテラルならtrueを返す
+// {} と、最初の組が "式:" か省略形の "名前," "名前}" で始まるものをハッシュリテラルとする
+// 名前だけを評価するブロック {x} は省略形のハッシュになる
+func (p *Parser) startsHashLiteral() bool {
+	switch {
+	case p.peekTokenIs(token.RBRACE):
+		return true
+	case p.peekTokenIs(token.IDENT):
+		next := *p.l
+		if t := next.NextToken().Type; t == token.COMMA || t == token.RBRACE {
+			return true
+		}
+	}
+
+	// 最初の式を試しに解析して、後に : が続くかを調べる。字句解析器と構文エラーは解析前の状態に戻す
+	lexer, cur, peek, errors := *p.l, p.curToken, p.peekToken, p.errors
+	p.nextToken()
+	p.parseExpression(LOWEST)
+	hash := p.peekTokenIs(token.COLON)
+	*p.l, p.curToken, p.peekToken, p.errors = lexer, cur, peek, errors
+	return hash
+}
+
+// 文の位置のブロック文の解析。if などのブロックと同じく、新しいスコープは作らない
+func (p *Parser) parseBareBlock() *ast.BlockStatement {
+	block := p.parseBlockStatement()
+	if !p.curTokenIs(token.RBRACE) {
+		p.addError(p.curToken, "expected next token to be %s, got %s instead", token.RBRACE, p.curToken.Type)
+		return nil
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return block
+}
+
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
@@ -148,6 +288,34 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// let f = fn() {...} の形なら関数に名前を付ける
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = p.curToken.Literal
+
+	if p.peekTokenIs(token.AS) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -225,8 +393,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for '%s' found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken, "no prefix parse function for '%s' found", t)
 }
 
 // 識別子の解析
@@ -236,11 +403,45 @@ func (p *Parser) parseIdentifier() ast.Expression {
 }
 
 // 整数リテラルの解析
+// 整数リテラルは10進数か、0o で始まる8進数。Go と同じく、0 で始まる2桁以上の10進数（007 など）はエラーにする
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	literal := p.curToken.Literal
+	digits, base := literal, 10
+	if len(literal) >= 2 && literal[0] == '0' && (literal[1] == 'o' || literal[1] == 'O') {
+		digits, base = literal[2:], 8
+		if digits == "" {
+			p.addError(p.curToken, "octal literal %q has no digits", literal)
+			return nil
+		}
+		if i := strings.IndexAny(digits, "89"); i >= 0 {
+			p.addError(p.curToken, "invalid digit %q in octal literal %q", digits[i], literal)
+			return nil
+		}
+	} else if len(literal) >= 2 && literal[0] == '0' {
+		decimal := strings.TrimLeft(literal, "0")
+		if decimal == "" {
+			decimal = "0"
+		}
+		if strings.ContainsAny(literal, "89") {
+			p.addError(p.curToken, "integer literal %q has a leading zero: use %s for decimal", literal, decimal)
+		} else {
+			p.addError(p.curToken, "integer literal %q has a leading zero: use 0o%s for octal or %s for decimal", literal, decimal, decimal)
+		}
+		return nil
+	}
+
+	value, err := strconv.ParseInt(digits, base, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		// int64 に収まらないリテラルは、演算の結果と同じく BigInteger に昇格する
+		// 負の数は - を前置演算子として解析するので、-9223372036854775808 のリテラル部分もここで昇格し、
+		// 符号を反転した値は int64 に収まるので Integer に戻る
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			if n, ok := new(big.Int).SetString(digits, base); ok {
+				return &ast.BigIntegerLiteral{Token: p.curToken, Value: n}
+			}
+		}
+		// 字句解析器は数字以外を数値リテラルに含めないので、通常は起きない
+		p.addError(p.curToken, "malformed integer literal %q", literal)
 		return nil
 	}
 
@@ -275,9 +476,26 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	precedence := p.curPrecedence()
 	p.nextToken()
 	exp.Right = p.parseExpression(precedence)
+	// 1 < 2 < 3 は ((1 < 2) < 3) になり真偽値と整数を比べてしまうので構文エラーにする
+	// a == b == c も a == b かつ b == c とは読めないので、同じく == と != の連鎖も構文エラーにする
+	// 1 < 2 == true や 5 > 4 == 3 < 4 は大小の比較が先に結合し、真偽値どうしを比べる式として意味を持つので許す
+	if isRelational(exp.Token.Type) && isRelational(p.peekToken.Type) ||
+		isEquality(exp.Token.Type) && isEquality(p.peekToken.Type) {
+		p.addError(p.peekToken, "chained comparisons are not supported; use &&")
+	}
 	return exp
 }
 
+// 大小を比べる演算子ならtrueを返す
+func isRelational(t token.TokenType) bool {
+	return t == token.LT || t == token.GT
+}
+
+// 等しいかを比べる演算子ならtrueを返す
+func isEquality(t token.TokenType) bool {
+	return t == token.EQ || t == token.NOT_EQ
+}
+
 // グループ化された式の解析
 func (p *Parser) parseGroupdExpression() ast.Expression {
 	p.nextToken()
@@ -327,6 +545,75 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// for (v in xs) { ... } または for (k, v in xs) { ... } の解析
+func (p *Parser) parseForInExpression() ast.Expression {
+	expression := &ast.ForInExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	// 変数が2つの場合は1つ目がキー
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.Key = expression.Value
+		expression.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Body = p.parseBlockStatement()
+
+	return expression
+}
+
+// try { ... } catch (e) { ... } の解析
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Body = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) {
+		return nil
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Handler = p.parseBlockStatement()
+
+	return expression
+}
+
 // ブロック文の解析
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
@@ -403,11 +690,64 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 // 関数呼び出しの解析
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
-	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp := &ast.CallExpression{Token: p.curToken, Function: function, Arguments: []ast.Expression{}}
+
+	// 引数がない場合
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return exp
+	}
+
+	for {
+		p.nextToken()
+		if !p.parseCallArgument(exp) {
+			return nil
+		}
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
 	return exp
 }
 
+// 呼び出しの引数を1つ解析して exp に加える。name: value は名前付き引数になる
+func (p *Parser) parseCallArgument(exp *ast.CallExpression) bool {
+	if !p.curTokenIs(token.IDENT) || !p.peekTokenIs(token.COLON) {
+		if len(exp.Names) > 0 {
+			// エラーにするが、続きを解析できるように引数は読み進める
+			p.addError(p.curToken, "positional argument after named argument")
+		}
+		arg := p.parseListElement()
+		if arg == nil {
+			return false
+		}
+		exp.Arguments = append(exp.Arguments, arg)
+		return true
+	}
+
+	name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if _, ok := exp.NamedArguments[name.Value]; ok {
+		p.addError(p.curToken, "duplicate named argument %s", name.Value)
+	}
+	p.nextToken()
+	p.nextToken()
+	value := p.parseExpression(LOWEST)
+	if value == nil {
+		return false
+	}
+	if exp.NamedArguments == nil {
+		exp.NamedArguments = make(map[string]ast.Expression)
+	}
+	exp.NamedArguments[name.Value] = value
+	exp.Names = append(exp.Names, name)
+	return true
+}
+
 // インデックス式の解析
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	ie := &ast.IndexExpression{Token: p.curToken, Left: left}
@@ -419,6 +759,17 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return ie
 }
 
+// NULL 安全なインデックス式の解析
+func (p *Parser) parseOptionalIndexExpression(left ast.Expression) ast.Expression {
+	oe := &ast.OptionalIndexExpression{Token: p.curToken, Left: left}
+	p.nextToken()
+	oe.Index = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return oe
+}
+
 // 配列リテラルの解析
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
@@ -435,14 +786,13 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
-		key := p.parseExpression(LOWEST)
-		if !p.expectPeek(token.COLON) {
+		key, value := p.parseHashPair()
+		if key == nil {
 			return nil
 		}
-		p.nextToken()
-		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -455,6 +805,32 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	return hash
 }
 
+// ハッシュリテラルの1組を解析する
+// {name} は {"name": name} の省略形で、{[key]: value} の key は構築時に評価する式になる
+func (p *Parser) parseHashPair() (ast.Expression, ast.Expression) {
+	if p.curTokenIs(token.IDENT) && (p.peekTokenIs(token.COMMA) || p.peekTokenIs(token.RBRACE)) {
+		key := &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: p.curToken.Literal, Line: p.curToken.Line, Column: p.curToken.Column}, Value: p.curToken.Literal}
+		return key, p.parseIdentifier()
+	}
+
+	var key ast.Expression
+	if p.curTokenIs(token.LBRACKET) {
+		// キーの位置の [ ] は配列リテラルではなく、計算するキーを囲む
+		p.nextToken()
+		key = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.RBRACKET) {
+			return nil, nil
+		}
+	} else {
+		key = p.parseExpression(LOWEST)
+	}
+	if key == nil || !p.expectPeek(token.COLON) {
+		return nil, nil
+	}
+	p.nextToken()
+	return key, p.parseExpression(LOWEST)
+}
+
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	args := []ast.Expression{}
 
@@ -465,12 +841,12 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	args = append(args, p.parseListElement())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		args = append(args, p.parseListElement())
 	}
 
 	if !p.expectPeek(end) {
@@ -480,6 +856,26 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return args
 }
 
+// 呼び出しの引数や配列リテラルの要素を1つ解析する。先頭の ... は展開（スプレッド）になる
+func (p *Parser) parseListElement() ast.Expression {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+	spread := &ast.SpreadExpression{Token: p.curToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+	if spread.Value == nil {
+		return nil
+	}
+	return spread
+}
+
+// 引数と配列の要素以外の位置にある ... は構文エラーにする
+func (p *Parser) parseMisplacedSpread() ast.Expression {
+	p.addError(p.curToken, "spread operator ... is only allowed in call arguments and array literals")
+	return nil
+}
+
 func (p *Parser) peekPrecedence() int {
 	return p.getPrecedence(p.peekToken.Type)
 }
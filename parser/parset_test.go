@@ -2,8 +2,13 @@ package parser
 
 import (
 	"fmt"
+	"io/ioutil"
 	"monkey/ast"
 	"monkey/lexer"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -165,6 +170,86 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralBases(t *testing.T) {
+	// 0o で始まるリテラルは8進数。Go と同じく、0 で始まる2桁以上のリテラルはエラーにする
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0", int64(0)},
+		{"10", int64(10)},
+		{"0o755", int64(493)},
+		{"0O17", int64(15)},
+		{"0o0", int64(0)},
+		{"00", `integer literal "00" has a leading zero: use 0o0 for octal or 0 for decimal`},
+		{"0755", `integer literal "0755" has a leading zero: use 0o755 for octal or 755 for decimal`},
+		{"007", `integer literal "007" has a leading zero: use 0o7 for octal or 7 for decimal`},
+		{"09", `integer literal "09" has a leading zero: use 9 for decimal`},
+		{"0o", `octal literal "0o" has no digits`},
+		{"0o78", `invalid digit '8' in octal literal "0o78"`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		switch expected := tt.expected.(type) {
+		case int64:
+			checkParserErrors(t, p)
+			literal, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+			if !ok || literal.Value != expected {
+				t.Errorf("%q: wrong literal. want=%d, got=%v", tt.input, expected, program.Statements[0])
+			}
+		case string:
+			if errs := p.Errors(); len(errs) == 0 || errs[0] != expected {
+				t.Errorf("%q: wrong errors. want=%q, got=%q", tt.input, expected, errs)
+			}
+		}
+	}
+}
+
+func TestIntegerLiteralRange(t *testing.T) {
+	// int64 に収まらないリテラルは BigIntegerLiteral になる
+	// - は前置演算子なので、-9223372036854775808 のリテラル部分も BigIntegerLiteral になる
+	tests := []struct {
+		input    string
+		expected string
+		big      bool
+	}{
+		{"9223372036854775807", "9223372036854775807", false},
+		{"-9223372036854775807", "9223372036854775807", false},
+		{"0o777777777777777777777", "9223372036854775807", false},
+		{"9223372036854775808", "9223372036854775808", true},
+		{"-9223372036854775808", "9223372036854775808", true},
+		{"99999999999999999999", "99999999999999999999", true},
+		{"0o1000000000000000000000", "9223372036854775808", true},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		exp := program.Statements[0].(*ast.ExpressionStatement).Expression
+		if prefix, ok := exp.(*ast.PrefixExpression); ok {
+			exp = prefix.Right
+		}
+		switch literal := exp.(type) {
+		case *ast.IntegerLiteral:
+			if tt.big || strconv.FormatInt(literal.Value, 10) != tt.expected {
+				t.Errorf("%q: wrong literal. want=%s (big=%t), got IntegerLiteral %d", tt.input, tt.expected, tt.big, literal.Value)
+			}
+		case *ast.BigIntegerLiteral:
+			if !tt.big || literal.Value.String() != tt.expected {
+				t.Errorf("%q: wrong literal. want=%s (big=%t), got BigIntegerLiteral %s", tt.input, tt.expected, tt.big, literal.Value)
+			}
+			if literal.TokenLiteral() != strings.TrimPrefix(tt.input, "-") {
+				t.Errorf("%q: wrong token literal %q", tt.input, literal.TokenLiteral())
+			}
+		default:
+			t.Errorf("%q: not an integer literal. got=%T", tt.input, exp)
+		}
+	}
+}
+
 // 前置演算子のテスト
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
@@ -174,6 +259,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 	}{
 		{"!5;", "!", 5},
 		{"-15", "-", 15},
+		{"+15", "+", 15},
 		{"!true", "!", true},
 		{"!false", "!", false},
 	}
@@ -226,6 +312,7 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
+		{"a is b", "a", "is", "b"},
 	}
 
 	for _, tt := range infixTests {
@@ -287,10 +374,50 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"-a * b",
 			"((-a) * b)",
 		},
+		{
+			"1..n + 1",
+			"(1 .. (n + 1))",
+		},
+		{
+			"a is b == !c",
+			"((a is b) == (!c))",
+		},
+		{
+			"a + 1 is b[0]",
+			"((a + 1) is (b[0]))",
+		},
+		{
+			"a..b == c",
+			"((a .. b) == c)",
+		},
 		{
 			"!-a",
 			"(!(-a))",
 		},
+		{
+			"- -5",
+			"(-(-5))",
+		},
+		{
+			"!!true",
+			"(!(!true))",
+		},
+		{
+			"+a * -b",
+			"((+a) * (-b))",
+		},
+		{
+			"a + +b",
+			"(a + (+b))",
+		},
+		{
+			"(a < b) < c",
+			"((a < b) < c)",
+		},
+		{
+			"a < b == c > d",
+			"((a < b) == (c > d))",
+		},
 		{
 			"a + b + c",
 			"((a + b) + c)",
@@ -877,6 +1004,71 @@ func TestParsingEmptyHashLiteral(t *testing.T) {
 	}
 }
 
+func TestBraceAtStatementStart(t *testing.T) {
+	// 文の先頭の { は、{} か最初の組が "式:" か省略形の名前で始まればハッシュリテラル、そうでなければブロック文
+	tests := []struct {
+		input string
+		block bool
+		// ブロック文の文の数
+		statements int
+	}{
+		{"{}", false, 0},
+		{`{"a": 1}`, false, 0},
+		{"{\n  \"a\": 1,\n  \"b\": 2\n}", false, 0},
+		{`{"a": 1}["a"]`, false, 0},
+		{"{a, b}", false, 0},
+		{"{[k]: 1}", false, 0},
+		{"{f(1) + 2: 3}", false, 0},
+		{"{ let x = 1; x }", true, 2},
+		{"{ x }", false, 0},
+		{"{ x; }", true, 1},
+		{"{ x + 1 }", true, 1},
+		{"{ [1, 2] }", true, 1},
+		{`{ {"a": 1} }`, true, 1},
+		{"{ if (x) { 1 } }", true, 1},
+		{"{ return 1; };", true, 1},
+		{"{ { let y = 2; } }", true, 1},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Errorf("%q: wrong number of statements. got=%d", tt.input, len(program.Statements))
+			continue
+		}
+		switch stmt := program.Statements[0].(type) {
+		case *ast.BlockStatement:
+			if !tt.block {
+				t.Errorf("%q: should be a hash literal, got a block", tt.input)
+			} else if len(stmt.Statements) != tt.statements {
+				t.Errorf("%q: wrong number of statements in the block. want=%d, got=%d", tt.input, tt.statements, len(stmt.Statements))
+			}
+		case *ast.ExpressionStatement:
+			if tt.block {
+				t.Errorf("%q: should be a block, got %T", tt.input, stmt.Expression)
+			}
+		default:
+			t.Errorf("%q: unexpected statement %T", tt.input, stmt)
+		}
+	}
+
+	// 式の途中の { は常にハッシュリテラル
+	p := New(lexer.New("let h = { x + 1 };"))
+	p.ParseProgram()
+	if errs := p.Errors(); len(errs) == 0 || errs[0] != "expected next token to be :, got } instead" {
+		t.Errorf("{ x + 1 } after let should be parsed as a hash literal. got=%v", errs)
+	}
+
+	// 閉じていないブロック文はエラーにする
+	p = New(lexer.New("{ let x = 1;"))
+	p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 1 || errs[0] != "expected next token to be }, got EOF instead" {
+		t.Errorf("wrong errors for an unclosed block. got=%v", errs)
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -1031,3 +1223,664 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestFunctionLiteralWithName(t *testing.T) {
+	input := `let myFunction = fn() { }; let other = 1; fn() { };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	let, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+	}
+	function, ok := let.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("let.Value is not ast.FunctionLiteral. got=%T", let.Value)
+	}
+	if function.Name != "myFunction" {
+		t.Errorf("function literal name wrong. want 'myFunction', got=%q", function.Name)
+	}
+
+	anonymous := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if anonymous.Name != "" {
+		t.Errorf("anonymous function has a name. got=%q", anonymous.Name)
+	}
+}
+
+func TestHashLiteralKeepsKeyOrder(t *testing.T) {
+	input := `{"b": 1, "a": 2, 3: 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := []string{"b", "a", "3"}
+	if len(hash.Keys) != len(expected) {
+		t.Fatalf("hash.Keys has wrong length. got=%d", len(hash.Keys))
+	}
+	for i, key := range hash.Keys {
+		if key.String() != expected[i] {
+			t.Errorf("key %d wrong. want=%q, got=%q", i, expected[i], key.String())
+		}
+	}
+	if hash.String() != "{b:1, a:2, 3:3}" {
+		t.Errorf("hash.String() wrong. got=%q", hash.String())
+	}
+}
+
+func TestHashLiteralShorthandAndComputedKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{name, age}`, "{name:name, age:age}"},
+		{`{[key]: 1}`, "{key:1}"},
+		{`{[k + "x"]: v, [f(1)]: 2}`, "{(k + x):v, f(1):2}"},
+		{`{name, "a": 1, [k]: 2, age}`, "{name:name, a:1, k:2, age:age}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	// 省略形のキーは文字列リテラル、値は同じ名前の識別子になる
+	p := New(lexer.New(`{name}`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	hash := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	key, ok := hash.Keys[0].(*ast.StringLiteral)
+	if !ok || key.Value != "name" {
+		t.Fatalf("key is not the string literal \"name\". got=%T (%s)", hash.Keys[0], hash.Keys[0])
+	}
+	testIdentifier(t, hash.Pairs[key], "name")
+	if ast.Format(hash) != `{"name": name}` {
+		t.Errorf("wrong format. got=%q", ast.Format(hash))
+	}
+}
+
+func TestHashLiteralKeyErrors(t *testing.T) {
+	tests := []string{
+		`{name age}`,
+		`{1, 2}`,
+		`{[1, 2]: 3}`,
+		`{[key] 1}`,
+		`{[key: 1}`,
+	}
+
+	for _, input := range tests {
+		// 文の先頭では {name age} などはブロック文になるので、式の位置で調べる
+		input = "let h = " + input
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parse errors for %q", input)
+		}
+	}
+}
+
+func TestForInExpression(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedKey string
+		expected    string
+	}{
+		{`for (x in xs) { x }`, "", "for (x in xs) x"},
+		{`for (i, x in [1, 2]) { puts(i) }`, "i", "for (i, x in [1, 2]) puts(i)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.ForInExpression)
+		if !ok {
+			t.Fatalf("exp is not ast.ForInExpression. got=%T", stmt.Expression)
+		}
+		if tt.expectedKey == "" && exp.Key != nil {
+			t.Errorf("exp.Key should be nil. got=%s", exp.Key)
+		}
+		if tt.expectedKey != "" && (exp.Key == nil || exp.Key.Value != tt.expectedKey) {
+			t.Errorf("exp.Key wrong. want=%s, got=%v", tt.expectedKey, exp.Key)
+		}
+		if exp.String() != tt.expected {
+			t.Errorf("exp.String() wrong. want=%q, got=%q", tt.expected, exp.String())
+		}
+	}
+}
+
+func TestForInExpressionErrors(t *testing.T) {
+	tests := []string{
+		`for x in xs { x }`,
+		`for (x xs) { x }`,
+		`for (1 in xs) { x }`,
+		`for (x in xs) x`,
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parse errors for %q", input)
+		}
+	}
+}
+
+func TestSpreadExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`f(...args)`, "f(...args)"},
+		{`f(1, ...xs, 2)`, "f(1, ...xs, 2)"},
+		{`[1, ...rest, 9]`, "[1, ...rest, 9]"},
+		{`[...a + b]`, "[...(a + b)]"},
+		{`[...f(...xs)]`, "[...f(...xs)]"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New(`[1, ...xs]`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	array := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ArrayLiteral)
+	spread, ok := array.Elements[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("array.Elements[1] is not ast.SpreadExpression. got=%T", array.Elements[1])
+	}
+	testIdentifier(t, spread.Value, "xs")
+}
+
+func TestNamedArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`connect(host: "h", port: 80)`, "connect(host: h, port: 80)"},
+		{`connect("h", tls: true, port: 80 + 1)`, "connect(h, tls: true, port: (80 + 1))"},
+		{`f(...xs, a: b)`, "f(...xs, a: b)"},
+		{`f(a: g(b: 1))`, "f(a: g(b: 1))"},
+		{`f(x: {"k": 1}["k"])`, "f(x: ({k:1}[k]))"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New(`connect(1, tls: true, port: 80)`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if len(call.Arguments) != 1 || len(call.Names) != 2 || len(call.NamedArguments) != 2 {
+		t.Fatalf("wrong arguments. got=%d positional, %d named", len(call.Arguments), len(call.Names))
+	}
+	if call.Names[0].Value != "tls" || call.Names[1].Value != "port" {
+		t.Errorf("names not in source order. got=%s, %s", call.Names[0].Value, call.Names[1].Value)
+	}
+	testBooleanLiteral(t, call.NamedArguments["tls"], true)
+	testIntegerLiteral(t, call.NamedArguments["port"], 80)
+}
+
+func TestChainedComparisonErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 < 2 < 3`, "1:7: chained comparisons are not supported; use &&"},
+		{`a > b > c`, "1:7: chained comparisons are not supported; use &&"},
+		{`a < b + 1 > c`, "1:11: chained comparisons are not supported; use &&"},
+		{`f(x < y < z)`, "1:9: chained comparisons are not supported; use &&"},
+		{`a == b == c`, "1:8: chained comparisons are not supported; use &&"},
+		{`a != b == c`, "1:8: chained comparisons are not supported; use &&"},
+		{`x == 1 + 1 != y`, "1:12: chained comparisons are not supported; use &&"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		details := p.ErrorDetails()
+		if len(details) != 1 {
+			t.Errorf("expected 1 parse error for %q. got=%v", tt.input, p.Errors())
+			continue
+		}
+		if details[0].Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, details[0].Error())
+		}
+	}
+
+	// 大小の比較と == は結合の強さが違うので連鎖ではなく、真偽値どうしを比べる式になる
+	valid := []struct {
+		input    string
+		expected string
+	}{
+		{`1 < 2 == true`, "((1 < 2) == true)"},
+		{`a == b < c`, "(a == (b < c))"},
+		{`(a == b) == c`, "((a == b) == c)"},
+		{`a == (b != c)`, "(a == (b != c))"},
+	}
+	for _, tt := range valid {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Errorf("unexpected parse errors for %q: %v", tt.input, p.Errors())
+			continue
+		}
+		if program.String() != tt.expected {
+			t.Errorf("wrong parse for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestNamedArgumentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`f(a: 1, 2)`, "1:9: positional argument after named argument"},
+		{`f(a: 1, ...xs)`, "1:9: positional argument after named argument"},
+		{`f(a: 1, b: 2, a: 3)`, "1:15: duplicate named argument a"},
+		{`f(a: )`, "1:6: no prefix parse function for ')' found"},
+		{`f("a": 1)`, "1:6: expected next token to be ), got : instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		details := p.ErrorDetails()
+		if len(details) == 0 {
+			t.Errorf("expected parse errors for %q", tt.input)
+			continue
+		}
+		if details[0].Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, details[0].Error())
+		}
+	}
+}
+
+func TestSpreadExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`...xs`, "1:1: spread operator ... is only allowed in call arguments and array literals"},
+		{`let x = ...xs;`, "1:9: spread operator ... is only allowed in call arguments and array literals"},
+		{`f(1 + ...xs)`, "1:7: spread operator ... is only allowed in call arguments and array literals"},
+		{`{"a": ...xs}`, "1:7: spread operator ... is only allowed in call arguments and array literals"},
+		{`[......xs]`, "1:5: spread operator ... is only allowed in call arguments and array literals"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		details := p.ErrorDetails()
+		if len(details) == 0 {
+			t.Errorf("expected parse errors for %q", tt.input)
+			continue
+		}
+		if details[0].Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, details[0].Error())
+		}
+	}
+}
+
+func TestOptionalIndexExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`cfg?["db"]`, "(cfg?[db])"},
+		{`cfg?["db"]?["host"]`, "((cfg?[db])?[host])"},
+		{`cfg["db"]?["host"][0]`, "(((cfg[db])?[host])[0])"},
+		{`-a?[i + 1] * 2`, "((-(a?[(i + 1)])) * 2)"},
+		{`f()?[0]`, "(f()?[0])"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New(`a?[1]`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.OptionalIndexExpression)
+	if !ok {
+		t.Fatalf("exp is not ast.OptionalIndexExpression. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	testIdentifier(t, exp.Left, "a")
+	testIntegerLiteral(t, exp.Index, 1)
+	if ast.Format(exp) != "a?[1]" {
+		t.Errorf("wrong format. got=%q", ast.Format(exp))
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	input := `try { f(x); g(x) } catch (e) { e }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("exp is not ast.TryExpression. got=%T", stmt.Expression)
+	}
+	if len(exp.Body.Statements) != 2 {
+		t.Errorf("exp.Body has wrong number of statements. got=%d", len(exp.Body.Statements))
+	}
+	testIdentifier(t, exp.Param, "e")
+	if exp.String() != "try f(x)g(x) catch (e) e" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+	if ast.Format(exp) != "try {\n\tf(x);\n\tg(x)\n} catch (e) {\n\te\n}" {
+		t.Errorf("wrong format. got=%q", ast.Format(exp))
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []string{
+		`try { 1 }`,
+		`try 1 catch (e) { 2 }`,
+		`try { 1 } catch { 2 }`,
+		`try { 1 } catch (1) { 2 }`,
+		`try { 1 } catch (e) 2`,
+		`catch (e) { 2 }`,
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parse errors for %q", input)
+		}
+	}
+}
+
+func TestImportStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedPath  string
+		expectedAlias string
+		expected      string
+	}{
+		{`import "math.mky" as m;`, "math.mky", "m", `import "math.mky" as m;`},
+		{`import "lib/util.mky"`, "lib/util.mky", "", `import "lib/util.mky";`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.ImportStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Path != tt.expectedPath {
+			t.Errorf("stmt.Path wrong. want=%q, got=%q", tt.expectedPath, stmt.Path)
+		}
+		if tt.expectedAlias == "" && stmt.Alias != nil {
+			t.Errorf("stmt.Alias should be nil. got=%s", stmt.Alias)
+		}
+		if tt.expectedAlias != "" && (stmt.Alias == nil || stmt.Alias.Value != tt.expectedAlias) {
+			t.Errorf("stmt.Alias wrong. want=%s, got=%v", tt.expectedAlias, stmt.Alias)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+
+	for _, input := range []string{`import math`, `import "m.mky" as`, `import "m.mky" as "m"`} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parse errors for %q", input)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	input := "#!/usr/bin/env monkey\nlet x = 1;\nputs(x);\n"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[1].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.ExpressionStatement. got=%T", program.Statements[1])
+	}
+	if stmt.Token.Line != 3 {
+		t.Errorf("statement should be on line 3. got=%d", stmt.Token.Line)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	p := New(lexer.New("let x = 1;\nlet = 2;"))
+	p.ParseProgram()
+
+	errors := p.ErrorDetails()
+	if len(errors) == 0 {
+		t.Fatal("expected parse errors")
+	}
+	if errors[0].Line != 2 || errors[0].Column != 5 {
+		t.Errorf("wrong position. want=2:5, got=%d:%d", errors[0].Line, errors[0].Column)
+	}
+	if errors[0].Message != p.Errors()[0] {
+		t.Errorf("Errors and ErrorDetails disagree. %q != %q", errors[0].Message, p.Errors()[0])
+	}
+}
+
+func TestParseExpressionOnly(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "(1 + (2 * 3))"},
+		{"-a * b;", "((-a) * b)"},
+		{"  add(1, [2, 3][0])\n", "add(1, ([2, 3][0]))"},
+		{`if (x < y) { x } else { y }`, "if(x < y) xelse y"},
+		{`fn(x) { x + 1 }(2)`, "fn(x)(x + 1)(2)"},
+		{`{"a": 1}["a"]`, "({a:1}[a])"},
+		{"1..10", "(1 .. 10)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		expr, errs := p.ParseExpressionOnly()
+		if len(errs) > 0 {
+			t.Errorf("%q: unexpected errors: %v", tt.input, errs)
+			continue
+		}
+		if expr.String() != tt.expected {
+			t.Errorf("%q: wrong expression. want=%q, got=%q", tt.input, tt.expected, expr.String())
+		}
+	}
+}
+
+func TestParseExpressionOnlyErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 3", `1:7: unexpected trailing input "3"`},
+		{"1; 2", `1:4: unexpected trailing input "2"`},
+		{"1;;", `1:3: unexpected trailing input ";"`},
+		{"f(1)\nx", `2:1: unexpected trailing input "x"`},
+		{"let x = 1", "1:1: expected an expression, got let statement"},
+		{"return 1", "1:1: expected an expression, got return statement"},
+		{`import "m"`, "1:1: expected an expression, got import statement"},
+		{"", "1:1: expected an expression, got end of input"},
+		{"1 +", "1:4: no prefix parse function for 'EOF' found"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		expr, errs := p.ParseExpressionOnly()
+		if expr != nil {
+			t.Errorf("%q: expected no expression. got=%s", tt.input, expr)
+		}
+		if len(errs) == 0 || errs[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, errs)
+		}
+		if len(errs) != len(p.ErrorDetails()) {
+			t.Errorf("%q: errors and ErrorDetails disagree. %v != %v", tt.input, errs, p.ErrorDetails())
+		}
+	}
+}
+
+func TestParseStatement(t *testing.T) {
+	p := New(lexer.New("let x = 1;\nputs(x)\nreturn x;"))
+	expected := []string{"let x = 1;", "puts(x)", "return  x;"}
+	for i, want := range expected {
+		stmt := p.ParseStatement()
+		if stmt == nil {
+			t.Fatalf("statement %d: unexpected end", i)
+		}
+		if stmt.String() != want {
+			t.Errorf("statement %d: want=%q, got=%q", i, want, stmt.String())
+		}
+	}
+	if stmt := p.ParseStatement(); stmt != nil {
+		t.Errorf("expected nil at the end. got=%q", stmt.String())
+	}
+	checkParserErrors(t, p)
+
+	// エラーはそれまでに読んだ文の分だけ増える
+	p = New(lexer.New("1; let = 2; 3"))
+	if p.ParseStatement(); len(p.Errors()) != 0 {
+		t.Fatalf("unexpected errors after the first statement: %v", p.Errors())
+	}
+	p.ParseStatement()
+	if len(p.Errors()) == 0 || p.Errors()[0] != "expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong errors after the second statement: %v", p.Errors())
+	}
+}
+
+// 構文解析の比較に使うプログラム。テスト用のファイルに構文エラーのある入力を加える
+func resetCorpus(t testing.TB) []string {
+	corpus := []string{
+		"",
+		"let = 1; let x 2;",
+		"fn(x, y) { x + y }(1, 2)",
+		`{"a": [1, 2, ...xs], [k]: fn() { try { f() } catch (e) { e } }}`,
+		"#!/usr/bin/env monkey\nfor (x in 0..10) { if (x > 5) { puts(x) } else { h?[x] } }",
+		`"unterminated`,
+	}
+	for _, pattern := range []string{"../testdata/*.mky", "../testdata/*/*.mky", "../bench/workloads/*.mky", "../prelude/*.mky"} {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			src, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			corpus = append(corpus, string(src))
+		}
+	}
+	return corpus
+}
+
+func TestReset(t *testing.T) {
+	// 1つの構文解析器を使い回しても、毎回生成した場合と同じ結果になる
+	reused := New(lexer.New("let x = ;"))
+	reused.ParseProgram()
+	for _, input := range resetCorpus(t) {
+		fresh := New(lexer.New(input))
+		want := fresh.ParseProgram()
+
+		reused.Reset(input)
+		got := reused.ParseProgram()
+
+		// 構文エラーのあるプログラムは String できないことがあるので、エラーだけを比べる
+		if len(fresh.Errors()) == 0 && got.String() != want.String() {
+			t.Errorf("%q: reset parser gave a different program.\nwant=%q\ngot=%q", input, want.String(), got.String())
+		}
+		if !reflect.DeepEqual(reused.ErrorDetails(), fresh.ErrorDetails()) {
+			t.Errorf("%q: reset parser gave different errors.\nwant=%v\ngot=%v", input, fresh.ErrorDetails(), reused.ErrorDetails())
+		}
+	}
+
+	// Reset の前に取り出したエラーは書き換えられない
+	reused.Reset("let = 1;")
+	reused.ParseProgram()
+	errs := reused.ErrorDetails()
+	saved := append([]Error(nil), errs...)
+	reused.Reset("let y 2;")
+	reused.ParseProgram()
+	if !reflect.DeepEqual(errs, saved) {
+		t.Errorf("errors returned before Reset were changed. want=%v, got=%v", saved, errs)
+	}
+}
+
+func BenchmarkParseFresh(b *testing.B) {
+	corpus := resetCorpus(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, input := range corpus {
+			New(lexer.New(input)).ParseProgram()
+		}
+	}
+}
+
+func BenchmarkParseReset(b *testing.B) {
+	corpus := resetCorpus(b)
+	p := New(lexer.New(""))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, input := range corpus {
+			p.Reset(input)
+			p.ParseProgram()
+		}
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Package prelude はユーザーのコードより先に評価する、Monkeyで書いた標準ライブラリを提供するパッケージ
+*/
+package prelude
+
+import (
+	_ "embed"
+	"fmt"
+	"io/ioutil"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+)
+
+// 標準のプレリュードのファイル名（エラーメッセージに使う）
+const stdlibName = "stdlib.mky"
+
+//go:embed stdlib.mky
+var stdlib string
+
+// Load は標準のプレリュードを ev で評価した環境を返す
+// ユーザーのコードはこの環境を外側に持つ環境（object.NewEnclosedEnvironment）で評価する
+func Load(ev *evaluator.Evaluator) (*object.Environment, error) {
+	return LoadSource(ev, stdlibName, stdlib)
+}
+
+// LoadFile は path のファイルをプレリュードとして評価した環境を返す
+func LoadFile(ev *evaluator.Evaluator, path string) (*object.Environment, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("prelude: %s", err)
+	}
+	return LoadSource(ev, path, string(src))
+}
+
+// LoadSource は src をプレリュードとして評価した環境を返す
+// 構文エラーや評価中のエラーは name を含むエラーとして返す
+func LoadSource(ev *evaluator.Evaluator, name, src string) (*object.Environment, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("prelude %s: parse error: %s", name, strings.Join(p.Errors(), "; "))
+	}
+
+	env := object.NewEnvironment()
+	if errObj, ok := ev.Eval(program, env).(*object.Error); ok {
+		return nil, fmt.Errorf("prelude %s: %s", name, errObj.Inspect())
+	}
+	return env, nil
+}
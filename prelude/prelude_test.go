@@ -0,0 +1,95 @@
+package prelude
+
+import (
+	"io/ioutil"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func evalWithPrelude(t *testing.T, base *object.Environment, input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return evaluator.New().Eval(program, object.NewEnclosedEnvironment(base))
+}
+
+func TestStdlib(t *testing.T) {
+	base, err := Load(evaluator.New())
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`identity(5)`, "5"},
+		{`let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; compose(inc, double)(5)`, "11"},
+		{`sum([1, 2, 3, 4])`, "10"},
+		{`sum([])`, "0"},
+		{`any([1, 2, 3], fn(x) { x > 2 })`, "true"},
+		{`any([1, 2, 3], fn(x) { x > 3 })`, "false"},
+		{`all([1, 2, 3], fn(x) { x > 0 })`, "true"},
+		{`all([1, 2, 3], fn(x) { x > 1 })`, "false"},
+		{`count([1, 2, 3, 4], fn(x) { x > 2 })`, "2"},
+		{`flatMap([1, 2], fn(x) { [x, x * 10] })`, "[1, 10, 2, 20]"},
+		// ユーザーのコードはプレリュードの名前を上書きできる
+		{`let sum = fn(xs) { "mine" }; sum([1])`, "mine"},
+	}
+
+	for _, tt := range tests {
+		evaluated := evalWithPrelude(t, base, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// 上書きはユーザーの環境だけに影響する
+	if evaluated := evalWithPrelude(t, base, `sum([1, 2])`); evaluated.Inspect() != "3" {
+		t.Errorf("prelude binding changed. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestWithoutPrelude(t *testing.T) {
+	evaluated := evaluator.New().Eval(parser.New(lexer.New(`sum([1])`)).ParseProgram(), object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "identifier not found: sum" {
+		t.Errorf("sum should not be defined without the prelude. got=%v", evaluated)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	custom := filepath.Join(dir, "custom.mky")
+	broken := filepath.Join(dir, "broken.mky")
+	failing := filepath.Join(dir, "failing.mky")
+	ioutil.WriteFile(custom, []byte(`let greet = fn(name) { "hi " + name };`), 0644)
+	ioutil.WriteFile(broken, []byte(`let greet = fn(name { name };`), 0644)
+	ioutil.WriteFile(failing, []byte(`let x = 1 + true;`), 0644)
+
+	base, err := LoadFile(evaluator.New(), custom)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %s", err)
+	}
+	if evaluated := evalWithPrelude(t, base, `greet("monkey")`); evaluated.Inspect() != "hi monkey" {
+		t.Errorf("custom prelude not loaded. got=%s", evaluated.Inspect())
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{broken, "prelude " + broken + ": parse error: expected next token to be ), got { instead"},
+		{failing, "prelude " + failing + ": ERROR: line 1, column 11: TypeError: type mismatch: INTEGER + BOOLEAN"},
+		{filepath.Join(dir, "missing.mky"), "prelude: open "},
+	}
+	for _, tt := range tests {
+		_, err := LoadFile(evaluator.New(), tt.path)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("want error starting with %q, got %v", tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// command は ":" で始まるREPLのコマンド
+type command struct {
+	// :help に表示する引数の書式（引数がなければ空）
+	usage string
+	// trueなら usage の引数を省略してもよい
+	optional bool
+	// :help に表示する説明
+	help string
+	// args にはコマンド名を除いた残りの入力が入る
+	run func(r *REPL, args string)
+}
+
+// commands はコマンド名（":" を除く）からコマンドへの対応
+var commands map[string]command
+
+func init() {
+	// :help が commands を参照するので init で初期化する
+	commands = map[string]command{
+		"help":     {help: "show this help", run: (*REPL).help},
+		"quit":     {help: "exit the REPL", run: (*REPL).exit},
+		"exit":     {help: "exit the REPL", run: (*REPL).exit},
+		"env":      {help: "list the current bindings", run: (*REPL).listBindings},
+		"reset":    {help: "discard all bindings and start over", run: (*REPL).reset},
+		"clear":    {help: "clear the screen", run: (*REPL).clear},
+		"time":     {usage: "<code>", help: "evaluate code and show how long it took", run: (*REPL).time},
+		"timing":   {usage: "on|off", help: "show how long every evaluation takes", run: (*REPL).setTiming},
+		"pretty":   {usage: "on|off", help: "print long arrays and hashes on several indented lines", run: (*REPL).setPretty},
+		"tokens":   {usage: "<code>", help: "show the tokens of code without evaluating it", run: (*REPL).tokens},
+		"ast":      {usage: "[-json] <code>", help: "show the syntax tree of code without evaluating it", run: (*REPL).ast},
+		"bytecode": {usage: "<code>", help: "show the compiled bytecode of code without running it", run: (*REPL).bytecode},
+		"break":    {usage: "<line>", help: "pause evaluation before the statements on line", run: (*REPL).setBreakpoint},
+		"run":      {usage: "<file>", help: "evaluate a file; its lines are the lines for :break", run: (*REPL).runFile},
+		"doc":      {usage: "[name]", optional: true, help: "describe a builtin, or list all builtins by category", run: (*REPL).doc},
+		"full":     {help: "print the last result without shortening it", run: (*REPL).full},
+		"set":      {usage: "maxout <n>", help: "print at most n bytes of each result (0 for no limit)", run: (*REPL).set},
+		"save": {usage: "<file>", help: "save the bindings to a JSON file", run: func(r *REPL, args string) {
+			saveEnvironment(r.Out, args, r.Env)
+		}},
+		"load": {usage: "<file>", help: "load bindings from a JSON file", run: func(r *REPL, args string) {
+			loadEnvironment(r.Out, args, r.Env)
+		}},
+	}
+}
+
+// :env で値を表示する最大の文字数
+const maxInspectLength = 40
+
+// ":" で始まる1行をコマンドとして実行する
+func (r *REPL) runCommand(line string) {
+	name := strings.TrimPrefix(line, ":")
+	args := ""
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name, args = name[:i], strings.TrimSpace(name[i+1:])
+	}
+
+	cmd, ok := commands[name]
+	if !ok || (cmd.usage == "" && args != "") || (cmd.usage != "" && !cmd.optional && args == "") {
+		w := r.Out
+		if r.quiet {
+			w = r.Err
+			r.status = 1
+		}
+		fmt.Fprintf(w, "unknown command: %s\n", line)
+		io.WriteString(w, "type :help for a list of commands\n")
+		return
+	}
+	cmd.run(r, args)
+}
+
+func (r *REPL) help(args string) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// 説明の桁を揃えるため、いちばん長い書式に合わせる
+	usages := make([]string, len(names))
+	width := 0
+	for i, name := range names {
+		usages[i] = ":" + name
+		if cmd := commands[name]; cmd.usage != "" {
+			usages[i] += " " + cmd.usage
+		}
+		if len(usages[i]) > width {
+			width = len(usages[i])
+		}
+	}
+	for i, name := range names {
+		fmt.Fprintf(r.Out, "  %-*s  %s\n", width, usages[i], commands[name].help)
+	}
+}
+
+// doc は :doc を実行する
+// :doc name は組み込み関数の呼び出し方と説明を、:doc は全組み込み関数を分類ごとに名前順で表示する
+func (r *REPL) doc(args string) {
+	if args != "" {
+		doc, ok := r.ev.Doc(args)
+		if !ok {
+			fmt.Fprintf(r.Out, "no documentation for %s\n", args)
+			return
+		}
+		fmt.Fprintln(r.Out, doc)
+		return
+	}
+
+	groups := map[string][]string{}
+	width := 0
+	for _, name := range r.ev.BuiltinNames() {
+		doc, _ := r.ev.Doc(name)
+		category := doc.Category
+		if category == "" {
+			category = "other"
+		}
+		groups[category] = append(groups[category], name)
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	for _, category := range evaluator.DocCategories {
+		if len(groups[category]) == 0 {
+			continue
+		}
+		fmt.Fprintf(r.Out, "%s\n", category)
+		for _, name := range groups[category] {
+			doc, ok := r.ev.Doc(name)
+			summary := doc.Summary
+			if !ok {
+				summary = "(no documentation)"
+			}
+			fmt.Fprintf(r.Out, "  %-*s  %s\n", width, name, summary)
+		}
+	}
+}
+
+func (r *REPL) exit(args string) {
+	r.quit = true
+}
+
+func (r *REPL) listBindings(args string) {
+	names := r.Env.Names()
+	if len(names) == 0 {
+		io.WriteString(r.Out, "no bindings\n")
+		return
+	}
+	for _, name := range names {
+		obj, _ := r.Env.Get(name)
+		fmt.Fprintf(r.Out, "%s: %s = %s\n", name, object.TypeName(obj.Type()), shorten(obj.Inspect()))
+	}
+}
+
+func (r *REPL) reset(args string) {
+	env, err := NewEnvironment(r.ev, r.Options)
+	if err != nil {
+		fmt.Fprintf(r.Out, "reset failed: %s\n", err)
+		return
+	}
+	r.Env = env
+	r.vm = NewVMRunner()
+	io.WriteString(r.Out, "environment reset\n")
+}
+
+func (r *REPL) clear(args string) {
+	// カーソルを左上に移動して画面全体を消去する
+	io.WriteString(r.Out, "\x1b[H\x1b[2J")
+}
+
+func (r *REPL) tokens(args string) {
+	for _, tok := range lexer.Tokenize(args) {
+		fmt.Fprintf(r.Out, "%-10s %s\n", tok.Type, tok.Literal)
+	}
+}
+
+func (r *REPL) ast(args string) {
+	asJSON := false
+	if fields := strings.Fields(args); len(fields) > 0 && fields[0] == "-json" {
+		asJSON = true
+		args = strings.TrimSpace(strings.TrimPrefix(args, "-json"))
+	}
+
+	p := parser.New(lexer.New(args))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		printParseErrors(r.Out, r.style, args, p.ErrorDetails())
+		return
+	}
+	if asJSON {
+		ast.PrintJSON(r.Out, program)
+		return
+	}
+	ast.Print(r.Out, program)
+}
+
+// 入力だけを新しいコンパイラでコンパイルする。以前の入力で定義した名前は参照できない
+func (r *REPL) bytecode(args string) {
+	p := parser.New(lexer.New(args))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		printParseErrors(r.Out, r.style, args, p.ErrorDetails())
+		return
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		io.WriteString(r.Out, r.style.value(compileError(err)))
+		io.WriteString(r.Out, "\n")
+		return
+	}
+	compiler.Disassemble(r.Out, comp.Bytecode())
+}
+
+func (r *REPL) time(args string) {
+	r.execute(args, 0, true)
+}
+
+func (r *REPL) setTiming(args string) {
+	switch args {
+	case "on":
+		r.timing = true
+	case "off":
+		r.timing = false
+	default:
+		io.WriteString(r.Out, "usage: :timing on|off\n")
+		return
+	}
+	fmt.Fprintf(r.Out, "timing %s\n", args)
+}
+
+func (r *REPL) setPretty(args string) {
+	switch args {
+	case "on":
+		r.style.pretty = true
+	case "off":
+		r.style.pretty = false
+	default:
+		io.WriteString(r.Out, "usage: :pretty on|off\n")
+		return
+	}
+	fmt.Fprintf(r.Out, "pretty %s\n", args)
+}
+
+// full は :full を実行し、最後に表示した評価結果を切り詰めず、要素も省略せずに表示し直す
+func (r *REPL) full(args string) {
+	if r.last == nil {
+		io.WriteString(r.Out, "no result to show\n")
+		return
+	}
+	r.writeResult(r.last, r.style.fullText(r.last), false)
+}
+
+// set は :set を実行し、REPLの設定を変更する
+func (r *REPL) set(args string) {
+	fields := strings.Fields(args)
+	if len(fields) != 2 || fields[0] != "maxout" {
+		io.WriteString(r.Out, "usage: :set maxout <n>\n")
+		return
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil || n < 0 {
+		fmt.Fprintf(r.Out, "maxout must be a non-negative integer, got %q\n", fields[1])
+		return
+	}
+	r.MaxOutput = n
+	fmt.Fprintf(r.Out, "maxout %d\n", n)
+}
+
+// formatDuration は d を大きさに合った単位で表す
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Microsecond:
+		return fmt.Sprintf("%dns", d.Nanoseconds())
+	case d < time.Millisecond:
+		return fmt.Sprintf("%.1fµs", float64(d)/float64(time.Microsecond))
+	case d < time.Second:
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	default:
+		return fmt.Sprintf("%.3fs", d.Seconds())
+	}
+}
+
+// 長い文字列を改行なしで maxInspectLength 文字以内に縮める
+func shorten(str string) string {
+	str = strings.Join(strings.Fields(str), " ")
+	if utf8.RuneCountInString(str) <= maxInspectLength {
+		return str
+	}
+	return string([]rune(str)[:maxInspectLength-3]) + "..."
+}
@@ -0,0 +1,81 @@
+package repl
+
+import (
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+// Complete は line の pos（バイト位置）の直前にある単語を補完する候補を名前順に返す
+// 候補はキーワード、標準の組み込み関数、env とその外側で束縛されている名前のうち、単語で始まるもの
+// 単語が空の場合や、文字列リテラルの中では候補を返さない
+func Complete(line string, pos int, env *object.Environment) []string {
+	if pos < 0 || pos > len(line) {
+		return nil
+	}
+	start := wordStart(line, pos)
+	prefix := line[start:pos]
+	if prefix == "" || isDigit(prefix[0]) || inString(line[:start]) {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var candidates []string
+	add := func(name string) {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	for _, name := range token.Keywords() {
+		add(name)
+	}
+	for _, name := range evaluator.BuiltinNames() {
+		add(name)
+	}
+	if env != nil {
+		for name := range env.All(true) {
+			add(name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// pos の直前にある識別子の先頭の位置を返す
+func wordStart(line string, pos int) int {
+	start := pos
+	for start > 0 && isIdentChar(line[start-1]) {
+		start--
+	}
+	return start
+}
+
+func isIdentChar(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || isDigit(ch)
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+// s の末尾が文字列リテラルの中かどうか
+func inString(s string) bool {
+	return strings.Count(s, `"`)%2 == 1
+}
+
+// commonPrefix は candidates に共通する最長の接頭辞を返す
+func commonPrefix(candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,85 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"monkey/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	outer := object.NewEnvironment()
+	outer.Set("sum", &object.Integer{Value: 1})
+	env := object.NewEnclosedEnvironment(outer)
+	env.Set("result", &object.Integer{Value: 1})
+	env.Set("rest_count", &object.Integer{Value: 2})
+
+	tests := []struct {
+		line     string
+		pos      int
+		expected []string
+	}{
+		{"le", 2, []string{"len", "let"}},
+		{"let x = fi", 10, []string{"filter", "find", "findIndex", "first", "firstOr"}},
+		{"re", 2, []string{"recv", "reduce", "remove", "repeat", "rest", "rest_count", "result", "return"}},
+		{"res", 3, []string{"rest", "rest_count", "result"}},
+		{"su", 2, []string{"sum"}},
+		// カーソルより後ろは見ない
+		{"pu(1)", 2, []string{"push", "puts"}},
+		{"fi + 1", 2, []string{"filter", "find", "findIndex", "first", "firstOr"}},
+		{"x + ", 4, nil},
+		{"", 0, nil},
+		{"zz", 2, nil},
+		{`puts("le`, 8, nil},
+		{"12", 2, nil},
+		{"le", 5, nil},
+	}
+
+	for _, tt := range tests {
+		got := Complete(tt.line, tt.pos, env)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Complete(%q, %d) wrong. want=%q, got=%q", tt.line, tt.pos, tt.expected, got)
+		}
+	}
+}
+
+func TestTerminalReaderCompletion(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("counter", &object.Integer{Value: 1})
+	complete := func(line string, pos int) []string { return Complete(line, pos, env) }
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"coun\te\t\r", "counter"},
+		{"fil\t(xs)\r", "filter(xs)"},
+		// 共通部分まで補完する
+		{"firs\t\r", "first"},
+		{"cou\t\r", "count"},
+		{"pu\t\r", "pu"},
+		{"x + \t\r", "x + "},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		r := &terminalReader{in: bufio.NewReader(strings.NewReader(tt.input)), out: &out, history: NewHistory(0), complete: complete}
+		line, err := r.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != tt.expected {
+			t.Errorf("%q: wrong line. want=%q, got=%q", tt.input, tt.expected, line)
+		}
+	}
+
+	// 補完できない場合は候補を一覧表示する
+	var out bytes.Buffer
+	r := &terminalReader{in: bufio.NewReader(strings.NewReader("pu\t\r")), out: &out, history: NewHistory(0), complete: complete}
+	r.ReadLine(PROMPT)
+	if !strings.Contains(out.String(), "\r\npush  puts\r\n") {
+		t.Errorf("candidates should be listed. got=%q", out.String())
+	}
+}
@@ -0,0 +1,189 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strconv"
+	"strings"
+)
+
+// デバッガで止まっているときのプロンプト
+const DEBUG_PROMPT = "(debug) "
+
+// debugMode はデバッガが次にどこで評価を止めるか
+type debugMode int
+
+const (
+	// ブレークポイントの行でだけ止まる
+	debugContinue debugMode = iota
+	// 次の文で止まる（呼び出した関数の中も含む）
+	debugStep
+	// 呼び出した関数の中では止まらず、同じ深さか呼び出し元の次の文で止まる
+	debugNext
+	// 入力が終わったので、次の文で評価を打ち切る
+	debugAbort
+)
+
+// debugger は :break で設定した行で評価を止め、(debug) プロンプトで入力したコマンドで再開する
+// 評価は別の goroutine で行い、止まっている間はREPLの goroutine がコマンドを読む
+// 止めるのも再開するのも評価器の文のフック（Pause と Resume）を使う
+type debugger struct {
+	ev          *evaluator.Evaluator
+	breakpoints map[int]bool
+	mode        debugMode
+	// debugNext のとき、止まった文の呼び出しの深さ
+	depth int
+	// フックが評価を止めるたびに止まった文を送る
+	paused chan debugPause
+}
+
+// debugPause は評価が止まった文とその時点の環境・呼び出し履歴
+type debugPause struct {
+	stmt  ast.Statement
+	env   *object.Environment
+	stack []object.StackFrame
+}
+
+func newDebugger(out io.Writer, opts Options) *debugger {
+	d := &debugger{breakpoints: map[int]bool{}, paused: make(chan debugPause)}
+	d.ev = evaluator.New(append(opts.evaluatorOptions(out), evaluator.WithStatementHook(d.hook))...)
+	return d
+}
+
+// hook は各文の前に評価の goroutine で呼ばれ、止める場合は止まった文をREPLに送る
+func (d *debugger) hook(stmt ast.Statement, env *object.Environment) evaluator.HookAction {
+	if d.mode == debugAbort {
+		return evaluator.Abort
+	}
+	stack := d.ev.CallStack()
+	line, _ := evaluator.Position(stmt)
+	switch {
+	case d.mode == debugStep:
+	case d.mode == debugNext && len(stack) <= d.depth:
+	case d.breakpoints[line]:
+	default:
+		return evaluator.Continue
+	}
+	d.paused <- debugPause{stmt: stmt, env: env, stack: stack}
+	return evaluator.Pause
+}
+
+// setBreakpoint は :break <line> を実行する
+// 最初のブレークポイントを設定したときから、入力の評価をデバッガの評価器で行う
+func (r *REPL) setBreakpoint(args string) {
+	line, err := strconv.Atoi(args)
+	if err != nil || line < 1 {
+		io.WriteString(r.Out, "usage: :break <line>\n")
+		return
+	}
+	if r.debugger == nil {
+		r.debugger = newDebugger(r.Out, r.Options)
+	}
+	r.debugger.breakpoints[line] = true
+	fmt.Fprintf(r.Out, "breakpoint set at line %d\n", line)
+}
+
+// runFile は :run <file> を実行する。ファイルの内容を入力したのと同じように評価し、行番号はファイルの行になる
+func (r *REPL) runFile(path string) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(r.Out, "run failed: %s\n", err)
+		return
+	}
+	r.execute(string(src), 0, r.timing)
+}
+
+// debug は program をデバッガの下で評価し、結果を返す
+func (r *REPL) debug(ctx context.Context, program ast.Node) object.Object {
+	d := r.debugger
+	d.mode = debugContinue
+	done := make(chan object.Object, 1)
+	go func() {
+		done <- d.ev.EvalContext(ctx, program, r.Env)
+	}()
+
+	for {
+		select {
+		case result := <-done:
+			return result
+		case p := <-d.paused:
+			r.showPause(p)
+			r.debugCommands(p)
+			d.ev.Resume()
+		}
+	}
+}
+
+func (r *REPL) showPause(p debugPause) {
+	line, _ := evaluator.Position(p.stmt)
+	fmt.Fprintf(r.Out, "paused at line %d: %s\n", line, strings.TrimSpace(ast.Format(p.stmt)))
+}
+
+// debugCommands は評価を再開するコマンドが入力されるまで (debug) プロンプトでコマンドを読んで実行する
+func (r *REPL) debugCommands(p debugPause) {
+	d := r.debugger
+	for {
+		line, err := r.reader.ReadLine(r.style.prompt(DEBUG_PROMPT))
+		if err != nil {
+			// 入力が終わるか Ctrl-C が押されたら評価を打ち切る
+			d.mode = debugAbort
+			return
+		}
+		name, args := strings.TrimSpace(line), ""
+		if i := strings.IndexAny(name, " \t"); i >= 0 {
+			name, args = name[:i], strings.TrimSpace(name[i+1:])
+		}
+
+		switch name {
+		case "step", "s":
+			d.mode = debugStep
+			return
+		case "next", "n":
+			d.mode, d.depth = debugNext, len(p.stack)
+			return
+		case "continue", "c":
+			d.mode = debugContinue
+			return
+		case "print", "p":
+			r.debugPrint(args, p.env)
+		case "where", "w":
+			if len(p.stack) == 0 {
+				io.WriteString(r.Out, "  at top level\n")
+			}
+			for _, frame := range p.stack {
+				fmt.Fprintf(r.Out, "  %s\n", frame)
+			}
+		default:
+			fmt.Fprintf(r.Out, "unknown debugger command: %s\n", line)
+			io.WriteString(r.Out, "commands: step, next, continue, print <expr>, where\n")
+		}
+	}
+}
+
+// debugPrint は止まっている環境で式を評価して表示する
+// 止まっている評価器を使うと式の中の関数呼び出しでもフックが呼ばれるので、別の評価器で評価する
+func (r *REPL) debugPrint(input string, env *object.Environment) {
+	if input == "" {
+		io.WriteString(r.Out, "usage: print <expr>\n")
+		return
+	}
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		printParseErrors(r.Out, r.style, input, p.ErrorDetails())
+		return
+	}
+	result := evaluator.New(evaluator.WithOutput(r.Out)).Eval(program, env)
+	if result == nil {
+		result = object.NULL
+	}
+	io.WriteString(r.Out, r.style.value(result))
+	io.WriteString(r.Out, "\n")
+}
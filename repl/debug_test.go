@@ -0,0 +1,58 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDebugger(t *testing.T) {
+	input := `:break 5
+:run testdata/debug.mky
+where
+print a
+step
+where
+print x
+next
+next
+print a
+hop
+continue
+`
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out, Options{NoPrelude: true})
+	want := `breakpoint set at line 5
+paused at line 5: let a = double(3);
+  at top level
+ERROR: line 1, column 1: NameError: identifier not found: a
+paused at line 2: let y = x * 2;
+  at double (line 5, column 9)
+3
+paused at line 3: y;
+paused at line 6: let b = a + 1;
+6
+unknown debugger command: hop
+commands: step, next, continue, print <expr>, where
+7
+7
+`
+	if out.String() != want {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", want, out.String())
+	}
+}
+
+func TestDebuggerAbortsAtEndOfInput(t *testing.T) {
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(":break 1\n1; 2\n"), &out, Options{NoPrelude: true})
+	want := "breakpoint set at line 1\npaused at line 1: 1;\nERROR: line 1, column 4: LimitError: evaluation aborted by statement hook\n"
+	if out.String() != want {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", want, out.String())
+	}
+
+	out.Reset()
+	StartWithOptions(strings.NewReader(":break x\n:run testdata/missing.mky\n"), &out, Options{NoPrelude: true})
+	if !strings.HasPrefix(out.String(), "usage: :break <line>\nrun failed: ") {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
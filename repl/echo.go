@@ -0,0 +1,38 @@
+package repl
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// ShouldEcho は、最後に評価した文が last で結果が result の入力について、結果を表示するかどうかを返す
+// REPL と monkey -e、-print-last を付けたスクリプトの実行は、この判定で最後の値を表示する
+// 表示するのは最後の文が式文（ブロック文ならその最後の文が式文）で、値が NULL でない場合だけ
+// let や return で終わる入力の値は表示しない。エラーはこの判定によらず表示すること
+// ただしスクリプトの実行では、トップレベルの return で終えた場合は return した値を表示する（main.go の run）
+func ShouldEcho(last ast.Statement, result object.Object) bool {
+	if result == nil || result == object.NULL {
+		return false
+	}
+	for {
+		switch stmt := last.(type) {
+		case *ast.ExpressionStatement:
+			return true
+		case *ast.BlockStatement:
+			if len(stmt.Statements) == 0 {
+				return false
+			}
+			last = stmt.Statements[len(stmt.Statements)-1]
+		default:
+			return false
+		}
+	}
+}
+
+// LastStatement は program の最後の文を返す。文がなければ nil
+func LastStatement(program *ast.Program) ast.Statement {
+	if len(program.Statements) == 0 {
+		return nil
+	}
+	return program.Statements[len(program.Statements)-1]
+}
@@ -0,0 +1,70 @@
+package repl
+
+import (
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/object"
+	"monkey/vm"
+)
+
+// 評価に使うバックエンドの名前
+const (
+	// 構文木をたどって評価する（既定）
+	EngineEval = "eval"
+	// バイトコードにコンパイルして仮想マシンで実行する
+	EngineVM = "vm"
+)
+
+// VMRunner は入力ごとにコンパイルして仮想マシンで実行する
+// 以前の入力で定義した大域変数を次の入力でも使える
+type VMRunner struct {
+	symbols   *compiler.SymbolTable
+	constants []object.Object
+	globals   []object.Object
+	// 直前の Run がトップレベルの return で終わったか
+	returned bool
+}
+
+func NewVMRunner() *VMRunner {
+	return &VMRunner{
+		symbols:   compiler.NewSymbolTable(),
+		constants: []object.Object{},
+		globals:   make([]object.Object, vm.GlobalsSize),
+	}
+}
+
+// Run は node をコンパイルして実行し、最後の式文の値（トップレベルの return で終えた場合は return した値）を返す
+// コンパイルや実行のエラーは評価器と同じく *object.Error で返す。コンパイルできなければ何も実行しない
+func (v *VMRunner) Run(node ast.Node) object.Object {
+	comp := compiler.NewWithState(v.symbols, v.constants)
+	if err := comp.Compile(node); err != nil {
+		return compileError(err)
+	}
+	bytecode := comp.Bytecode()
+	v.constants = bytecode.Constants
+
+	machine := vm.NewWithGlobalsStore(bytecode, v.globals)
+	err := machine.Run()
+	v.returned = machine.Returned()
+	if err != nil {
+		if vmErr, ok := err.(*vm.Error); ok {
+			// エラーの種類や exit() の終了コードを残す
+			return vmErr.Object
+		}
+		return &object.Error{Message: err.Error()}
+	}
+	return machine.LastPoppedStackElem()
+}
+
+// Returned は直前の Run がトップレベルの return で終わったかどうかを返す
+func (v *VMRunner) Returned() bool {
+	return v.returned
+}
+
+// compileError はコンパイルのエラーを、評価器のエラーと同じように表示できる *object.Error にする
+func compileError(err error) *object.Error {
+	if compileErr, ok := err.(*compiler.Error); ok {
+		return &object.Error{Message: "compile error: " + compileErr.Message, Line: compileErr.Line, Column: compileErr.Column}
+	}
+	return &object.Error{Message: "compile error: " + err.Error()}
+}
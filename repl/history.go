@@ -0,0 +1,72 @@
+package repl
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// 履歴に残す行数の既定値
+const DefaultHistorySize = 1000
+
+// History は入力した行の履歴
+// path が空でなければ Add のたびにファイルへ保存する
+type History struct {
+	lines []string
+	max   int
+	path  string
+}
+
+// NewHistory はファイルに保存しない履歴を生成する
+func NewHistory(max int) *History {
+	return &History{max: max}
+}
+
+// LoadHistory は path のファイルから履歴を読み込む。ファイルがなければ空の履歴を返す
+func LoadHistory(path string, max int) (*History, error) {
+	h := &History{max: max, path: path}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.add(scanner.Text())
+	}
+	return h, scanner.Err()
+}
+
+// Add は line を履歴の末尾に加えて保存する
+// 空行と直前と同じ行は加えない
+func (h *History) Add(line string) error {
+	if !h.add(line) || h.path == "" {
+		return nil
+	}
+	return h.save()
+}
+
+func (h *History) add(line string) bool {
+	if strings.TrimSpace(line) == "" || (len(h.lines) > 0 && h.lines[len(h.lines)-1] == line) {
+		return false
+	}
+	h.lines = append(h.lines, line)
+	if h.max > 0 && len(h.lines) > h.max {
+		h.lines = h.lines[len(h.lines)-h.max:]
+	}
+	return true
+}
+
+// Lines は古い順に履歴を返す
+func (h *History) Lines() []string {
+	return h.lines
+}
+
+func (h *History) save() error {
+	return ioutil.WriteFile(h.path, []byte(strings.Join(h.lines, "\n")+"\n"), 0600)
+}
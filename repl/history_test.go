@@ -0,0 +1,50 @@
+package repl
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHistoryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatalf("missing history file should not be an error. got=%s", err)
+	}
+	for _, line := range []string{"let a = 1", "", "a", "a", "a + 1", "a * 2"} {
+		if err := h.Add(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 空行と連続した重複は残さず、古い行から捨てる
+	expected := []string{"a", "a + 1", "a * 2"}
+	if !reflect.DeepEqual(h.Lines(), expected) {
+		t.Errorf("wrong lines. want=%q, got=%q", expected, h.Lines())
+	}
+
+	saved, _ := ioutil.ReadFile(path)
+	if string(saved) != "a\na + 1\na * 2\n" {
+		t.Errorf("wrong file content. got=%q", saved)
+	}
+
+	reloaded, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded.Lines(), expected) {
+		t.Errorf("history not restored. want=%q, got=%q", expected, reloaded.Lines())
+	}
+}
+
+func TestHistoryWithoutFile(t *testing.T) {
+	h := NewHistory(0)
+	h.Add("1")
+	h.Add("2")
+	if !reflect.DeepEqual(h.Lines(), []string{"1", "2"}) {
+		t.Errorf("wrong lines. got=%q", h.Lines())
+	}
+}
@@ -0,0 +1,73 @@
+package repl
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/object"
+	"os"
+	"os/signal"
+)
+
+// notifyInterrupts は SIGINT を受け取るチャネルと、受け取りをやめる関数を返す
+// 行の入力中は端末が Ctrl-C をシグナルにしないので、シグナルが届くのは評価中だけ
+func notifyInterrupts() (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	return ch, func() { signal.Stop(ch) }
+}
+
+// returned は直前に evaluate した入力がトップレベルの return で終わったかどうかを返す
+func (r *REPL) returned() bool {
+	switch {
+	case r.Engine == EngineVM:
+		return r.vm.Returned()
+	case r.debugger != nil:
+		return r.debugger.ev.Returned()
+	default:
+		return r.ev.Returned()
+	}
+}
+
+// evaluate は program を評価する。評価中に r.interrupt に値が届いた場合は評価を中断し、trueを返す
+// 中断しても、それまでに束縛した名前は環境に残る
+// Engine が EngineVM なら仮想マシンで実行する。仮想マシンの実行は中断できない
+func (r *REPL) evaluate(program ast.Node) (object.Object, bool) {
+	if r.Engine == EngineVM {
+		return r.vm.Run(program), false
+	}
+	if r.interrupt == nil {
+		if r.debugger != nil {
+			return r.debug(context.Background(), program), false
+		}
+		return r.ev.Eval(program, r.Env), false
+	}
+
+	// 評価の前に届いていた古い割り込みは捨てる
+	for drained := false; !drained; {
+		select {
+		case <-r.interrupt:
+		default:
+			drained = true
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.interrupt:
+			cancel()
+		case <-done:
+		}
+	}()
+
+	var result object.Object
+	if r.debugger != nil {
+		result = r.debug(ctx, program)
+	} else {
+		result = r.ev.EvalContext(ctx, program, r.Env)
+	}
+	return result, ctx.Err() != nil
+}
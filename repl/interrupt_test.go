@@ -0,0 +1,65 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"monkey/evaluator"
+	"monkey/object"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterruptCancelsEvaluation(t *testing.T) {
+	interrupt := make(chan os.Signal)
+	go func() {
+		// 割り込みは評価中にしか受け取らないので、無限ループの評価中に届く
+		interrupt <- os.Interrupt
+	}()
+
+	// 割り込みより前に終わる評価がないよう、最初の行で無限ループに入る
+	input := `let x = 5; let loop = fn() { loop() }; loop()
+x
+`
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		StartWithOptions(strings.NewReader(input), &out, Options{NoPrelude: true, Interrupt: interrupt})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("evaluation was not interrupted")
+	}
+	if out.String() != "interrupted\n5\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestCtrlCAtPrompt(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 1回目は入力中の行を捨てるだけ
+		{"1 +\x03 2\r", "(press Ctrl-C again to exit)\n2\n"},
+		// 続けて押すと終了する
+		{"\x03\x032\r", "(press Ctrl-C again to exit)\n"},
+		// 間に入力があれば終了しない
+		{"\x031\r\x032\r", "(press Ctrl-C again to exit)\n1\n(press Ctrl-C again to exit)\n2\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		ev := evaluator.New()
+		r := &REPL{Out: &out, ev: ev, Env: object.NewEnvironment(), now: time.Now}
+		term := &terminalReader{in: bufio.NewReader(strings.NewReader(tt.input)), out: &bytes.Buffer{}, history: NewHistory(0)}
+		r.run(term)
+		if out.String() != tt.expected {
+			t.Errorf("%q: wrong output. want=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted は行の入力中に Ctrl-C が押されたことを表す
+var ErrInterrupted = errors.New("interrupted")
+
+// LineReader はプロンプトを表示して1行を読む
+// 入力の終わりでは io.EOF を返す
+type LineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// completeFunc は行とカーソルのバイト位置から補完の候補を返す
+type completeFunc func(line string, pos int) []string
+
+// newLineReader は in が端末なら行編集のできる LineReader を、そうでなければ1行ずつ読むだけの LineReader を返す
+func newLineReader(in io.Reader, out io.Writer, history *History, complete completeFunc) LineReader {
+	if f, ok := in.(*os.File); ok && isTerminal(f.Fd()) {
+		return &terminalReader{in: bufio.NewReader(f), out: out, history: history, complete: complete, fd: f.Fd(), raw: true}
+	}
+	return &scannerReader{scanner: bufio.NewScanner(in), promptOut: out}
+}
+
+// scannerReader はパイプなど端末でない入力から1行ずつ読む
+type scannerReader struct {
+	scanner *bufio.Scanner
+	// プロンプトの出力先。nil ならプロンプトを表示しない
+	promptOut io.Writer
+}
+
+func (r *scannerReader) ReadLine(prompt string) (string, error) {
+	if r.promptOut != nil {
+		io.WriteString(r.promptOut, prompt)
+	}
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// terminalReader は端末を非カノニカルモードにして1文字ずつ読み、行を編集する
+// 対応するキー: 左右の矢印, 上下の矢印（履歴）, Tab（補完）, Ctrl-A, Ctrl-E, Ctrl-W, Ctrl-U, Backspace, Ctrl-D, Ctrl-C
+type terminalReader struct {
+	in       *bufio.Reader
+	out      io.Writer
+	history  *History
+	complete completeFunc
+	fd       uintptr
+	// falseなら端末のモードを切り替えない（テスト用）
+	raw bool
+}
+
+const (
+	keyCtrlA     = 1
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+func (r *terminalReader) ReadLine(prompt string) (string, error) {
+	if r.raw {
+		restore, err := makeRaw(r.fd)
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e := &lineEditor{prompt: prompt, history: r.history.Lines(), index: len(r.history.Lines())}
+	r.redraw(e)
+	for {
+		ch, _, err := r.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch ch {
+		case '\r', '\n':
+			io.WriteString(r.out, "\r\n")
+			line := string(e.buf)
+			r.history.Add(line)
+			return line, nil
+		case keyCtrlC:
+			io.WriteString(r.out, "^C\r\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				io.WriteString(r.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteForward()
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.buf)
+		case keyCtrlU:
+			e.buf = e.buf[e.pos:]
+			e.pos = 0
+		case keyCtrlW:
+			e.deleteWord()
+		case keyBackspace, keyDelete:
+			e.deleteBackward()
+		case keyTab:
+			r.completeWord(e)
+		case keyEscape:
+			r.readEscape(e)
+		default:
+			if unicode.IsPrint(ch) {
+				e.insert(ch)
+			}
+		}
+		r.redraw(e)
+	}
+}
+
+// カーソルの前の単語を候補に共通する部分まで補完する
+// それ以上補完できず候補が複数ある場合は候補を一覧表示する
+func (r *terminalReader) completeWord(e *lineEditor) {
+	if r.complete == nil {
+		return
+	}
+	line := string(e.buf)
+	pos := len(string(e.buf[:e.pos]))
+	candidates := r.complete(line, pos)
+	if len(candidates) == 0 {
+		return
+	}
+
+	word := line[wordStart(line, pos):pos]
+	if common := commonPrefix(candidates); len(common) > len(word) {
+		for _, ch := range common[len(word):] {
+			e.insert(ch)
+		}
+		return
+	}
+	if len(candidates) > 1 {
+		fmt.Fprintf(r.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
+
+// "ESC [ X" の形の矢印キーを読む
+func (r *terminalReader) readEscape(e *lineEditor) {
+	if b, err := r.in.ReadByte(); err != nil || b != '[' {
+		return
+	}
+	b, err := r.in.ReadByte()
+	if err != nil {
+		return
+	}
+	switch b {
+	case 'A':
+		e.previous()
+	case 'B':
+		e.next()
+	case 'C':
+		if e.pos < len(e.buf) {
+			e.pos++
+		}
+	case 'D':
+		if e.pos > 0 {
+			e.pos--
+		}
+	case 'H':
+		e.pos = 0
+	case 'F':
+		e.pos = len(e.buf)
+	}
+}
+
+// 行を描き直し、カーソルを編集位置に移す
+func (r *terminalReader) redraw(e *lineEditor) {
+	fmt.Fprintf(r.out, "\r%s%s\x1b[K\r", e.prompt, string(e.buf))
+	if col := visibleWidth(e.prompt) + e.pos; col > 0 {
+		fmt.Fprintf(r.out, "\x1b[%dC", col)
+	}
+}
+
+// lineEditor は編集中の行
+type lineEditor struct {
+	prompt string
+	buf    []rune
+	pos    int
+	// 履歴と、いま表示している履歴の位置（len(history) なら新しい行）
+	history []string
+	index   int
+	// 履歴をたどる前に入力していた行
+	draft []rune
+}
+
+func (e *lineEditor) insert(ch rune) {
+	e.buf = append(e.buf[:e.pos], append([]rune{ch}, e.buf[e.pos:]...)...)
+	e.pos++
+}
+
+func (e *lineEditor) deleteBackward() {
+	if e.pos == 0 {
+		return
+	}
+	e.buf = append(e.buf[:e.pos-1], e.buf[e.pos:]...)
+	e.pos--
+}
+
+func (e *lineEditor) deleteForward() {
+	if e.pos == len(e.buf) {
+		return
+	}
+	e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+}
+
+// カーソルの前の単語と、その後ろの空白を消す
+func (e *lineEditor) deleteWord() {
+	start := e.pos
+	for start > 0 && unicode.IsSpace(e.buf[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+		start--
+	}
+	e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+	e.pos = start
+}
+
+func (e *lineEditor) previous() {
+	if e.index == 0 {
+		return
+	}
+	if e.index == len(e.history) {
+		e.draft = e.buf
+	}
+	e.index--
+	e.show([]rune(e.history[e.index]))
+}
+
+func (e *lineEditor) next() {
+	if e.index == len(e.history) {
+		return
+	}
+	e.index++
+	if e.index == len(e.history) {
+		e.show(e.draft)
+		return
+	}
+	e.show([]rune(e.history[e.index]))
+}
+
+func (e *lineEditor) show(line []rune) {
+	e.buf = append([]rune(nil), line...)
+	e.pos = len(e.buf)
+}
@@ -0,0 +1,70 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func newTestTerminalReader(input string, history *History) *terminalReader {
+	return &terminalReader{in: bufio.NewReader(strings.NewReader(input)), out: &bytes.Buffer{}, history: history}
+}
+
+func TestTerminalReaderEditing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1\r", "let x = 1"},
+		{"abc\x01X\r", "Xabc"},
+		{"abc\x01\x05X\r", "abcX"},
+		{"let x = foo bar\x17\x17baz\r", "let x = baz"},
+		{"abcd\x7f\x7f\r", "ab"},
+		{"ac\x1b[Db\r", "abc"},
+		{"ab\x1b[D\x1b[D\x1b[C\x04\r", "a"},
+		{"abc\x15xyz\r", "xyz"},
+		{"あい\x08う\r", "あう"},
+	}
+
+	for _, tt := range tests {
+		r := newTestTerminalReader(tt.input, NewHistory(0))
+		line, err := r.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatalf("%q: unexpected error %s", tt.input, err)
+		}
+		if line != tt.expected {
+			t.Errorf("%q: wrong line. want=%q, got=%q", tt.input, tt.expected, line)
+		}
+	}
+}
+
+func TestTerminalReaderHistory(t *testing.T) {
+	history := NewHistory(0)
+	r := newTestTerminalReader("first\rsecond\r\x1b[A\x1b[A\r\x1b[A\x1b[A\x1b[Bx\rdraft\x1b[A\x1b[B!\r", history)
+
+	expected := []string{"first", "second", "first", "firstx", "draft!"}
+	for _, want := range expected {
+		line, err := r.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != want {
+			t.Errorf("wrong line. want=%q, got=%q", want, line)
+		}
+	}
+	if len(history.Lines()) != 5 {
+		t.Errorf("lines should be added to the history. got=%q", history.Lines())
+	}
+}
+
+func TestTerminalReaderControlKeys(t *testing.T) {
+	r := newTestTerminalReader("abc\x03\x04", NewHistory(0))
+	if _, err := r.ReadLine(PROMPT); err != ErrInterrupted {
+		t.Errorf("Ctrl-C should interrupt. got=%v", err)
+	}
+	if _, err := r.ReadLine(PROMPT); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line should be EOF. got=%v", err)
+	}
+}
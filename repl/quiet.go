@@ -0,0 +1,40 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// 対話しない場合に構文エラーを errOut に書く
+// 行番号は src の前にある offset 行を足して、入力全体での位置にする
+func (r *REPL) printErrorsQuietly(src string, errors []parser.Error, offset int) {
+	for _, err := range errors {
+		io.WriteString(r.Err, Snippet(src, err.Line, err.Column))
+		line := err.Line
+		if line > 0 {
+			line += offset
+		}
+		fmt.Fprintf(r.Err, "%d:%d: %s\n", line, err.Column, err.Message)
+	}
+	r.status = 1
+}
+
+// 対話しない場合に評価の結果を書く。NULL は書かず、エラーは errOut に書く
+func (r *REPL) printResultQuietly(result object.Object, offset int) {
+	if result == nil || result == object.NULL {
+		return
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		if errObj.Line > 0 {
+			errObj.Line += offset
+		}
+		fmt.Fprintln(r.Err, errObj.Inspect())
+		io.WriteString(r.Err, errObj.StackTrace())
+		r.status = 1
+		return
+	}
+	// 対話しない場合は色を付けないので、:pretty の設定だけが効く
+	fmt.Fprintln(r.Out, r.style.value(result))
+}
@@ -7,11 +7,21 @@ import (
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
+	"monkey/optimizer"
 	"monkey/parser"
+	"monkey/prelude"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 const PROMPT = ">> "
 
+// 入力が続いているときのプロンプト
+const CONTINUATION_PROMPT = "... "
+
 const MONKEY_FACE = `            __,__
    .--.  .-"     "-.  .--.
   / .. \/  .-. .-.  \/ .. \
@@ -25,41 +35,386 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
+// Options はREPLの動作の設定
+type Options struct {
+	// 評価の前に optimizer.Fold で定数を畳み込む
+	Fold bool
+	// 標準のプレリュードを読み込まない
+	NoPrelude bool
+	// 標準のプレリュードの代わりに読み込むファイル
+	PreludePath string
+	// 端末から入力した行を保存するファイル（空なら保存しない）
+	HistoryPath string
+	// 値が届くと実行中の評価を中断する
+	// nil で入力が端末の場合は SIGINT を受け取るよう設定する
+	Interrupt <-chan os.Signal
+	// 評価に使うバックエンド。EngineEval（空の場合も）か EngineVM
+	Engine string
+	// 同じスコープで同じ名前を let で束縛し直すとエラーにする（評価器のみ）
+	Strict bool
+}
+
+// evaluatorOptions は opts に従って評価器の設定を返す
+func (opts Options) evaluatorOptions(out io.Writer) []evaluator.Option {
+	evalOpts := []evaluator.Option{evaluator.WithOutput(out)}
+	if opts.Strict {
+		evalOpts = append(evalOpts, evaluator.WithStrict())
+	}
+	return evalOpts
+}
+
+// NewEnvironment は opts に従ってプレリュードを読み込み、ユーザーのコードを評価する環境を返す
+// プレリュードの束縛は外側の環境に置くので、ユーザーの let で上書きでき、:save の対象にもならない
+func NewEnvironment(ev *evaluator.Evaluator, opts Options) (*object.Environment, error) {
+	var base *object.Environment
+	var err error
+	switch {
+	case opts.NoPrelude:
+		return object.NewEnvironment(), nil
+	case opts.PreludePath != "":
+		base, err = prelude.LoadFile(ev, opts.PreludePath)
+	default:
+		base, err = prelude.Load(ev)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return object.NewEnclosedEnvironment(base), nil
+}
+
+// REPL は入力を1行ずつ読んで評価し、結果を表示する
+// New で生成し、必要に応じてフィールドを変更してから Start か RunNonInteractive を呼ぶ
+type REPL struct {
+	In  io.Reader
+	Out io.Writer
+	// 対話しない場合にエラーを書く
+	Err io.Writer
+	// 入力を促すプロンプトと、括弧などが閉じずに入力が続いているときのプロンプト
+	Prompt             string
+	ContinuationPrompt string
+	// trueなら開始時に挨拶を表示する
+	ShowBanner bool
+	// falseなら出力に色を付けない
+	// trueでも、Out が端末でないか NO_COLOR 環境変数が設定されていれば色を付けない
+	Color bool
+	// 評価に使う環境。nil なら Options に従ってプレリュードを読み込んだ環境を作る
+	Env *object.Environment
+	// 対話する場合に評価結果を表示する最大のバイト数。長い結果は切り詰め、:full で全体を表示する
+	// 0なら切り詰めない。:set maxout で変更できる
+	MaxOutput int
+	Options
+
+	ev *evaluator.Evaluator
+	// Engine が EngineVM の場合に使う
+	vm    *VMRunner
+	style styler
+	// プロンプトの出力先。nil なら Out
+	promptOut io.Writer
+	// trueなら対話せず、プロンプトを出さずにエラーを Err に書く
+	quiet bool
+	// 対話しない場合の終了コード
+	status int
+	// 値が届くと実行中の評価を中断する
+	interrupt <-chan os.Signal
+	// trueなら評価のたびにかかった時間を表示する
+	timing bool
+	// 現在時刻を返す。テストでは固定の時刻に差し替える
+	now func() time.Time
+	// trueになるとREPLを終了する
+	quit bool
+	// 入力を読む。デバッガで止まっている間のコマンドもここから読む
+	reader LineReader
+	// :break でブレークポイントを設定すると作られる
+	debugger *debugger
+	// 最後に表示した評価結果。:full で切り詰めずに表示し直す
+	last object.Object
+}
+
+// 評価結果を表示する最大のバイト数の既定値
+const DefaultMaxOutput = 4096
+
+// New は in から読んで out に書く、標準のプロンプトのREPLを生成する
+func New(in io.Reader, out io.Writer) *REPL {
+	return &REPL{
+		In:                 in,
+		Out:                out,
+		Err:                os.Stderr,
+		Prompt:             PROMPT,
+		ContinuationPrompt: CONTINUATION_PROMPT,
+		Color:              true,
+		MaxOutput:          DefaultMaxOutput,
+		now:                time.Now,
+	}
+}
+
+// Start は標準の設定でREPLを実行する
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	StartWithOptions(in, out, Options{})
+}
 
-	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+// StartWithOptions は opts の設定でREPLを実行する
+// 端末でない入力に対しては、従来どおりプロンプトを out ではなく標準出力に表示する
+func StartWithOptions(in io.Reader, out io.Writer, opts Options) {
+	r := New(in, out)
+	r.Options = opts
+	r.promptOut = os.Stdout
+	r.Start()
+}
+
+// RunNonInteractive は opts の設定で対話しないREPLを実行し、終了コードを返す
+func RunNonInteractive(in io.Reader, out, errOut io.Writer, opts Options) int {
+	r := New(in, out)
+	r.Err = errOut
+	r.Options = opts
+	return r.RunNonInteractive()
+}
+
+// Start は入力が終わるか :quit が入力されるまで、読んで評価して表示することを繰り返す
+func (r *REPL) Start() {
+	if err := r.init(); err != nil {
+		fmt.Fprintln(r.Out, err)
+		return
+	}
+	if r.ShowBanner {
+		r.printBanner()
+	}
+
+	history := NewHistory(DefaultHistorySize)
+	if r.HistoryPath != "" {
+		var err error
+		if history, err = LoadHistory(r.HistoryPath, DefaultHistorySize); err != nil {
+			fmt.Fprintf(r.Out, "could not load history: %s\n", err)
+			history = NewHistory(DefaultHistorySize)
+		}
+	}
+	promptOut := r.promptOut
+	if promptOut == nil {
+		promptOut = r.Out
+	}
+	reader := newLineReader(r.In, promptOut, history, func(line string, pos int) []string {
+		return Complete(line, pos, r.Env)
+	})
+	if _, ok := reader.(*terminalReader); ok && r.interrupt == nil {
+		interrupt, stop := notifyInterrupts()
+		defer stop()
+		r.interrupt = interrupt
+	}
+
+	r.run(reader)
+}
+
+// RunNonInteractive はパイプなどから読んだ入力を、プロンプトを出さずに1つの環境で評価し、終了コードを返す
+// 結果は NULL 以外を Out に、エラーは Err に書く
+// エラーが1つでもあれば1を、exit(n) が呼ばれればそこで終えてnを返す
+func (r *REPL) RunNonInteractive() int {
+	r.quiet = true
+	if err := r.init(); err != nil {
+		fmt.Fprintln(r.Err, err)
+		return 1
+	}
+	r.run(&scannerReader{scanner: bufio.NewScanner(r.In)})
+	return r.status
+}
+
+// 評価器と環境を用意する
+func (r *REPL) init() error {
+	r.ev = evaluator.New(r.evaluatorOptions(r.Out)...)
+	r.vm = NewVMRunner()
+	r.interrupt = r.Interrupt
+	r.style = styler{enabled: r.Color && !r.quiet && colorEnabled(r.Out)}
+	if r.now == nil {
+		r.now = time.Now
+	}
+	if r.Env != nil {
+		return nil
+	}
+	env, err := NewEnvironment(r.ev, r.Options)
+	if err != nil {
+		return err
+	}
+	r.Env = env
+	return nil
+}
+
+func (r *REPL) printBanner() {
+	name := "there"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	fmt.Fprintf(r.Out, "Hello %s! This is the Monkey programing language!\n", name)
+	fmt.Fprintf(r.Out, "Feel free to type in commands\n")
+}
+
+// IsTerminal は f が端末かどうかを返す
+func IsTerminal(f *os.File) bool {
+	return isTerminal(f.Fd())
+}
+
+// run は reader から読んだ入力を評価し、結果を表示する
+func (r *REPL) run(reader LineReader) {
+	r.reader = reader
+	// 括弧や文字列が閉じていない間は行をためておく
+	var pending []string
+	// 読んだ行数と、pending の先頭の行番号
+	lines, firstLine := 0, 0
+	// 直前の入力か評価が Ctrl-C で中断された場合はtrue
+	interrupted := false
+	for !r.quit {
+		prompt := r.Prompt
+		if len(pending) > 0 {
+			prompt = r.ContinuationPrompt
+		}
+		line, err := reader.ReadLine(r.style.prompt(prompt))
+		if err == ErrInterrupted {
+			// 続けて Ctrl-C が押されたら終了し、そうでなければ入力中の行を捨てる
+			if interrupted {
+				return
+			}
+			interrupted = true
+			pending = nil
+			io.WriteString(r.Out, "(press Ctrl-C again to exit)\n")
+			continue
+		}
+		if err != nil {
 			return
 		}
+		interrupted = false
+		lines++
 
-		line := scanner.Text()
-		lx := lexer.New(line)
-		psr := parser.New(lx)
+		if len(pending) == 0 && strings.HasPrefix(line, ":") {
+			r.runCommand(line)
+			continue
+		}
+		if len(pending) > 0 && strings.TrimSpace(line) == "" {
+			// 空行で入力を取り消す
+			pending = nil
+			continue
+		}
 
-		program := psr.ParseProgram()
-		if len(psr.Errors()) > 0 {
-			printParseErrors(out, psr.Errors())
+		if len(pending) == 0 {
+			firstLine = lines
+		}
+		pending = append(pending, line)
+		input := strings.Join(pending, "\n")
+		if lexer.Incomplete(input) {
 			continue
 		}
+		pending = nil
+
+		interrupted = r.execute(input, firstLine-1, r.timing)
+	}
+}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+// execute は input を構文解析して評価し、結果を表示する。評価が中断された場合はtrueを返す
+// offset は input の前にある行数で、対話しない場合にエラーの行番号を入力全体での位置にするのに使う
+// timed がtrueなら評価にかかった時間も表示する
+func (r *REPL) execute(input string, offset int, timed bool) bool {
+	start := r.now()
+	psr := parser.New(lexer.New(input))
+	program := psr.ParseProgram()
+	if len(psr.Errors()) > 0 {
+		if r.quiet {
+			r.printErrorsQuietly(input, psr.ErrorDetails(), offset)
+		} else {
+			printParseErrors(r.Out, r.style, input, psr.ErrorDetails())
 		}
+		return false
+	}
+	if r.Fold {
+		program = optimizer.Fold(program)
+	}
+	parsed := r.now()
+
+	evaluated, cancelled := r.evaluate(program)
+	evaluatedAt := r.now()
+	if cancelled {
+		io.WriteString(r.Out, "interrupted\n")
+		return true
+	}
+	if errObj, ok := evaluated.(*object.Error); ok && errObj.Exit {
+		r.status = errObj.ExitCode
+		r.quit = true
+		return false
+	}
+
+	// エラー以外は、式文の NULL でない値だけを表示する。トップレベルの return で終えた入力の値は表示しない
+	if _, isError := evaluated.(*object.Error); !isError && (r.returned() || !ShouldEcho(LastStatement(program), evaluated)) {
+		evaluated = nil
+	}
+	if r.quiet {
+		r.printResultQuietly(evaluated, offset)
+	} else if evaluated != nil {
+		r.last = evaluated
+		r.printResult(evaluated, r.MaxOutput)
+	}
+	if timed {
+		fmt.Fprintf(r.Out, "time: %s (parse %s)\n",
+			formatDuration(evaluatedAt.Sub(parsed)), formatDuration(parsed.Sub(start)))
+	}
+	return false
+}
+
+// printResult は評価結果を表示する。max バイトより長い結果は切り詰める（0なら切り詰めない）
+func (r *REPL) printResult(obj object.Object, max int) {
+	text, truncated := truncateOutput(r.style.text(obj), max)
+	r.writeResult(obj, text, truncated)
+}
+
+// writeResult は obj を表示する文字列 text を色付きで書く。エラーならスタックトレースも書く
+func (r *REPL) writeResult(obj object.Object, text string, truncated bool) {
+	io.WriteString(r.Out, r.style.color(obj, text))
+	if truncated {
+		io.WriteString(r.Out, r.style.apply(styleDim, "… (use :full to show all)"))
+	}
+	io.WriteString(r.Out, "\n")
+	if errObj, ok := obj.(*object.Error); ok {
+		io.WriteString(r.Out, errObj.StackTrace())
+	}
+}
+
+// truncateOutput は str が max バイトより長ければ、max バイト以内の文字の区切りで切り詰める
+// 切り詰めた場合は truncated がtrueになる。max が0以下なら切り詰めない
+func truncateOutput(str string, max int) (result string, truncated bool) {
+	if max <= 0 || len(str) <= max {
+		return str, false
+	}
+	end := max
+	for end > 0 && !utf8.RuneStart(str[end]) {
+		end--
+	}
+	return str[:end], true
+}
+
+func saveEnvironment(out io.Writer, path string, env *object.Environment) {
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(out, "save failed: %s\n", err)
+		return
+	}
+	defer f.Close()
+
+	skipped, err := evaluator.SaveEnvironment(f, env)
+	if err != nil {
+		fmt.Fprintf(out, "save failed: %s\n", err)
+		return
 	}
+	for _, msg := range skipped {
+		fmt.Fprintf(out, "skipped %s\n", msg)
+	}
+	fmt.Fprintf(out, "saved to %s\n", path)
 }
 
-func printParseErrors(out io.Writer, errors []string) {
-	io.WriteString(out, MONKEY_FACE)
-	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
-	io.WriteString(out, " parser errors:\n")
+func loadEnvironment(out io.Writer, path string, env *object.Environment) {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(out, "load failed: %s\n", err)
+		return
+	}
+	defer f.Close()
 
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+	if err := evaluator.LoadEnvironment(f, env); err != nil {
+		fmt.Fprintf(out, "load failed: %s\n", err)
+		return
 	}
+	fmt.Fprintf(out, "loaded from %s\n", path)
 }
@@ -0,0 +1,569 @@
+package repl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"monkey/object"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStartSurvivesRunawayRecursion(t *testing.T) {
+	input := `let f = fn() { f() };
+f();
+1 + 2
+`
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if !strings.Contains(out.String(), "maximum recursion depth exceeded") {
+		t.Errorf("recursion error not reported. got=%q", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "\n3\n") {
+		t.Errorf("REPL did not continue after the error. got=%q", out.String())
+	}
+}
+
+func TestSaveAndLoadCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	input := `let xs = [1, 2, 3]; let f = fn() { 1 };
+:save ` + path + `
+`
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	if !strings.Contains(out.String(), "skipped f: cannot save function\nsaved to "+path) {
+		t.Fatalf("wrong :save output. got=%q", out.String())
+	}
+
+	out.Reset()
+	Start(strings.NewReader(":load "+path+"\nxs[1]\nf\n"), &out)
+	if !strings.Contains(out.String(), "loaded from "+path+"\n2\n") {
+		t.Errorf("saved binding not restored. got=%q", out.String())
+	}
+	if !strings.Contains(out.String(), "identifier not found: f") {
+		t.Errorf("function should not be restored. got=%q", out.String())
+	}
+
+	out.Reset()
+	Start(strings.NewReader(":load\n:load "+filepath.Join(t.TempDir(), "missing.json")+"\n"), &out)
+	if !strings.Contains(out.String(), "unknown command: :load") || !strings.Contains(out.String(), "load failed:") {
+		t.Errorf("wrong error output. got=%q", out.String())
+	}
+}
+
+func TestStartWithFold(t *testing.T) {
+	input := `let day = 60 * 60 * 24;
+day / 3600
+1 / 0
+`
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out, Options{Fold: true})
+
+	if !strings.HasPrefix(out.String(), "24\n") {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+	if !strings.Contains(out.String(), "division by zero") {
+		t.Errorf("division by zero should still be reported. got=%q", out.String())
+	}
+}
+
+func TestPreludeOptions(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("sum([1, 2, 3])\n"), &out)
+	if out.String() != "6\n" {
+		t.Errorf("prelude should be loaded by default. got=%q", out.String())
+	}
+
+	out.Reset()
+	StartWithOptions(strings.NewReader("sum([1, 2, 3])\n"), &out, Options{NoPrelude: true})
+	if !strings.Contains(out.String(), "identifier not found: sum") {
+		t.Errorf("prelude should not be loaded. got=%q", out.String())
+	}
+
+	dir := t.TempDir()
+	custom := filepath.Join(dir, "custom.mky")
+	broken := filepath.Join(dir, "broken.mky")
+	ioutil.WriteFile(custom, []byte(`let answer = 42;`), 0644)
+	ioutil.WriteFile(broken, []byte(`let answer = ;`), 0644)
+
+	out.Reset()
+	StartWithOptions(strings.NewReader("answer\n"), &out, Options{PreludePath: custom})
+	if out.String() != "42\n" {
+		t.Errorf("custom prelude not loaded. got=%q", out.String())
+	}
+
+	out.Reset()
+	StartWithOptions(strings.NewReader("answer\n"), &out, Options{PreludePath: broken})
+	if !strings.HasPrefix(out.String(), "prelude "+broken+": parse error: ") {
+		t.Errorf("prelude errors should be reported. got=%q", out.String())
+	}
+}
+
+func TestMultilineInput(t *testing.T) {
+	input := `let add = fn(x, y) {
+  x + y
+};
+add(1,
+  2)
+let s = "a
+b";
+len(s)
+`
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	if out.String() != "3\n3\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestMultilineBracesInput(t *testing.T) {
+	// 行頭の { は、ハッシュリテラルに見えればハッシュ、そうでなければブロック文として読む
+	input := `{}
+{
+  "a": 1,
+  "b": [2,
+    3]
+}
+{
+  let x = 20;
+  let y = x + 1;
+  y * 2
+}
+x
+if (true) {
+}
+{ {"k": "v"} }
+`
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	want := "{}\n{\"a\":1, \"b\":[2, 3]}\n42\n20\n{\"k\":\"v\"}\n"
+	if out.String() != want {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", want, out.String())
+	}
+}
+
+func TestMultilineInputAbortAndInvalid(t *testing.T) {
+	// 空行で取り消した入力は評価しない
+	input := `let f = fn(x) {
+
+1 + 1
+`
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	if out.String() != "2\n" {
+		t.Errorf("aborted input should be discarded. got=%q", out.String())
+	}
+
+	// 閉じ括弧が多すぎる入力は続きを待たずにエラーにする
+	out.Reset()
+	Start(strings.NewReader("(1 + 2))\n4\n"), &out)
+	if !strings.Contains(out.String(), "parser errors") || !strings.HasSuffix(out.String(), "\n4\n") {
+		t.Errorf("invalid input should fail immediately. got=%q", out.String())
+	}
+}
+
+func TestMetaCommands(t *testing.T) {
+	input := `:help
+let xs = [1, 2, 3]; let name = "monkey";
+:env
+:reset
+:env
+xs
+:clear
+:nope
+:quit
+1 + 1
+`
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out, Options{NoPrelude: true})
+	got := out.String()
+
+	for _, want := range []string{
+		// 説明はいちばん長い書式（:ast [-json] <code>）に揃える
+		"  :help                show this help\n",
+		"  :load <file>         load bindings from a JSON file\n",
+		"  :doc [name]          describe a builtin, or list all builtins by category\n",
+		"  :ast [-json] <code>  show the syntax tree of code without evaluating it\n",
+		"  :set maxout <n>      print at most n bytes of each result (0 for no limit)\n",
+		"name: string = monkey\nxs: array = [1, 2, 3]\n",
+		"environment reset\nno bindings\n",
+		"identifier not found: xs",
+		"\x1b[H\x1b[2J",
+		"unknown command: :nope\ntype :help for a list of commands\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q. got=%q", want, got)
+		}
+	}
+	if strings.HasSuffix(got, "2\n") {
+		t.Errorf(":quit should end the REPL. got=%q", got)
+	}
+}
+
+func TestDocCommand(t *testing.T) {
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(":doc padLeft\n:doc sum\n:doc\n"), &out, Options{NoPrelude: true})
+	got := out.String()
+
+	for _, want := range []string{
+		"padLeft(s, width[, fill])\n  Pads s on the left with fill (a space by default) to at least width characters.\n",
+		// プレリュードの関数は組み込み関数ではない
+		"no documentation for sum\n",
+		"strings\n  build         Returns the string written to a string builder so far.\n",
+		"\nconcurrency\n  channel       ",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q. got=%q", want, got)
+		}
+	}
+	// 分類は DocCategories の順に並ぶ
+	if strings.Index(got, "\ncollections\n") > strings.Index(got, "\narrays\n") {
+		t.Errorf("collections should be listed before arrays. got=%q", got)
+	}
+}
+
+func TestResetKeepsPrelude(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("let sum = 1;\n:reset\nsum([1, 2])\n:exit\n"), &out)
+	if !strings.HasSuffix(out.String(), "environment reset\n3\n") {
+		t.Errorf("builtins and prelude should survive :reset. got=%q", out.String())
+	}
+}
+
+func TestEnvShortensValues(t *testing.T) {
+	var out bytes.Buffer
+	input := "let s = \"" + strings.Repeat("ab", 30) + "\"\nlet f = fn(x) {\n x\n}\n:env\n"
+	StartWithOptions(strings.NewReader(input), &out, Options{NoPrelude: true})
+	want := "f: function = fn f(x) { ... }\ns: string = " + strings.Repeat("ab", 18) + "a...\n"
+	if out.String() != want {
+		t.Errorf("wrong :env output. want=%q, got=%q", want, out.String())
+	}
+}
+
+func TestTokensAndAstCommands(t *testing.T) {
+	tests := []struct {
+		command string
+		golden  string
+	}{
+		{":tokens let x = 1 + 2;", "tokens.golden"},
+		{":ast let x = 1 + 2;", "ast.golden"},
+		{":ast -json let x = 1 + 2;", "ast_json.golden"},
+		{":bytecode let x = 1; fn(a) { a + x }", "bytecode.golden"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		// 評価しないので x は定義されない
+		StartWithOptions(strings.NewReader(tt.command+"\nx\n"), &out, Options{NoPrelude: true})
+
+		golden, err := ioutil.ReadFile(filepath.Join("testdata", tt.golden))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := string(golden) + "ERROR: line 1, column 1: NameError: identifier not found: x\n"
+		if out.String() != want {
+			t.Errorf("%s: wrong output.\nwant=%q\ngot=%q", tt.command, want, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(":ast let = 1;\n1 + 1\n"), &out, Options{NoPrelude: true})
+	if !strings.Contains(out.String(), "parser errors") || !strings.HasSuffix(out.String(), "\n2\n") {
+		t.Errorf("parse errors should be shown without ending the session. got=%q", out.String())
+	}
+
+	out.Reset()
+	StartWithOptions(strings.NewReader(":bytecode for (x in [1]) { x }\n1 + 1\n"), &out, Options{NoPrelude: true})
+	if out.String() != "ERROR: compile error: unsupported node *ast.ForInExpression\n2\n" {
+		t.Errorf("compile errors should be shown without ending the session. got=%q", out.String())
+	}
+}
+
+func TestLineReaderFallback(t *testing.T) {
+	if _, ok := newLineReader(strings.NewReader("1\n"), &bytes.Buffer{}, NewHistory(0), nil).(*scannerReader); !ok {
+		t.Errorf("a plain reader should use the scanner")
+	}
+
+	f, err := ioutil.TempFile(t.TempDir(), "input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, ok := newLineReader(f, &bytes.Buffer{}, NewHistory(0), nil).(*scannerReader); !ok {
+		t.Errorf("a file that is not a terminal should use the scanner")
+	}
+
+	// 端末でない入力は履歴ファイルに書かない
+	path := filepath.Join(t.TempDir(), "history")
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader("1 + 1\n"), &out, Options{NoPrelude: true, HistoryPath: path})
+	if out.String() != "2\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+	if _, err := ioutil.ReadFile(path); err == nil {
+		t.Errorf("history should not be written for piped input")
+	}
+}
+
+func TestRunNonInteractive(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+puts(add(1, 2))
+add(3, 4)
+missing
+let = 1;
+:nope
+if (false) { 1 }
+"done"
+`
+	var out, errOut bytes.Buffer
+	status := RunNonInteractive(strings.NewReader(input), &out, &errOut, Options{NoPrelude: true})
+
+	if status != 1 {
+		t.Errorf("status should be 1 after errors. got=%d", status)
+	}
+	expectedOut := "3\n7\ndone\n"
+	if out.String() != expectedOut {
+		t.Errorf("wrong stdout.\nwant=%q\ngot=%q", expectedOut, out.String())
+	}
+	expectedErr := "ERROR: line 6, column 1: NameError: identifier not found: missing\n" +
+		"let = 1;\n    ^\n7:5: expected next token to be IDENT, got = instead\n" +
+		"let = 1;\n    ^\n7:5: no prefix parse function for '=' found\n" +
+		"unknown command: :nope\ntype :help for a list of commands\n"
+	if errOut.String() != expectedErr {
+		t.Errorf("wrong stderr.\nwant=%q\ngot=%q", expectedErr, errOut.String())
+	}
+}
+
+func TestRunNonInteractiveStatus(t *testing.T) {
+	tests := []struct {
+		input  string
+		status int
+		out    string
+	}{
+		{"1 + 1\nlet x = 2\n", 0, "2\n"},
+		{"puts(1)\nexit(4)\nputs(2)\n", 4, "1\n"},
+		{"", 0, ""},
+	}
+
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		status := RunNonInteractive(strings.NewReader(tt.input), &out, &errOut, Options{})
+		if status != tt.status {
+			t.Errorf("%q: wrong status. want=%d, got=%d", tt.input, tt.status, status)
+		}
+		if out.String() != tt.out || errOut.Len() != 0 {
+			t.Errorf("%q: wrong output. want=%q, got=%q (stderr=%q)", tt.input, tt.out, out.String(), errOut.String())
+		}
+	}
+}
+
+func TestEchoPolicy(t *testing.T) {
+	// 式文の NULL でない値だけを表示し、let や return で終わる入力と NULL は表示しない
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "3\n"},
+		{"let x = 3", ""},
+		{"let x = 3; x", "3\n"},
+		{"1; let x = 3", ""},
+		{"return 4", ""},
+		// トップレベルの return はその入力の評価だけを終える
+		{"return 4; 5", ""},
+		{"if (true) { return 4 }; 5\n6", "6\n"},
+		{`puts("p")`, "p\n"},
+		{"if (false) { 1 }", ""},
+		{"{ let y = 5; y }", "5\n"},
+		{"{ let y = 5; }", ""},
+		{"{}", "{}\n"},
+	}
+
+	for _, engine := range []string{EngineEval, EngineVM} {
+		for _, tt := range tests {
+			if engine == EngineVM && strings.Contains(tt.input, "puts") {
+				// 仮想マシンの puts は標準出力に書く
+				continue
+			}
+			// 対話する場合
+			var out bytes.Buffer
+			StartWithOptions(strings.NewReader(tt.input+"\n"), &out, Options{NoPrelude: true, Engine: engine})
+			if out.String() != tt.expected {
+				t.Errorf("%s: %q: wrong output. want=%q, got=%q", engine, tt.input, tt.expected, out.String())
+			}
+
+			// 対話しない場合
+			out.Reset()
+			var errOut bytes.Buffer
+			RunNonInteractive(strings.NewReader(tt.input+"\n"), &out, &errOut, Options{NoPrelude: true, Engine: engine})
+			if out.String() != tt.expected || errOut.Len() > 0 {
+				t.Errorf("%s: %q: wrong non-interactive output. want=%q, got=%q (stderr=%q)", engine, tt.input, tt.expected, out.String(), errOut.String())
+			}
+		}
+	}
+
+	// エラーは文の種類によらず表示する
+	var out bytes.Buffer
+	Start(strings.NewReader("let z = missing\n"), &out)
+	if !strings.Contains(out.String(), "identifier not found: missing") {
+		t.Errorf("errors should be shown. got=%q", out.String())
+	}
+}
+
+func TestOutputLimit(t *testing.T) {
+	input := `:full
+let xs = toArray(0..20000);
+xs
+:full
+len(xs)
+:set maxout 10
+repeat("日", 10)
+"short"
+:set maxout 0
+repeat("ab", 3000)
+:set maxout -1
+:set width 3
+`
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out, Options{NoPrelude: true})
+	lines := strings.Split(out.String(), "\n")
+
+	all := toArrayInspect(20000)
+	if lines[0] != "no result to show" {
+		t.Errorf("wrong output of :full before any result. got=%q", lines[0])
+	}
+	// 長い結果は既定の長さで切り詰め、:full で要素も省略せずに全体を表示する
+	if want := all[:DefaultMaxOutput] + "… (use :full to show all)"; lines[1] != want {
+		t.Errorf("wrong truncated output. want a prefix of %d bytes, got %d bytes ending in %q", DefaultMaxOutput, len(lines[1]), lines[1][len(lines[1])-40:])
+	}
+	if lines[2] != all {
+		t.Errorf(":full should print the whole result. got %d bytes", len(lines[2]))
+	}
+	// 短い結果はそのまま
+	if lines[3] != "20000" {
+		t.Errorf("short results should not change. got=%q", lines[3])
+	}
+	// 複数バイトの文字の途中では切らない
+	want := []string{
+		"maxout 10",
+		"日日日… (use :full to show all)",
+		"short",
+		"maxout 0",
+		strings.Repeat("ab", 3000),
+		`maxout must be a non-negative integer, got "-1"`,
+		"usage: :set maxout <n>",
+		"",
+	}
+	if got := lines[4:]; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", want, got)
+	}
+
+	// 対話しない場合は切り詰めない（要素数の上限による省略は Inspect と同じ）
+	out.Reset()
+	var errOut bytes.Buffer
+	RunNonInteractive(strings.NewReader("toArray(0..20000)\n"), &out, &errOut, Options{NoPrelude: true})
+	inspected := strings.TrimSuffix(toArrayInspect(1000), "]") + ", …]"
+	if out.String() != inspected+"\n" {
+		t.Errorf("non-interactive output should not be truncated. got %d bytes", out.Len())
+	}
+}
+
+// toArrayInspect は toArray(0..n) を Inspect した文字列を返す
+func toArrayInspect(n int) string {
+	elements := make([]string, n)
+	for i := range elements {
+		elements[i] = strconv.Itoa(i)
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func TestREPLStruct(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("seed", &object.Integer{Value: 41})
+
+	var out bytes.Buffer
+	r := New(strings.NewReader("let f = fn(x) {\nx + 1 }\nputs(f(seed))\n"), &out)
+	r.Prompt = "monkey> "
+	r.ContinuationPrompt = "      | "
+	r.Env = env
+	r.Start()
+
+	// puts の結果の NULL は表示しない
+	expected := "monkey>       | monkey> 42\nmonkey> "
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+	if _, ok := env.Get("f"); !ok {
+		t.Errorf("bindings should be made in the given environment")
+	}
+}
+
+func TestREPLBanner(t *testing.T) {
+	var out bytes.Buffer
+	r := New(strings.NewReader(""), &out)
+	r.Prompt = ""
+	r.ShowBanner = true
+	r.Start()
+	if !strings.HasPrefix(out.String(), "Hello ") || !strings.HasSuffix(out.String(), "Feel free to type in commands\n") {
+		t.Errorf("wrong banner. got=%q", out.String())
+	}
+}
+
+func TestEngineVM(t *testing.T) {
+	input := `1 + 2 * 3
+if (1 > 2) { 10 }
+!true
+-true
+for (x in [1, 2]) { x }
+9223372036854775807 + 1
+`
+	var out, errOut bytes.Buffer
+	status := RunNonInteractive(strings.NewReader(input), &out, &errOut, Options{NoPrelude: true, Engine: EngineVM})
+
+	if status != 1 {
+		t.Errorf("status should be 1 after errors. got=%d", status)
+	}
+	expectedOut := "7\nfalse\n9223372036854775808\n"
+	if out.String() != expectedOut {
+		t.Errorf("wrong stdout.\nwant=%q\ngot=%q", expectedOut, out.String())
+	}
+	expectedErr := "ERROR: TypeError: unknown operator: -BOOLEAN\n" +
+		"ERROR: compile error: unsupported node *ast.ForInExpression\n"
+	if errOut.String() != expectedErr {
+		t.Errorf("wrong stderr.\nwant=%q\ngot=%q", expectedErr, errOut.String())
+	}
+}
+
+func TestEngineVMKeepsGlobals(t *testing.T) {
+	input := `let x = 2
+let y = x * 3
+x + y
+undefined + 1
+:reset
+x
+`
+	var out, errOut bytes.Buffer
+	RunNonInteractive(strings.NewReader(input), &out, &errOut, Options{NoPrelude: true, Engine: EngineVM})
+
+	expectedOut := "8\nenvironment reset\n"
+	if out.String() != expectedOut {
+		t.Errorf("wrong stdout.\nwant=%q\ngot=%q", expectedOut, out.String())
+	}
+	expectedErr := "ERROR: line 4, column 1: compile error: undefined variable undefined\n" +
+		"ERROR: line 6, column 1: compile error: undefined variable x\n"
+	if errOut.String() != expectedErr {
+		t.Errorf("wrong stderr.\nwant=%q\ngot=%q", expectedErr, errOut.String())
+	}
+}
+
+func TestStrictOption(t *testing.T) {
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader("let x = 1\nlet x = 2\nx\n"), &out, Options{NoPrelude: true, Strict: true})
+	want := "ERROR: line 1, column 1: NameError: x is already defined in this scope\n1\n"
+	if out.String() != want {
+		t.Errorf("wrong output. want=%q, got=%q", want, out.String())
+	}
+}
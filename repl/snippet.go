@@ -0,0 +1,62 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"monkey/parser"
+	"strings"
+	"unicode/utf8"
+)
+
+// タブを展開するときの幅
+const tabWidth = 4
+
+// Snippet は src の line 行目と、その column 列目を指す "^" の2行を返す
+// タブは空白に展開し、"^" の位置もそれに合わせる。位置が src の外を指す場合は空文字列を返す
+func Snippet(src string, line, column int) string {
+	lines := strings.Split(src, "\n")
+	if line < 1 || line > len(lines) || column < 1 {
+		return ""
+	}
+	text := lines[line-1]
+	if column > len(text)+1 {
+		return ""
+	}
+
+	expanded := expandTabs(text)
+	// column は1始まりのバイト位置なので、その手前までの表示幅に "^" を置く
+	caret := strings.Repeat(" ", utf8.RuneCountInString(expandTabs(text[:column-1])))
+	return expanded + "\n" + caret + "^\n"
+}
+
+// タブを次のタブ位置までの空白に置き換える
+func expandTabs(s string) string {
+	var out strings.Builder
+	width := 0
+	for _, r := range s {
+		if r == '\t' {
+			n := tabWidth - width%tabWidth
+			out.WriteString(strings.Repeat(" ", n))
+			width += n
+			continue
+		}
+		out.WriteRune(r)
+		width++
+	}
+	return out.String()
+}
+
+func printParseErrors(out io.Writer, style styler, src string, errors []parser.Error) {
+	io.WriteString(out, MONKEY_FACE)
+	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
+	io.WriteString(out, " parser errors:\n")
+
+	for _, err := range errors {
+		for _, l := range strings.SplitAfter(Snippet(src, err.Line, err.Column), "\n") {
+			if l != "" {
+				io.WriteString(out, "\t"+l)
+			}
+		}
+		fmt.Fprintf(out, "\t%s\n", style.error(err.Message))
+	}
+}
@@ -0,0 +1,56 @@
+package repl
+
+import (
+	"bytes"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		src      string
+		line     int
+		column   int
+		expected string
+	}{
+		// 行頭
+		{"let x = 1;\n= 2", 2, 1, "= 2\n^\n"},
+		// 行の途中
+		{"let = 1;", 1, 5, "let = 1;\n    ^\n"},
+		// 行末の次（EOF）
+		{"let x =", 1, 8, "let x =\n       ^\n"},
+		// タブは幅4に展開する
+		{"\tlet = 1;", 1, 6, "    let = 1;\n        ^\n"},
+		{"a\tb", 1, 3, "a   b\n    ^\n"},
+		// 複数バイトの文字は1文字として数える
+		{`"あ" +`, 1, 7, `"あ" +` + "\n    ^\n"},
+		// 位置が不明
+		{"let = 1;", 0, 0, ""},
+		{"let = 1;", 2, 1, ""},
+	}
+
+	for _, tt := range tests {
+		got := Snippet(tt.src, tt.line, tt.column)
+		if got != tt.expected {
+			t.Errorf("Snippet(%q, %d, %d) wrong.\nwant=%q\ngot=%q", tt.src, tt.line, tt.column, tt.expected, got)
+		}
+	}
+}
+
+func TestPrintParseErrorsWithSnippets(t *testing.T) {
+	src := "let x = 1;\nlet = 2;\nlet y = 3 +"
+	p := parser.New(lexer.New(src))
+	p.ParseProgram()
+
+	var out bytes.Buffer
+	printParseErrors(&out, styler{}, src, p.ErrorDetails())
+
+	expected := MONKEY_FACE + "Woops! We ran into some monkey business here!\n parser errors:\n" +
+		"\tlet = 2;\n\t    ^\n\texpected next token to be IDENT, got = instead\n" +
+		"\tlet = 2;\n\t    ^\n\tno prefix parse function for '=' found\n" +
+		"\tlet y = 3 +\n\t           ^\n\tno prefix parse function for 'EOF' found\n"
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, out.String())
+	}
+}
@@ -0,0 +1,97 @@
+package repl
+
+import (
+	"monkey/object"
+	"os"
+	"regexp"
+	"unicode/utf8"
+)
+
+// ANSI のエスケープシーケンスで文字を装飾する
+const (
+	styleReset = "\x1b[0m"
+	styleBold  = "\x1b[1m"
+	styleDim   = "\x1b[2m"
+	styleRed   = "\x1b[31m"
+	styleGreen = "\x1b[32m"
+	styleCyan  = "\x1b[36m"
+)
+
+// styler は出力を色付けする。enabled がfalseなら文字列をそのまま返す
+type styler struct {
+	enabled bool
+	// trueなら評価結果の長い配列やハッシュを複数行に分けて表示する
+	pretty bool
+}
+
+func (s styler) apply(code, str string) string {
+	if !s.enabled || str == "" {
+		return str
+	}
+	return code + str + styleReset
+}
+
+// prompt はプロンプトを太字にする
+func (s styler) prompt(str string) string {
+	return s.apply(styleBold, str)
+}
+
+// error はエラーのメッセージを赤にする
+func (s styler) error(str string) string {
+	return s.apply(styleRed, str)
+}
+
+// value は評価結果の Inspect を型に応じた色にする
+func (s styler) value(obj object.Object) string {
+	return s.color(obj, s.text(obj))
+}
+
+// text は評価結果を表示する文字列を返す。pretty がtrueなら長い配列やハッシュを複数行に分ける
+func (s styler) text(obj object.Object) string {
+	if s.pretty {
+		return object.Pretty(obj, object.PrettyWidth)
+	}
+	return obj.Inspect()
+}
+
+// fullText は text と同じだが、要素の多い配列・ハッシュ・集合も省略せずにすべて表示する
+func (s styler) fullText(obj object.Object) string {
+	if s.pretty {
+		return object.InspectAll(obj, object.PrettyWidth)
+	}
+	return object.InspectAll(obj, 0)
+}
+
+// color は obj を表示する文字列 str を obj の型に応じた色にする
+// 文字列は緑、数は水色、null は薄く、それ以外はそのまま
+func (s styler) color(obj object.Object, str string) string {
+	switch obj.Type() {
+	case object.ERROR_OBJ:
+		return s.error(str)
+	case object.STRING_OBJ:
+		return s.apply(styleGreen, str)
+	case object.INTEGER_OBJ, object.BIG_INTEGER_OBJ:
+		return s.apply(styleCyan, str)
+	case object.NULL_OBJ:
+		return s.apply(styleDim, str)
+	default:
+		return str
+	}
+}
+
+// colorEnabled は w に色を付けて出力してよいかを返す
+// NO_COLOR 環境変数が設定されているか、w が端末でなければfalse
+func colorEnabled(w interface{}) bool {
+	if _, set := os.LookupEnv("NO_COLOR"); set {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && isTerminal(f.Fd())
+}
+
+var escapeSequence = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// visibleWidth はエスケープシーケンスを除いた文字数を返す
+func visibleWidth(str string) int {
+	return utf8.RuneCountInString(escapeSequence.ReplaceAllString(str, ""))
+}
@@ -0,0 +1,70 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"monkey/object"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStyler(t *testing.T) {
+	on := styler{enabled: true}
+	tests := []struct {
+		got      string
+		expected string
+	}{
+		{on.prompt(">> "), "\x1b[1m>> \x1b[0m"},
+		{on.error("boom"), "\x1b[31mboom\x1b[0m"},
+		{on.value(&object.String{Value: "hi"}), "\x1b[32mhi\x1b[0m"},
+		{on.value(&object.Integer{Value: 42}), "\x1b[36m42\x1b[0m"},
+		{on.value(object.NULL), "\x1b[2mnull\x1b[0m"},
+		{on.value(&object.Error{Message: "bad"}), "\x1b[31mERROR: bad\x1b[0m"},
+		{on.value(object.TRUE), "true"},
+		{on.error(""), ""},
+	}
+	for i, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("tests[%d] wrong. want=%q, got=%q", i, tt.expected, tt.got)
+		}
+	}
+
+	off := styler{}
+	if off.prompt(">> ") != ">> " || off.value(&object.Integer{Value: 1}) != "1" {
+		t.Errorf("disabled styler should not change the text")
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	if colorEnabled(&bytes.Buffer{}) {
+		t.Errorf("a buffer is not a terminal")
+	}
+	f, err := os.Create(t.TempDir() + "/out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if colorEnabled(f) {
+		t.Errorf("a regular file is not a terminal")
+	}
+}
+
+func TestVisibleWidth(t *testing.T) {
+	if w := visibleWidth("\x1b[1m>> \x1b[0m"); w != 3 {
+		t.Errorf("wrong width. want=3, got=%d", w)
+	}
+	if w := visibleWidth("あい"); w != 2 {
+		t.Errorf("wrong width. want=2, got=%d", w)
+	}
+}
+
+func TestColoredPromptCursor(t *testing.T) {
+	var out bytes.Buffer
+	r := &terminalReader{in: bufio.NewReader(strings.NewReader("ab\r")), out: &out, history: NewHistory(0)}
+	r.ReadLine(styler{enabled: true}.prompt(">> "))
+	// エスケープシーケンスは幅に数えない
+	if !strings.Contains(out.String(), "\x1b[5C") {
+		t.Errorf("cursor should be placed after the visible prompt. got=%q", out.String())
+	}
+}
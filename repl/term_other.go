@@ -0,0 +1,14 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+// Linux 以外では行編集を使わず、入力を1行ずつ読む
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
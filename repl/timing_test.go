@@ -0,0 +1,99 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"monkey/evaluator"
+	"monkey/object"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 呼ばれるたびに steps の値を順に進める時計
+func fakeClock(steps ...time.Duration) func() time.Time {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := base
+	i := 0
+	return func() time.Time {
+		if i < len(steps) {
+			now = now.Add(steps[i])
+			i++
+		}
+		return now
+	}
+}
+
+func TestTimeCommand(t *testing.T) {
+	var out bytes.Buffer
+	r := &REPL{Out: &out, ev: evaluator.New(), Env: object.NewEnvironment(),
+		now: fakeClock(0, 20*time.Microsecond, 1500*time.Microsecond)}
+
+	r.run(&scannerReader{scanner: bufioScanner(":time 1 + 2\n")})
+	expected := "3\ntime: 1.50ms (parse 20.0µs)\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestTimingToggle(t *testing.T) {
+	var out bytes.Buffer
+	r := &REPL{Out: &out, ev: evaluator.New(), Env: object.NewEnvironment(),
+		now: fakeClock(0, 500, 2*time.Second, 0, 0, 0)}
+
+	r.run(&scannerReader{scanner: bufioScanner(":timing on\n1\n:timing off\n2\n:timing maybe\n")})
+	expected := "timing on\n1\ntime: 2.000s (parse 500ns)\ntiming off\n2\nusage: :timing on|off\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+// 長い構造は :pretty on のときだけ複数行に分け、短い構造と文字列はそのまま表示する
+func TestPrettyToggle(t *testing.T) {
+	input := `let project = {"name": "monkey", "tags": ["lang", "interpreter"], "deps": [{"name": "lexer", "lines": 310}, {"name": "parser", "lines": 720, "files": ["parser.go", "tracing.go"]}], "empty": [], "ids": set(1, 2)};
+project
+:pretty on
+project
+[1, "a"]
+project["name"]
+:pretty off
+:pretty maybe
+`
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out, Options{NoPrelude: true})
+
+	golden, err := ioutil.ReadFile(filepath.Join("testdata", "pretty.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != string(golden) {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", string(golden), out.String())
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{0, "0ns"},
+		{999, "999ns"},
+		{1500, "1.5µs"},
+		{250 * time.Microsecond, "250.0µs"},
+		{12345 * time.Microsecond, "12.35ms"},
+		{1500 * time.Millisecond, "1.500s"},
+		{2 * time.Minute, "120.000s"},
+	}
+
+	for _, tt := range tests {
+		if got := formatDuration(tt.d); got != tt.expected {
+			t.Errorf("formatDuration(%d) = %q, want %q", tt.d, got, tt.expected)
+		}
+	}
+}
+
+func bufioScanner(input string) *bufio.Scanner {
+	return bufio.NewScanner(strings.NewReader(input))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/repl"
+)
+
+// runTest は monkey test を実行し、終了コードを返す
+// ファイルごとに新しい環境でスクリプトを実行してから、test() で登録されたテストを runTests() と同じように実行する
+// スクリプトの中で runTests() を呼んだ場合は、その後に登録されたテストだけを実行する
+// 失敗したテストがあるか、スクリプトがエラーになったファイルがあれば1を返す。exit(n) したファイルは n を失敗の有無として扱う
+//
+//	monkey test [-no-prelude] [-prelude file] path ...
+func runTest(args []string, out, errOut io.Writer) int {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	noPrelude := fs.Bool("no-prelude", false, "do not load the standard prelude")
+	preludePath := fs.String("prelude", "", "load this `file` as the prelude instead of the standard one")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(errOut, "usage: monkey test [-no-prelude] [-prelude file] path ...")
+		return 2
+	}
+
+	var paths []string
+	for _, arg := range fs.Args() {
+		expanded, err := expandFmtArg(arg)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+		paths = append(paths, expanded...)
+	}
+
+	status := 0
+	for _, path := range paths {
+		// 複数のファイルを実行する場合は、どのファイルの結果か分かるよう見出しを付ける
+		if len(paths) > 1 {
+			fmt.Fprintf(out, "== %s\n", path)
+		}
+		if testFile(path, out, errOut, repl.Options{NoPrelude: *noPrelude, PreludePath: *preludePath}) != 0 {
+			status = 1
+		}
+	}
+	return status
+}
+
+func testFile(path string, out, errOut io.Writer, opts repl.Options) int {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		printParseErrors(errOut, source{name: path, text: string(src)}, p.ErrorDetails())
+		return 1
+	}
+
+	ev := evaluator.New(evaluator.WithOutput(out))
+	env, err := repl.NewEnvironment(ev, opts)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	if errObj, ok := ev.Eval(program, env).(*object.Error); ok {
+		if errObj.Exit {
+			return errObj.ExitCode
+		}
+		fmt.Fprintf(errOut, "%s: %s\n", path, errObj.Inspect())
+		fmt.Fprint(errOut, errObj.StackTrace())
+		return 1
+	}
+
+	failed, exit := ev.RunTests()
+	if exit != nil {
+		return exit.ExitCode
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunTest(t *testing.T) {
+	tests := []struct {
+		args   []string
+		status int
+		out    string
+	}{
+		{
+			[]string{"testdata/test/pass.mky"},
+			0,
+			"PASS double doubles\nPASS lets stay inside the test\nPASS sum of an empty array\n3 passed, 0 failed\n",
+		},
+		{
+			[]string{"testdata/test/fail.mky"},
+			1,
+			"PASS passes\n" +
+				"FAIL assertion: line 6, column 2: AssertionError: expected 3\n" +
+				"FAIL runtime error: line 10, column 4: TypeError: type mismatch: INTEGER + BOOLEAN\n" +
+				"PASS still runs\n" +
+				"2 passed, 2 failed\n",
+		},
+		// スクリプトが runTests() の結果で exit した場合は、テストを2度実行しない
+		// 0以外の終了コードは失敗として1になる
+		{
+			[]string{"testdata/test/exit.mky"},
+			1,
+			"FAIL fails: line 1, column 22: AssertionError: assertion failed\nPASS passes\n1 passed, 1 failed\n",
+		},
+		// プレリュードがなければ sum は未定義
+		{
+			[]string{"-no-prelude", "testdata/test/pass.mky"},
+			1,
+			"FAIL sum of an empty array: line 14, column 9: NameError: identifier not found: sum\n2 passed, 1 failed\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		if status := runTest(tt.args, &out, &errOut); status != tt.status {
+			t.Errorf("%v: wrong status. want=%d, got=%d (stderr=%q)", tt.args, tt.status, status, errOut.String())
+		}
+		if !strings.HasSuffix(out.String(), tt.out) {
+			t.Errorf("%v: wrong output.\nwant=%q\ngot=%q", tt.args, tt.out, out.String())
+		}
+	}
+
+	// 複数のファイルはそれぞれ見出しを付けて実行し、1つでも失敗すれば1を返す
+	var out, errOut bytes.Buffer
+	if status := runTest([]string{"testdata/test/pass.mky", "testdata/test/fail.mky"}, &out, &errOut); status != 1 {
+		t.Errorf("wrong status for several files. want=1, got=%d", status)
+	}
+	if !strings.HasPrefix(out.String(), "== testdata/test/pass.mky\n") || !strings.Contains(out.String(), "== testdata/test/fail.mky\nPASS passes\n") {
+		t.Errorf("wrong output for several files. got=%q", out.String())
+	}
+
+	out.Reset()
+	errOut.Reset()
+	if status := runTest(nil, &out, &errOut); status != 2 {
+		t.Errorf("wrong status without arguments. want=2, got=%d", status)
+	}
+}
@@ -1,9 +1,14 @@
 package token
 
+import "sort"
+
 type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	// トークンの先頭の位置（1始まり）
+	Line   int
+	Column int
 }
 
 const (
@@ -30,6 +35,11 @@ const (
 	GT        = ">"
 	LBRACKET  = "["
 	RBRACKET  = "]"
+	DOTDOT    = ".."
+	ELLIPSIS  = "..."
+
+	// 受け手が NULL なら NULL になる添字アクセス a?[i]
+	OPTIONAL_LBRACKET = "?["
 
 	EQ     = "=="
 	NOT_EQ = "!="
@@ -41,6 +51,13 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	FOR      = "FOR"
+	IN       = "IN"
+	IMPORT   = "IMPORT"
+	AS       = "AS"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	IS       = "IS"
 )
 
 var keywords = map[string]TokenType{
@@ -51,6 +68,23 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"for":    FOR,
+	"in":     IN,
+	"import": IMPORT,
+	"as":     AS,
+	"try":    TRY,
+	"catch":  CATCH,
+	"is":     IS,
+}
+
+// Keywords はキーワードを名前順に返す
+func Keywords() []string {
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func LookuptIdent(ident string) TokenType {
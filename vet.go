@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey/check"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/repl"
+)
+
+// runVet は monkey vet を実行し、終了コードを返す
+// スクリプトを実行せずに調べ、未定義の名前の参照と使われない let を "file:line:col: message" の形で out に書く
+// 問題が見つかるか構文エラーがあれば1を返す
+//
+//	monkey vet [-no-prelude] [-prelude file] path ...
+func runVet(args []string, out, errOut io.Writer) int {
+	fs := flag.NewFlagSet("vet", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	noPrelude := fs.Bool("no-prelude", false, "do not treat the names of the standard prelude as defined")
+	preludePath := fs.String("prelude", "", "treat the names defined by this `file` as defined instead of the standard prelude")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(errOut, "usage: monkey vet [-no-prelude] [-prelude file] path ...")
+		return 2
+	}
+
+	// プレリュードが定義する名前は定義済みとする
+	env, err := repl.NewEnvironment(evaluator.New(evaluator.WithOutput(ioutil.Discard)), repl.Options{NoPrelude: *noPrelude, PreludePath: *preludePath})
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	var predefined []string
+	for name := range env.All(true) {
+		predefined = append(predefined, name)
+	}
+
+	status := 0
+	for _, arg := range fs.Args() {
+		paths, err := expandFmtArg(arg)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			status = 1
+			continue
+		}
+		for _, path := range paths {
+			if vetFile(path, predefined, out, errOut) != 0 {
+				status = 1
+			}
+		}
+	}
+	return status
+}
+
+func vetFile(path string, predefined []string, out, errOut io.Writer) int {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		printParseErrors(errOut, source{name: path, text: string(src)}, p.ErrorDetails())
+		return 1
+	}
+
+	diagnostics := check.Check(program, predefined)
+	for _, d := range diagnostics {
+		fmt.Fprintf(out, "%s:%s\n", path, d)
+	}
+	if len(diagnostics) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunVet(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "script.mky")
+	src := "let unused = 1;\nlet f = fn(n) { n + m };\nputs(f(1), sum([1]));\n"
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	clean := filepath.Join(dir, "clean.mky")
+	if err := ioutil.WriteFile(clean, []byte("let x = 1;\nputs(x);\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	if status := runVet([]string{path, clean}, &out, &errOut); status != 1 {
+		t.Errorf("wrong status. want=1, got=%d (stderr=%q)", status, errOut.String())
+	}
+	want := path + ":1:5: unused is declared but never used\n" + path + ":2:21: undefined: m\n"
+	if out.String() != want {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", want, out.String())
+	}
+
+	// プレリュードを使わなければ sum は未定義
+	out.Reset()
+	runVet([]string{"-no-prelude", path}, &out, &errOut)
+	if !strings.Contains(out.String(), path+":3:12: undefined: sum\n") {
+		t.Errorf("sum should be undefined without the prelude. got=%q", out.String())
+	}
+
+	out.Reset()
+	if status := runVet([]string{clean}, &out, &errOut); status != 0 || out.Len() != 0 {
+		t.Errorf("a clean file should pass. status=%d, output=%q", status, out.String())
+	}
+	if status := runVet(nil, &out, &errOut); status != 2 {
+		t.Errorf("vet without paths should fail with status 2. got=%d", status)
+	}
+}
@@ -0,0 +1,25 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+// Frame は実行中の関数の呼び出し
+type Frame struct {
+	cl *object.Closure
+	// 次に実行する命令の位置
+	ip int
+	// 局所変数はスタックの basePointer から NumLocals 個の位置に置く
+	basePointer int
+	// このフレームに至るまでに続けて置き換えた末尾呼び出しの数
+	tailCalls int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: 0, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,640 @@
+/*
+Package vm はコンパイラが生成したバイトコードをスタックマシンで実行する
+結果とエラーのメッセージは評価器と同じになるようにする
+*/
+package vm
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+// StackSize はスタックに積める値の数の上限
+const StackSize = 1 << 16
+
+// GlobalsSize は大域変数の数の上限。OpGetGlobal のオペランドで表せる数
+const GlobalsSize = 65536
+
+// MaxFrames はフレームを入れ子にできる数の上限。評価器の evaluator.DefaultMaxDepth と同じ
+const MaxFrames = 10000
+
+// MaxTailCalls は続けて置き換えられる末尾呼び出しの数の上限。評価器の evaluator.DefaultMaxTailCalls と同じ
+const MaxTailCalls = 2000000
+
+// Error は実行中のエラーや組み込み関数が返したエラー。エラーの種類や exit() の終了コードなども Object に残る
+type Error struct {
+	Object *object.Error
+}
+
+func (e *Error) Error() string {
+	return e.Object.Message
+}
+
+func newError(kind object.ErrorKind, format string, a ...interface{}) *Error {
+	return &Error{Object: &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}}
+}
+
+var (
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
+)
+
+// VM は1つのバイトコードを実行する
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	// 次に値を積む位置。スタックの先頭は stack[sp-1]
+	sp int
+	// 最後に OpPop で捨てた値。トップレベルの return で終えた場合は return した値
+	lastPopped object.Object
+	// トップレベルの return で実行を終えたか
+	returned bool
+
+	// 大域変数。まだ代入していない変数は nil
+	globals []object.Object
+	// 大域変数の名前。エラーメッセージに使う
+	globalNames []string
+
+	// OpGetBuiltin の番号が指す組み込み関数。この版にない名前は nil
+	builtins     []*object.Builtin
+	builtinNames []string
+
+	frames     []*Frame
+	frameIndex int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsStore は以前の実行の大域変数を引き継ぐVMを生成する
+// compiler.NewWithState と組み合わせて、REPLの入力ごとに実行するのに使う
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFrame := NewFrame(&object.Closure{Fn: mainFn}, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	builtins := make([]*object.Builtin, len(bytecode.BuiltinNames))
+	for i, name := range bytecode.BuiltinNames {
+		builtins[i], _ = evaluator.LookupBuiltin(name)
+	}
+
+	return &VM{
+		constants: bytecode.Constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals:     globals,
+		globalNames: bytecode.GlobalNames,
+
+		builtins:     builtins,
+		builtinNames: bytecode.BuiltinNames,
+
+		frames:     frames,
+		frameIndex: 1,
+	}
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.frameIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.frameIndex >= MaxFrames {
+		return newError(object.LimitError, "maximum recursion depth exceeded")
+	}
+	top := f.basePointer + f.cl.Fn.NumLocals()
+	if top >= StackSize {
+		return newError(object.LimitError, "stack overflow")
+	}
+	vm.frames[vm.frameIndex] = f
+	vm.frameIndex++
+	// 引数以外の局所変数の場所を空けておく。前の呼び出しの値が残っていてはいけない
+	for i := f.basePointer + f.cl.Fn.NumParameters; i < top; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = top
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.frameIndex--
+	return vm.frames[vm.frameIndex]
+}
+
+// LastPoppedStackElem は最後の式文の値を返す。式文を実行していなければ nil
+// トップレベルの return で終えた場合は return した値を返す
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPopped
+}
+
+// Returned はトップレベルの return で実行を終えたかどうかを返す。return より後の命令は実行しない
+func (vm *VM) Returned() bool {
+	return vm.returned
+}
+
+// Run はバイトコードを最後まで実行する。実行時エラーは評価器と同じメッセージで返す
+func (vm *VM) Run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions()) {
+		frame := vm.currentFrame()
+		ip = frame.ip
+		ins = frame.Instructions()
+		op = code.Opcode(ins[ip])
+		frame.ip++
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			if err := vm.push(nativeBoolToBooleanObject(!isTruthy(vm.pop()))); err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			if err := vm.executeMinusOperator(); err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[ip+1:]))
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if !isTruthy(vm.pop()) {
+				frame.ip = pos
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.globals[globalIndex] = vm.pop()
+			if vm.frameIndex == 1 {
+				// 最上位の let の後は、プログラムの値は評価器と同じく nil
+				vm.lastPopped = nil
+			}
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			value := vm.globals[globalIndex]
+			if value == nil {
+				// 実行されなかった let の名前を参照した
+				return newError(object.NameError, "identifier not found: %s", vm.globalName(int(globalIndex)))
+			}
+			if err := vm.push(value); err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+			value := vm.stack[frame.basePointer+int(localIndex)]
+			if value == nil {
+				return newError(object.NameError, "identifier not found: %s", frame.cl.Fn.LocalNames[localIndex])
+			}
+			if err := vm.push(value); err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+			if err := vm.push(frame.cl.Free[freeIndex]); err != nil {
+				return err
+			}
+
+		case code.OpCurrentClosure:
+			if err := vm.push(frame.cl); err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+			if err := vm.callFunction(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+			if err := vm.tailCallFunction(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip++
+			builtin := vm.builtins[builtinIndex]
+			if builtin == nil {
+				return newError(object.NameError, "identifier not found: %s", vm.builtinNames[builtinIndex])
+			}
+			if err := vm.push(builtin); err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+			if err := vm.push(&object.Array{Elements: elements}); err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp -= numElements
+			if err := vm.push(hash); err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			result, err := executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+			if err := vm.push(result); err != nil {
+				return err
+			}
+
+		case code.OpReturnValue, code.OpReturn:
+			returnValue := object.Object(Null)
+			if op == code.OpReturnValue {
+				returnValue = vm.pop()
+			}
+			if vm.frameIndex == 1 {
+				// 最上位の return はプログラムを終える
+				vm.lastPopped = returnValue
+				vm.returned = true
+				return nil
+			}
+			frame := vm.popFrame()
+			// 呼び出した関数も取り除く
+			vm.sp = frame.basePointer - 1
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+
+		default:
+			return fmt.Errorf("unknown opcode %d", op)
+		}
+	}
+
+	return nil
+}
+
+// スタックの上の numArgs 個の引数で、その下にある関数を呼び出す
+func (vm *VM) callFunction(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		if numArgs != callee.Fn.NumParameters {
+			return newError(object.ArityError, "wrong number of arguments: want=%d, got=%d", callee.Fn.NumParameters, numArgs)
+		}
+		// 引数がそのまま最初の局所変数になる
+		return vm.pushFrame(NewFrame(callee, vm.sp-numArgs))
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return newError(object.TypeError, "not a function: %s", callee.Type())
+	}
+}
+
+// tailCallFunction は実行中のフレームを捨ててから関数を呼び出す
+// 呼び出した関数の戻り値は、実行中のフレームの呼び出し元に返る
+func (vm *VM) tailCallFunction(numArgs int) error {
+	callee, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok || vm.frameIndex == 1 {
+		return vm.callFunction(numArgs)
+	}
+	if numArgs != callee.Fn.NumParameters {
+		return newError(object.ArityError, "wrong number of arguments: want=%d, got=%d", callee.Fn.NumParameters, numArgs)
+	}
+
+	// 末尾呼び出しだけの無限ループも、評価器と同じく回数の上限で止める
+	replaced := vm.currentFrame()
+	if replaced.tailCalls >= MaxTailCalls {
+		return newError(object.LimitError, "maximum recursion depth exceeded")
+	}
+
+	// 関数と引数を、実行中の関数とその引数の位置に移す
+	base := vm.popFrame().basePointer - 1
+	copy(vm.stack[base:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.sp = base + 1 + numArgs
+	frame := NewFrame(callee, base+1)
+	frame.tailCalls = replaced.tailCalls + 1
+	return vm.pushFrame(frame)
+}
+
+// 組み込み関数を呼び出し、関数と引数を結果で置き換える
+// 評価器と同じく、組み込み関数が返したエラーは実行時エラーになる
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	result := builtin.Fn(args...)
+	if errObj, ok := result.(*object.Error); ok {
+		return &Error{Object: errObj}
+	}
+	if result == nil {
+		result = Null
+	}
+	vm.sp = vm.sp - numArgs - 1
+	return vm.push(result)
+}
+
+// スタックの start から end までのキーと値の組からハッシュを作る
+func (vm *VM) buildHash(start, end int) (object.Object, error) {
+	hash := object.NewHash()
+	for i := start; i < end; i += 2 {
+		key, value := vm.stack[i], vm.stack[i+1]
+		if err := object.CheckHashKey(key); err != nil {
+			return nil, &Error{Object: err}
+		}
+		hash.Set(key, value)
+	}
+	return hash, nil
+}
+
+// 評価器と同じく、範囲外の添字や存在しないキーは NULL になる
+func executeIndexExpression(left, index object.Object) (object.Object, error) {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i := index.(*object.Integer).Value
+		if i < 0 || int64(len(elements)) <= i {
+			return Null, nil
+		}
+		return elements[i], nil
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		value, ok := left.(*object.Range).At(index.(*object.Integer).Value)
+		if !ok {
+			return Null, nil
+		}
+		return object.NewInteger(value), nil
+	case left.Type() == object.HASH_OBJ:
+		if err := object.CheckHashKey(index); err != nil {
+			return nil, &Error{Object: err}
+		}
+		pair, ok := left.(*object.Hash).Pairs[index.(object.Hashable).HashKey()]
+		if !ok {
+			return Null, nil
+		}
+		return pair.Value, nil
+	default:
+		return nil, newError(object.TypeError, "index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	fn, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", vm.constants[constIndex])
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp -= numFree
+
+	return vm.push(&object.Closure{Fn: fn, Free: free})
+}
+
+// 大域変数の名前。分からなければ番号を返す
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) {
+		return vm.globalNames[index]
+	}
+	return fmt.Sprintf("global #%d", index)
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return newError(object.LimitError, "stack overflow")
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// 評価器の演算子の表記。エラーメッセージに使う
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+	operator := operators[op]
+
+	var result object.Object
+	var err error
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		result, err = integerOperation(operator, left.(*object.Integer).Value, right.(*object.Integer).Value)
+	case isInteger(left) && isInteger(right):
+		result, err = bigIntegerOperation(operator, toBigInt(left), toBigInt(right))
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ && op == code.OpAdd:
+		result = &object.String{Value: left.(*object.String).Value + right.(*object.String).Value}
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		err = newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	case op == code.OpEqual:
+		result = nativeBoolToBooleanObject(left == right)
+	case op == code.OpNotEqual:
+		result = nativeBoolToBooleanObject(left != right)
+	case left.Type() != right.Type():
+		err = newError(object.TypeError, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		err = newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+	if err != nil {
+		return err
+	}
+	return vm.push(result)
+}
+
+// int64 で計算し、桁あふれする場合は big.Int で計算し直す
+func integerOperation(operator string, left, right int64) (object.Object, error) {
+	switch operator {
+	case "+":
+		if sum := left + right; (left^sum)&(right^sum) >= 0 {
+			return object.NewInteger(sum), nil
+		}
+	case "-":
+		if diff := left - right; (left^right)&(left^diff) >= 0 {
+			return object.NewInteger(diff), nil
+		}
+	case "*":
+		if left == 0 || right == 0 {
+			return object.NewInteger(0), nil
+		}
+		product := left * right
+		if product/right == left && !(left == -1 && right == math.MinInt64) && !(right == -1 && left == math.MinInt64) {
+			return object.NewInteger(product), nil
+		}
+	case "/":
+		if right == 0 {
+			return nil, newError(object.DivisionByZero, "division by zero")
+		}
+		if !(left == math.MinInt64 && right == -1) {
+			return object.NewInteger(left / right), nil
+		}
+	case "<":
+		return nativeBoolToBooleanObject(left < right), nil
+	case ">":
+		return nativeBoolToBooleanObject(left > right), nil
+	case "==":
+		return nativeBoolToBooleanObject(left == right), nil
+	case "!=":
+		return nativeBoolToBooleanObject(left != right), nil
+	}
+	return bigIntegerOperation(operator, big.NewInt(left), big.NewInt(right))
+}
+
+func bigIntegerOperation(operator string, left, right *big.Int) (object.Object, error) {
+	switch operator {
+	case "+":
+		return newInteger(new(big.Int).Add(left, right)), nil
+	case "-":
+		return newInteger(new(big.Int).Sub(left, right)), nil
+	case "*":
+		return newInteger(new(big.Int).Mul(left, right)), nil
+	case "/":
+		if right.Sign() == 0 {
+			return nil, newError(object.DivisionByZero, "division by zero")
+		}
+		return newInteger(new(big.Int).Quo(left, right)), nil
+	case "<":
+		return nativeBoolToBooleanObject(left.Cmp(right) < 0), nil
+	case ">":
+		return nativeBoolToBooleanObject(left.Cmp(right) > 0), nil
+	case "==":
+		return nativeBoolToBooleanObject(left.Cmp(right) == 0), nil
+	default:
+		return nativeBoolToBooleanObject(left.Cmp(right) != 0), nil
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+	if !isInteger(operand) {
+		return newError(object.TypeError, "unknown operator: -%s", operand.Type())
+	}
+	if i, ok := operand.(*object.Integer); ok && i.Value != math.MinInt64 {
+		return vm.push(object.NewInteger(-i.Value))
+	}
+	return vm.push(newInteger(new(big.Int).Neg(toBigInt(operand))))
+}
+
+func isInteger(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.INTEGER_OBJ || t == object.BIG_INTEGER_OBJ
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	if i, ok := obj.(*object.Integer); ok {
+		return big.NewInt(i.Value)
+	}
+	return obj.(*object.BigInteger).Value
+}
+
+// int64に収まれば Integer、収まらなければ BigInteger を返す
+func newInteger(n *big.Int) object.Object {
+	if n.IsInt64() {
+		return object.NewInteger(n.Int64())
+	}
+	return &object.BigInteger{Value: n}
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case Null, False:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
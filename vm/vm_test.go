@@ -0,0 +1,609 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+// run は input をコンパイルして実行し、最後の式文の値を返す
+func run(t testing.TB, input string) (object.Object, error) {
+	t.Helper()
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	err := vm.Run()
+	return vm.LastPoppedStackElem(), err
+}
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+	for _, tt := range tests {
+		result, err := run(t, tt.input)
+		if err != nil {
+			t.Fatalf("%s: vm error: %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+	switch expected := expected.(type) {
+	case int:
+		result, ok := actual.(*object.Integer)
+		if !ok {
+			t.Errorf("%s: object is not Integer. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if result.Value != int64(expected) {
+			t.Errorf("%s: object has wrong value. want=%d, got=%d", input, expected, result.Value)
+		}
+	case bool:
+		result, ok := actual.(*object.Boolean)
+		if !ok {
+			t.Errorf("%s: object is not Boolean. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if result.Value != expected {
+			t.Errorf("%s: object has wrong value. want=%t, got=%t", input, expected, result.Value)
+		}
+	case string:
+		if _, ok := actual.(*object.String); !ok && actual != nil {
+			// 配列やハッシュは表示で比べる
+			if actual.Inspect() != expected {
+				t.Errorf("%s: object has wrong value. want=%s, got=%s", input, expected, actual.Inspect())
+			}
+			return
+		}
+		result, ok := actual.(*object.String)
+		if !ok {
+			t.Errorf("%s: object is not String. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if result.Value != expected {
+			t.Errorf("%s: object has wrong value. want=%q, got=%q", input, expected, result.Value)
+		}
+	case nil:
+		if actual != Null {
+			t.Errorf("%s: object is not Null. got=%T (%+v)", input, actual, actual)
+		}
+	}
+}
+
+// 評価器の TestEvalIntegerExpression と同じ表
+var integerTests = []vmTestCase{
+	{"5", 5},
+	{"10", 10},
+	{"-5", -5},
+	{"-10", -10},
+	{"5 + 5 + 5 + 5 - 10", 10},
+	{"2 * 2 * 2 * 2 * 2", 32},
+	{"-50 + 100 + -50", 0},
+	{"5 * 2 + 10", 20},
+	{"5 + 2 * 10", 25},
+	{"20 + 2 * -10", 0},
+	{"50 / 2 * 2 + 10", 60},
+	{"2 * (5 + 10)", 30},
+	{"3 * 3 * 3 + 10", 37},
+	{"3 * (3 * 3) + 10", 37},
+	{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+}
+
+// 評価器の TestEvalBooleanExpression と TestBangOperator と同じ表
+var booleanTests = []vmTestCase{
+	{"true", true},
+	{"false", false},
+	{"1 < 2", true},
+	{"1 > 2", false},
+	{"1 < 1", false},
+	{"1 > 1", false},
+	{"1 == 1", true},
+	{"1 != 1", false},
+	{"1 == 2", false},
+	{"1 != 2", true},
+	{"true == true", true},
+	{"false == false", true},
+	{"true == false", false},
+	{"true != false", true},
+	{"false != true", true},
+	{"(1 < 2) == true", true},
+	{"(1 < 2) == false", false},
+	{"(1 > 2) == true", false},
+	{"(1 > 2) == false", true},
+	{"!true", false},
+	{"!false", true},
+	{"!5", false},
+	{"!!true", true},
+	{"!!false", false},
+	{"!!5", true},
+}
+
+// 評価器の TestIfElseExpressions と同じ表
+var conditionalTests = []vmTestCase{
+	{"if (true) { 10 }", 10},
+	{"if (false) { 10 }", nil},
+	{"if (1) { 10 }", 10},
+	{"if (1 < 2) { 10 }", 10},
+	{"if (1 > 2) { 10 }", nil},
+	{"if (1 > 2) { 10 } else { 20 }", 20},
+	{"if (1 < 2) { 10 } else { 20 }", 10},
+	{"if (true) { 1; 2 }", 2},
+	{"if (true) {}", nil},
+	{"!(if (false) { 5; })", true},
+	{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+}
+
+var stringTests = []vmTestCase{
+	{`"monkey"`, "monkey"},
+	{`"mon" + "key"`, "monkey"},
+	{`"mon" + "key" + "banana"`, "monkeybanana"},
+	{`let greet = fn(name) { "hello " + name }; greet("world")`, "hello world"},
+}
+
+func TestStringExpressions(t *testing.T) {
+	runVmTests(t, stringTests)
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	runVmTests(t, integerTests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	runVmTests(t, booleanTests)
+}
+
+func TestConditionals(t *testing.T) {
+	runVmTests(t, conditionalTests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		kind     object.ErrorKind
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN", object.TypeError},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN", object.TypeError},
+		{"-true", "unknown operator: -BOOLEAN", object.TypeError},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN", object.TypeError},
+		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN", object.TypeError},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN", object.TypeError},
+		{"1 / 0", "division by zero", object.DivisionByZero},
+		{"fn(x) { x }()", "wrong number of arguments: want=1, got=0", object.ArityError},
+		{"[1][true]", "index operator not supported: ARRAY", object.TypeError},
+		{`len(1)`, "len: argument 1 must be string, array, hash, set, range or string_builder, got integer", object.TypeError},
+		{`pop([])`, "pop: argument 1 must be non-empty array, got empty array", object.IndexError},
+		{`error("Timeout", "too slow")`, "too slow", "Timeout"},
+	}
+
+	for _, tt := range tests {
+		_, err := run(t, tt.input)
+		if err == nil {
+			t.Errorf("%s: expected error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+		// エラーの種類も評価器と同じになる
+		if vmErr, ok := err.(*Error); !ok || vmErr.Object.Kind != tt.kind {
+			t.Errorf("%s: wrong error kind. want=%s, got=%#v", tt.input, tt.kind, err)
+		}
+	}
+}
+
+// 同じプログラムを評価器とVMで実行し、結果が同じであることを確かめる
+func TestMatchesEvaluator(t *testing.T) {
+	var inputs []string
+	for _, tests := range [][]vmTestCase{integerTests, booleanTests, conditionalTests, stringTests} {
+		for _, tt := range tests {
+			inputs = append(inputs, tt.input)
+		}
+	}
+	inputs = append(inputs,
+		"9223372036854775807 + 1",
+		"-9223372036854775807 - 2",
+		"3037000500 * 3037000500",
+		"(9223372036854775807 + 1) / 2 - 1",
+		"(9223372036854775807 + 1) > 9223372036854775807",
+		"-(9223372036854775807 + 1) == -9223372036854775807 - 1",
+		"99999999999999999999 + 1",
+		"-9223372036854775808",
+		"-9223372036854775808 == -9223372036854775807 - 1",
+		"0o1000000000000000000000",
+		"5 + true",
+		"-false",
+		"true > false",
+		"1 / 0",
+		`"a" == "a"`,
+		`"a" - "b"`,
+		`"a" + 1`,
+	)
+
+	for _, input := range inputs {
+		expected := evaluator.Eval(parse(input), object.NewEnvironment())
+		if expected == nil {
+			// 評価器は空のブロックの値を nil にするが、VMでは NULL になる
+			expected = Null
+		}
+
+		result, err := run(t, input)
+		if errObj, ok := expected.(*object.Error); ok {
+			if err == nil || err.Error() != errObj.Message {
+				t.Errorf("%s: wrong error. want=%q, got=%v", input, errObj.Message, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: vm error: %s", input, err)
+			continue
+		}
+		if result.Type() != expected.Type() || result.Inspect() != expected.Inspect() {
+			t.Errorf("%s: results differ. evaluator=%s (%s), vm=%s (%s)",
+				input, expected.Inspect(), expected.Type(), result.Inspect(), result.Type())
+		}
+	}
+}
+
+// fibSource は fib(n) の再帰をすべて展開した式を返す
+// 関数呼び出しを使わずに大きな命令列を作るために使う
+func fibSource(n int) string {
+	if n < 2 {
+		return fmt.Sprintf("if (%d < 2) { %d } else { 0 }", n, n)
+	}
+	return fmt.Sprintf("if (%d < 2) { %d } else { (%s) + (%s) }", n, n, fibSource(n-1), fibSource(n-2))
+}
+
+const fibProgram = `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(20);
+`
+
+func BenchmarkFibEvaluator(b *testing.B) {
+	program := parse(fibProgram)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		evaluator.Eval(program, object.NewEnvironment())
+	}
+}
+
+func BenchmarkFibVM(b *testing.B) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(fibProgram)); err != nil {
+		b.Fatal(err)
+	}
+	bytecode := comp.Bytecode()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := New(bytecode).Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestFibSource(t *testing.T) {
+	result, err := run(t, fibSource(15))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testExpectedObject(t, "fib(15)", 610, result)
+}
+
+// トップレベルの return で終えたかどうかは評価器と同じ
+func TestReturnedMatchesEvaluator(t *testing.T) {
+	tests := []struct {
+		input    string
+		returned bool
+	}{
+		{"return 1; 2", true},
+		{"if (true) { return 1 }; 2", true},
+		{"{ return 3; 4 }", true},
+		{"if (false) { return 1 }; 2", false},
+		{"let f = fn() { return 1 }; f()", false},
+		{"1", false},
+	}
+
+	for _, tt := range tests {
+		ev := evaluator.New()
+		ev.Eval(parse(tt.input), object.NewEnvironment())
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("%s: compiler error: %s", tt.input, err)
+		}
+		machine := New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			t.Fatalf("%s: vm error: %s", tt.input, err)
+		}
+		if ev.Returned() != tt.returned || machine.Returned() != tt.returned {
+			t.Errorf("%s: wrong Returned. want=%t, evaluator=%t, vm=%t", tt.input, tt.returned, ev.Returned(), machine.Returned())
+		}
+	}
+}
+
+func TestProgramTooLarge(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(fibSource(18)))
+	if err == nil || !strings.HasPrefix(err.Error(), "program too large") {
+		t.Errorf("expected program too large error. got=%v", err)
+	}
+}
+
+// 評価器と同じく、ブロックは新しいスコープを作らない
+var letTests = []vmTestCase{
+	{"let one = 1; one", 1},
+	{"let one = 1; let two = 2; one + two", 3},
+	{"let one = 1; let two = one + one; one + two", 3},
+	{"let x = 1; let x = x + 1; x", 2},
+	{"let x = 1; if (true) { let x = 2; }; x", 2},
+	{"let x = 1; if (false) { let x = 2; }; x", 1},
+	{"let x = 1; if (x > 0) { let y = x * 10; if (y > 5) { let x = y + 1; x } }", 11},
+	{"let a = 5; let b = a * 2; let c = if (b > a) { b - a } else { a - b }; c * c", 25},
+	{"let t = true; let f = !t; if (f) { 1 } else { if (t == !f) { 2 } }", 2},
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	runVmTests(t, letTests)
+}
+
+func TestUnassignedGlobal(t *testing.T) {
+	_, err := run(t, "if (false) { let z = 1 }; z")
+	if err == nil || err.Error() != "identifier not found: z" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestLetMatchesEvaluator(t *testing.T) {
+	for _, tt := range letTests {
+		expected := evaluator.Eval(parse(tt.input), object.NewEnvironment())
+		result, err := run(t, tt.input)
+		if err != nil {
+			t.Errorf("%s: vm error: %s", tt.input, err)
+			continue
+		}
+		if result.Inspect() != expected.Inspect() {
+			t.Errorf("%s: results differ. evaluator=%s, vm=%s", tt.input, expected.Inspect(), result.Inspect())
+		}
+	}
+}
+
+// 入力ごとにコンパイルしても、大域変数は同じ番号で引き継ぐ
+func TestGlobalsStore(t *testing.T) {
+	symbols := compiler.NewSymbolTable()
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+
+	var result object.Object
+	for _, input := range []string{"let a = 1;", "let b = a + 1;", "let a = b * 10;", "a + b"} {
+		comp := compiler.NewWithState(symbols, constants)
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("%s: compiler error: %s", input, err)
+		}
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobalsStore(bytecode, globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("%s: vm error: %s", input, err)
+		}
+		result = machine.LastPoppedStackElem()
+	}
+	testExpectedObject(t, "a + b", 22, result)
+}
+
+var functionTests = []vmTestCase{
+	{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+	{"let one = fn() { 1; }; let two = fn() { 2; }; one() + two()", 3},
+	{"let a = fn() { 1 }; let b = fn() { a() + 1 }; let c = fn() { b() + 1 }; c();", 3},
+	{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+	{"let earlyExit = fn() { if (true) { return 1; }; 2 }; earlyExit();", 1},
+	{"let noReturn = fn() { }; noReturn();", nil},
+	{"let noReturn = fn() { }; let two = fn() { noReturn(); 2 }; two();", 2},
+	{"let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();", 1},
+	{"let identity = fn(a) { a; }; identity(4);", 4},
+	{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+	{"let globalNum = 10; let sum = fn(a, b) { let c = a + b; c + globalNum; }; let outer = fn() { sum(1, 2) + sum(3, 4) + globalNum; }; outer() + globalNum;", 50},
+	{"fn(x) { if (x > 0) { let y = x * 2 }; y }(3)", 6},
+	{"return 5; 10", 5},
+}
+
+var closureTests = []vmTestCase{
+	{"let newClosure = fn(a) { fn() { a; }; }; let closure = newClosure(99); closure();", 99},
+	{"let newAdder = fn(a, b) { fn(c) { a + b + c }; }; let adder = newAdder(1, 2); adder(8);", 11},
+	{"let newAdderOuter = fn(a, b) { let c = a + b; fn(d) { let e = d + c; fn(f) { e + f; }; }; }; let newAdderInner = newAdderOuter(1, 2); let adder = newAdderInner(3); adder(8);", 14},
+	{"let newClosure = fn(a, b) { let one = fn() { a; }; let two = fn() { b; }; fn() { one() + two(); }; }; let closure = newClosure(9, 90); closure();", 99},
+	{"let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } }; countDown(1);", 0},
+	{"let wrapper = fn() { let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } }; countDown(1); }; wrapper();", 0},
+	{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15);", 610},
+	{"let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } }; let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } }; isEven(10)", true},
+}
+
+func TestFunctionCalls(t *testing.T) {
+	runVmTests(t, functionTests)
+}
+
+func TestClosures(t *testing.T) {
+	runVmTests(t, closureTests)
+}
+
+func TestFunctionsMatchEvaluator(t *testing.T) {
+	var inputs []string
+	for _, tests := range [][]vmTestCase{functionTests, closureTests} {
+		for _, tt := range tests {
+			inputs = append(inputs, tt.input)
+		}
+	}
+	inputs = append(inputs,
+		"fn(a, b) { a }(1)",
+		"fn() { 1 }(2)",
+		"let x = 1; x()",
+		"let f = fn(n) { 1 + f(n + 1) }; f(0)",
+	)
+
+	for _, input := range inputs {
+		expected := evaluator.Eval(parse(input), object.NewEnvironment())
+		if expected == nil {
+			expected = Null
+		}
+		if rv, ok := expected.(*object.ReturnValue); ok {
+			expected = rv.Value
+		}
+
+		result, err := run(t, input)
+		if errObj, ok := expected.(*object.Error); ok {
+			if err == nil || err.Error() != errObj.Message {
+				t.Errorf("%s: wrong error. want=%q, got=%v", input, errObj.Message, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: vm error: %s", input, err)
+			continue
+		}
+		if result.Type() != expected.Type() || result.Inspect() != expected.Inspect() {
+			t.Errorf("%s: results differ. evaluator=%s (%s), vm=%s (%s)",
+				input, expected.Inspect(), expected.Type(), result.Inspect(), result.Type())
+		}
+	}
+}
+
+func TestCallingErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { 1; }(1);", "wrong number of arguments: want=0, got=1"},
+		{"fn(a) { a; }();", "wrong number of arguments: want=1, got=0"},
+		{"fn(a, b) { a + b; }(1);", "wrong number of arguments: want=2, got=1"},
+		{"let x = 1; x();", "not a function: INTEGER"},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", "maximum recursion depth exceeded"},
+		// 末尾呼び出しだけの無限ループも止まる
+		{"let f = fn() { f() }; f()", "maximum recursion depth exceeded"},
+		{"fn() { if (false) { let y = 1 }; y }()", "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		_, err := run(t, tt.input)
+		if err == nil {
+			t.Errorf("%s: expected error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+var collectionTests = []vmTestCase{
+	{"[]", "[]"},
+	{"[1, 2 + 3, \"a\"]", `[1, 5, "a"]`},
+	{"[1, 2, 3][1]", 2},
+	{"[1, 2, 3][1 + 1]", 3},
+	{"[1, 2, 3][3]", nil},
+	{"[1, 2, 3][-1]", nil},
+	{"[[1, 2]][0][1]", 2},
+	{"{}", "{}"},
+	{`{"a": 1, "b": 2 * 3}`, `{"a":1, "b":6}`},
+	{`{"a": 1, "b": 2}["b"]`, 2},
+	{`{"a": 1}["c"]`, nil},
+	{`{1: "one", true: "yes"}[true]`, "yes"},
+	{`let key = fn() { "k" }; {key(): [1]}["k"][0]`, 1},
+	{`let a = 1; let b = 2; {a, b}`, `{"a":1, "b":2}`},
+	{`let k = "x"; {[k + "y"]: 1, k}["xy"]`, 1},
+}
+
+var builtinTests = []vmTestCase{
+	{`len("four")`, 4},
+	{`len([1, 2, 3])`, 3},
+	{`push([1], 2)`, "[1, 2]"},
+	{`first([7, 8])`, 7},
+	{`rest([1, 2, 3])`, "[2, 3]"},
+	{`get({"a": 1}, "b", 0)`, 0},
+	{`keys(merge({"a": 1}, {"b": 2}))`, `["a", "b"]`},
+	{`let len = fn(x) { 0 }; len([1])`, 0},
+	{`let apply = fn(f, x) { f(x) }; apply(len, [1, 2])`, 2},
+	{`len`, "builtin fn: len"},
+}
+
+// 末尾位置の呼び出しはフレームを積まないので、深さの上限を超えて繰り返せる
+var tailCallTests = []vmTestCase{
+	{"let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + n) } }; loop(100000, 0)", 5000050000},
+	{"let loop = fn(n) { if (n == 0) { return \"done\" }; return loop(n - 1) }; loop(20000)", "done"},
+	{"let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } }; let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } }; isEven(20001)", false},
+	{"let build = fn(n, arr) { if (n == 0) { arr } else { build(n - 1, append(arr, n)) } }; len(build(11000, []))", 11000},
+	{"let f = fn(x) { len(x) }; f([1, 2])", 2},
+}
+
+func TestCollections(t *testing.T) {
+	runVmTests(t, collectionTests)
+}
+
+func TestBuiltins(t *testing.T) {
+	runVmTests(t, builtinTests)
+}
+
+func TestTailCalls(t *testing.T) {
+	runVmTests(t, tailCallTests)
+}
+
+func TestCollectionsMatchEvaluator(t *testing.T) {
+	var inputs []string
+	for _, tests := range [][]vmTestCase{collectionTests, builtinTests, tailCallTests} {
+		for _, tt := range tests {
+			inputs = append(inputs, tt.input)
+		}
+	}
+	inputs = append(inputs,
+		`1[0]`,
+		`{"a": 1}[[1]]`,
+		`{[[1]]: 2}`,
+		`len(1)`,
+		`push(1)`,
+	)
+
+	for _, input := range inputs {
+		expected := evaluator.Eval(parse(input), object.NewEnvironment())
+		result, err := run(t, input)
+		if errObj, ok := expected.(*object.Error); ok {
+			if err == nil || err.Error() != errObj.Message {
+				t.Errorf("%s: wrong error. want=%q, got=%v", input, errObj.Message, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: vm error: %s", input, err)
+			continue
+		}
+		if result.Type() != expected.Type() || result.Inspect() != expected.Inspect() {
+			t.Errorf("%s: results differ. evaluator=%s (%s), vm=%s (%s)",
+				input, expected.Inspect(), expected.Type(), result.Inspect(), result.Type())
+		}
+	}
+}
+
+// 関数を呼び出す組み込み関数はまだVMでは使えない
+func TestEvaluatorOnlyBuiltins(t *testing.T) {
+	_, err := run(t, "map([1], fn(x) { x })")
+	if err == nil || err.Error() != "map: cannot be called outside of the evaluator" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}